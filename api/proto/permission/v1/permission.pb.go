@@ -0,0 +1,1648 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        v5.29.3
+// source: permission/v1/permission.proto
+
+package permissionv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Engine selects the permission engine. Unspecified means the server default:
+// the shadow-mode primary or the cutover route when enabled, otherwise Zanzibar.
+type Engine int32
+
+const (
+	Engine_ENGINE_UNSPECIFIED Engine = 0
+	Engine_ENGINE_ZANZIBAR    Engine = 1
+	Engine_ENGINE_MYSQL       Engine = 2
+)
+
+// Enum value maps for Engine.
+var (
+	Engine_name = map[int32]string{
+		0: "ENGINE_UNSPECIFIED",
+		1: "ENGINE_ZANZIBAR",
+		2: "ENGINE_MYSQL",
+	}
+	Engine_value = map[string]int32{
+		"ENGINE_UNSPECIFIED": 0,
+		"ENGINE_ZANZIBAR":    1,
+		"ENGINE_MYSQL":       2,
+	}
+)
+
+func (x Engine) Enum() *Engine {
+	p := new(Engine)
+	*p = x
+	return p
+}
+
+func (x Engine) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Engine) Descriptor() protoreflect.EnumDescriptor {
+	return file_permission_v1_permission_proto_enumTypes[0].Descriptor()
+}
+
+func (Engine) Type() protoreflect.EnumType {
+	return &file_permission_v1_permission_proto_enumTypes[0]
+}
+
+func (x Engine) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Engine.Descriptor instead.
+func (Engine) EnumDescriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{0}
+}
+
+type TupleOperation int32
+
+const (
+	TupleOperation_TUPLE_OPERATION_UNSPECIFIED TupleOperation = 0
+	TupleOperation_TUPLE_OPERATION_TOUCH       TupleOperation = 1
+	TupleOperation_TUPLE_OPERATION_CREATE      TupleOperation = 2
+	TupleOperation_TUPLE_OPERATION_DELETE      TupleOperation = 3
+)
+
+// Enum value maps for TupleOperation.
+var (
+	TupleOperation_name = map[int32]string{
+		0: "TUPLE_OPERATION_UNSPECIFIED",
+		1: "TUPLE_OPERATION_TOUCH",
+		2: "TUPLE_OPERATION_CREATE",
+		3: "TUPLE_OPERATION_DELETE",
+	}
+	TupleOperation_value = map[string]int32{
+		"TUPLE_OPERATION_UNSPECIFIED": 0,
+		"TUPLE_OPERATION_TOUCH":       1,
+		"TUPLE_OPERATION_CREATE":      2,
+		"TUPLE_OPERATION_DELETE":      3,
+	}
+)
+
+func (x TupleOperation) Enum() *TupleOperation {
+	p := new(TupleOperation)
+	*p = x
+	return p
+}
+
+func (x TupleOperation) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TupleOperation) Descriptor() protoreflect.EnumDescriptor {
+	return file_permission_v1_permission_proto_enumTypes[1].Descriptor()
+}
+
+func (TupleOperation) Type() protoreflect.EnumType {
+	return &file_permission_v1_permission_proto_enumTypes[1]
+}
+
+func (x TupleOperation) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TupleOperation.Descriptor instead.
+func (TupleOperation) EnumDescriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{1}
+}
+
+type PreconditionOperation int32
+
+const (
+	PreconditionOperation_PRECONDITION_OPERATION_UNSPECIFIED    PreconditionOperation = 0
+	PreconditionOperation_PRECONDITION_OPERATION_MUST_EXIST     PreconditionOperation = 1
+	PreconditionOperation_PRECONDITION_OPERATION_MUST_NOT_EXIST PreconditionOperation = 2
+)
+
+// Enum value maps for PreconditionOperation.
+var (
+	PreconditionOperation_name = map[int32]string{
+		0: "PRECONDITION_OPERATION_UNSPECIFIED",
+		1: "PRECONDITION_OPERATION_MUST_EXIST",
+		2: "PRECONDITION_OPERATION_MUST_NOT_EXIST",
+	}
+	PreconditionOperation_value = map[string]int32{
+		"PRECONDITION_OPERATION_UNSPECIFIED":    0,
+		"PRECONDITION_OPERATION_MUST_EXIST":     1,
+		"PRECONDITION_OPERATION_MUST_NOT_EXIST": 2,
+	}
+)
+
+func (x PreconditionOperation) Enum() *PreconditionOperation {
+	p := new(PreconditionOperation)
+	*p = x
+	return p
+}
+
+func (x PreconditionOperation) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PreconditionOperation) Descriptor() protoreflect.EnumDescriptor {
+	return file_permission_v1_permission_proto_enumTypes[2].Descriptor()
+}
+
+func (PreconditionOperation) Type() protoreflect.EnumType {
+	return &file_permission_v1_permission_proto_enumTypes[2]
+}
+
+func (x PreconditionOperation) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PreconditionOperation.Descriptor instead.
+func (PreconditionOperation) EnumDescriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{2}
+}
+
+type CheckRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	UserId     string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	DocumentId string                 `protobuf:"bytes,2,opt,name=document_id,json=documentId,proto3" json:"document_id,omitempty"`
+	Permission string                 `protobuf:"bytes,3,opt,name=permission,proto3" json:"permission,omitempty"`
+	Engine     Engine                 `protobuf:"varint,4,opt,name=engine,proto3,enum=permission.v1.Engine" json:"engine,omitempty"`
+	// Request context conditional tuples are evaluated against (Zanzibar).
+	Context       *structpb.Struct `protobuf:"bytes,5,opt,name=context,proto3" json:"context,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckRequest) Reset() {
+	*x = CheckRequest{}
+	mi := &file_permission_v1_permission_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckRequest) ProtoMessage() {}
+
+func (x *CheckRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckRequest.ProtoReflect.Descriptor instead.
+func (*CheckRequest) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CheckRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *CheckRequest) GetDocumentId() string {
+	if x != nil {
+		return x.DocumentId
+	}
+	return ""
+}
+
+func (x *CheckRequest) GetPermission() string {
+	if x != nil {
+		return x.Permission
+	}
+	return ""
+}
+
+func (x *CheckRequest) GetEngine() Engine {
+	if x != nil {
+		return x.Engine
+	}
+	return Engine_ENGINE_UNSPECIFIED
+}
+
+func (x *CheckRequest) GetContext() *structpb.Struct {
+	if x != nil {
+		return x.Context
+	}
+	return nil
+}
+
+type CheckResponse struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Allowed    bool                   `protobuf:"varint,1,opt,name=allowed,proto3" json:"allowed,omitempty"`
+	Sources    []string               `protobuf:"bytes,2,rep,name=sources,proto3" json:"sources,omitempty"`
+	DurationMs float64                `protobuf:"fixed64,3,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	// Set when only a conditional tuple could grant and its caveat needs the missing context.
+	Conditional    bool     `protobuf:"varint,4,opt,name=conditional,proto3" json:"conditional,omitempty"`
+	MissingContext []string `protobuf:"bytes,5,rep,name=missing_context,json=missingContext,proto3" json:"missing_context,omitempty"`
+	// Set when the relationships grant but the attribute rule of the permission does not hold.
+	DeniedByAttributes bool `protobuf:"varint,6,opt,name=denied_by_attributes,json=deniedByAttributes,proto3" json:"denied_by_attributes,omitempty"`
+	// Set when the relationships grant but an ethical wall keeps the user from the document.
+	DeniedByEthicalWall bool `protobuf:"varint,7,opt,name=denied_by_ethical_wall,json=deniedByEthicalWall,proto3" json:"denied_by_ethical_wall,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *CheckResponse) Reset() {
+	*x = CheckResponse{}
+	mi := &file_permission_v1_permission_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckResponse) ProtoMessage() {}
+
+func (x *CheckResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckResponse.ProtoReflect.Descriptor instead.
+func (*CheckResponse) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CheckResponse) GetAllowed() bool {
+	if x != nil {
+		return x.Allowed
+	}
+	return false
+}
+
+func (x *CheckResponse) GetSources() []string {
+	if x != nil {
+		return x.Sources
+	}
+	return nil
+}
+
+func (x *CheckResponse) GetDurationMs() float64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *CheckResponse) GetConditional() bool {
+	if x != nil {
+		return x.Conditional
+	}
+	return false
+}
+
+func (x *CheckResponse) GetMissingContext() []string {
+	if x != nil {
+		return x.MissingContext
+	}
+	return nil
+}
+
+func (x *CheckResponse) GetDeniedByAttributes() bool {
+	if x != nil {
+		return x.DeniedByAttributes
+	}
+	return false
+}
+
+func (x *CheckResponse) GetDeniedByEthicalWall() bool {
+	if x != nil {
+		return x.DeniedByEthicalWall
+	}
+	return false
+}
+
+type BatchCheckRequest struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	UserId      string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	DocumentIds []string               `protobuf:"bytes,2,rep,name=document_ids,json=documentIds,proto3" json:"document_ids,omitempty"`
+	Permission  string                 `protobuf:"bytes,3,opt,name=permission,proto3" json:"permission,omitempty"`
+	Engine      Engine                 `protobuf:"varint,4,opt,name=engine,proto3,enum=permission.v1.Engine" json:"engine,omitempty"`
+	// Request context conditional tuples are evaluated against (Zanzibar).
+	Context       *structpb.Struct `protobuf:"bytes,5,opt,name=context,proto3" json:"context,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchCheckRequest) Reset() {
+	*x = BatchCheckRequest{}
+	mi := &file_permission_v1_permission_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchCheckRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchCheckRequest) ProtoMessage() {}
+
+func (x *BatchCheckRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchCheckRequest.ProtoReflect.Descriptor instead.
+func (*BatchCheckRequest) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BatchCheckRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *BatchCheckRequest) GetDocumentIds() []string {
+	if x != nil {
+		return x.DocumentIds
+	}
+	return nil
+}
+
+func (x *BatchCheckRequest) GetPermission() string {
+	if x != nil {
+		return x.Permission
+	}
+	return ""
+}
+
+func (x *BatchCheckRequest) GetEngine() Engine {
+	if x != nil {
+		return x.Engine
+	}
+	return Engine_ENGINE_UNSPECIFIED
+}
+
+func (x *BatchCheckRequest) GetContext() *structpb.Struct {
+	if x != nil {
+		return x.Context
+	}
+	return nil
+}
+
+type BatchCheckResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       map[string]bool        `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	DurationMs    float64                `protobuf:"fixed64,2,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchCheckResponse) Reset() {
+	*x = BatchCheckResponse{}
+	mi := &file_permission_v1_permission_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchCheckResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchCheckResponse) ProtoMessage() {}
+
+func (x *BatchCheckResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchCheckResponse.ProtoReflect.Descriptor instead.
+func (*BatchCheckResponse) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BatchCheckResponse) GetResults() map[string]bool {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *BatchCheckResponse) GetDurationMs() float64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+type ExpandRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DocumentId    string                 `protobuf:"bytes,1,opt,name=document_id,json=documentId,proto3" json:"document_id,omitempty"`
+	Permission    string                 `protobuf:"bytes,2,opt,name=permission,proto3" json:"permission,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExpandRequest) Reset() {
+	*x = ExpandRequest{}
+	mi := &file_permission_v1_permission_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExpandRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpandRequest) ProtoMessage() {}
+
+func (x *ExpandRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpandRequest.ProtoReflect.Descriptor instead.
+func (*ExpandRequest) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ExpandRequest) GetDocumentId() string {
+	if x != nil {
+		return x.DocumentId
+	}
+	return ""
+}
+
+func (x *ExpandRequest) GetPermission() string {
+	if x != nil {
+		return x.Permission
+	}
+	return ""
+}
+
+type ExpandNode struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Kind          string                 `protobuf:"bytes,1,opt,name=kind,proto3" json:"kind,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Subjects      []string               `protobuf:"bytes,3,rep,name=subjects,proto3" json:"subjects,omitempty"`
+	Children      []*ExpandNode          `protobuf:"bytes,4,rep,name=children,proto3" json:"children,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExpandNode) Reset() {
+	*x = ExpandNode{}
+	mi := &file_permission_v1_permission_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExpandNode) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpandNode) ProtoMessage() {}
+
+func (x *ExpandNode) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpandNode.ProtoReflect.Descriptor instead.
+func (*ExpandNode) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ExpandNode) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *ExpandNode) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ExpandNode) GetSubjects() []string {
+	if x != nil {
+		return x.Subjects
+	}
+	return nil
+}
+
+func (x *ExpandNode) GetChildren() []*ExpandNode {
+	if x != nil {
+		return x.Children
+	}
+	return nil
+}
+
+type ExpandResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tree          *ExpandNode            `protobuf:"bytes,1,opt,name=tree,proto3" json:"tree,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExpandResponse) Reset() {
+	*x = ExpandResponse{}
+	mi := &file_permission_v1_permission_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExpandResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpandResponse) ProtoMessage() {}
+
+func (x *ExpandResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpandResponse.ProtoReflect.Descriptor instead.
+func (*ExpandResponse) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ExpandResponse) GetTree() *ExpandNode {
+	if x != nil {
+		return x.Tree
+	}
+	return nil
+}
+
+type LookupResourcesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Permission    string                 `protobuf:"bytes,2,opt,name=permission,proto3" json:"permission,omitempty"`
+	Engine        Engine                 `protobuf:"varint,3,opt,name=engine,proto3,enum=permission.v1.Engine" json:"engine,omitempty"`
+	BatchSize     int32                  `protobuf:"varint,4,opt,name=batch_size,json=batchSize,proto3" json:"batch_size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupResourcesRequest) Reset() {
+	*x = LookupResourcesRequest{}
+	mi := &file_permission_v1_permission_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupResourcesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupResourcesRequest) ProtoMessage() {}
+
+func (x *LookupResourcesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupResourcesRequest.ProtoReflect.Descriptor instead.
+func (*LookupResourcesRequest) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *LookupResourcesRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *LookupResourcesRequest) GetPermission() string {
+	if x != nil {
+		return x.Permission
+	}
+	return ""
+}
+
+func (x *LookupResourcesRequest) GetEngine() Engine {
+	if x != nil {
+		return x.Engine
+	}
+	return Engine_ENGINE_UNSPECIFIED
+}
+
+func (x *LookupResourcesRequest) GetBatchSize() int32 {
+	if x != nil {
+		return x.BatchSize
+	}
+	return 0
+}
+
+type LookupResourcesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DocumentIds   []string               `protobuf:"bytes,1,rep,name=document_ids,json=documentIds,proto3" json:"document_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupResourcesResponse) Reset() {
+	*x = LookupResourcesResponse{}
+	mi := &file_permission_v1_permission_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupResourcesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupResourcesResponse) ProtoMessage() {}
+
+func (x *LookupResourcesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupResourcesResponse.ProtoReflect.Descriptor instead.
+func (*LookupResourcesResponse) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *LookupResourcesResponse) GetDocumentIds() []string {
+	if x != nil {
+		return x.DocumentIds
+	}
+	return nil
+}
+
+type LookupSubjectsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DocumentId    string                 `protobuf:"bytes,1,opt,name=document_id,json=documentId,proto3" json:"document_id,omitempty"`
+	Permission    string                 `protobuf:"bytes,2,opt,name=permission,proto3" json:"permission,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupSubjectsRequest) Reset() {
+	*x = LookupSubjectsRequest{}
+	mi := &file_permission_v1_permission_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupSubjectsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupSubjectsRequest) ProtoMessage() {}
+
+func (x *LookupSubjectsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupSubjectsRequest.ProtoReflect.Descriptor instead.
+func (*LookupSubjectsRequest) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *LookupSubjectsRequest) GetDocumentId() string {
+	if x != nil {
+		return x.DocumentId
+	}
+	return ""
+}
+
+func (x *LookupSubjectsRequest) GetPermission() string {
+	if x != nil {
+		return x.Permission
+	}
+	return ""
+}
+
+type LookupSubjectsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserIds       []string               `protobuf:"bytes,1,rep,name=user_ids,json=userIds,proto3" json:"user_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupSubjectsResponse) Reset() {
+	*x = LookupSubjectsResponse{}
+	mi := &file_permission_v1_permission_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupSubjectsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupSubjectsResponse) ProtoMessage() {}
+
+func (x *LookupSubjectsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupSubjectsResponse.ProtoReflect.Descriptor instead.
+func (*LookupSubjectsResponse) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *LookupSubjectsResponse) GetUserIds() []string {
+	if x != nil {
+		return x.UserIds
+	}
+	return nil
+}
+
+type Tuple struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Namespace        string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	ObjectId         string                 `protobuf:"bytes,2,opt,name=object_id,json=objectId,proto3" json:"object_id,omitempty"`
+	Relation         string                 `protobuf:"bytes,3,opt,name=relation,proto3" json:"relation,omitempty"`
+	SubjectNamespace string                 `protobuf:"bytes,4,opt,name=subject_namespace,json=subjectNamespace,proto3" json:"subject_namespace,omitempty"`
+	SubjectId        string                 `protobuf:"bytes,5,opt,name=subject_id,json=subjectId,proto3" json:"subject_id,omitempty"`
+	UsersetNamespace *string                `protobuf:"bytes,6,opt,name=userset_namespace,json=usersetNamespace,proto3,oneof" json:"userset_namespace,omitempty"`
+	UsersetRelation  *string                `protobuf:"bytes,7,opt,name=userset_relation,json=usersetRelation,proto3,oneof" json:"userset_relation,omitempty"`
+	// Conditional tuples only grant when the named caveat holds.
+	CaveatName *string `protobuf:"bytes,8,opt,name=caveat_name,json=caveatName,proto3,oneof" json:"caveat_name,omitempty"`
+	// JSON object binding caveat parameters.
+	CaveatContext *string `protobuf:"bytes,9,opt,name=caveat_context,json=caveatContext,proto3,oneof" json:"caveat_context,omitempty"`
+	// Time-bound grants stop counting at expires_at. Unset, a CREATE never
+	// expires and a TOUCH keeps the tuple's current expiry.
+	ExpiresAt     *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Tuple) Reset() {
+	*x = Tuple{}
+	mi := &file_permission_v1_permission_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Tuple) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Tuple) ProtoMessage() {}
+
+func (x *Tuple) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Tuple.ProtoReflect.Descriptor instead.
+func (*Tuple) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Tuple) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *Tuple) GetObjectId() string {
+	if x != nil {
+		return x.ObjectId
+	}
+	return ""
+}
+
+func (x *Tuple) GetRelation() string {
+	if x != nil {
+		return x.Relation
+	}
+	return ""
+}
+
+func (x *Tuple) GetSubjectNamespace() string {
+	if x != nil {
+		return x.SubjectNamespace
+	}
+	return ""
+}
+
+func (x *Tuple) GetSubjectId() string {
+	if x != nil {
+		return x.SubjectId
+	}
+	return ""
+}
+
+func (x *Tuple) GetUsersetNamespace() string {
+	if x != nil && x.UsersetNamespace != nil {
+		return *x.UsersetNamespace
+	}
+	return ""
+}
+
+func (x *Tuple) GetUsersetRelation() string {
+	if x != nil && x.UsersetRelation != nil {
+		return *x.UsersetRelation
+	}
+	return ""
+}
+
+func (x *Tuple) GetCaveatName() string {
+	if x != nil && x.CaveatName != nil {
+		return *x.CaveatName
+	}
+	return ""
+}
+
+func (x *Tuple) GetCaveatContext() string {
+	if x != nil && x.CaveatContext != nil {
+		return *x.CaveatContext
+	}
+	return ""
+}
+
+func (x *Tuple) GetExpiresAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+type TupleUpdate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Operation     TupleOperation         `protobuf:"varint,1,opt,name=operation,proto3,enum=permission.v1.TupleOperation" json:"operation,omitempty"`
+	Tuple         *Tuple                 `protobuf:"bytes,2,opt,name=tuple,proto3" json:"tuple,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TupleUpdate) Reset() {
+	*x = TupleUpdate{}
+	mi := &file_permission_v1_permission_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TupleUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TupleUpdate) ProtoMessage() {}
+
+func (x *TupleUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TupleUpdate.ProtoReflect.Descriptor instead.
+func (*TupleUpdate) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *TupleUpdate) GetOperation() TupleOperation {
+	if x != nil {
+		return x.Operation
+	}
+	return TupleOperation_TUPLE_OPERATION_UNSPECIFIED
+}
+
+func (x *TupleUpdate) GetTuple() *Tuple {
+	if x != nil {
+		return x.Tuple
+	}
+	return nil
+}
+
+type Precondition struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Operation     PreconditionOperation  `protobuf:"varint,1,opt,name=operation,proto3,enum=permission.v1.PreconditionOperation" json:"operation,omitempty"`
+	Tuple         *Tuple                 `protobuf:"bytes,2,opt,name=tuple,proto3" json:"tuple,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Precondition) Reset() {
+	*x = Precondition{}
+	mi := &file_permission_v1_permission_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Precondition) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Precondition) ProtoMessage() {}
+
+func (x *Precondition) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Precondition.ProtoReflect.Descriptor instead.
+func (*Precondition) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Precondition) GetOperation() PreconditionOperation {
+	if x != nil {
+		return x.Operation
+	}
+	return PreconditionOperation_PRECONDITION_OPERATION_UNSPECIFIED
+}
+
+func (x *Precondition) GetTuple() *Tuple {
+	if x != nil {
+		return x.Tuple
+	}
+	return nil
+}
+
+type WriteTuplesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Updates       []*TupleUpdate         `protobuf:"bytes,1,rep,name=updates,proto3" json:"updates,omitempty"`
+	Preconditions []*Precondition        `protobuf:"bytes,2,rep,name=preconditions,proto3" json:"preconditions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteTuplesRequest) Reset() {
+	*x = WriteTuplesRequest{}
+	mi := &file_permission_v1_permission_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteTuplesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteTuplesRequest) ProtoMessage() {}
+
+func (x *WriteTuplesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteTuplesRequest.ProtoReflect.Descriptor instead.
+func (*WriteTuplesRequest) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *WriteTuplesRequest) GetUpdates() []*TupleUpdate {
+	if x != nil {
+		return x.Updates
+	}
+	return nil
+}
+
+func (x *WriteTuplesRequest) GetPreconditions() []*Precondition {
+	if x != nil {
+		return x.Preconditions
+	}
+	return nil
+}
+
+type WriteTuplesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Created       int32                  `protobuf:"varint,1,opt,name=created,proto3" json:"created,omitempty"`
+	Touched       int32                  `protobuf:"varint,2,opt,name=touched,proto3" json:"touched,omitempty"`
+	Deleted       int32                  `protobuf:"varint,3,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	DurationMs    float64                `protobuf:"fixed64,4,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteTuplesResponse) Reset() {
+	*x = WriteTuplesResponse{}
+	mi := &file_permission_v1_permission_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteTuplesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteTuplesResponse) ProtoMessage() {}
+
+func (x *WriteTuplesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteTuplesResponse.ProtoReflect.Descriptor instead.
+func (*WriteTuplesResponse) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *WriteTuplesResponse) GetCreated() int32 {
+	if x != nil {
+		return x.Created
+	}
+	return 0
+}
+
+func (x *WriteTuplesResponse) GetTouched() int32 {
+	if x != nil {
+		return x.Touched
+	}
+	return 0
+}
+
+func (x *WriteTuplesResponse) GetDeleted() int32 {
+	if x != nil {
+		return x.Deleted
+	}
+	return 0
+}
+
+func (x *WriteTuplesResponse) GetDurationMs() float64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+type TupleFilter struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Namespace        string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	ObjectId         string                 `protobuf:"bytes,2,opt,name=object_id,json=objectId,proto3" json:"object_id,omitempty"`
+	Relation         string                 `protobuf:"bytes,3,opt,name=relation,proto3" json:"relation,omitempty"`
+	SubjectNamespace string                 `protobuf:"bytes,4,opt,name=subject_namespace,json=subjectNamespace,proto3" json:"subject_namespace,omitempty"`
+	SubjectId        string                 `protobuf:"bytes,5,opt,name=subject_id,json=subjectId,proto3" json:"subject_id,omitempty"`
+	UsersetNamespace string                 `protobuf:"bytes,6,opt,name=userset_namespace,json=usersetNamespace,proto3" json:"userset_namespace,omitempty"`
+	UsersetRelation  string                 `protobuf:"bytes,7,opt,name=userset_relation,json=usersetRelation,proto3" json:"userset_relation,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *TupleFilter) Reset() {
+	*x = TupleFilter{}
+	mi := &file_permission_v1_permission_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TupleFilter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TupleFilter) ProtoMessage() {}
+
+func (x *TupleFilter) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TupleFilter.ProtoReflect.Descriptor instead.
+func (*TupleFilter) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *TupleFilter) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *TupleFilter) GetObjectId() string {
+	if x != nil {
+		return x.ObjectId
+	}
+	return ""
+}
+
+func (x *TupleFilter) GetRelation() string {
+	if x != nil {
+		return x.Relation
+	}
+	return ""
+}
+
+func (x *TupleFilter) GetSubjectNamespace() string {
+	if x != nil {
+		return x.SubjectNamespace
+	}
+	return ""
+}
+
+func (x *TupleFilter) GetSubjectId() string {
+	if x != nil {
+		return x.SubjectId
+	}
+	return ""
+}
+
+func (x *TupleFilter) GetUsersetNamespace() string {
+	if x != nil {
+		return x.UsersetNamespace
+	}
+	return ""
+}
+
+func (x *TupleFilter) GetUsersetRelation() string {
+	if x != nil {
+		return x.UsersetRelation
+	}
+	return ""
+}
+
+type ReadTuplesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Filter        *TupleFilter           `protobuf:"bytes,1,opt,name=filter,proto3" json:"filter,omitempty"`
+	PageToken     string                 `protobuf:"bytes,2,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	PageSize      int32                  `protobuf:"varint,3,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReadTuplesRequest) Reset() {
+	*x = ReadTuplesRequest{}
+	mi := &file_permission_v1_permission_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReadTuplesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReadTuplesRequest) ProtoMessage() {}
+
+func (x *ReadTuplesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReadTuplesRequest.ProtoReflect.Descriptor instead.
+func (*ReadTuplesRequest) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *ReadTuplesRequest) GetFilter() *TupleFilter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+func (x *ReadTuplesRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+func (x *ReadTuplesRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+type ReadTuplesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tuples        []*Tuple               `protobuf:"bytes,1,rep,name=tuples,proto3" json:"tuples,omitempty"`
+	NextPageToken string                 `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReadTuplesResponse) Reset() {
+	*x = ReadTuplesResponse{}
+	mi := &file_permission_v1_permission_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReadTuplesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReadTuplesResponse) ProtoMessage() {}
+
+func (x *ReadTuplesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_permission_v1_permission_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReadTuplesResponse.ProtoReflect.Descriptor instead.
+func (*ReadTuplesResponse) Descriptor() ([]byte, []int) {
+	return file_permission_v1_permission_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *ReadTuplesResponse) GetTuples() []*Tuple {
+	if x != nil {
+		return x.Tuples
+	}
+	return nil
+}
+
+func (x *ReadTuplesResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+var File_permission_v1_permission_proto protoreflect.FileDescriptor
+
+const file_permission_v1_permission_proto_rawDesc = "" +
+	"\n" +
+	"\x1epermission/v1/permission.proto\x12\rpermission.v1\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xca\x01\n" +
+	"\fCheckRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1f\n" +
+	"\vdocument_id\x18\x02 \x01(\tR\n" +
+	"documentId\x12\x1e\n" +
+	"\n" +
+	"permission\x18\x03 \x01(\tR\n" +
+	"permission\x12-\n" +
+	"\x06engine\x18\x04 \x01(\x0e2\x15.permission.v1.EngineR\x06engine\x121\n" +
+	"\acontext\x18\x05 \x01(\v2\x17.google.protobuf.StructR\acontext\"\x96\x02\n" +
+	"\rCheckResponse\x12\x18\n" +
+	"\aallowed\x18\x01 \x01(\bR\aallowed\x12\x18\n" +
+	"\asources\x18\x02 \x03(\tR\asources\x12\x1f\n" +
+	"\vduration_ms\x18\x03 \x01(\x01R\n" +
+	"durationMs\x12 \n" +
+	"\vconditional\x18\x04 \x01(\bR\vconditional\x12'\n" +
+	"\x0fmissing_context\x18\x05 \x03(\tR\x0emissingContext\x120\n" +
+	"\x14denied_by_attributes\x18\x06 \x01(\bR\x12deniedByAttributes\x123\n" +
+	"\x16denied_by_ethical_wall\x18\a \x01(\bR\x13deniedByEthicalWall\"\xd1\x01\n" +
+	"\x11BatchCheckRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12!\n" +
+	"\fdocument_ids\x18\x02 \x03(\tR\vdocumentIds\x12\x1e\n" +
+	"\n" +
+	"permission\x18\x03 \x01(\tR\n" +
+	"permission\x12-\n" +
+	"\x06engine\x18\x04 \x01(\x0e2\x15.permission.v1.EngineR\x06engine\x121\n" +
+	"\acontext\x18\x05 \x01(\v2\x17.google.protobuf.StructR\acontext\"\xbb\x01\n" +
+	"\x12BatchCheckResponse\x12H\n" +
+	"\aresults\x18\x01 \x03(\v2..permission.v1.BatchCheckResponse.ResultsEntryR\aresults\x12\x1f\n" +
+	"\vduration_ms\x18\x02 \x01(\x01R\n" +
+	"durationMs\x1a:\n" +
+	"\fResultsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\bR\x05value:\x028\x01\"P\n" +
+	"\rExpandRequest\x12\x1f\n" +
+	"\vdocument_id\x18\x01 \x01(\tR\n" +
+	"documentId\x12\x1e\n" +
+	"\n" +
+	"permission\x18\x02 \x01(\tR\n" +
+	"permission\"\x87\x01\n" +
+	"\n" +
+	"ExpandNode\x12\x12\n" +
+	"\x04kind\x18\x01 \x01(\tR\x04kind\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1a\n" +
+	"\bsubjects\x18\x03 \x03(\tR\bsubjects\x125\n" +
+	"\bchildren\x18\x04 \x03(\v2\x19.permission.v1.ExpandNodeR\bchildren\"?\n" +
+	"\x0eExpandResponse\x12-\n" +
+	"\x04tree\x18\x01 \x01(\v2\x19.permission.v1.ExpandNodeR\x04tree\"\x9f\x01\n" +
+	"\x16LookupResourcesRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1e\n" +
+	"\n" +
+	"permission\x18\x02 \x01(\tR\n" +
+	"permission\x12-\n" +
+	"\x06engine\x18\x03 \x01(\x0e2\x15.permission.v1.EngineR\x06engine\x12\x1d\n" +
+	"\n" +
+	"batch_size\x18\x04 \x01(\x05R\tbatchSize\"<\n" +
+	"\x17LookupResourcesResponse\x12!\n" +
+	"\fdocument_ids\x18\x01 \x03(\tR\vdocumentIds\"X\n" +
+	"\x15LookupSubjectsRequest\x12\x1f\n" +
+	"\vdocument_id\x18\x01 \x01(\tR\n" +
+	"documentId\x12\x1e\n" +
+	"\n" +
+	"permission\x18\x02 \x01(\tR\n" +
+	"permission\"3\n" +
+	"\x16LookupSubjectsResponse\x12\x19\n" +
+	"\buser_ids\x18\x01 \x03(\tR\auserIds\"\xe7\x03\n" +
+	"\x05Tuple\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x1b\n" +
+	"\tobject_id\x18\x02 \x01(\tR\bobjectId\x12\x1a\n" +
+	"\brelation\x18\x03 \x01(\tR\brelation\x12+\n" +
+	"\x11subject_namespace\x18\x04 \x01(\tR\x10subjectNamespace\x12\x1d\n" +
+	"\n" +
+	"subject_id\x18\x05 \x01(\tR\tsubjectId\x120\n" +
+	"\x11userset_namespace\x18\x06 \x01(\tH\x00R\x10usersetNamespace\x88\x01\x01\x12.\n" +
+	"\x10userset_relation\x18\a \x01(\tH\x01R\x0fusersetRelation\x88\x01\x01\x12$\n" +
+	"\vcaveat_name\x18\b \x01(\tH\x02R\n" +
+	"caveatName\x88\x01\x01\x12*\n" +
+	"\x0ecaveat_context\x18\t \x01(\tH\x03R\rcaveatContext\x88\x01\x01\x129\n" +
+	"\n" +
+	"expires_at\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\texpiresAtB\x14\n" +
+	"\x12_userset_namespaceB\x13\n" +
+	"\x11_userset_relationB\x0e\n" +
+	"\f_caveat_nameB\x11\n" +
+	"\x0f_caveat_context\"v\n" +
+	"\vTupleUpdate\x12;\n" +
+	"\toperation\x18\x01 \x01(\x0e2\x1d.permission.v1.TupleOperationR\toperation\x12*\n" +
+	"\x05tuple\x18\x02 \x01(\v2\x14.permission.v1.TupleR\x05tuple\"~\n" +
+	"\fPrecondition\x12B\n" +
+	"\toperation\x18\x01 \x01(\x0e2$.permission.v1.PreconditionOperationR\toperation\x12*\n" +
+	"\x05tuple\x18\x02 \x01(\v2\x14.permission.v1.TupleR\x05tuple\"\x8d\x01\n" +
+	"\x12WriteTuplesRequest\x124\n" +
+	"\aupdates\x18\x01 \x03(\v2\x1a.permission.v1.TupleUpdateR\aupdates\x12A\n" +
+	"\rpreconditions\x18\x02 \x03(\v2\x1b.permission.v1.PreconditionR\rpreconditions\"\x84\x01\n" +
+	"\x13WriteTuplesResponse\x12\x18\n" +
+	"\acreated\x18\x01 \x01(\x05R\acreated\x12\x18\n" +
+	"\atouched\x18\x02 \x01(\x05R\atouched\x12\x18\n" +
+	"\adeleted\x18\x03 \x01(\x05R\adeleted\x12\x1f\n" +
+	"\vduration_ms\x18\x04 \x01(\x01R\n" +
+	"durationMs\"\x88\x02\n" +
+	"\vTupleFilter\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x1b\n" +
+	"\tobject_id\x18\x02 \x01(\tR\bobjectId\x12\x1a\n" +
+	"\brelation\x18\x03 \x01(\tR\brelation\x12+\n" +
+	"\x11subject_namespace\x18\x04 \x01(\tR\x10subjectNamespace\x12\x1d\n" +
+	"\n" +
+	"subject_id\x18\x05 \x01(\tR\tsubjectId\x12+\n" +
+	"\x11userset_namespace\x18\x06 \x01(\tR\x10usersetNamespace\x12)\n" +
+	"\x10userset_relation\x18\a \x01(\tR\x0fusersetRelation\"\x83\x01\n" +
+	"\x11ReadTuplesRequest\x122\n" +
+	"\x06filter\x18\x01 \x01(\v2\x1a.permission.v1.TupleFilterR\x06filter\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x02 \x01(\tR\tpageToken\x12\x1b\n" +
+	"\tpage_size\x18\x03 \x01(\x05R\bpageSize\"j\n" +
+	"\x12ReadTuplesResponse\x12,\n" +
+	"\x06tuples\x18\x01 \x03(\v2\x14.permission.v1.TupleR\x06tuples\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken*G\n" +
+	"\x06Engine\x12\x16\n" +
+	"\x12ENGINE_UNSPECIFIED\x10\x00\x12\x13\n" +
+	"\x0fENGINE_ZANZIBAR\x10\x01\x12\x10\n" +
+	"\fENGINE_MYSQL\x10\x02*\x84\x01\n" +
+	"\x0eTupleOperation\x12\x1f\n" +
+	"\x1bTUPLE_OPERATION_UNSPECIFIED\x10\x00\x12\x19\n" +
+	"\x15TUPLE_OPERATION_TOUCH\x10\x01\x12\x1a\n" +
+	"\x16TUPLE_OPERATION_CREATE\x10\x02\x12\x1a\n" +
+	"\x16TUPLE_OPERATION_DELETE\x10\x03*\x91\x01\n" +
+	"\x15PreconditionOperation\x12&\n" +
+	"\"PRECONDITION_OPERATION_UNSPECIFIED\x10\x00\x12%\n" +
+	"!PRECONDITION_OPERATION_MUST_EXIST\x10\x01\x12)\n" +
+	"%PRECONDITION_OPERATION_MUST_NOT_EXIST\x10\x022\xdd\x04\n" +
+	"\x11PermissionService\x12B\n" +
+	"\x05Check\x12\x1b.permission.v1.CheckRequest\x1a\x1c.permission.v1.CheckResponse\x12Q\n" +
+	"\n" +
+	"BatchCheck\x12 .permission.v1.BatchCheckRequest\x1a!.permission.v1.BatchCheckResponse\x12E\n" +
+	"\x06Expand\x12\x1c.permission.v1.ExpandRequest\x1a\x1d.permission.v1.ExpandResponse\x12b\n" +
+	"\x0fLookupResources\x12%.permission.v1.LookupResourcesRequest\x1a&.permission.v1.LookupResourcesResponse0\x01\x12]\n" +
+	"\x0eLookupSubjects\x12$.permission.v1.LookupSubjectsRequest\x1a%.permission.v1.LookupSubjectsResponse\x12T\n" +
+	"\vWriteTuples\x12!.permission.v1.WriteTuplesRequest\x1a\".permission.v1.WriteTuplesResponse\x12Q\n" +
+	"\n" +
+	"ReadTuples\x12 .permission.v1.ReadTuplesRequest\x1a!.permission.v1.ReadTuplesResponseBFZDgithub.com/d60-Lab/gin-template/api/proto/permission/v1;permissionv1b\x06proto3"
+
+var (
+	file_permission_v1_permission_proto_rawDescOnce sync.Once
+	file_permission_v1_permission_proto_rawDescData []byte
+)
+
+func file_permission_v1_permission_proto_rawDescGZIP() []byte {
+	file_permission_v1_permission_proto_rawDescOnce.Do(func() {
+		file_permission_v1_permission_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_permission_v1_permission_proto_rawDesc), len(file_permission_v1_permission_proto_rawDesc)))
+	})
+	return file_permission_v1_permission_proto_rawDescData
+}
+
+var file_permission_v1_permission_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_permission_v1_permission_proto_msgTypes = make([]protoimpl.MessageInfo, 20)
+var file_permission_v1_permission_proto_goTypes = []any{
+	(Engine)(0),                     // 0: permission.v1.Engine
+	(TupleOperation)(0),             // 1: permission.v1.TupleOperation
+	(PreconditionOperation)(0),      // 2: permission.v1.PreconditionOperation
+	(*CheckRequest)(nil),            // 3: permission.v1.CheckRequest
+	(*CheckResponse)(nil),           // 4: permission.v1.CheckResponse
+	(*BatchCheckRequest)(nil),       // 5: permission.v1.BatchCheckRequest
+	(*BatchCheckResponse)(nil),      // 6: permission.v1.BatchCheckResponse
+	(*ExpandRequest)(nil),           // 7: permission.v1.ExpandRequest
+	(*ExpandNode)(nil),              // 8: permission.v1.ExpandNode
+	(*ExpandResponse)(nil),          // 9: permission.v1.ExpandResponse
+	(*LookupResourcesRequest)(nil),  // 10: permission.v1.LookupResourcesRequest
+	(*LookupResourcesResponse)(nil), // 11: permission.v1.LookupResourcesResponse
+	(*LookupSubjectsRequest)(nil),   // 12: permission.v1.LookupSubjectsRequest
+	(*LookupSubjectsResponse)(nil),  // 13: permission.v1.LookupSubjectsResponse
+	(*Tuple)(nil),                   // 14: permission.v1.Tuple
+	(*TupleUpdate)(nil),             // 15: permission.v1.TupleUpdate
+	(*Precondition)(nil),            // 16: permission.v1.Precondition
+	(*WriteTuplesRequest)(nil),      // 17: permission.v1.WriteTuplesRequest
+	(*WriteTuplesResponse)(nil),     // 18: permission.v1.WriteTuplesResponse
+	(*TupleFilter)(nil),             // 19: permission.v1.TupleFilter
+	(*ReadTuplesRequest)(nil),       // 20: permission.v1.ReadTuplesRequest
+	(*ReadTuplesResponse)(nil),      // 21: permission.v1.ReadTuplesResponse
+	nil,                             // 22: permission.v1.BatchCheckResponse.ResultsEntry
+	(*structpb.Struct)(nil),         // 23: google.protobuf.Struct
+	(*timestamppb.Timestamp)(nil),   // 24: google.protobuf.Timestamp
+}
+var file_permission_v1_permission_proto_depIdxs = []int32{
+	0,  // 0: permission.v1.CheckRequest.engine:type_name -> permission.v1.Engine
+	23, // 1: permission.v1.CheckRequest.context:type_name -> google.protobuf.Struct
+	0,  // 2: permission.v1.BatchCheckRequest.engine:type_name -> permission.v1.Engine
+	23, // 3: permission.v1.BatchCheckRequest.context:type_name -> google.protobuf.Struct
+	22, // 4: permission.v1.BatchCheckResponse.results:type_name -> permission.v1.BatchCheckResponse.ResultsEntry
+	8,  // 5: permission.v1.ExpandNode.children:type_name -> permission.v1.ExpandNode
+	8,  // 6: permission.v1.ExpandResponse.tree:type_name -> permission.v1.ExpandNode
+	0,  // 7: permission.v1.LookupResourcesRequest.engine:type_name -> permission.v1.Engine
+	24, // 8: permission.v1.Tuple.expires_at:type_name -> google.protobuf.Timestamp
+	1,  // 9: permission.v1.TupleUpdate.operation:type_name -> permission.v1.TupleOperation
+	14, // 10: permission.v1.TupleUpdate.tuple:type_name -> permission.v1.Tuple
+	2,  // 11: permission.v1.Precondition.operation:type_name -> permission.v1.PreconditionOperation
+	14, // 12: permission.v1.Precondition.tuple:type_name -> permission.v1.Tuple
+	15, // 13: permission.v1.WriteTuplesRequest.updates:type_name -> permission.v1.TupleUpdate
+	16, // 14: permission.v1.WriteTuplesRequest.preconditions:type_name -> permission.v1.Precondition
+	19, // 15: permission.v1.ReadTuplesRequest.filter:type_name -> permission.v1.TupleFilter
+	14, // 16: permission.v1.ReadTuplesResponse.tuples:type_name -> permission.v1.Tuple
+	3,  // 17: permission.v1.PermissionService.Check:input_type -> permission.v1.CheckRequest
+	5,  // 18: permission.v1.PermissionService.BatchCheck:input_type -> permission.v1.BatchCheckRequest
+	7,  // 19: permission.v1.PermissionService.Expand:input_type -> permission.v1.ExpandRequest
+	10, // 20: permission.v1.PermissionService.LookupResources:input_type -> permission.v1.LookupResourcesRequest
+	12, // 21: permission.v1.PermissionService.LookupSubjects:input_type -> permission.v1.LookupSubjectsRequest
+	17, // 22: permission.v1.PermissionService.WriteTuples:input_type -> permission.v1.WriteTuplesRequest
+	20, // 23: permission.v1.PermissionService.ReadTuples:input_type -> permission.v1.ReadTuplesRequest
+	4,  // 24: permission.v1.PermissionService.Check:output_type -> permission.v1.CheckResponse
+	6,  // 25: permission.v1.PermissionService.BatchCheck:output_type -> permission.v1.BatchCheckResponse
+	9,  // 26: permission.v1.PermissionService.Expand:output_type -> permission.v1.ExpandResponse
+	11, // 27: permission.v1.PermissionService.LookupResources:output_type -> permission.v1.LookupResourcesResponse
+	13, // 28: permission.v1.PermissionService.LookupSubjects:output_type -> permission.v1.LookupSubjectsResponse
+	18, // 29: permission.v1.PermissionService.WriteTuples:output_type -> permission.v1.WriteTuplesResponse
+	21, // 30: permission.v1.PermissionService.ReadTuples:output_type -> permission.v1.ReadTuplesResponse
+	24, // [24:31] is the sub-list for method output_type
+	17, // [17:24] is the sub-list for method input_type
+	17, // [17:17] is the sub-list for extension type_name
+	17, // [17:17] is the sub-list for extension extendee
+	0,  // [0:17] is the sub-list for field type_name
+}
+
+func init() { file_permission_v1_permission_proto_init() }
+func file_permission_v1_permission_proto_init() {
+	if File_permission_v1_permission_proto != nil {
+		return
+	}
+	file_permission_v1_permission_proto_msgTypes[11].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_permission_v1_permission_proto_rawDesc), len(file_permission_v1_permission_proto_rawDesc)),
+			NumEnums:      3,
+			NumMessages:   20,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_permission_v1_permission_proto_goTypes,
+		DependencyIndexes: file_permission_v1_permission_proto_depIdxs,
+		EnumInfos:         file_permission_v1_permission_proto_enumTypes,
+		MessageInfos:      file_permission_v1_permission_proto_msgTypes,
+	}.Build()
+	File_permission_v1_permission_proto = out.File
+	file_permission_v1_permission_proto_goTypes = nil
+	file_permission_v1_permission_proto_depIdxs = nil
+}
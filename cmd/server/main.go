@@ -12,7 +12,10 @@ import (
 	"github.com/getsentry/sentry-go"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
+	"github.com/d60-Lab/gin-template/internal/api/extauthz"
+	"github.com/d60-Lab/gin-template/internal/api/grpcserver"
 	"github.com/d60-Lab/gin-template/internal/api/handler"
 	"github.com/d60-Lab/gin-template/internal/api/middleware"
 	"github.com/d60-Lab/gin-template/internal/api/router"
@@ -21,6 +24,7 @@ import (
 	"github.com/d60-Lab/gin-template/pkg/config"
 	"github.com/d60-Lab/gin-template/pkg/database"
 	"github.com/d60-Lab/gin-template/pkg/logger"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
 	"github.com/d60-Lab/gin-template/pkg/validator"
 )
 
@@ -105,8 +109,129 @@ func main() {
 		logger.Fatal("Failed to init database", zap.Error(err))
 	}
 
+	// 注册 SQL 追踪插件（如果启用），每条语句作为当前请求 span 的子 span
+	if cfg.Tracing.Enabled {
+		if err := db.Use(database.TracingPlugin{}); err != nil {
+			logger.Fatal("Failed to register tracing plugin", zap.Error(err))
+		}
+	}
+
+	// 注册 Prometheus SQL 指标插件（如果启用）
+	if cfg.Metrics.Enabled {
+		if err := db.Use(metrics.GormPlugin{}); err != nil {
+			logger.Fatal("Failed to register metrics plugin", zap.Error(err))
+		}
+	}
+
 	// 初始化仓储层
 	userRepo := repository.NewUserRepository(db)
+	mysqlPermissionRepo := repository.NewMySQLPermissionRepository(db)
+	zanzibarRepo := repository.NewZanzibarPermissionRepository(db)
+	if err := zanzibarRepo.SetManagerChainStrategy(cfg.Zanzibar.ManagerChainStrategy, cfg.Zanzibar.CTEThreshold); err != nil {
+		logger.Fatal("Invalid zanzibar config", zap.Error(err))
+	}
+	caveats := make(map[string]string, len(cfg.Zanzibar.Caveats))
+	for _, cv := range cfg.Zanzibar.Caveats {
+		caveats[cv.Name] = cv.Expression
+	}
+	if err := zanzibarRepo.SetCaveats(caveats); err != nil {
+		logger.Fatal("Invalid zanzibar caveats", zap.Error(err))
+	}
+	if cfg.Zanzibar.BitmapIndex {
+		zanzibarRepo.UseBitmapIndex(repository.NewDocumentBitmapIndex(cfg.Zanzibar.BitmapIndexMaxUsers))
+	}
+	if cfg.Zanzibar.EncodedTuples {
+		zanzibarRepo.UseEncodedTuples(repository.NewEncodedTupleStore(db))
+	}
+
+	// 属性规则：两个引擎在关系授权之后再校验用户、文档及其客户的属性
+	attributeRules := make([]repository.AttributeRule, 0, len(cfg.AttributeRules))
+	for _, rule := range cfg.AttributeRules {
+		attributeRules = append(attributeRules, repository.AttributeRule{Permission: rule.Permission, Expression: rule.Expression})
+	}
+	if len(attributeRules) > 0 {
+		rules, err := repository.CompileAttributeRules(attributeRules)
+		if err != nil {
+			logger.Fatal("Invalid attribute rules", zap.Error(err))
+		}
+		mysqlPermissionRepo.UseAttributeRules(rules)
+		zanzibarRepo.UseAttributeRules(rules)
+	}
+
+	// 道德墙：关注某客户的员工及经由其访问的上级看不到竞争客户的文档
+	if cfg.EthicalWalls.Enabled {
+		walls, err := repository.NewEthicalWalls(cfg.EthicalWalls.FollowerConflict)
+		if err != nil {
+			logger.Fatal("Invalid ethical walls config", zap.Error(err))
+		}
+		mysqlPermissionRepo.UseEthicalWalls(walls)
+		zanzibarRepo.UseEthicalWalls(walls)
+	}
+
+	// 软删除：两个引擎读取时忽略软删除的实体，保留期过后再清理元组和展开行
+	softDeleteRepo := repository.NewSoftDeleteRepository(db)
+	softDeleteRepo.OnChange(zanzibarRepo.SoftDeleteChanged)
+	softDeletePurger := service.SoftDeletePurgerFromConfig(cfg.SoftDelete, softDeleteRepo, mysqlPermissionRepo, zanzibarRepo)
+
+	// 限时授权：过期授权读取时即被忽略，清扫器随后物理删除
+	grantSweeper := service.ExpiredGrantSweeperFromConfig(cfg.Grants, mysqlPermissionRepo, zanzibarRepo)
+
+	// 启动权限重算任务队列（MySQL 展开表的后台重算）
+	var jobQueue *service.PermissionJobQueue
+	if cfg.Jobs.Enabled {
+		jobQueue = service.NewPermissionJobQueue(
+			repository.NewPermissionJobRepository(db),
+			service.JobQueueOptionsFromConfig(cfg.Jobs),
+		)
+		service.RegisterMySQLPermissionJobs(jobQueue, mysqlPermissionRepo)
+		service.RegisterMaterializerJobs(jobQueue, repository.NewPermissionMaterializer(db))
+		service.RegisterSoftDeleteJobs(jobQueue, softDeletePurger)
+		service.RegisterExpiredGrantJobs(jobQueue, grantSweeper)
+
+		// 以 relation_tuples 为准：元组变更后增量物化展开表
+		if cfg.Jobs.Materialize {
+			service.MaterializeOnTupleChange(jobQueue, zanzibarRepo)
+		}
+
+		jobQueue.Start()
+	}
+
+	// 影子模式和切流都决定由哪个引擎应答，不能同时开启：先用影子模式验证 Zanzibar，再切流
+	if cfg.Shadow.Enabled && cfg.Cutover.Enabled {
+		logger.Fatal("Shadow evaluation and cutover cannot be enabled together")
+	}
+
+	// 启动影子模式：主引擎应答，另一引擎异步复核并记录不一致
+	var shadowEvaluator *service.ShadowEvaluator
+	if cfg.Shadow.Enabled {
+		shadowEvaluator, err = service.NewShadowEvaluator(
+			mysqlPermissionRepo,
+			zanzibarRepo,
+			repository.NewShadowMismatchRepository(db),
+			service.ShadowOptionsFromConfig(cfg.Shadow),
+		)
+		if err != nil {
+			logger.Fatal("Failed to init shadow evaluation", zap.Error(err))
+		}
+		shadowEvaluator.Start()
+	}
+
+	// 引擎切流：按比例 + 白/黑名单把请求路由到 MySQL 或 Zanzibar
+	var cutoverRouter *service.CutoverRouter
+	if cfg.Cutover.Enabled {
+		cutoverRouter, err = service.NewCutoverRouter(mysqlPermissionRepo, zanzibarRepo, service.CutoverRulesFromConfig(cfg.Cutover))
+		if err != nil {
+			logger.Fatal("Failed to init cutover router", zap.Error(err))
+		}
+
+		// 配置文件中切流配置变更时热更新（未变更时保留通过 API 调整的规则和回滚状态）；
+		// enabled 改为 false 时所有请求路由到 MySQL
+		config.Watch(func(newCfg *config.Config) {
+			if err := cutoverRouter.Reload(newCfg.Cutover); err != nil {
+				logger.Error("Failed to reload cutover rules", zap.Error(err))
+			}
+		})
+	}
 
 	// 初始化服务层
 	userService := service.NewUserService(userRepo, cfg)
@@ -121,6 +246,19 @@ func main() {
 	r := gin.New()
 	router.Setup(r, h, cfg)
 
+	// 权限相关路由：两个引擎、任务队列、影子模式、切流、软删除、属性与道德墙
+	permissionHandler := handler.NewPermissionHandler(
+		mysqlPermissionRepo,
+		zanzibarRepo,
+		jobQueue,
+		shadowEvaluator,
+		cutoverRouter,
+		softDeleteRepo,
+		repository.NewEntityAttributeRepository(db),
+		repository.NewCustomerConflictRepository(db),
+	)
+	router.SetupPermissionRoutes(r, permissionHandler, cfg)
+
 	// 创建 HTTP 服务器
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
@@ -139,6 +277,88 @@ func main() {
 		}
 	}()
 
+	// 定期刷新元组数、展开行数等存储指标（如果启用）
+	var storageMetrics *service.StorageMetricsCollector
+	if cfg.Metrics.Enabled {
+		storageMetrics = service.NewStorageMetricsCollector(
+			mysqlPermissionRepo,
+			zanzibarRepo,
+			time.Duration(cfg.Metrics.RefreshInterval)*time.Second,
+		)
+		storageMetrics.Start()
+	}
+
+	// 定时清理超过保留期的软删除实体（purge_interval 为 0 时不启动）
+	softDeletePurger.Start()
+
+	// 定时清扫过期授权（sweep_interval 为 0 时不启动）
+	grantSweeper.Start()
+
+	// 启动 gRPC 权限服务（如果启用，使用独立端口）
+	var grpcSrv *grpc.Server
+	if cfg.GRPC.Enabled {
+		lis, err := grpcserver.Listen(cfg)
+		if err != nil {
+			logger.Fatal("Failed to listen for gRPC", zap.Error(err))
+		}
+
+		// 未指定引擎的请求与外部授权一致：影子模式下由主引擎应答并复核，切流开启时由切流规则决定
+		var defaultEngine grpcserver.Engine = zanzibarRepo
+		if shadowEvaluator != nil {
+			defaultEngine = shadowEvaluator
+		}
+		if cutoverRouter != nil {
+			defaultEngine = cutoverRouter
+		}
+
+		permissionServer := grpcserver.NewPermissionServer(mysqlPermissionRepo, zanzibarRepo, defaultEngine)
+		grpcSrv = grpcserver.New(cfg, permissionServer)
+
+		go func() {
+			logger.Info("gRPC server is running",
+				zap.String("addr", lis.Addr().String()),
+			)
+			if err := grpcSrv.Serve(lis); err != nil && err != grpc.ErrServerStopped {
+				logger.Fatal("Failed to start gRPC server", zap.Error(err))
+			}
+		}()
+	}
+
+	// 启动 Envoy ext_authz 外部授权服务（如果启用，使用独立端口）
+	var extAuthzSrv *grpc.Server
+	if cfg.ExtAuthz.Enabled {
+		// 影子模式下外部授权流量同样由主引擎应答并复核
+		var checker extauthz.Checker = zanzibarRepo
+		if shadowEvaluator != nil {
+			checker = shadowEvaluator
+		}
+		// 切流开启时由切流规则决定应答引擎
+		if cutoverRouter != nil {
+			checker = cutoverRouter
+		}
+
+		authzServer, err := extauthz.NewServer(checker, cfg.ExtAuthz, cfg.JWT.Secret)
+		if err != nil {
+			logger.Fatal("Failed to init ext_authz server", zap.Error(err))
+		}
+
+		lis, err := extauthz.Listen(cfg.ExtAuthz)
+		if err != nil {
+			logger.Fatal("Failed to listen for ext_authz", zap.Error(err))
+		}
+
+		extAuthzSrv = extauthz.NewGRPCServer(authzServer)
+
+		go func() {
+			logger.Info("ext_authz server is running",
+				zap.String("addr", lis.Addr().String()),
+			)
+			if err := extAuthzSrv.Serve(lis); err != nil && err != grpc.ErrServerStopped {
+				logger.Fatal("Failed to start ext_authz server", zap.Error(err))
+			}
+		}()
+	}
+
 	// 等待中断信号以优雅地关闭服务器
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -154,5 +374,23 @@ func main() {
 		logger.Fatal("Server forced to shutdown", zap.Error(err))
 	}
 
+	if grpcSrv != nil {
+		grpcSrv.GracefulStop()
+	}
+	if extAuthzSrv != nil {
+		extAuthzSrv.GracefulStop()
+	}
+	if jobQueue != nil {
+		jobQueue.Stop()
+	}
+	if shadowEvaluator != nil {
+		shadowEvaluator.Stop()
+	}
+	if storageMetrics != nil {
+		storageMetrics.Stop()
+	}
+	softDeletePurger.Stop()
+	grantSweeper.Stop()
+
 	logger.Info("Server exited")
 }
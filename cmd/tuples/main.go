@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/internal/service"
+)
+
+const usage = `Usage: go run cmd/tuples/main.go <command> [flags]
+
+Commands:
+  import       Import tuples (namespace:object#relation@subject) from a file or stdin
+  export       Export tuples to a file or stdout
+  diff         Compare two tuple dumps
+  materialize  Rebuild document_permissions_mysql from the tuples
+  backfill     Infer base tuples from an expanded permission table
+  encode       Rebuild the dictionary-encoded tuple table from relation_tuples
+  purge        Delete tuples and expanded rows of entities soft-deleted before the retention period
+  sweep        Delete expired tuples and expanded rows
+
+Every command except diff reads the database from DATABASE_DSN, which is required.
+
+Run "go run cmd/tuples/main.go <command> -h" for command flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = runImport(ctx, os.Args[2:])
+	case "export":
+		err = runExport(ctx, os.Args[2:])
+	case "diff":
+		err = runDiff(os.Args[2:])
+	case "materialize":
+		err = runMaterialize(ctx, os.Args[2:])
+	case "backfill":
+		err = runBackfill(ctx, os.Args[2:])
+	case "encode":
+		err = runEncode(ctx, os.Args[2:])
+	case "purge":
+		err = runPurge(ctx, os.Args[2:])
+	case "sweep":
+		err = runSweep(ctx, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if errors.Is(err, errDumpsDiffer) {
+		stop()
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatalf("❌ %s failed: %v", os.Args[1], err)
+	}
+}
+
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("file", "-", "Input file, - for stdin")
+	batchSize := fs.Int("batch-size", 1000, "Tuples per INSERT batch")
+	dryRun := fs.Bool("dry-run", false, "Validate and dedupe only, do not write")
+	strict := fs.Bool("strict", false, "Abort on the first invalid or conflicting line")
+	_ = fs.Parse(args)
+
+	in, closeIn, err := openInput(*file)
+	if err != nil {
+		return err
+	}
+	defer closeIn()
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+
+	importer := service.NewTupleImporter(repository.NewZanzibarPermissionRepository(db))
+	stats, err := importer.Import(ctx, in, service.ImportOptions{
+		BatchSize: *batchSize,
+		DryRun:    *dryRun,
+		Strict:    *strict,
+		Progress: func(s service.ImportStats) {
+			fmt.Fprintf(os.Stderr, "   ... %d lines, %d inserted, %d existing, %d duplicates, %d conflicts, %d invalid (%v)\n",
+				s.Lines, s.Inserted, s.Existing, s.Duplicates, s.Conflicts, s.Invalid, s.Duration)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, lineErr := range stats.Errors {
+		fmt.Fprintf(os.Stderr, "⚠️  line %d: %s\n", lineErr.Line, lineErr.Error)
+	}
+
+	mode := "Imported"
+	if *dryRun {
+		mode = "Validated (dry run)"
+	}
+	fmt.Fprintf(os.Stderr, "✅ %s %d lines in %v\n", mode, stats.Lines, stats.Duration)
+	fmt.Fprintf(os.Stderr, "   Parsed: %d, Inserted: %d, Existing: %d, Duplicates: %d, Conflicts: %d, Invalid: %d\n",
+		stats.Parsed, stats.Inserted, stats.Existing, stats.Duplicates, stats.Conflicts, stats.Invalid)
+	return nil
+}
+
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	file := fs.String("file", "-", "Output file, - for stdout")
+	pageSize := fs.Int("page-size", 1000, "Tuples fetched per query")
+	var filter model.TupleFilter
+	fs.StringVar(&filter.Namespace, "namespace", "", "Filter by object namespace")
+	fs.StringVar(&filter.ObjectID, "object-id", "", "Filter by object ID")
+	fs.StringVar(&filter.Relation, "relation", "", "Filter by relation")
+	fs.StringVar(&filter.SubjectNamespace, "subject-namespace", "", "Filter by subject namespace")
+	fs.StringVar(&filter.SubjectID, "subject-id", "", "Filter by subject ID")
+	_ = fs.Parse(args)
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if *file != "-" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *file, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	exporter := service.NewTupleExporter(repository.NewZanzibarPermissionRepository(db))
+	count, err := exporter.Export(ctx, out, filter, *pageSize)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "✅ Exported %d tuples\n", count)
+	return nil
+}
+
+// errDumpsDiffer makes diff exit with status 1 when the dumps are not equal, like diff(1)
+var errDumpsDiffer = errors.New("dumps differ")
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: diff <before.txt> <after.txt>")
+	}
+
+	before, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer before.Close()
+
+	after, err := os.Open(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer after.Close()
+
+	diff, err := service.DiffTupleDumps(before, after)
+	if err != nil {
+		return err
+	}
+
+	for _, tuple := range diff.Removed {
+		fmt.Println("- " + tuple)
+	}
+	for _, tuple := range diff.Added {
+		fmt.Println("+ " + tuple)
+	}
+	fmt.Fprintf(os.Stderr, "📊 %d added, %d removed\n", len(diff.Added), len(diff.Removed))
+
+	if len(diff.Added) > 0 || len(diff.Removed) > 0 {
+		return errDumpsDiffer
+	}
+	return nil
+}
+
+func runMaterialize(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("materialize", flag.ExitOnError)
+	documents := fs.String("documents", "", "Comma-separated document IDs to recompute (default: full rebuild)")
+	_ = fs.Parse(args)
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+
+	ctx = repository.WithProgress(ctx, func(done, total int64, message string) {
+		fmt.Fprintf(os.Stderr, "   ... %s\n", message)
+	})
+
+	materializer := repository.NewPermissionMaterializer(db)
+	var result *model.MaterializeResult
+	if *documents == "" {
+		result, err = materializer.Rebuild(ctx)
+	} else {
+		result, err = materializer.MaterializeDocuments(ctx, strings.Split(*documents, ","))
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "✅ Materialized %d documents in %.0fms\n", result.Documents, result.DurationMs)
+	fmt.Fprintf(os.Stderr, "   Inserted: %d, Updated: %d, Deleted: %d, Skipped (unknown user): %d\n",
+		result.Inserted, result.Updated, result.Deleted, result.Skipped)
+	return nil
+}
+
+// runBackfill infers base tuples from an expanded permission table and reports unexplained rows
+func runBackfill(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	table := fs.String("table", "document_permissions_mysql", "Expanded permission table to read")
+	batchSize := fs.Int("batch-size", 1000, "Rows per read and tuples per INSERT batch")
+	orgFromTables := fs.Bool("org-from-tables", false, "Also derive department tuples from departments/user_departments")
+	dryRun := fs.Bool("dry-run", false, "Infer and verify only, do not write")
+	maxUnexplained := fs.Int("max-unexplained", 1000, "Unexplained rows to keep in the report")
+	report := fs.String("report", "", "Write the unexplained rows as JSON to this file, - for stdout")
+	_ = fs.Parse(args)
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+
+	ctx = repository.WithProgress(ctx, func(done, total int64, message string) {
+		fmt.Fprintf(os.Stderr, "   ... %s\n", message)
+	})
+
+	result, err := repository.NewPermissionBackfiller(db).Backfill(ctx, repository.BackfillOptions{
+		SourceTable:    *table,
+		BatchSize:      *batchSize,
+		OrgFromTables:  *orgFromTables,
+		DryRun:         *dryRun,
+		MaxUnexplained: *maxUnexplained,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *report != "" {
+		out := io.Writer(os.Stdout)
+		if *report != "-" {
+			f, err := os.Create(*report)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", *report, err)
+			}
+			defer f.Close()
+			out = f
+		}
+
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result.Unexplained); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	} else {
+		for _, row := range result.Unexplained {
+			fmt.Fprintf(os.Stderr, "⚠️  row %d: user=%s doc=%s %s (%s): %s\n",
+				row.RowID, row.UserID, row.DocumentID, row.PermissionType, row.SourceType, row.Reason)
+		}
+	}
+
+	mode := "Backfilled"
+	if *dryRun {
+		mode = "Inferred (dry run)"
+	}
+	fmt.Fprintf(os.Stderr, "✅ %s tuples from %d rows of %s in %.0fms\n", mode, result.RowsScanned, *table, result.DurationMs)
+	fmt.Fprintf(os.Stderr, "   Explained: %d, Unexplained: %d\n", result.RowsExplained, result.RowsUnexplained)
+	fmt.Fprintf(os.Stderr, "   Direct: %d, Follower: %d, Owner customer: %d, Superuser: %d, Department: %d\n",
+		result.DirectTuples, result.FollowerTuples, result.OwnerCustomerTuples, result.SuperuserTuples, result.DepartmentTuples)
+	if !*dryRun {
+		fmt.Fprintf(os.Stderr, "   Inserted: %d, Existing: %d\n", result.TuplesInserted, result.TuplesExisting)
+	}
+	return nil
+}
+
+func runEncode(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("encode", flag.ExitOnError)
+	batchSize := fs.Int("batch-size", 1000, "Tuples per read and INSERT batch")
+	_ = fs.Parse(args)
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+
+	ctx = repository.WithProgress(ctx, func(done, total int64, message string) {
+		fmt.Fprintf(os.Stderr, "   ... %s\n", message)
+	})
+
+	store := repository.NewEncodedTupleStore(db)
+	result, err := store.Rebuild(ctx, *batchSize)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "✅ Encoded %d tuples in %.0fms\n", result.Tuples, result.DurationMs)
+	fmt.Fprintf(os.Stderr, "   Names: %d, Object IDs: %d\n", result.Names, result.ObjectIDs)
+
+	stats, err := store.GetStorageStats(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "   Storage: %.2f MB (data %.2f MB, index %.2f MB)\n", stats.TotalSizeMB, stats.DataSizeMB, stats.IndexSizeMB)
+	return nil
+}
+
+func runPurge(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	retention := fs.Duration("retention", 720*time.Hour, "Keep tuples and expanded rows of entities soft-deleted more recently than this")
+	_ = fs.Parse(args)
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+
+	purger := service.NewSoftDeletePurger(
+		repository.NewSoftDeleteRepository(db),
+		repository.NewMySQLPermissionRepository(db),
+		repository.NewZanzibarPermissionRepository(db),
+		*retention, 0,
+	)
+	result, err := purger.Purge(ctx, *retention)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "✅ Purged entities soft-deleted before %s in %.0fms\n", result.Cutoff.Format(time.RFC3339), result.DurationMs)
+	fmt.Fprintf(os.Stderr, "   Users: %d, Documents: %d, Customers: %d\n", result.Users, result.Documents, result.Customers)
+	fmt.Fprintf(os.Stderr, "   Tuples deleted: %d, Expanded rows deleted: %d\n", result.TuplesDeleted, result.PermissionsDeleted)
+	return nil
+}
+
+func runSweep(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	batchSize := fs.Int("batch-size", 1000, "Expired tuples deleted per batch")
+	materialize := fs.Bool("materialize", true, "Update document_permissions_mysql for the documents the expired tuples reached")
+	_ = fs.Parse(args)
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+
+	zanzibarRepo := repository.NewZanzibarPermissionRepository(db)
+	var materializeErr error
+	if *materialize {
+		materializer := repository.NewPermissionMaterializer(db)
+		zanzibarRepo.OnTupleChange(func(ctx context.Context, changed []model.RelationTuple) {
+			if _, err := materializer.ApplyTupleChanges(ctx, changed); err != nil && materializeErr == nil {
+				materializeErr = err
+			}
+		})
+	}
+
+	sweeper := service.NewExpiredGrantSweeper(repository.NewMySQLPermissionRepository(db), zanzibarRepo, 0, *batchSize)
+	result, err := sweeper.Sweep(ctx)
+	if err != nil {
+		return err
+	}
+	if materializeErr != nil {
+		return fmt.Errorf("failed to materialize expired tuples: %w", materializeErr)
+	}
+
+	fmt.Fprintf(os.Stderr, "✅ Swept expired grants in %.0fms\n", result.DurationMs)
+	fmt.Fprintf(os.Stderr, "   Tuples deleted: %d, Expanded rows deleted: %d\n", result.TuplesDeleted, result.PermissionsDeleted)
+	return nil
+}
+
+// connect opens the database from DATABASE_DSN
+func connect() (*gorm.DB, error) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		return nil, errors.New("missing database: set DATABASE_DSN")
+	}
+
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Warn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
+
+// openInput opens a file for reading, or stdin for "-"
+func openInput(path string) (io.Reader, func(), error) {
+	if path == "-" {
+		return os.Stdin, func() {}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return f, func() { f.Close() }, nil
+}
@@ -2,82 +2,614 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 
 	"github.com/d60-Lab/gin-template/internal/model"
 	"github.com/d60-Lab/gin-template/internal/repository"
 )
 
+const usage = `Usage: go run cmd/verify-consistency/main.go [flags]
+
+Compares the documents each user can access through the MySQL engine
+(document_permissions_mysql) with the tuple engine's answer, for every
+requested permission type. Each checked
+user is compared against all documents, so a mismatch is never missed because
+of document sampling.
+
+The database is read from -dsn or DATABASE_DSN; one of them is required.
+
+Flags:
+`
+
+// User strata used by stratified sampling, in precedence order
+var strata = []string{"superuser", "manager", "follower", "other"}
+
+// mismatch is one (user, document, permission) pair the two engines disagree on
+type mismatch struct {
+	UserID          string   `json:"user_id"`
+	DocumentID      string   `json:"document_id"`
+	PermissionType  string   `json:"permission_type"`
+	Stratum         string   `json:"stratum"`
+	MySQL           bool     `json:"mysql"`
+	Zanzibar        bool     `json:"zanzibar"`
+	MySQLSources    []string `json:"mysql_sources"`
+	ZanzibarSources []string `json:"zanzibar_sources"`
+	Error           string   `json:"error,omitempty"`
+	Repaired        bool     `json:"repaired"`
+}
+
+// checkError records a (user, permission) task that could not be compared
+type checkError struct {
+	UserID         string `json:"user_id"`
+	PermissionType string `json:"permission_type"`
+	Error          string `json:"error"`
+}
+
+// report is the full output of a verification run
+type report struct {
+	GeneratedAt      time.Time                `json:"generated_at"`
+	Mode             string                   `json:"mode"`
+	Seed             int64                    `json:"seed"`
+	PermissionTypes  []string                 `json:"permission_types"`
+	UsersChecked     int                      `json:"users_checked"`
+	UsersByStratum   map[string]int           `json:"users_by_stratum"`
+	PairsCompared    int64                    `json:"pairs_compared"`
+	Mismatches       int64                    `json:"mismatches"`
+	MySQLOnly        int64                    `json:"mysql_only"`
+	ZanzibarOnly     int64                    `json:"zanzibar_only"`
+	Explained        int                      `json:"explained"`
+	Errors           []checkError             `json:"errors"`
+	Repair           *model.MaterializeResult `json:"repair,omitempty"`
+	DurationMs       float64                  `json:"duration_ms"`
+	MismatchDetails  []mismatch               `json:"mismatch_details"`
+	mismatchDocs     map[string]bool
+	mu               sync.Mutex
+	explainRemaining int
+}
+
+type options struct {
+	mode            string
+	sample          int
+	seed            int64
+	permissionTypes []string
+	workers         int
+	batchSize       int
+	maxExplain      int
+	reportPath      string
+	format          string
+	repair          bool
+	dsn             string
+}
+
 func main() {
-	dsn := "root:123456@tcp(127.0.0.1:3306)/zanzibar_permission?charset=utf8mb4&parseTime=True&loc=Local"
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	fs := flag.NewFlagSet("verify-consistency", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	mode := fs.String("mode", "sample", "full: every user; sample: stratified random sample of users")
+	sample := fs.Int("sample", 200, "Users to check in sample mode, spread evenly across superusers, managers, followers and others")
+	seed := fs.Int64("seed", 0, "Random seed for sampling (default: current time)")
+	permissions := fs.String("permissions", "viewer,editor,owner", "Comma-separated permission types to compare")
+	workers := fs.Int("workers", 8, "Parallel workers")
+	batchSize := fs.Int("batch-size", 1000, "Batch size for tuple lookups and repair")
+	maxExplain := fs.Int("max-explain", 10000, "Maximum mismatches to explain with both engines' sources")
+	reportPath := fs.String("report", "", "Write the mismatch report to this file (.json or .csv)")
+	format := fs.String("format", "", "Report format: json or csv (default: from the -report extension)")
+	repair := fs.Bool("repair", false, "Rewrite the expanded rows of mismatched documents from the tuples")
+	dsn := fs.String("dsn", os.Getenv("DATABASE_DSN"), "MySQL DSN (default: $DATABASE_DSN)")
+	_ = fs.Parse(os.Args[1:])
+
+	if *dsn == "" {
+		fmt.Fprintln(os.Stderr, "❌ missing database: set -dsn or DATABASE_DSN")
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	opts := options{
+		mode:            *mode,
+		sample:          *sample,
+		seed:            *seed,
+		permissionTypes: splitList(*permissions),
+		workers:         *workers,
+		batchSize:       *batchSize,
+		maxExplain:      *maxExplain,
+		reportPath:      *reportPath,
+		format:          *format,
+		repair:          *repair,
+		dsn:             *dsn,
+	}
+	if opts.seed == 0 {
+		opts.seed = time.Now().UnixNano()
+	}
+	if opts.workers <= 0 {
+		opts.workers = 1
+	}
+	if opts.format == "" && opts.reportPath != "" {
+		opts.format = strings.TrimPrefix(strings.ToLower(filepath.Ext(opts.reportPath)), ".")
+	}
+	if opts.mode != "full" && opts.mode != "sample" {
+		log.Fatalf("❌ invalid -mode %q, expected full or sample", opts.mode)
+	}
+	if opts.reportPath != "" && opts.format != "json" && opts.format != "csv" {
+		log.Fatalf("❌ invalid report format %q, expected json or csv", opts.format)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	rep, err := run(ctx, opts)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("❌ verify-consistency failed: %v", err)
 	}
 
-	ctx := context.Background()
-	mysqlRepo := repository.NewMySQLPermissionRepository(db)
-	zanzibarRepo := repository.NewZanzibarPermissionRepository(db)
+	if opts.reportPath != "" {
+		if err := writeReport(opts.reportPath, opts.format, rep); err != nil {
+			log.Fatalf("❌ failed to write report: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "📝 Report written to %s\n", opts.reportPath)
+	}
 
-	var users []model.User
-	db.Limit(20).Find(&users)
+	if len(rep.Errors) > 0 || (rep.Mismatches > 0 && rep.Repair == nil) || unrepaired(rep) > 0 {
+		os.Exit(1)
+	}
+}
+
+// unrepaired counts the reported mismatches a repair run did not fix
+func unrepaired(rep *report) int {
+	if rep.Repair == nil {
+		return 0
+	}
+	n := 0
+	for _, m := range rep.MismatchDetails {
+		if !m.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+func run(ctx context.Context, opts options) (*report, error) {
+	startTime := time.Now()
+
+	db, err := connect(opts.dsn)
+	if err != nil {
+		return nil, err
+	}
 
-	var docs []model.Document
-	db.Limit(20).Find(&docs)
+	mysqlRepo := repository.NewMySQLPermissionRepository(db)
+	zanzibarRepo := repository.NewZanzibarPermissionRepository(db)
 
-	fmt.Println("🔍 Verifying MySQL vs Zanzibar consistency...")
-	fmt.Println()
+	// Step 1: Pick the users to check
+	users, err := selectUsers(ctx, db, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	inconsistencies := 0
-	totalChecks := 0
-	mysqlTrue := 0
-	zanzibarTrue := 0
-	bothTrue := 0
+	rep := &report{
+		GeneratedAt:      startTime,
+		Mode:             opts.mode,
+		Seed:             opts.seed,
+		PermissionTypes:  opts.permissionTypes,
+		UsersChecked:     len(users),
+		UsersByStratum:   make(map[string]int),
+		Errors:           []checkError{},
+		MismatchDetails:  []mismatch{},
+		mismatchDocs:     make(map[string]bool),
+		explainRemaining: opts.maxExplain,
+	}
+	for _, u := range users {
+		rep.UsersByStratum[u.stratum]++
+	}
 
-	for _, user := range users {
-		for _, doc := range docs {
-			totalChecks++
+	fmt.Fprintf(os.Stderr, "🔍 Verifying MySQL vs Zanzibar for %d users × %v (%s mode, seed %d, %d workers)\n",
+		len(users), opts.permissionTypes, opts.mode, opts.seed, opts.workers)
 
-			mysqlResult, _ := mysqlRepo.CheckPermission(ctx, user.ID, doc.ID, "viewer")
-			zanzibarResult, _ := zanzibarRepo.CheckPermission(ctx, user.ID, doc.ID, "viewer")
+	// Step 2: Compare each (user, permission) pair in parallel
+	type task struct {
+		user           sampledUser
+		permissionType string
+	}
+	tasks := make(chan task)
+	var done int64
+	total := int64(len(users) * len(opts.permissionTypes))
 
-			mysqlHas := mysqlResult.HasPermission
-			zanzibarHas := zanzibarResult.HasPermission
+	var wg sync.WaitGroup
+	for i := 0; i < opts.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				err := compareUser(ctx, mysqlRepo, zanzibarRepo, rep, t.user, t.permissionType, opts.batchSize)
 
-			if mysqlHas {
-				mysqlTrue++
+				rep.mu.Lock()
+				if err != nil {
+					rep.Errors = append(rep.Errors, checkError{UserID: t.user.id, PermissionType: t.permissionType, Error: err.Error()})
+				}
+				done++
+				if done%100 == 0 || done == total {
+					fmt.Fprintf(os.Stderr, "   ... %d/%d checks, %d mismatches, %d errors\n", done, total, rep.Mismatches, len(rep.Errors))
+				}
+				rep.mu.Unlock()
 			}
-			if zanzibarHas {
-				zanzibarTrue++
+		}()
+	}
+
+feed:
+	for _, u := range users {
+		for _, permissionType := range opts.permissionTypes {
+			select {
+			case tasks <- task{user: u, permissionType: permissionType}:
+			case <-ctx.Done():
+				break feed
 			}
-			if mysqlHas && zanzibarHas {
-				bothTrue++
+		}
+	}
+	close(tasks)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(rep.MismatchDetails, func(i, j int) bool {
+		a, b := rep.MismatchDetails[i], rep.MismatchDetails[j]
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		if a.PermissionType != b.PermissionType {
+			return a.PermissionType < b.PermissionType
+		}
+		return a.DocumentID < b.DocumentID
+	})
+	rep.Explained = len(rep.MismatchDetails)
+
+	printSummary(rep)
+
+	// Step 3: Rewrite the expanded rows of every mismatched document from the tuples
+	if opts.repair && len(rep.mismatchDocs) > 0 {
+		repairResult, err := repairDocuments(ctx, db, mysqlRepo, zanzibarRepo, rep, opts.batchSize)
+		if err != nil {
+			return nil, err
+		}
+		rep.Repair = repairResult
+	}
+
+	rep.DurationMs = float64(time.Since(startTime).Milliseconds())
+	return rep, nil
+}
+
+// sampledUser is a user selected for checking, tagged with its stratum
+type sampledUser struct {
+	id      string
+	stratum string
+}
+
+// selectUsers returns every user in full mode, or an even stratified random sample
+func selectUsers(ctx context.Context, db *gorm.DB, opts options) ([]sampledUser, error) {
+	var allIDs, superuserIDs, managerIDs, followerIDs []string
+	if err := db.WithContext(ctx).Model(&model.User{}).Order("id").Pluck("id", &allIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load users: %w", err)
+	}
+	if err := db.WithContext(ctx).Model(&model.User{}).Where("is_superuser = ?", true).Pluck("id", &superuserIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load superusers: %w", err)
+	}
+	if err := db.WithContext(ctx).Model(&model.Department{}).Where("manager_id IS NOT NULL").Distinct().Pluck("manager_id", &managerIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load managers: %w", err)
+	}
+	if err := db.WithContext(ctx).Model(&model.CustomerFollower{}).Distinct().Pluck("user_id", &followerIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load followers: %w", err)
+	}
+
+	// Each user belongs to the first stratum that matches
+	stratumOf := make(map[string]string, len(allIDs))
+	for _, group := range []struct {
+		name string
+		ids  []string
+	}{{"superuser", superuserIDs}, {"manager", managerIDs}, {"follower", followerIDs}} {
+		for _, id := range group.ids {
+			if _, ok := stratumOf[id]; !ok {
+				stratumOf[id] = group.name
 			}
+		}
+	}
 
-			if mysqlHas != zanzibarHas {
-				inconsistencies++
-				fmt.Printf("❌ INCONSISTENCY: user=%s, doc=%s\n", user.ID, doc.ID)
-				fmt.Printf("   MySQL: has=%v, sources=%v\n", mysqlHas, mysqlResult.Sources)
-				fmt.Printf("   Zanzibar: has=%v, sources=%v\n", zanzibarHas, zanzibarResult.Sources)
-				fmt.Println()
+	byStratum := make(map[string][]string)
+	for _, id := range allIDs {
+		stratum, ok := stratumOf[id]
+		if !ok {
+			stratum = "other"
+		}
+		byStratum[stratum] = append(byStratum[stratum], id)
+	}
+
+	var users []sampledUser
+	if opts.mode == "full" {
+		for _, stratum := range strata {
+			for _, id := range byStratum[stratum] {
+				users = append(users, sampledUser{id: id, stratum: stratum})
 			}
 		}
+		return users, nil
 	}
 
-	fmt.Printf("\n📊 Results:\n")
-	fmt.Printf("   Total checks: %d\n", totalChecks)
-	fmt.Printf("   MySQL permissions: %d\n", mysqlTrue)
-	fmt.Printf("   Zanzibar permissions: %d\n", zanzibarTrue)
-	fmt.Printf("   Both said yes: %d\n", bothTrue)
-	fmt.Printf("   Inconsistencies: %d\n", inconsistencies)
+	// Spread the sample evenly across non-empty strata; strata smaller than
+	// their share are taken whole and the remainder goes to the larger ones
+	rng := rand.New(rand.NewSource(opts.seed))
+	remaining := opts.sample
+	var pending []string
+	for _, stratum := range strata {
+		if len(byStratum[stratum]) > 0 {
+			pending = append(pending, stratum)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return len(byStratum[pending[i]]) < len(byStratum[pending[j]])
+	})
+	for i, stratum := range pending {
+		ids := byStratum[stratum]
+		share := remaining / (len(pending) - i)
+		if share > len(ids) {
+			share = len(ids)
+		}
+		rng.Shuffle(len(ids), func(a, b int) { ids[a], ids[b] = ids[b], ids[a] })
+		for _, id := range ids[:share] {
+			users = append(users, sampledUser{id: id, stratum: stratum})
+		}
+		remaining -= share
+	}
+	return users, nil
+}
+
+// compareUser diffs the documents one user can access under one permission type
+func compareUser(ctx context.Context, mysqlRepo *repository.MySQLPermissionRepository, zanzibarRepo *repository.ZanzibarPermissionRepository, rep *report, user sampledUser, permissionType string, batchSize int) error {
+	// Both sides go through the engines, so expired, deleted and filtered rows count the same way
+	mysqlSet := make(map[string]bool)
+	if err := mysqlRepo.LookupDocuments(ctx, user.id, permissionType, batchSize, func(documentIDs []string) error {
+		for _, id := range documentIDs {
+			mysqlSet[id] = true
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to lookup mysql documents: %w", err)
+	}
+
+	zanzibarSet := make(map[string]bool, len(mysqlSet))
+	if err := zanzibarRepo.LookupDocuments(ctx, user.id, permissionType, batchSize, func(documentIDs []string) error {
+		for _, id := range documentIDs {
+			zanzibarSet[id] = true
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to lookup zanzibar documents: %w", err)
+	}
+
+	var found []mismatch
+	for id := range mysqlSet {
+		if !zanzibarSet[id] {
+			found = append(found, mismatch{UserID: user.id, DocumentID: id, PermissionType: permissionType, Stratum: user.stratum, MySQL: true})
+		}
+	}
+	for id := range zanzibarSet {
+		if !mysqlSet[id] {
+			found = append(found, mismatch{UserID: user.id, DocumentID: id, PermissionType: permissionType, Stratum: user.stratum, Zanzibar: true})
+		}
+	}
+
+	union := len(mysqlSet) + len(zanzibarSet)
+	for id := range zanzibarSet {
+		if mysqlSet[id] {
+			union--
+		}
+	}
 
-	if inconsistencies == 0 {
-		fmt.Printf("   ✅ All results are consistent!\n")
+	// Reserve an explanation budget, then ask both engines why outside the lock
+	rep.mu.Lock()
+	rep.PairsCompared += int64(union)
+	rep.Mismatches += int64(len(found))
+	for _, m := range found {
+		if m.MySQL {
+			rep.MySQLOnly++
+		} else {
+			rep.ZanzibarOnly++
+		}
+		rep.mismatchDocs[m.DocumentID] = true
+	}
+	explain := len(found)
+	if explain > rep.explainRemaining {
+		explain = rep.explainRemaining
+	}
+	rep.explainRemaining -= explain
+	rep.mu.Unlock()
+
+	for i := 0; i < explain; i++ {
+		explainMismatch(ctx, mysqlRepo, zanzibarRepo, &found[i])
+	}
+
+	rep.mu.Lock()
+	rep.MismatchDetails = append(rep.MismatchDetails, found[:explain]...)
+	rep.mu.Unlock()
+	return nil
+}
+
+// explainMismatch fills in the sources each engine reports for the pair
+func explainMismatch(ctx context.Context, mysqlRepo *repository.MySQLPermissionRepository, zanzibarRepo *repository.ZanzibarPermissionRepository, m *mismatch) {
+	var errs []string
+
+	mysqlResult, err := mysqlRepo.CheckPermission(ctx, m.UserID, m.DocumentID, m.PermissionType)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("mysql: %v", err))
 	} else {
-		fmt.Printf("   ⚠️  Consistency rate: %.2f%%\n", float64(totalChecks-inconsistencies)*100/float64(totalChecks))
+		m.MySQLSources = mysqlResult.Sources
+	}
+
+	zanzibarResult, err := zanzibarRepo.CheckPermission(ctx, m.UserID, m.DocumentID, m.PermissionType)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("zanzibar: %v", err))
+	} else {
+		m.ZanzibarSources = zanzibarResult.Sources
+	}
+
+	m.Error = strings.Join(errs, "; ")
+}
+
+// repairDocuments recomputes the expanded rows of all mismatched documents in batches,
+// then re-checks every reported mismatch and marks only those the engines now agree on
+func repairDocuments(ctx context.Context, db *gorm.DB, mysqlRepo *repository.MySQLPermissionRepository, zanzibarRepo *repository.ZanzibarPermissionRepository, rep *report, batchSize int) (*model.MaterializeResult, error) {
+	documentIDs := make([]string, 0, len(rep.mismatchDocs))
+	for id := range rep.mismatchDocs {
+		documentIDs = append(documentIDs, id)
+	}
+	sort.Strings(documentIDs)
+
+	fmt.Fprintf(os.Stderr, "🔧 Repairing %d documents from the tuples...\n", len(documentIDs))
+
+	materializer := repository.NewPermissionMaterializer(db)
+	total := &model.MaterializeResult{}
+	startTime := time.Now()
+	for start := 0; start < len(documentIDs); start += batchSize {
+		end := start + batchSize
+		if end > len(documentIDs) {
+			end = len(documentIDs)
+		}
+		result, err := materializer.MaterializeDocuments(ctx, documentIDs[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("failed to repair documents: %w", err)
+		}
+		total.Documents += result.Documents
+		total.Inserted += result.Inserted
+		total.Updated += result.Updated
+		total.Deleted += result.Deleted
+		total.Skipped += result.Skipped
+		fmt.Fprintf(os.Stderr, "   ... %d/%d documents\n", end, len(documentIDs))
+	}
+	total.DurationMs = float64(time.Since(startTime).Milliseconds())
+
+	repaired := 0
+	for i := range rep.MismatchDetails {
+		m := &rep.MismatchDetails[i]
+		ok, err := recheckMismatch(ctx, mysqlRepo, zanzibarRepo, m)
+		if err != nil {
+			if m.Error != "" {
+				m.Error += "; "
+			}
+			m.Error += fmt.Sprintf("recheck: %v", err)
+			continue
+		}
+		m.Repaired = ok
+		if ok {
+			repaired++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "✅ Repaired %d documents in %.0fms\n", total.Documents, total.DurationMs)
+	fmt.Fprintf(os.Stderr, "   Inserted: %d, Updated: %d, Deleted: %d, Skipped (unknown user): %d\n",
+		total.Inserted, total.Updated, total.Deleted, total.Skipped)
+	fmt.Fprintf(os.Stderr, "   Re-checked mismatches now consistent: %d/%d\n", repaired, len(rep.MismatchDetails))
+	return total, nil
+}
+
+// recheckMismatch compares the pair again after repair and reports whether both engines now agree
+func recheckMismatch(ctx context.Context, mysqlRepo *repository.MySQLPermissionRepository, zanzibarRepo *repository.ZanzibarPermissionRepository, m *mismatch) (bool, error) {
+	mysqlResult, err := mysqlRepo.CheckPermission(ctx, m.UserID, m.DocumentID, m.PermissionType)
+	if err != nil {
+		return false, err
+	}
+
+	zanzibarResult, err := zanzibarRepo.CheckPermission(ctx, m.UserID, m.DocumentID, m.PermissionType)
+	if err != nil {
+		return false, err
+	}
+	return mysqlResult.HasPermission == zanzibarResult.HasPermission, nil
+}
+
+func printSummary(rep *report) {
+	fmt.Fprintf(os.Stderr, "\n📊 Results:\n")
+	fmt.Fprintf(os.Stderr, "   Users checked: %d %v\n", rep.UsersChecked, rep.UsersByStratum)
+	fmt.Fprintf(os.Stderr, "   Pairs compared: %d\n", rep.PairsCompared)
+	fmt.Fprintf(os.Stderr, "   Mismatches: %d (MySQL only: %d, Zanzibar only: %d, explained: %d)\n",
+		rep.Mismatches, rep.MySQLOnly, rep.ZanzibarOnly, rep.Explained)
+	fmt.Fprintf(os.Stderr, "   Errors: %d\n", len(rep.Errors))
+	for _, e := range rep.Errors {
+		fmt.Fprintf(os.Stderr, "⚠️  user=%s permission=%s: %s\n", e.UserID, e.PermissionType, e.Error)
+	}
+
+	if rep.Mismatches == 0 {
+		fmt.Fprintf(os.Stderr, "   ✅ All results are consistent!\n")
+	} else if rep.PairsCompared > 0 {
+		fmt.Fprintf(os.Stderr, "   ⚠️  Consistency rate: %.2f%%\n",
+			float64(rep.PairsCompared-rep.Mismatches)*100/float64(rep.PairsCompared))
+	}
+}
+
+func writeReport(path, format string, rep *report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if format == "csv" {
+		return writeCSV(f, rep)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+func writeCSV(w io.Writer, rep *report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"user_id", "document_id", "permission_type", "stratum", "mysql", "zanzibar",
+		"mysql_sources", "zanzibar_sources", "error", "repaired"}); err != nil {
+		return err
+	}
+	for _, m := range rep.MismatchDetails {
+		if err := cw.Write([]string{m.UserID, m.DocumentID, m.PermissionType, m.Stratum,
+			strconv.FormatBool(m.MySQL), strconv.FormatBool(m.Zanzibar),
+			strings.Join(m.MySQLSources, ";"), strings.Join(m.ZanzibarSources, ";"),
+			m.Error, strconv.FormatBool(m.Repaired)}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// connect opens the database at dsn
+func connect(dsn string) (*gorm.DB, error) {
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Warn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
+	return db, nil
 }
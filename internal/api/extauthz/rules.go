@@ -0,0 +1,161 @@
+package extauthz
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/d60-Lab/gin-template/pkg/config"
+)
+
+// templateVar matches {name}, {header:name} and {jwt} placeholders
+var templateVar = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// rule is a compiled config.ExtAuthzRule
+type rule struct {
+	name      string
+	methods   map[string]bool
+	path      *regexp.Regexp
+	headers   map[string]*regexp.Regexp
+	namespace string
+	object    string
+	relation  string
+	subject   string
+}
+
+// request is the part of an HTTP request that rules match against
+type request struct {
+	method  string
+	path    string
+	headers map[string]string
+}
+
+// compileRules validates and compiles mapping rules
+func compileRules(cfgRules []config.ExtAuthzRule) ([]*rule, error) {
+	rules := make([]*rule, 0, len(cfgRules))
+	for i, cr := range cfgRules {
+		name := cr.Name
+		if name == "" {
+			name = fmt.Sprintf("rule-%d", i)
+		}
+
+		r := &rule{
+			name:      name,
+			methods:   make(map[string]bool, len(cr.Methods)),
+			headers:   make(map[string]*regexp.Regexp, len(cr.Headers)),
+			namespace: cr.Namespace,
+			object:    cr.Object,
+			relation:  cr.Relation,
+			subject:   cr.Subject,
+		}
+		if r.namespace == "" {
+			r.namespace = "document"
+		}
+		if r.subject == "" {
+			r.subject = "{jwt}"
+		}
+
+		// CheckPermission only answers document permissions
+		if r.namespace != "document" {
+			return nil, fmt.Errorf("rule %s: unsupported namespace %q", name, r.namespace)
+		}
+		switch r.relation {
+		case "viewer", "editor", "owner":
+		default:
+			return nil, fmt.Errorf("rule %s: relation must be one of viewer, editor, owner", name)
+		}
+		if r.object == "" {
+			return nil, fmt.Errorf("rule %s: object is required", name)
+		}
+
+		for _, m := range cr.Methods {
+			r.methods[strings.ToUpper(m)] = true
+		}
+
+		if cr.Path != "" {
+			re, err := regexp.Compile(cr.Path)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: invalid path pattern: %w", name, err)
+			}
+			r.path = re
+		}
+
+		for header, pattern := range cr.Headers {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: invalid pattern for header %s: %w", name, header, err)
+			}
+			r.headers[strings.ToLower(header)] = re
+		}
+
+		// Every {name} placeholder must be a named group of the path pattern
+		for _, tmpl := range []string{r.object, r.subject} {
+			for _, m := range templateVar.FindAllStringSubmatch(tmpl, -1) {
+				v := m[1]
+				if v == "jwt" || strings.HasPrefix(v, "header:") {
+					continue
+				}
+				if r.path == nil || r.path.SubexpIndex(v) < 0 {
+					return nil, fmt.Errorf("rule %s: placeholder {%s} is not a named group of the path pattern", name, v)
+				}
+			}
+		}
+
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// match reports whether the rule applies and returns the named path groups
+func (r *rule) match(req *request) (map[string]string, bool) {
+	if len(r.methods) > 0 && !r.methods[strings.ToUpper(req.method)] {
+		return nil, false
+	}
+
+	for header, re := range r.headers {
+		value, ok := req.headers[header]
+		if !ok || !re.MatchString(value) {
+			return nil, false
+		}
+	}
+
+	groups := make(map[string]string)
+	if r.path != nil {
+		m := r.path.FindStringSubmatch(req.path)
+		if m == nil {
+			return nil, false
+		}
+		for i, name := range r.path.SubexpNames() {
+			if name != "" {
+				groups[name] = m[i]
+			}
+		}
+	}
+
+	return groups, true
+}
+
+// expand fills the placeholders of tmpl. The JWT subject is resolved lazily via jwtSubject
+// so that only rules which reference {jwt} require a token.
+func expand(tmpl string, groups map[string]string, headers map[string]string, jwtSubject func() (string, error)) (string, error) {
+	var expandErr error
+	out := templateVar.ReplaceAllStringFunc(tmpl, func(m string) string {
+		v := m[1 : len(m)-1]
+		switch {
+		case v == "jwt":
+			subject, err := jwtSubject()
+			if err != nil {
+				expandErr = err
+			}
+			return subject
+		case strings.HasPrefix(v, "header:"):
+			return headers[strings.ToLower(strings.TrimPrefix(v, "header:"))]
+		default:
+			return groups[v]
+		}
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	return out, nil
+}
@@ -0,0 +1,197 @@
+// Package extauthz implements the Envoy external authorization gRPC API on top of the permission engine.
+package extauthz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"go.uber.org/zap"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/d60-Lab/gin-template/internal/api/grpcserver"
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/service"
+	"github.com/d60-Lab/gin-template/pkg/config"
+	"github.com/d60-Lab/gin-template/pkg/jwt"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+// Response headers added to allowed requests
+const (
+	HeaderSubject = "x-authz-subject"
+	HeaderRule    = "x-authz-rule"
+)
+
+var errUnauthenticated = errors.New("missing or invalid bearer token")
+
+// Checker answers document permission checks (implemented by ZanzibarPermissionRepository)
+type Checker interface {
+	CheckPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error)
+}
+
+// Server implements authv3.AuthorizationServer
+type Server struct {
+	authv3.UnimplementedAuthorizationServer
+
+	checker      Checker
+	rules        []*rule
+	jwtSecret    string
+	defaultAllow bool
+}
+
+// NewServer creates an ext_authz server from the mapping rules in cfg
+func NewServer(checker Checker, cfg config.ExtAuthzConfig, jwtSecret string) (*Server, error) {
+	rules, err := compileRules(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		checker:      checker,
+		rules:        rules,
+		jwtSecret:    jwtSecret,
+		defaultAllow: cfg.DefaultAllow,
+	}, nil
+}
+
+// NewGRPCServer creates a gRPC server with logging and tracing interceptors serving ext_authz.
+// It deliberately has no auth interceptor: Envoy authenticates the downstream request via the rules.
+func NewGRPCServer(srv *Server) *grpc.Server {
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			grpcserver.TracingUnaryInterceptor(),
+			grpcserver.LoggingUnaryInterceptor(),
+		),
+	)
+	authv3.RegisterAuthorizationServer(s, srv)
+	return s
+}
+
+// Listen opens the TCP listener for the configured ext_authz port
+func Listen(cfg config.ExtAuthzConfig) (net.Listener, error) {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on ext_authz port %d: %w", cfg.Port, err)
+	}
+	return lis, nil
+}
+
+// Check maps the HTTP request to a document permission and answers it
+func (s *Server) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	httpReq := req.GetAttributes().GetRequest().GetHttp()
+
+	path := httpReq.GetPath()
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	r := &request{
+		method:  httpReq.GetMethod(),
+		path:    path,
+		headers: lowerKeys(httpReq.GetHeaders()),
+	}
+
+	for _, rl := range s.rules {
+		groups, ok := rl.match(r)
+		if !ok {
+			continue
+		}
+		return s.checkRule(ctx, rl, groups, r), nil
+	}
+
+	if s.defaultAllow {
+		return allow(nil), nil
+	}
+	return deny(codes.PermissionDenied, typev3.StatusCode_Forbidden, "no authorization rule matches the request"), nil
+}
+
+// checkRule evaluates a matched rule against the permission engine
+func (s *Server) checkRule(ctx context.Context, rl *rule, groups map[string]string, r *request) *authv3.CheckResponse {
+	jwtSubject := func() (string, error) {
+		token := strings.TrimPrefix(r.headers["authorization"], "Bearer ")
+		if token == "" {
+			return "", errUnauthenticated
+		}
+		claims, err := jwt.ParseToken(token, s.jwtSecret)
+		if err != nil || claims.UserID == "" {
+			return "", errUnauthenticated
+		}
+		return claims.UserID, nil
+	}
+
+	subject, err := expand(rl.subject, groups, r.headers, jwtSubject)
+	if err != nil {
+		return deny(codes.Unauthenticated, typev3.StatusCode_Unauthorized, err.Error())
+	}
+	object, err := expand(rl.object, groups, r.headers, jwtSubject)
+	if err != nil {
+		return deny(codes.Unauthenticated, typev3.StatusCode_Unauthorized, err.Error())
+	}
+	if subject == "" || object == "" {
+		return deny(codes.PermissionDenied, typev3.StatusCode_Forbidden, "rule "+rl.name+" resolved an empty subject or object")
+	}
+
+	result, err := s.checker.CheckPermission(service.WithRouteNamespace(ctx, rl.namespace), subject, object, rl.relation)
+	if err != nil {
+		logger.Error("ext_authz permission check failed",
+			zap.String("rule", rl.name),
+			zap.String("subject", subject),
+			zap.String("object", object),
+			zap.Error(err),
+		)
+		return deny(codes.Unavailable, typev3.StatusCode_ServiceUnavailable, "permission check failed")
+	}
+
+	if !result.HasPermission {
+		return deny(codes.PermissionDenied, typev3.StatusCode_Forbidden,
+			fmt.Sprintf("user:%s lacks %s on %s:%s", subject, rl.relation, rl.namespace, object))
+	}
+
+	return allow([]*corev3.HeaderValueOption{
+		header(HeaderSubject, subject),
+		header(HeaderRule, rl.name),
+	})
+}
+
+func allow(headers []*corev3.HeaderValueOption) *authv3.CheckResponse {
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{
+			OkResponse: &authv3.OkHttpResponse{Headers: headers},
+		},
+	}
+}
+
+func deny(code codes.Code, httpCode typev3.StatusCode, message string) *authv3.CheckResponse {
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(code), Message: message},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &authv3.DeniedHttpResponse{
+				Status: &typev3.HttpStatus{Code: httpCode},
+				Body:   message,
+			},
+		},
+	}
+}
+
+func header(key, value string) *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{
+		Header: &corev3.HeaderValue{Key: key, Value: value},
+	}
+}
+
+// lowerKeys normalizes header names; Envoy already sends them lowercased
+func lowerKeys(headers map[string]string) map[string]string {
+	out := make(map[string]string, len(headers))
+	for k, v := range headers {
+		out[strings.ToLower(k)] = v
+	}
+	return out
+}
@@ -0,0 +1,185 @@
+package extauthz
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/pkg/config"
+	"github.com/d60-Lab/gin-template/pkg/jwt"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+const testSecret = "test-secret"
+
+// fakeChecker grants the permissions listed in allowed ("user|doc|relation")
+type fakeChecker struct {
+	allowed map[string]bool
+	err     error
+}
+
+func (f *fakeChecker) CheckPermission(_ context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &model.PermissionCheckResult{
+		HasPermission:  f.allowed[userID+"|"+documentID+"|"+permissionType],
+		PermissionType: permissionType,
+	}, nil
+}
+
+var testRules = []config.ExtAuthzRule{
+	{
+		Name:     "document-read",
+		Methods:  []string{"GET"},
+		Path:     `^/api/documents/(?P<document>[^/]+)$`,
+		Object:   "{document}",
+		Relation: "viewer",
+		Subject:  "{jwt}",
+	},
+	{
+		Name:     "document-write",
+		Methods:  []string{"PUT"},
+		Path:     `^/api/documents/(?P<document>[^/]+)$`,
+		Object:   "{document}",
+		Relation: "editor",
+		Subject:  "{jwt}",
+	},
+	{
+		Name:     "internal-owner",
+		Path:     `^/internal/owner$`,
+		Headers:  map[string]string{"x-internal": "^true$"},
+		Object:   "{header:x-document-id}",
+		Relation: "owner",
+		Subject:  "{header:x-user-id}",
+	},
+}
+
+func setupTestClient(t *testing.T, checker Checker, defaultAllow bool) authv3.AuthorizationClient {
+	require.NoError(t, logger.Init("test"))
+
+	srv, err := NewServer(checker, config.ExtAuthzConfig{Rules: testRules, DefaultAllow: defaultAllow}, testSecret)
+	require.NoError(t, err)
+
+	lis := bufconn.Listen(1024 * 1024)
+	gs := NewGRPCServer(srv)
+	go func() { _ = gs.Serve(lis) }()
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return authv3.NewAuthorizationClient(conn)
+}
+
+func httpCheck(method, path string, headers map[string]string) *authv3.CheckRequest {
+	return &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{
+					Method:  method,
+					Path:    path,
+					Headers: headers,
+				},
+			},
+		},
+	}
+}
+
+func bearer(t *testing.T, userID string) map[string]string {
+	token, err := jwt.GenerateToken(userID, "tester", testSecret, 60)
+	require.NoError(t, err)
+	return map[string]string{"authorization": "Bearer " + token}
+}
+
+func TestCheck(t *testing.T) {
+	checker := &fakeChecker{allowed: map[string]bool{
+		"alice|doc-1|viewer": true,
+		"bob|doc-2|owner":    true,
+	}}
+	client := setupTestClient(t, checker, false)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		req      *authv3.CheckRequest
+		wantCode codes.Code
+		wantHTTP typev3.StatusCode
+	}{
+		{"viewer allowed", httpCheck("GET", "/api/documents/doc-1?x=1", bearer(t, "alice")), codes.OK, 0},
+		{"editor denied", httpCheck("PUT", "/api/documents/doc-1", bearer(t, "alice")), codes.PermissionDenied, typev3.StatusCode_Forbidden},
+		{"other document denied", httpCheck("GET", "/api/documents/doc-2", bearer(t, "alice")), codes.PermissionDenied, typev3.StatusCode_Forbidden},
+		{"missing token", httpCheck("GET", "/api/documents/doc-1", nil), codes.Unauthenticated, typev3.StatusCode_Unauthorized},
+		{"invalid token", httpCheck("GET", "/api/documents/doc-1", map[string]string{"authorization": "Bearer nope"}), codes.Unauthenticated, typev3.StatusCode_Unauthorized},
+		{"header mapping", httpCheck("POST", "/internal/owner", map[string]string{"x-internal": "true", "x-user-id": "bob", "x-document-id": "doc-2"}), codes.OK, 0},
+		{"header rule not matched", httpCheck("POST", "/internal/owner", map[string]string{"x-user-id": "bob", "x-document-id": "doc-2"}), codes.PermissionDenied, typev3.StatusCode_Forbidden},
+		{"no rule", httpCheck("GET", "/healthz", nil), codes.PermissionDenied, typev3.StatusCode_Forbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Check(ctx, tt.req)
+			require.NoError(t, err)
+			assert.Equal(t, int32(tt.wantCode), resp.GetStatus().GetCode())
+			if tt.wantCode == codes.OK {
+				require.NotNil(t, resp.GetOkResponse())
+			} else {
+				assert.Equal(t, tt.wantHTTP, resp.GetDeniedResponse().GetStatus().GetCode())
+			}
+		})
+	}
+
+	// Allowed responses carry the resolved subject and rule
+	resp, err := client.Check(ctx, httpCheck("GET", "/api/documents/doc-1", bearer(t, "alice")))
+	require.NoError(t, err)
+	headers := map[string]string{}
+	for _, h := range resp.GetOkResponse().GetHeaders() {
+		headers[h.GetHeader().GetKey()] = h.GetHeader().GetValue()
+	}
+	assert.Equal(t, "alice", headers[HeaderSubject])
+	assert.Equal(t, "document-read", headers[HeaderRule])
+}
+
+func TestCheck_DefaultAllowAndEngineError(t *testing.T) {
+	client := setupTestClient(t, &fakeChecker{err: errors.New("db down")}, true)
+	ctx := context.Background()
+
+	resp, err := client.Check(ctx, httpCheck("GET", "/healthz", nil))
+	require.NoError(t, err)
+	assert.Equal(t, int32(codes.OK), resp.GetStatus().GetCode())
+
+	resp, err = client.Check(ctx, httpCheck("GET", "/api/documents/doc-1", bearer(t, "alice")))
+	require.NoError(t, err)
+	assert.Equal(t, int32(codes.Unavailable), resp.GetStatus().GetCode())
+	assert.Equal(t, typev3.StatusCode_ServiceUnavailable, resp.GetDeniedResponse().GetStatus().GetCode())
+}
+
+func TestNewServer_InvalidRules(t *testing.T) {
+	invalid := []config.ExtAuthzRule{
+		{Name: "namespace", Namespace: "customer", Object: "c", Relation: "viewer"},
+		{Name: "relation", Object: "d", Relation: "admin"},
+		{Name: "path", Path: "(", Object: "d", Relation: "viewer"},
+		{Name: "group", Path: "^/docs/(?P<id>[^/]+)$", Object: "{document}", Relation: "viewer"},
+	}
+	for _, r := range invalid {
+		_, err := NewServer(&fakeChecker{}, config.ExtAuthzConfig{Rules: []config.ExtAuthzRule{r}}, testSecret)
+		assert.Error(t, err, "rule %s should be rejected", r.Name)
+	}
+}
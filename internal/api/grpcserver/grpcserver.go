@@ -0,0 +1,46 @@
+// Package grpcserver exposes the permission engines over gRPC, on a port separate from the HTTP API.
+package grpcserver
+
+import (
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+
+	permissionv1 "github.com/d60-Lab/gin-template/api/proto/permission/v1"
+	"github.com/d60-Lab/gin-template/pkg/config"
+)
+
+// New creates a gRPC server with logging, tracing and (optionally) auth interceptors
+// and registers the permission service on it
+func New(cfg *config.Config, permissionServer permissionv1.PermissionServiceServer) *grpc.Server {
+	unary := []grpc.UnaryServerInterceptor{
+		TracingUnaryInterceptor(),
+		LoggingUnaryInterceptor(),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		TracingStreamInterceptor(),
+		LoggingStreamInterceptor(),
+	}
+	if cfg.GRPC.AuthEnabled {
+		unary = append(unary, AuthUnaryInterceptor(cfg.JWT.Secret))
+		stream = append(stream, AuthStreamInterceptor(cfg.JWT.Secret))
+	}
+
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)
+	permissionv1.RegisterPermissionServiceServer(srv, permissionServer)
+
+	return srv
+}
+
+// Listen opens the TCP listener for the configured gRPC port
+func Listen(cfg *config.Config) (net.Listener, error) {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPC.Port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on grpc port %d: %w", cfg.GRPC.Port, err)
+	}
+	return lis, nil
+}
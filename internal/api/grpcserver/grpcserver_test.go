@@ -0,0 +1,163 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	permissionv1 "github.com/d60-Lab/gin-template/api/proto/permission/v1"
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/pkg/config"
+	"github.com/d60-Lab/gin-template/pkg/jwt"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+const testSecret = "test-secret"
+
+// setupTestClient starts the gRPC server on an in-memory listener.
+// Repositories are nil, so only calls rejected before reaching an engine are exercised.
+func setupTestClient(t *testing.T, authEnabled bool) permissionv1.PermissionServiceClient {
+	return setupTestClientWithServer(t, authEnabled, NewPermissionServer(nil, nil, nil))
+}
+
+// setupTestClientWithServer starts the given permission server on an in-memory listener
+func setupTestClientWithServer(t *testing.T, authEnabled bool, server *PermissionServer) permissionv1.PermissionServiceClient {
+	require.NoError(t, logger.Init("test"))
+
+	cfg := &config.Config{
+		JWT:  config.JWTConfig{Secret: testSecret},
+		GRPC: config.GRPCConfig{AuthEnabled: authEnabled},
+	}
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := New(cfg, server)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return permissionv1.NewPermissionServiceClient(conn)
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	client := setupTestClient(t, true)
+	req := &permissionv1.CheckRequest{DocumentId: "doc-1", Permission: "viewer"}
+
+	// Missing token
+	_, err := client.Check(context.Background(), req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Invalid token
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer not-a-jwt")
+	_, err = client.Check(ctx, req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Valid token reaches the service, which rejects the missing user_id
+	token, err := jwt.GenerateToken("user-1", "tester", testSecret, 60)
+	require.NoError(t, err)
+	ctx = metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	_, err = client.Check(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Streaming calls are authenticated too
+	stream, err := client.LookupResources(context.Background(), &permissionv1.LookupResourcesRequest{UserId: "user-1", Permission: "viewer"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestRequestValidation(t *testing.T) {
+	client := setupTestClient(t, false)
+	ctx := context.Background()
+
+	_, err := client.Check(ctx, &permissionv1.CheckRequest{UserId: "user-1", DocumentId: "doc-1", Permission: "admin"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.BatchCheck(ctx, &permissionv1.BatchCheckRequest{UserId: "user-1", Permission: "viewer"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.WriteTuples(ctx, &permissionv1.WriteTuplesRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.LookupSubjects(ctx, &permissionv1.LookupSubjectsRequest{Permission: "viewer"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// fakeEngine is a default engine that grants viewer on doc-1 and lists it
+type fakeEngine struct {
+	calls int
+}
+
+func (f *fakeEngine) CheckPermission(_ context.Context, _, documentID, permissionType string) (*model.PermissionCheckResult, error) {
+	f.calls++
+	return &model.PermissionCheckResult{HasPermission: documentID == "doc-1", PermissionType: permissionType}, nil
+}
+
+func (f *fakeEngine) CheckPermissionsBatch(_ context.Context, _ string, documentIDs []string, _ string) (map[string]bool, error) {
+	f.calls++
+	results := make(map[string]bool, len(documentIDs))
+	for _, documentID := range documentIDs {
+		results[documentID] = documentID == "doc-1"
+	}
+	return results, nil
+}
+
+func (f *fakeEngine) LookupDocuments(_ context.Context, _, _ string, _ int, yield func(documentIDs []string) error) error {
+	f.calls++
+	return yield([]string{"doc-1"})
+}
+
+func TestDefaultEngine(t *testing.T) {
+	engine := &fakeEngine{}
+	client := setupTestClientWithServer(t, false, NewPermissionServer(nil, nil, engine))
+	ctx := context.Background()
+
+	// Requests without an engine go to the default engine (shadow evaluator or cutover router)
+	check, err := client.Check(ctx, &permissionv1.CheckRequest{UserId: "user-1", DocumentId: "doc-1", Permission: "viewer"})
+	require.NoError(t, err)
+	assert.True(t, check.GetAllowed())
+
+	batch, err := client.BatchCheck(ctx, &permissionv1.BatchCheckRequest{UserId: "user-1", DocumentIds: []string{"doc-1", "doc-2"}, Permission: "viewer"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"doc-1": true, "doc-2": false}, batch.GetResults())
+
+	stream, err := client.LookupResources(ctx, &permissionv1.LookupResourcesRequest{UserId: "user-1", Permission: "viewer"})
+	require.NoError(t, err)
+	page, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"doc-1"}, page.GetDocumentIds())
+
+	assert.Equal(t, 3, engine.calls)
+}
+
+func TestTupleConversion(t *testing.T) {
+	expiresAt := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+	caveat := "corporate_network"
+	tuples := []model.RelationTuple{
+		{Namespace: "document", ObjectID: "doc-1", Relation: "viewer", SubjectNamespace: "user", SubjectID: "user-1"},
+		{Namespace: "document", ObjectID: "doc-1", Relation: "viewer", SubjectNamespace: "user", SubjectID: "user-2", ExpiresAt: &expiresAt, CaveatName: &caveat},
+	}
+
+	for _, tuple := range tuples {
+		converted := tupleFromProto(tupleToProto(&tuple))
+		assert.Equal(t, tuple.Text(), converted.Text())
+	}
+	assert.Nil(t, tupleToProto(&tuples[0]).GetExpiresAt(), "a tuple without expiry never expires")
+}
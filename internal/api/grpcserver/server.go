@@ -0,0 +1,341 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	permissionv1 "github.com/d60-Lab/gin-template/api/proto/permission/v1"
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+)
+
+// Engine answers the checks and lookups that do not select an engine: the
+// Zanzibar repository, or the shadow evaluator or cutover router in front of both
+type Engine interface {
+	CheckPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error)
+	CheckPermissionsBatch(ctx context.Context, userID string, documentIDs []string, permissionType string) (map[string]bool, error)
+	LookupDocuments(ctx context.Context, userID, permissionType string, batchSize int, yield func(documentIDs []string) error) error
+}
+
+// PermissionServer implements permissionv1.PermissionServiceServer on top of the permission engines
+type PermissionServer struct {
+	permissionv1.UnimplementedPermissionServiceServer
+
+	mysqlRepo     *repository.MySQLPermissionRepository
+	zanzibarRepo  *repository.ZanzibarPermissionRepository
+	defaultEngine Engine
+}
+
+// NewPermissionServer creates a new gRPC permission server. Requests with
+// ENGINE_UNSPECIFIED are answered by defaultEngine, or by Zanzibar when it is nil.
+func NewPermissionServer(
+	mysqlRepo *repository.MySQLPermissionRepository,
+	zanzibarRepo *repository.ZanzibarPermissionRepository,
+	defaultEngine Engine,
+) *PermissionServer {
+	if defaultEngine == nil {
+		defaultEngine = zanzibarRepo
+	}
+	return &PermissionServer{
+		mysqlRepo:     mysqlRepo,
+		zanzibarRepo:  zanzibarRepo,
+		defaultEngine: defaultEngine,
+	}
+}
+
+// engine returns the engine selected by a request
+func (s *PermissionServer) engine(engine permissionv1.Engine) Engine {
+	switch engine {
+	case permissionv1.Engine_ENGINE_MYSQL:
+		return s.mysqlRepo
+	case permissionv1.Engine_ENGINE_ZANZIBAR:
+		return s.zanzibarRepo
+	default:
+		return s.defaultEngine
+	}
+}
+
+// Check checks whether a user holds a permission on a document
+func (s *PermissionServer) Check(ctx context.Context, req *permissionv1.CheckRequest) (*permissionv1.CheckResponse, error) {
+	if req.GetUserId() == "" || req.GetDocumentId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id and document_id are required")
+	}
+	if err := validatePermission(req.GetPermission()); err != nil {
+		return nil, err
+	}
+
+	if req.GetContext() != nil {
+		ctx = repository.WithCaveatContext(ctx, req.GetContext().AsMap())
+	}
+	result, err := s.engine(req.GetEngine()).CheckPermission(ctx, req.GetUserId(), req.GetDocumentId(), req.GetPermission())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &permissionv1.CheckResponse{
+		Allowed:             result.HasPermission,
+		Sources:             result.Sources,
+		DurationMs:          result.DurationMs,
+		Conditional:         result.Conditional,
+		MissingContext:      result.MissingContext,
+		DeniedByAttributes:  result.DeniedByAttributes,
+		DeniedByEthicalWall: result.DeniedByEthicalWall,
+	}, nil
+}
+
+// BatchCheck checks a permission on many documents at once
+func (s *PermissionServer) BatchCheck(ctx context.Context, req *permissionv1.BatchCheckRequest) (*permissionv1.BatchCheckResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if len(req.GetDocumentIds()) == 0 || len(req.GetDocumentIds()) > 100 {
+		return nil, status.Error(codes.InvalidArgument, "document_ids must contain between 1 and 100 entries")
+	}
+	if err := validatePermission(req.GetPermission()); err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+
+	if req.GetContext() != nil {
+		ctx = repository.WithCaveatContext(ctx, req.GetContext().AsMap())
+	}
+	results, err := s.engine(req.GetEngine()).CheckPermissionsBatch(ctx, req.GetUserId(), req.GetDocumentIds(), req.GetPermission())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	// Make sure every requested document has an answer
+	for _, docID := range req.GetDocumentIds() {
+		if _, ok := results[docID]; !ok {
+			results[docID] = false
+		}
+	}
+
+	return &permissionv1.BatchCheckResponse{
+		Results:    results,
+		DurationMs: float64(time.Since(startTime).Microseconds()) / 1000.0,
+	}, nil
+}
+
+// Expand returns the userset tree of a document permission
+func (s *PermissionServer) Expand(ctx context.Context, req *permissionv1.ExpandRequest) (*permissionv1.ExpandResponse, error) {
+	if req.GetDocumentId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "document_id is required")
+	}
+	if err := validatePermission(req.GetPermission()); err != nil {
+		return nil, err
+	}
+
+	tree, err := s.zanzibarRepo.Expand(ctx, req.GetDocumentId(), req.GetPermission())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &permissionv1.ExpandResponse{Tree: expandNodeToProto(tree)}, nil
+}
+
+// LookupResources streams the documents a user can access
+func (s *PermissionServer) LookupResources(req *permissionv1.LookupResourcesRequest, stream permissionv1.PermissionService_LookupResourcesServer) error {
+	if req.GetUserId() == "" {
+		return status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if err := validatePermission(req.GetPermission()); err != nil {
+		return err
+	}
+
+	send := func(documentIDs []string) error {
+		return stream.Send(&permissionv1.LookupResourcesResponse{DocumentIds: documentIDs})
+	}
+
+	ctx := stream.Context()
+	batchSize := int(req.GetBatchSize())
+
+	err := s.engine(req.GetEngine()).LookupDocuments(ctx, req.GetUserId(), req.GetPermission(), batchSize, send)
+	if err != nil {
+		return toStatus(err)
+	}
+	return nil
+}
+
+// LookupSubjects returns the users that can access a document
+func (s *PermissionServer) LookupSubjects(ctx context.Context, req *permissionv1.LookupSubjectsRequest) (*permissionv1.LookupSubjectsResponse, error) {
+	if req.GetDocumentId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "document_id is required")
+	}
+	if err := validatePermission(req.GetPermission()); err != nil {
+		return nil, err
+	}
+
+	userIDs, err := s.zanzibarRepo.LookupSubjects(ctx, req.GetDocumentId(), req.GetPermission())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &permissionv1.LookupSubjectsResponse{UserIds: userIDs}, nil
+}
+
+// WriteTuples applies tuple updates atomically
+func (s *PermissionServer) WriteTuples(ctx context.Context, req *permissionv1.WriteTuplesRequest) (*permissionv1.WriteTuplesResponse, error) {
+	if len(req.GetUpdates()) == 0 || len(req.GetUpdates()) > 1000 {
+		return nil, status.Error(codes.InvalidArgument, "updates must contain between 1 and 1000 entries")
+	}
+
+	updates := make([]model.TupleUpdate, len(req.GetUpdates()))
+	for i, u := range req.GetUpdates() {
+		updates[i] = model.TupleUpdate{
+			Operation: tupleOperations[u.GetOperation()],
+			Tuple:     tupleFromProto(u.GetTuple()),
+		}
+	}
+	preconditions := make([]model.TuplePrecondition, len(req.GetPreconditions()))
+	for i, p := range req.GetPreconditions() {
+		preconditions[i] = model.TuplePrecondition{
+			Operation: preconditionOperations[p.GetOperation()],
+			Tuple:     tupleFromProto(p.GetTuple()),
+		}
+	}
+
+	result, err := s.zanzibarRepo.WriteTuples(ctx, updates, preconditions)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &permissionv1.WriteTuplesResponse{
+		Created:    int32(result.Created),
+		Touched:    int32(result.Touched),
+		Deleted:    int32(result.Deleted),
+		DurationMs: result.DurationMs,
+	}, nil
+}
+
+// ReadTuples lists tuples matching a filter
+func (s *PermissionServer) ReadTuples(ctx context.Context, req *permissionv1.ReadTuplesRequest) (*permissionv1.ReadTuplesResponse, error) {
+	f := req.GetFilter()
+	filter := model.TupleFilter{
+		Namespace:        f.GetNamespace(),
+		ObjectID:         f.GetObjectId(),
+		Relation:         f.GetRelation(),
+		SubjectNamespace: f.GetSubjectNamespace(),
+		SubjectID:        f.GetSubjectId(),
+		UsersetNamespace: f.GetUsersetNamespace(),
+		UsersetRelation:  f.GetUsersetRelation(),
+	}
+
+	list, err := s.zanzibarRepo.ReadTuples(ctx, filter, req.GetPageToken(), int(req.GetPageSize()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	tuples := make([]*permissionv1.Tuple, len(list.Tuples))
+	for i := range list.Tuples {
+		tuples[i] = tupleToProto(&list.Tuples[i])
+	}
+
+	return &permissionv1.ReadTuplesResponse{
+		Tuples:        tuples,
+		NextPageToken: list.NextPageToken,
+	}, nil
+}
+
+// tupleOperations maps protobuf tuple operations to model operations
+var tupleOperations = map[permissionv1.TupleOperation]string{
+	permissionv1.TupleOperation_TUPLE_OPERATION_TOUCH:  model.TupleOperationTouch,
+	permissionv1.TupleOperation_TUPLE_OPERATION_CREATE: model.TupleOperationCreate,
+	permissionv1.TupleOperation_TUPLE_OPERATION_DELETE: model.TupleOperationDelete,
+}
+
+// preconditionOperations maps protobuf precondition operations to model operations
+var preconditionOperations = map[permissionv1.PreconditionOperation]string{
+	permissionv1.PreconditionOperation_PRECONDITION_OPERATION_MUST_EXIST:     model.PreconditionMustExist,
+	permissionv1.PreconditionOperation_PRECONDITION_OPERATION_MUST_NOT_EXIST: model.PreconditionMustNotExist,
+}
+
+// validatePermission checks the permission type of a request
+func validatePermission(permission string) error {
+	switch permission {
+	case "viewer", "editor", "owner":
+		return nil
+	}
+	return status.Errorf(codes.InvalidArgument, "permission must be one of viewer, editor, owner (got %q)", permission)
+}
+
+// toStatus converts repository errors into gRPC status errors
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrPreconditionFailed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, repository.ErrTupleAlreadyExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, repository.ErrInvalidTuple), errors.Is(err, repository.ErrInvalidPageToken):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// tupleFromProto converts a protobuf tuple into a model tuple
+func tupleFromProto(t *permissionv1.Tuple) model.RelationTuple {
+	tuple := model.RelationTuple{
+		Namespace:        t.GetNamespace(),
+		ObjectID:         t.GetObjectId(),
+		Relation:         t.GetRelation(),
+		SubjectNamespace: t.GetSubjectNamespace(),
+		SubjectID:        t.GetSubjectId(),
+		UsersetNamespace: t.UsersetNamespace,
+		UsersetRelation:  t.UsersetRelation,
+		CaveatName:       t.CaveatName,
+		CaveatContext:    t.CaveatContext,
+	}
+	if t.ExpiresAt != nil {
+		expiresAt := t.GetExpiresAt().AsTime()
+		tuple.ExpiresAt = &expiresAt
+	}
+	return tuple
+}
+
+// tupleToProto converts a model tuple into a protobuf tuple
+func tupleToProto(t *model.RelationTuple) *permissionv1.Tuple {
+	tuple := &permissionv1.Tuple{
+		Namespace:        t.Namespace,
+		ObjectId:         t.ObjectID,
+		Relation:         t.Relation,
+		SubjectNamespace: t.SubjectNamespace,
+		SubjectId:        t.SubjectID,
+		UsersetNamespace: t.UsersetNamespace,
+		UsersetRelation:  t.UsersetRelation,
+		CaveatName:       t.CaveatName,
+		CaveatContext:    t.CaveatContext,
+	}
+	if t.ExpiresAt != nil {
+		tuple.ExpiresAt = timestamppb.New(*t.ExpiresAt)
+	}
+	return tuple
+}
+
+// expandNodeToProto converts an expand tree into its protobuf form
+func expandNodeToProto(node *model.ExpandNode) *permissionv1.ExpandNode {
+	if node == nil {
+		return nil
+	}
+	out := &permissionv1.ExpandNode{
+		Kind:     node.Kind,
+		Name:     node.Name,
+		Subjects: node.Subjects,
+	}
+	for _, child := range node.Children {
+		out.Children = append(out.Children, expandNodeToProto(child))
+	}
+	return out
+}
@@ -2,30 +2,53 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/d60-Lab/gin-template/internal/dto"
+	"github.com/d60-Lab/gin-template/internal/model"
 	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/internal/service"
 )
 
 // PermissionHandler handles permission-related HTTP requests
 type PermissionHandler struct {
 	mysqlRepo    *repository.MySQLPermissionRepository
 	zanzibarRepo *repository.ZanzibarPermissionRepository
+	jobQueue     *service.PermissionJobQueue
+	shadow       *service.ShadowEvaluator // nil when shadow mode is disabled
+	cutover      *service.CutoverRouter   // nil when cutover routing is disabled
+	softDeletes  *repository.SoftDeleteRepository
+	attributes   *repository.EntityAttributeRepository
+	conflicts    *repository.CustomerConflictRepository
 }
 
 // NewPermissionHandler creates a new permission handler
 func NewPermissionHandler(
 	mysqlRepo *repository.MySQLPermissionRepository,
 	zanzibarRepo *repository.ZanzibarPermissionRepository,
+	jobQueue *service.PermissionJobQueue,
+	shadow *service.ShadowEvaluator,
+	cutover *service.CutoverRouter,
+	softDeletes *repository.SoftDeleteRepository,
+	attributes *repository.EntityAttributeRepository,
+	conflicts *repository.CustomerConflictRepository,
 ) *PermissionHandler {
 	return &PermissionHandler{
 		mysqlRepo:    mysqlRepo,
 		zanzibarRepo: zanzibarRepo,
+		jobQueue:     jobQueue,
+		shadow:       shadow,
+		cutover:      cutover,
+		softDeletes:  softDeletes,
+		attributes:   attributes,
+		conflicts:    conflicts,
 	}
 }
 
@@ -68,7 +91,12 @@ func (h *PermissionHandler) CheckPermissionZanzibar(c *gin.Context) {
 		return
 	}
 
-	result, err := h.zanzibarRepo.CheckPermission(c.Request.Context(), req.UserID, req.DocumentID, req.PermissionType)
+	ctx := checkContext(c.Request.Context(), req)
+	if req.ManagerChainStrategy != "" {
+		ctx = repository.WithManagerChainStrategy(ctx, req.ManagerChainStrategy)
+	}
+
+	result, err := h.zanzibarRepo.CheckPermission(ctx, req.UserID, req.DocumentID, req.PermissionType)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -98,7 +126,7 @@ func (h *PermissionHandler) CheckPermissionBoth(c *gin.Context) {
 		return
 	}
 
-	zanzibarResult, err := h.zanzibarRepo.CheckPermission(c.Request.Context(), req.UserID, req.DocumentID, req.PermissionType)
+	zanzibarResult, err := h.zanzibarRepo.CheckPermission(checkContext(c.Request.Context(), req), req.UserID, req.DocumentID, req.PermissionType)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Zanzibar error: " + err.Error()})
 		return
@@ -118,6 +146,227 @@ func (h *PermissionHandler) CheckPermissionBoth(c *gin.Context) {
 	})
 }
 
+// CheckPermissionShadow answers from the configured primary engine and
+// evaluates the other engine asynchronously, recording any mismatch
+// @Summary Check permission (Shadow mode)
+// @Tags Comparison
+// @Accept json
+// @Produce json
+// @Param request body dto.CheckPermissionRequest true "Permission check request"
+// @Success 200 {object} model.PermissionCheckResult
+// @Failure 503 {object} map[string]interface{}
+// @Router /api/v1/permissions/shadow/check [post]
+func (h *PermissionHandler) CheckPermissionShadow(c *gin.Context) {
+	if h.shadow == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "shadow mode is disabled"})
+		return
+	}
+
+	var req dto.CheckPermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.shadow.CheckPermission(checkContext(c.Request.Context(), req), req.UserID, req.DocumentID, req.PermissionType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetShadowStats returns shadow evaluation counters
+// @Summary Get shadow evaluation statistics
+// @Tags Comparison
+// @Produce json
+// @Success 200 {object} model.ShadowStats
+// @Router /api/v1/permissions/shadow/stats [get]
+func (h *PermissionHandler) GetShadowStats(c *gin.Context) {
+	if h.shadow == nil {
+		c.JSON(http.StatusOK, &model.ShadowStats{Enabled: false})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.shadow.Stats())
+}
+
+// ListShadowMismatches returns recently recorded shadow mismatches
+// @Summary List shadow mismatches
+// @Tags Comparison
+// @Produce json
+// @Param user_id query string false "Filter by user ID"
+// @Param document_id query string false "Filter by document ID"
+// @Param limit query int false "Maximum mismatches to return" default(100)
+// @Success 200 {array} model.ShadowMismatch
+// @Failure 503 {object} map[string]interface{}
+// @Router /api/v1/permissions/shadow/mismatches [get]
+func (h *PermissionHandler) ListShadowMismatches(c *gin.Context) {
+	if h.shadow == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "shadow mode is disabled"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	mismatches, err := h.shadow.Mismatches(c.Request.Context(), c.Query("user_id"), c.Query("document_id"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, mismatches)
+}
+
+// CheckPermissionRouted checks permission on the engine picked by the cutover rules
+// @Summary Check permission (Cutover routed)
+// @Tags Cutover
+// @Accept json
+// @Produce json
+// @Param request body dto.CheckPermissionRequest true "Permission check request"
+// @Success 200 {object} model.PermissionCheckResult
+// @Failure 503 {object} map[string]interface{}
+// @Router /api/v1/permissions/check [post]
+func (h *PermissionHandler) CheckPermissionRouted(c *gin.Context) {
+	if h.cutover == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "cutover routing is disabled"})
+		return
+	}
+
+	var req dto.CheckPermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := service.WithRouteNamespace(checkContext(c.Request.Context(), req), req.Namespace)
+	result, err := h.cutover.CheckPermission(ctx, req.UserID, req.DocumentID, req.PermissionType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetUserDocumentsRouted gets user's documents from the engine picked by the cutover rules
+// @Summary Get user documents (Cutover routed)
+// @Tags Cutover
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param permission_type query string false "Permission type" Enums(viewer, editor, owner) default(viewer)
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Param namespace query string false "Namespace matched by the cutover namespace rules" default(document)
+// @Success 200 {object} model.UserDocumentList
+// @Failure 503 {object} map[string]interface{}
+// @Router /api/v1/permissions/users/:user_id/documents [get]
+func (h *PermissionHandler) GetUserDocumentsRouted(c *gin.Context) {
+	if h.cutover == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "cutover routing is disabled"})
+		return
+	}
+
+	userID := c.Param("user_id")
+	permissionType := c.DefaultQuery("permission_type", "viewer")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	ctx := service.WithRouteNamespace(c.Request.Context(), c.Query("namespace"))
+	result, err := h.cutover.GetUserDocuments(ctx, userID, permissionType, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetCutoverStats returns the cutover rules and per-engine traffic share
+// @Summary Get cutover rules and traffic share
+// @Tags Cutover
+// @Produce json
+// @Success 200 {object} model.CutoverStats
+// @Router /api/v1/permissions/cutover [get]
+func (h *PermissionHandler) GetCutoverStats(c *gin.Context) {
+	if h.cutover == nil {
+		c.JSON(http.StatusOK, &model.CutoverStats{Enabled: false})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.cutover.Stats())
+}
+
+// UpdateCutoverRules replaces the cutover rules at runtime
+// @Summary Update cutover rules
+// @Tags Cutover
+// @Accept json
+// @Produce json
+// @Param request body dto.UpdateCutoverRequest true "Cutover rules"
+// @Success 200 {object} model.CutoverStats
+// @Failure 503 {object} map[string]interface{}
+// @Router /api/v1/permissions/cutover [put]
+func (h *PermissionHandler) UpdateCutoverRules(c *gin.Context) {
+	if h.cutover == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "cutover routing is disabled"})
+		return
+	}
+
+	var req dto.UpdateCutoverRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.cutover.Update(service.CutoverRules{
+		ZanzibarPercent: *req.ZanzibarPercent,
+		AllowUsers:      req.AllowUsers,
+		DenyUsers:       req.DenyUsers,
+		AllowNamespaces: req.AllowNamespaces,
+		DenyNamespaces:  req.DenyNamespaces,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.cutover.Stats())
+}
+
+// RollbackCutover routes all traffic back to MySQL immediately
+// @Summary Roll back cutover to MySQL
+// @Tags Cutover
+// @Produce json
+// @Success 200 {object} model.CutoverStats
+// @Failure 503 {object} map[string]interface{}
+// @Router /api/v1/permissions/cutover/rollback [post]
+func (h *PermissionHandler) RollbackCutover(c *gin.Context) {
+	if h.cutover == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "cutover routing is disabled"})
+		return
+	}
+
+	h.cutover.Rollback()
+	c.JSON(http.StatusOK, h.cutover.Stats())
+}
+
+// ResumeCutover re-applies the cutover rules after a rollback
+// @Summary Resume cutover after a rollback
+// @Tags Cutover
+// @Produce json
+// @Success 200 {object} model.CutoverStats
+// @Failure 503 {object} map[string]interface{}
+// @Router /api/v1/permissions/cutover/resume [post]
+func (h *PermissionHandler) ResumeCutover(c *gin.Context) {
+	if h.cutover == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "cutover routing is disabled"})
+		return
+	}
+
+	h.cutover.Resume()
+	c.JSON(http.StatusOK, h.cutover.Stats())
+}
+
 // GetUserDocumentsMySQL gets user's documents using MySQL engine
 // @Summary Get user documents (MySQL)
 // @Tags MySQL Permissions
@@ -168,13 +417,79 @@ func (h *PermissionHandler) GetUserDocumentsZanzibar(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// CountUserDocumentsZanzibar counts the documents a user can access using Zanzibar engine
+// @Summary Count user documents (Zanzibar)
+// @Tags Zanzibar Permissions
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param permission_type query string false "Permission type" Enums(viewer, editor, owner) default(viewer)
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/permissions/zanzibar/users/:user_id/documents/count [get]
+func (h *PermissionHandler) CountUserDocumentsZanzibar(c *gin.Context) {
+	userID := c.Param("user_id")
+	permissionType := c.DefaultQuery("permission_type", "viewer")
+
+	count, err := h.zanzibarRepo.CountUserDocuments(c.Request.Context(), userID, permissionType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":         userID,
+		"permission_type": permissionType,
+		"count":           count,
+	})
+}
+
+// GetBitmapIndexStatsZanzibar returns the size of the Zanzibar bitmap index
+// @Summary Get bitmap index statistics (Zanzibar)
+// @Tags Zanzibar Permissions
+// @Produce json
+// @Success 200 {object} model.BitmapIndexStats
+// @Router /api/v1/permissions/zanzibar/bitmap-index [get]
+func (h *PermissionHandler) GetBitmapIndexStatsZanzibar(c *gin.Context) {
+	idx := h.zanzibarRepo.BitmapIndex()
+	if idx == nil {
+		c.JSON(http.StatusOK, &model.BitmapIndexStats{Enabled: false})
+		return
+	}
+
+	c.JSON(http.StatusOK, idx.Stats())
+}
+
+// RebuildBitmapIndexZanzibar rebuilds the document sets of every user
+// @Summary Rebuild bitmap index (Zanzibar)
+// @Tags Zanzibar Permissions
+// @Produce json
+// @Param permission_type query string false "Permission type" Enums(viewer, editor, owner) default(viewer)
+// @Success 200 {object} model.BitmapIndexStats
+// @Failure 503 {object} map[string]interface{}
+// @Router /api/v1/permissions/zanzibar/bitmap-index/rebuild [post]
+func (h *PermissionHandler) RebuildBitmapIndexZanzibar(c *gin.Context) {
+	permissionType := c.DefaultQuery("permission_type", "viewer")
+
+	stats, err := h.zanzibarRepo.RebuildBitmapIndex(c.Request.Context(), permissionType)
+	if err != nil {
+		if errors.Is(err, repository.ErrBitmapIndexDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
 // GrantPermissionMySQL grants permission using MySQL engine
 // @Summary Grant permission (MySQL)
 // @Tags MySQL Permissions
 // @Accept json
 // @Produce json
 // @Param request body dto.GrantPermissionRequest true "Grant permission request"
-// @Success 200 {object} map[string]interface{}
+// @Success 200 {object} dto.GrantPermissionResponse
+// @Failure 400 {object} map[string]interface{}
 // @Router /api/v1/permissions/mysql/grant [post]
 func (h *PermissionHandler) GrantPermissionMySQL(c *gin.Context) {
 	var req dto.GrantPermissionRequest
@@ -182,14 +497,19 @@ func (h *PermissionHandler) GrantPermissionMySQL(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	expiresAt, err := grantExpiry(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	err := h.mysqlRepo.GrantDirectPermission(c.Request.Context(), req.UserID, req.DocumentID, req.PermissionType)
+	err = h.mysqlRepo.GrantDirectPermissionUntil(c.Request.Context(), req.UserID, req.DocumentID, req.PermissionType, expiresAt)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Permission granted successfully"})
+	c.JSON(http.StatusOK, grantResponse(expiresAt))
 }
 
 // GrantPermissionZanzibar grants permission using Zanzibar engine
@@ -198,7 +518,8 @@ func (h *PermissionHandler) GrantPermissionMySQL(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param request body dto.GrantPermissionRequest true "Grant permission request"
-// @Success 200 {object} map[string]interface{}
+// @Success 200 {object} dto.GrantPermissionResponse
+// @Failure 400 {object} map[string]interface{}
 // @Router /api/v1/permissions/zanzibar/grant [post]
 func (h *PermissionHandler) GrantPermissionZanzibar(c *gin.Context) {
 	var req dto.GrantPermissionRequest
@@ -206,23 +527,184 @@ func (h *PermissionHandler) GrantPermissionZanzibar(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	expiresAt, err := grantExpiry(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	err := h.zanzibarRepo.GrantDirectPermission(c.Request.Context(), req.UserID, req.DocumentID, req.PermissionType)
+	err = h.zanzibarRepo.GrantDirectPermissionUntil(c.Request.Context(), req.UserID, req.DocumentID, req.PermissionType, expiresAt)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Permission granted successfully"})
+	c.JSON(http.StatusOK, grantResponse(expiresAt))
+}
+
+// WriteTuplesZanzibar applies tuple updates atomically (Zanzibar)
+// @Summary Write tuples (Zanzibar - atomic, with preconditions)
+// @Tags Zanzibar Permissions
+// @Accept json
+// @Produce json
+// @Param request body dto.WriteTuplesRequest true "Write tuples request"
+// @Success 200 {object} model.WriteTuplesResult
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 412 {object} map[string]interface{}
+// @Router /api/v1/permissions/zanzibar/tuples [post]
+func (h *PermissionHandler) WriteTuplesZanzibar(c *gin.Context) {
+	var req dto.WriteTuplesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := make([]model.TupleUpdate, len(req.Updates))
+	for i, u := range req.Updates {
+		updates[i] = model.TupleUpdate{Operation: u.Operation, Tuple: tupleFromRequest(u.Tuple)}
+	}
+	preconditions := make([]model.TuplePrecondition, len(req.Preconditions))
+	for i, p := range req.Preconditions {
+		preconditions[i] = model.TuplePrecondition{Operation: p.Operation, Tuple: tupleFromRequest(p.Tuple)}
+	}
+
+	result, err := h.zanzibarRepo.WriteTuples(c.Request.Context(), updates, preconditions)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrPreconditionFailed):
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrTupleAlreadyExists):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrInvalidTuple):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ReadTuplesZanzibar lists relation tuples matching the given filters (Zanzibar)
+// @Summary Read tuples (Zanzibar - filtered, keyset paginated)
+// @Tags Zanzibar Permissions
+// @Produce json
+// @Param namespace query string false "Object namespace"
+// @Param object_id query string false "Object ID"
+// @Param relation query string false "Relation"
+// @Param subject_namespace query string false "Subject namespace"
+// @Param subject_id query string false "Subject ID"
+// @Param userset_namespace query string false "Userset namespace"
+// @Param userset_relation query string false "Userset relation"
+// @Param page_token query string false "Page token returned by the previous page"
+// @Param page_size query int false "Page size" default(100)
+// @Success 200 {object} model.TupleList
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/permissions/zanzibar/tuples [get]
+func (h *PermissionHandler) ReadTuplesZanzibar(c *gin.Context) {
+	var req dto.ReadTuplesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := model.TupleFilter{
+		Namespace:        req.Namespace,
+		ObjectID:         req.ObjectID,
+		Relation:         req.Relation,
+		SubjectNamespace: req.SubjectNamespace,
+		SubjectID:        req.SubjectID,
+		UsersetNamespace: req.UsersetNamespace,
+		UsersetRelation:  req.UsersetRelation,
+	}
+
+	result, err := h.zanzibarRepo.ReadTuples(c.Request.Context(), filter, req.PageToken, req.PageSize)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidPageToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// grantExpiry resolves the end time of a grant from its duration or end time; nil never expires
+func grantExpiry(req dto.GrantPermissionRequest) (*time.Time, error) {
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expires_in: %w", err)
+		}
+		if d <= 0 {
+			return nil, errors.New("expires_in must be positive")
+		}
+		expiresAt := time.Now().Add(d).Truncate(time.Second)
+		return &expiresAt, nil
+	}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return nil, errors.New("expires_at must be in the future")
+		}
+		expiresAt := req.ExpiresAt.Truncate(time.Second)
+		return &expiresAt, nil
+	}
+	return nil, nil
+}
+
+// grantResponse reports a grant together with its remaining validity
+func grantResponse(expiresAt *time.Time) dto.GrantPermissionResponse {
+	return dto.GrantPermissionResponse{
+		Message:          "Permission granted successfully",
+		ExpiresAt:        expiresAt,
+		ExpiresInSeconds: model.SecondsUntil(expiresAt),
+	}
+}
+
+// checkContext attaches the request context of a check, against which the Zanzibar
+// engine evaluates the caveats of conditional tuples
+func checkContext(ctx context.Context, req dto.CheckPermissionRequest) context.Context {
+	if len(req.Context) == 0 {
+		return ctx
+	}
+	return repository.WithCaveatContext(ctx, req.Context)
+}
+
+// tupleFromRequest converts an API tuple into a model tuple
+func tupleFromRequest(t dto.TupleRequest) model.RelationTuple {
+	var caveatContext *string
+	if t.CaveatContext != nil {
+		// Marshalling a map sorts its keys, which is the canonical form
+		raw, _ := json.Marshal(t.CaveatContext)
+		s := string(raw)
+		caveatContext = &s
+	}
+	return model.RelationTuple{
+		Namespace:        t.Namespace,
+		ObjectID:         t.ObjectID,
+		Relation:         t.Relation,
+		SubjectNamespace: t.SubjectNamespace,
+		SubjectID:        t.SubjectID,
+		UsersetNamespace: t.UsersetNamespace,
+		UsersetRelation:  t.UsersetRelation,
+		ExpiresAt:        t.ExpiresAt,
+		CaveatName:       t.CaveatName,
+		CaveatContext:    caveatContext,
+	}
 }
 
 // UpdateDepartmentManagerMySQL updates department manager (MySQL - EXPENSIVE!)
-// @Summary Update department manager (MySQL - triggers full rebuild)
+// @Summary Update department manager (MySQL - queues a full rebuild)
 // @Tags MySQL Permissions
 // @Accept json
 // @Produce json
 // @Param request body dto.UpdateDepartmentManagerRequest true "Update manager request"
-// @Success 200 {object} map[string]interface{}
+// @Param Idempotency-Key header string false "Reusing a key returns the existing job"
+// @Success 202 {object} dto.JobAcceptedResponse
 // @Router /api/v1/permissions/mysql/department/manager [post]
 func (h *PermissionHandler) UpdateDepartmentManagerMySQL(c *gin.Context) {
 	var req dto.UpdateDepartmentManagerRequest
@@ -231,22 +713,178 @@ func (h *PermissionHandler) UpdateDepartmentManagerMySQL(c *gin.Context) {
 		return
 	}
 
-	// Copy values for goroutine - don't use request context
-	departmentID := req.DepartmentID
+	// The rebuild touches millions of rows - it runs on the durable job queue
+	h.enqueueJob(c, service.JobUpdateDepartmentManager, service.UpdateDepartmentManagerPayload{
+		DepartmentID: req.DepartmentID,
+		ManagerID:    req.ManagerID,
+	})
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Department manager update initiated (this will take a while...)",
-		"warning": "This operation will rebuild millions of permission rows",
+// MoveDepartmentMySQL moves a department under a new parent (MySQL - EXPENSIVE!)
+// @Summary Move a department subtree (MySQL - queues relation and permission rebuild)
+// @Tags MySQL Permissions
+// @Accept json
+// @Produce json
+// @Param request body dto.MoveDepartmentRequest true "Move department request"
+// @Param Idempotency-Key header string false "Reusing a key returns the existing job"
+// @Success 202 {object} dto.JobAcceptedResponse
+// @Router /api/v1/permissions/mysql/department/move [post]
+func (h *PermissionHandler) MoveDepartmentMySQL(c *gin.Context) {
+	var req dto.MoveDepartmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.enqueueJob(c, service.JobMoveDepartment, service.MoveDepartmentPayload{
+		DepartmentID: req.DepartmentID,
+		NewParentID:  req.NewParentID,
 	})
+}
+
+// MergeDepartmentsMySQL merges one department into another (MySQL - EXPENSIVE!)
+// @Summary Merge departments (MySQL - queues relation and permission rebuild)
+// @Tags MySQL Permissions
+// @Accept json
+// @Produce json
+// @Param request body dto.MergeDepartmentsRequest true "Merge departments request"
+// @Param Idempotency-Key header string false "Reusing a key returns the existing job"
+// @Success 202 {object} dto.JobAcceptedResponse
+// @Router /api/v1/permissions/mysql/department/merge [post]
+func (h *PermissionHandler) MergeDepartmentsMySQL(c *gin.Context) {
+	var req dto.MergeDepartmentsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.enqueueJob(c, service.JobMergeDepartments, service.MergeDepartmentsPayload{
+		SourceDepartmentID: req.SourceDepartmentID,
+		TargetDepartmentID: req.TargetDepartmentID,
+	})
+}
 
-	// Run in background with background context
-	go func() {
-		ctx := context.Background()
-		if err := h.mysqlRepo.RebuildDepartmentPermissions(ctx, departmentID); err != nil {
-			// Log error - in production, use proper logging
-			fmt.Printf("Error rebuilding department permissions: %v\n", err)
+// SplitDepartmentMySQL splits members out of a department into a new one (MySQL - EXPENSIVE!)
+// @Summary Split a department (MySQL - queues relation and permission rebuild)
+// @Tags MySQL Permissions
+// @Accept json
+// @Produce json
+// @Param request body dto.SplitDepartmentRequest true "Split department request"
+// @Param Idempotency-Key header string false "Reusing a key returns the existing job"
+// @Success 202 {object} dto.JobAcceptedResponse
+// @Router /api/v1/permissions/mysql/department/split [post]
+func (h *PermissionHandler) SplitDepartmentMySQL(c *gin.Context) {
+	var req dto.SplitDepartmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.enqueueJob(c, service.JobSplitDepartment, service.SplitDepartmentPayload{
+		DepartmentID:      req.DepartmentID,
+		NewDepartmentID:   req.NewDepartmentID,
+		NewDepartmentName: req.NewDepartmentName,
+		ManagerID:         req.ManagerID,
+		MemberIDs:         req.MemberIDs,
+	})
+}
+
+// EnqueueJobMySQL queues a background recompute of MySQL expanded permissions
+// @Summary Queue a permission recompute job (MySQL)
+// @Tags MySQL Permissions
+// @Accept json
+// @Produce json
+// @Param request body dto.EnqueueJobRequest true "Job request"
+// @Param Idempotency-Key header string false "Reusing a key returns the existing job"
+// @Success 202 {object} dto.JobAcceptedResponse
+// @Router /api/v1/permissions/mysql/jobs [post]
+func (h *PermissionHandler) EnqueueJobMySQL(c *gin.Context) {
+	var req dto.EnqueueJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.enqueueJob(c, req.JobType, req.Payload)
+}
+
+// GetJobMySQL returns the status and progress of a recompute job
+// @Summary Get permission recompute job status (MySQL)
+// @Tags MySQL Permissions
+// @Produce json
+// @Param id path int true "Job ID"
+// @Success 200 {object} model.PermissionJob
+// @Router /api/v1/permissions/mysql/jobs/{id} [get]
+func (h *PermissionHandler) GetJobMySQL(c *gin.Context) {
+	if h.jobQueue == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "permission job queue is disabled"})
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
+		return
+	}
+
+	job, err := h.jobQueue.Get(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
 		}
-	}()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// GetJobStatsMySQL returns queue depth and the staleness window of the expanded table
+// @Summary Get permission job queue statistics (MySQL)
+// @Tags MySQL Permissions
+// @Produce json
+// @Success 200 {object} model.JobStats
+// @Router /api/v1/permissions/mysql/jobs/stats [get]
+func (h *PermissionHandler) GetJobStatsMySQL(c *gin.Context) {
+	if h.jobQueue == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "permission job queue is disabled"})
+		return
+	}
+
+	stats, err := h.jobQueue.Stats(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// enqueueJob queues a job keyed by the optional Idempotency-Key header and answers 202
+func (h *PermissionHandler) enqueueJob(c *gin.Context, jobType string, payload interface{}) {
+	if h.jobQueue == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "permission job queue is disabled"})
+		return
+	}
+
+	job, created, err := h.jobQueue.Enqueue(c.Request.Context(), jobType, c.GetHeader("Idempotency-Key"), payload)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownJobType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.JobAcceptedResponse{
+		JobID:     job.ID,
+		JobKey:    job.JobKey,
+		Status:    job.Status,
+		Created:   created,
+		StatusURL: fmt.Sprintf("/api/v1/permissions/mysql/jobs/%d", job.ID),
+	})
 }
 
 // UpdateDepartmentManagerZanzibar updates department manager (Zanzibar - FAST!)
@@ -276,6 +914,102 @@ func (h *PermissionHandler) UpdateDepartmentManagerZanzibar(c *gin.Context) {
 	})
 }
 
+// MoveDepartmentZanzibar moves a department under a new parent (Zanzibar - single tuple update)
+// @Summary Move a department subtree (Zanzibar - replaces the department#parent tuple)
+// @Tags Zanzibar Permissions
+// @Accept json
+// @Produce json
+// @Param request body dto.MoveDepartmentRequest true "Move department request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/permissions/zanzibar/department/move [post]
+func (h *PermissionHandler) MoveDepartmentZanzibar(c *gin.Context) {
+	var req dto.MoveDepartmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.zanzibarRepo.MoveDepartment(c.Request.Context(), req.DepartmentID, req.NewParentID)
+	if err != nil {
+		writeDepartmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Department moved successfully",
+	})
+}
+
+// MergeDepartmentsZanzibar merges one department into another (Zanzibar)
+// @Summary Merge departments (Zanzibar - re-points member and parent tuples)
+// @Tags Zanzibar Permissions
+// @Accept json
+// @Produce json
+// @Param request body dto.MergeDepartmentsRequest true "Merge departments request"
+// @Success 200 {object} model.ReorgResult
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/permissions/zanzibar/department/merge [post]
+func (h *PermissionHandler) MergeDepartmentsZanzibar(c *gin.Context) {
+	var req dto.MergeDepartmentsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.zanzibarRepo.MergeDepartments(c.Request.Context(), req.SourceDepartmentID, req.TargetDepartmentID)
+	if err != nil {
+		writeDepartmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// SplitDepartmentZanzibar splits members out of a department into a new one (Zanzibar)
+// @Summary Split a department (Zanzibar - moves member tuples)
+// @Tags Zanzibar Permissions
+// @Accept json
+// @Produce json
+// @Param request body dto.SplitDepartmentRequest true "Split department request"
+// @Success 200 {object} model.ReorgResult
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/permissions/zanzibar/department/split [post]
+func (h *PermissionHandler) SplitDepartmentZanzibar(c *gin.Context) {
+	var req dto.SplitDepartmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.zanzibarRepo.SplitDepartment(c.Request.Context(),
+		req.DepartmentID, req.NewDepartmentID, req.NewDepartmentName, req.ManagerID, req.MemberIDs)
+	if err != nil {
+		writeDepartmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// writeDepartmentError maps department reorganization errors to HTTP status codes
+func writeDepartmentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrDepartmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrDepartmentCycle),
+		errors.Is(err, repository.ErrDepartmentTooDeep),
+		errors.Is(err, repository.ErrDepartmentExists),
+		errors.Is(err, repository.ErrNotDepartmentMember):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 // GetStorageComparison returns storage statistics comparison
 // @Summary Get storage comparison
 // @Tags Comparison
@@ -295,6 +1029,40 @@ func (h *PermissionHandler) GetStorageComparison(c *gin.Context) {
 		return
 	}
 
+	var (
+		encoded             *dto.StorageStats
+		encodedReductionPct float64
+	)
+	if store := h.zanzibarRepo.EncodedTuples(); store != nil {
+		encodedStats, err := store.GetStorageStats(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Encoded tuple stats error: " + err.Error()})
+			return
+		}
+		encoded = &dto.StorageStats{
+			EngineType:  encodedStats.EngineType,
+			TableName:   encodedStats.TableName,
+			RowCount:    encodedStats.RowCount,
+			DataSizeMB:  encodedStats.DataSizeMB,
+			IndexSizeMB: encodedStats.IndexSizeMB,
+			TotalSizeMB: encodedStats.TotalSizeMB,
+		}
+		if zanzibarStats.TotalSizeMB > 0 {
+			encodedReductionPct = (zanzibarStats.TotalSizeMB - encodedStats.TotalSizeMB) / zanzibarStats.TotalSizeMB * 100
+		}
+	}
+
+	var bitmapIndex *dto.BitmapIndexStats
+	if idx := h.zanzibarRepo.BitmapIndex(); idx != nil {
+		stats := idx.Stats()
+		bitmapIndex = &dto.BitmapIndexStats{
+			Users:         stats.Users,
+			Documents:     stats.Documents,
+			MemoryBytes:   stats.MemoryBytes,
+			LastRebuildMs: stats.LastRebuildMs,
+		}
+	}
+
 	reductionPct := 0.0
 	if mysqlStats.RowCount > 0 {
 		reductionPct = float64(mysqlStats.RowCount-zanzibarStats.RowCount) / float64(mysqlStats.RowCount) * 100
@@ -318,6 +1086,10 @@ func (h *PermissionHandler) GetStorageComparison(c *gin.Context) {
 			TotalSizeMB: zanzibarStats.TotalSizeMB,
 		},
 		ReductionPct: reductionPct,
+		BitmapIndex:  bitmapIndex,
+
+		ZanzibarEncoded:     encoded,
+		EncodedReductionPct: encodedReductionPct,
 	})
 }
 
@@ -369,3 +1141,310 @@ func (h *PermissionHandler) ClearZanzibarCache(c *gin.Context) {
 	// Cache removed - no longer needed
 	c.JSON(http.StatusOK, gin.H{"message": "Cache has been removed from the implementation"})
 }
+
+// SoftDeleteEntity soft-deletes a user, document or customer. Both engines stop
+// granting access at once; tuples and expanded rows stay until the purge.
+// @Summary Soft-delete an entity
+// @Tags Entities
+// @Produce json
+// @Param entity path string true "Entity" Enums(user, document, customer)
+// @Param id path string true "Entity ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/entities/{entity}/{id} [delete]
+func (h *PermissionHandler) SoftDeleteEntity(c *gin.Context) {
+	h.changeEntity(c, h.softDeletes.SoftDelete, "soft-deleted")
+}
+
+// RestoreEntity restores a soft-deleted user, document or customer with its access
+// @Summary Restore a soft-deleted entity
+// @Tags Entities
+// @Produce json
+// @Param entity path string true "Entity" Enums(user, document, customer)
+// @Param id path string true "Entity ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/entities/{entity}/{id}/restore [post]
+func (h *PermissionHandler) RestoreEntity(c *gin.Context) {
+	h.changeEntity(c, h.softDeletes.Restore, "restored")
+}
+
+// GetEntityAttributes returns the attributes of a user, document or customer
+// @Summary Get entity attributes
+// @Tags Entities
+// @Produce json
+// @Param entity path string true "Entity" Enums(user, document, customer)
+// @Param id path string true "Entity ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/entities/{entity}/{id}/attributes [get]
+func (h *PermissionHandler) GetEntityAttributes(c *gin.Context) {
+	entity, id := c.Param("entity"), c.Param("id")
+
+	attrs, err := h.attributes.Attributes(c.Request.Context(), entity, id)
+	if err != nil {
+		entityError(c, err)
+		return
+	}
+	if attrs == nil {
+		attrs = model.Attributes{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entity":     entity,
+		"id":         id,
+		"attributes": attrs,
+	})
+}
+
+// SetEntityAttributes replaces the attributes of a user, document or customer that
+// attribute rules reference; both engines apply the change on the next check
+// @Summary Replace entity attributes
+// @Tags Entities
+// @Accept json
+// @Produce json
+// @Param entity path string true "Entity" Enums(user, document, customer)
+// @Param id path string true "Entity ID"
+// @Param request body dto.SetAttributesRequest true "Attributes"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/entities/{entity}/{id}/attributes [put]
+func (h *PermissionHandler) SetEntityAttributes(c *gin.Context) {
+	entity, id := c.Param("entity"), c.Param("id")
+
+	var req dto.SetAttributesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.attributes.SetAttributes(c.Request.Context(), entity, id, req.Attributes); err != nil {
+		entityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    fmt.Sprintf("%s %s attributes updated", entity, id),
+		"entity":     entity,
+		"id":         id,
+		"attributes": req.Attributes,
+	})
+}
+
+// AddCustomerFollowerMySQL adds the expanded rows of a customer follower (MySQL)
+// @Summary Add customer follower (MySQL)
+// @Tags MySQL Permissions
+// @Accept json
+// @Produce json
+// @Param request body dto.AddCustomerFollowerRequest true "Add customer follower request"
+// @Success 200 {object} dto.AddCustomerFollowerResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/permissions/mysql/customers/followers [post]
+func (h *PermissionHandler) AddCustomerFollowerMySQL(c *gin.Context) {
+	h.addCustomerFollower(c, h.mysqlRepo.FollowConflicts, h.mysqlRepo.AddCustomerFollowerPermissions, false)
+}
+
+// OverrideCustomerFollowerMySQL adds a follower of a competing customer on behalf of the authenticated superuser (MySQL)
+// @Summary Add customer follower across an ethical wall (MySQL)
+// @Tags MySQL Permissions
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body dto.AddCustomerFollowerRequest true "Add customer follower request"
+// @Success 200 {object} dto.AddCustomerFollowerResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /api/v1/permissions/mysql/customers/followers/override [post]
+func (h *PermissionHandler) OverrideCustomerFollowerMySQL(c *gin.Context) {
+	h.addCustomerFollower(c, h.mysqlRepo.FollowConflicts, h.mysqlRepo.AddCustomerFollowerPermissions, true)
+}
+
+// AddCustomerFollowerZanzibar adds a follower tuple to a customer (Zanzibar)
+// @Summary Add customer follower (Zanzibar)
+// @Tags Zanzibar Permissions
+// @Accept json
+// @Produce json
+// @Param request body dto.AddCustomerFollowerRequest true "Add customer follower request"
+// @Success 200 {object} dto.AddCustomerFollowerResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/permissions/zanzibar/customers/followers [post]
+func (h *PermissionHandler) AddCustomerFollowerZanzibar(c *gin.Context) {
+	h.addCustomerFollower(c, h.zanzibarRepo.FollowConflicts, h.zanzibarRepo.AddCustomerFollower, false)
+}
+
+// OverrideCustomerFollowerZanzibar adds a follower of a competing customer on behalf of the authenticated superuser (Zanzibar)
+// @Summary Add customer follower across an ethical wall (Zanzibar)
+// @Tags Zanzibar Permissions
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body dto.AddCustomerFollowerRequest true "Add customer follower request"
+// @Success 200 {object} dto.AddCustomerFollowerResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /api/v1/permissions/zanzibar/customers/followers/override [post]
+func (h *PermissionHandler) OverrideCustomerFollowerZanzibar(c *gin.Context) {
+	h.addCustomerFollower(c, h.zanzibarRepo.FollowConflicts, h.zanzibarRepo.AddCustomerFollower, true)
+}
+
+// addCustomerFollower adds a follower with follow. With ethical walls a follower of a
+// competing customer is refused unless override is set, in which case the authenticated
+// user (set by the auth middleware) must be a superuser; the competing customers are
+// reported either way.
+func (h *PermissionHandler) addCustomerFollower(
+	c *gin.Context,
+	conflictsOf func(ctx context.Context, customerID, userID string) ([]string, error),
+	follow func(ctx context.Context, customerID, userID string) error,
+	override bool,
+) {
+	var req dto.AddCustomerFollowerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var adminID string
+	if override {
+		adminID = c.GetString("userID")
+		if adminID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "an override requires an authenticated superuser"})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	conflicts, err := conflictsOf(ctx, req.CustomerID, req.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if adminID != "" {
+		ctx = repository.WithConflictOverride(ctx, adminID)
+	}
+
+	if err := follow(ctx, req.CustomerID, req.UserID); err != nil {
+		entityError(c, err)
+		return
+	}
+
+	resp := dto.AddCustomerFollowerResponse{
+		Message:   fmt.Sprintf("user %s follows customer %s", req.UserID, req.CustomerID),
+		Conflicts: conflicts,
+	}
+	if len(conflicts) > 0 {
+		resp.OverriddenBy = adminID
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListConflictGroups returns the customers of every conflict group
+// @Summary List customer conflict groups
+// @Tags Customers
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/customers/conflict-groups [get]
+func (h *PermissionHandler) ListConflictGroups(c *gin.Context) {
+	groups, err := h.conflicts.Groups(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"groups": groups})
+}
+
+// SetConflictGroup replaces the customers of a conflict group; ethical walls apply the
+// change on the next check in both engines
+// @Summary Replace a customer conflict group
+// @Tags Customers
+// @Accept json
+// @Produce json
+// @Param group_id path string true "Conflict group ID"
+// @Param request body dto.SetConflictGroupRequest true "Competing customers"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/customers/conflict-groups/{group_id} [put]
+func (h *PermissionHandler) SetConflictGroup(c *gin.Context) {
+	groupID := c.Param("group_id")
+
+	var req dto.SetConflictGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.conflicts.SetGroup(c.Request.Context(), groupID, req.CustomerIDs); err != nil {
+		entityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      fmt.Sprintf("conflict group %s updated", groupID),
+		"group_id":     groupID,
+		"customer_ids": req.CustomerIDs,
+	})
+}
+
+// DeleteConflictGroup removes a conflict group, lifting the walls between its customers
+// @Summary Delete a customer conflict group
+// @Tags Customers
+// @Produce json
+// @Param group_id path string true "Conflict group ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/customers/conflict-groups/{group_id} [delete]
+func (h *PermissionHandler) DeleteConflictGroup(c *gin.Context) {
+	groupID := c.Param("group_id")
+
+	if err := h.conflicts.DeleteGroup(c.Request.Context(), groupID); err != nil {
+		entityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  fmt.Sprintf("conflict group %s deleted", groupID),
+		"group_id": groupID,
+	})
+}
+
+func (h *PermissionHandler) changeEntity(c *gin.Context, change func(ctx context.Context, entity, id string) error, verb string) {
+	entity, id := c.Param("entity"), c.Param("id")
+
+	if err := change(c.Request.Context(), entity, id); err != nil {
+		entityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("%s %s %s", entity, id, verb),
+		"entity":  entity,
+		"id":      id,
+	})
+}
+
+// entityError maps errors of entity operations to HTTP statuses
+func entityError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrUnknownEntity), errors.Is(err, repository.ErrInvalidConflictGroup):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrConflictOverrideDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrCustomerConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrEntityNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
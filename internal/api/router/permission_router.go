@@ -4,10 +4,12 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/d60-Lab/gin-template/internal/api/handler"
+	"github.com/d60-Lab/gin-template/internal/api/middleware"
+	"github.com/d60-Lab/gin-template/pkg/config"
 )
 
 // SetupPermissionRoutes sets up all permission-related routes
-func SetupPermissionRoutes(r *gin.Engine, permissionHandler *handler.PermissionHandler) {
+func SetupPermissionRoutes(r *gin.Engine, permissionHandler *handler.PermissionHandler, cfg *config.Config) {
 	// API v1 group
 	v1 := r.Group("/api/v1")
 	{
@@ -17,7 +19,15 @@ func SetupPermissionRoutes(r *gin.Engine, permissionHandler *handler.PermissionH
 			mysql.POST("/check", permissionHandler.CheckPermissionMySQL)
 			mysql.GET("/users/:user_id/documents", permissionHandler.GetUserDocumentsMySQL)
 			mysql.POST("/grant", permissionHandler.GrantPermissionMySQL)
+			mysql.POST("/customers/followers", permissionHandler.AddCustomerFollowerMySQL)
+			mysql.POST("/customers/followers/override", middleware.Auth(cfg), middleware.AdminOnly(), permissionHandler.OverrideCustomerFollowerMySQL)
 			mysql.POST("/department/manager", permissionHandler.UpdateDepartmentManagerMySQL)
+			mysql.POST("/department/move", permissionHandler.MoveDepartmentMySQL)
+			mysql.POST("/department/merge", permissionHandler.MergeDepartmentsMySQL)
+			mysql.POST("/department/split", permissionHandler.SplitDepartmentMySQL)
+			mysql.POST("/jobs", permissionHandler.EnqueueJobMySQL)
+			mysql.GET("/jobs/stats", permissionHandler.GetJobStatsMySQL)
+			mysql.GET("/jobs/:id", permissionHandler.GetJobMySQL)
 			mysql.GET("/stats", permissionHandler.GetPermissionStatsMySQL)
 		}
 
@@ -26,10 +36,20 @@ func SetupPermissionRoutes(r *gin.Engine, permissionHandler *handler.PermissionH
 		{
 			zanzibar.POST("/check", permissionHandler.CheckPermissionZanzibar)
 			zanzibar.GET("/users/:user_id/documents", permissionHandler.GetUserDocumentsZanzibar)
+			zanzibar.GET("/users/:user_id/documents/count", permissionHandler.CountUserDocumentsZanzibar)
 			zanzibar.POST("/grant", permissionHandler.GrantPermissionZanzibar)
+			zanzibar.POST("/customers/followers", permissionHandler.AddCustomerFollowerZanzibar)
+			zanzibar.POST("/customers/followers/override", middleware.Auth(cfg), middleware.AdminOnly(), permissionHandler.OverrideCustomerFollowerZanzibar)
+			zanzibar.POST("/tuples", permissionHandler.WriteTuplesZanzibar)
+			zanzibar.GET("/tuples", permissionHandler.ReadTuplesZanzibar)
 			zanzibar.POST("/department/manager", permissionHandler.UpdateDepartmentManagerZanzibar)
+			zanzibar.POST("/department/move", permissionHandler.MoveDepartmentZanzibar)
+			zanzibar.POST("/department/merge", permissionHandler.MergeDepartmentsZanzibar)
+			zanzibar.POST("/department/split", permissionHandler.SplitDepartmentZanzibar)
 			zanzibar.GET("/stats", permissionHandler.GetTupleStatsZanzibar)
 			zanzibar.POST("/cache/clear", permissionHandler.ClearZanzibarCache)
+			zanzibar.GET("/bitmap-index", permissionHandler.GetBitmapIndexStatsZanzibar)
+			zanzibar.POST("/bitmap-index/rebuild", permissionHandler.RebuildBitmapIndexZanzibar)
 		}
 
 		// Comparison Routes
@@ -38,7 +58,46 @@ func SetupPermissionRoutes(r *gin.Engine, permissionHandler *handler.PermissionH
 			comparison.GET("/storage", permissionHandler.GetStorageComparison)
 		}
 
+		// Soft delete: both engines ignore soft-deleted users, documents and customers;
+		// tuples and expanded rows are purged by the purge_soft_deleted job.
+		// Attributes of the entities are what attribute rules reference.
+		entities := v1.Group("/entities")
+		{
+			entities.DELETE("/:entity/:id", permissionHandler.SoftDeleteEntity)
+			entities.POST("/:entity/:id/restore", permissionHandler.RestoreEntity)
+			entities.GET("/:entity/:id/attributes", permissionHandler.GetEntityAttributes)
+			entities.PUT("/:entity/:id/attributes", permissionHandler.SetEntityAttributes)
+		}
+
+		// Ethical walls: customers of a conflict group compete, and followers of one
+		// do not see documents of the others in either engine
+		customers := v1.Group("/customers")
+		{
+			customers.GET("/conflict-groups", permissionHandler.ListConflictGroups)
+			customers.PUT("/conflict-groups/:group_id", permissionHandler.SetConflictGroup)
+			customers.DELETE("/conflict-groups/:group_id", permissionHandler.DeleteConflictGroup)
+		}
+
 		// Both engines comparison
 		v1.POST("/permissions/both/check", permissionHandler.CheckPermissionBoth)
+
+		// Shadow mode: primary engine answers, the other is evaluated asynchronously
+		shadow := v1.Group("/permissions/shadow")
+		{
+			shadow.POST("/check", permissionHandler.CheckPermissionShadow)
+			shadow.GET("/stats", permissionHandler.GetShadowStats)
+			shadow.GET("/mismatches", permissionHandler.ListShadowMismatches)
+		}
+
+		// Cutover: the engine is picked per request by percentage and allow/deny lists
+		v1.POST("/permissions/check", permissionHandler.CheckPermissionRouted)
+		v1.GET("/permissions/users/:user_id/documents", permissionHandler.GetUserDocumentsRouted)
+		cutover := v1.Group("/permissions/cutover")
+		{
+			cutover.GET("", permissionHandler.GetCutoverStats)
+			cutover.PUT("", permissionHandler.UpdateCutoverRules)
+			cutover.POST("/rollback", permissionHandler.RollbackCutover)
+			cutover.POST("/resume", permissionHandler.ResumeCutover)
+		}
 	}
 }
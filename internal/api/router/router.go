@@ -10,6 +10,7 @@ import (
 	"github.com/d60-Lab/gin-template/internal/api/handler"
 	"github.com/d60-Lab/gin-template/internal/api/middleware"
 	"github.com/d60-Lab/gin-template/pkg/config"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
 )
 
 // Setup 设置路由
@@ -36,6 +37,16 @@ func Setup(r *gin.Engine, h *handler.Handler, cfg *config.Config) {
 		middleware.Pprof(r)
 	}
 
+	// 可选的 Prometheus 指标
+	if cfg.Metrics.Enabled {
+		path := cfg.Metrics.Path
+		if path == "" {
+			path = "/metrics"
+		}
+		r.Use(middleware.Metrics())
+		r.GET(path, gin.WrapH(metrics.Handler()))
+	}
+
 	// Swagger 文档
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
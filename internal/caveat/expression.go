@@ -0,0 +1,819 @@
+// Package caveat implements the condition language of conditional tuples.
+//
+// An expression is a side-effect free boolean formula over named values:
+//
+//	ip_in_cidr(client_ip, cidr) && purpose in ["audit", "legal"]
+//	now() >= window_start && now() < window_end
+//
+// Supported are string, number and boolean literals, list literals, identifiers
+// (which may be dotted, as in user.clearance), parentheses, the operators ! && || == != < <= > >= and in, and the functions
+// ip_in_cidr, now and timestamp. Strings in RFC 3339 format compare as times when
+// the other operand is a time. There are no loops, assignments or user-defined
+// functions, so evaluation always terminates and cannot reach outside its inputs.
+//
+// Evaluation uses three-valued logic: a value that is neither bound nor supplied
+// is missing, and a formula that depends on it is undecided rather than false.
+// && and || still decide when the known operand settles the result.
+package caveat
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxExpressionLength and maxExpressionDepth bound the size of a compiled expression
+const (
+	maxExpressionLength = 4096
+	maxExpressionDepth  = 32
+)
+
+// ErrInvalidExpression is returned for expressions that do not compile
+var ErrInvalidExpression = errors.New("invalid caveat expression")
+
+// ErrEvaluation is returned when an expression cannot be evaluated, e.g. because
+// an operand has the wrong type
+var ErrEvaluation = errors.New("caveat evaluation failed")
+
+// Expression is a compiled caveat expression; it is safe for concurrent use
+type Expression struct {
+	source      string
+	root        node
+	identifiers []string
+}
+
+// Result is the outcome of an evaluation. With Missing set the expression is
+// undecided and Satisfied is false.
+type Result struct {
+	Satisfied bool
+	Missing   []string // Sorted names of the values the result depends on but were not given
+}
+
+// Decided reports whether the expression evaluated to true or false
+func (r Result) Decided() bool {
+	return len(r.Missing) == 0
+}
+
+// Compile parses source into an expression
+func Compile(source string) (*Expression, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, fmt.Errorf("%w: empty expression", ErrInvalidExpression)
+	}
+	if len(source) > maxExpressionLength {
+		return nil, fmt.Errorf("%w: longer than %d bytes", ErrInvalidExpression, maxExpressionLength)
+	}
+
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExpression, err)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr(0)
+	if err == nil && p.peek().kind != tokenEOF {
+		err = fmt.Errorf("unexpected %s at offset %d", p.peek(), p.peek().pos)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExpression, err)
+	}
+
+	seen := make(map[string]bool)
+	collectIdentifiers(root, seen)
+	identifiers := make([]string, 0, len(seen))
+	for name := range seen {
+		identifiers = append(identifiers, name)
+	}
+	sort.Strings(identifiers)
+
+	return &Expression{source: source, root: root, identifiers: identifiers}, nil
+}
+
+// String returns the source of the expression
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Identifiers returns the sorted names the expression refers to
+func (e *Expression) Identifiers() []string {
+	return e.identifiers
+}
+
+// Evaluate evaluates the expression with vars. Values may be strings, booleans,
+// numbers, times or lists of those, as produced by decoding JSON.
+func (e *Expression) Evaluate(vars map[string]interface{}) (Result, error) {
+	v, err := e.root.eval(vars)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrEvaluation, err)
+	}
+	if len(v.missing) > 0 {
+		return Result{Missing: sortedNames(v.missing)}, nil
+	}
+	b, ok := v.val.(bool)
+	if !ok {
+		return Result{}, fmt.Errorf("%w: expression yields %s, not a boolean", ErrEvaluation, typeName(v.val))
+	}
+	return Result{Satisfied: b}, nil
+}
+
+// =====================================================
+// Lexer
+// =====================================================
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// operators are matched longest first
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!"}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentPart(src[i]) || src[i] == '.' && i+1 < len(src) && isIdentStart(src[i+1])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: src[start:i], pos: start})
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			start := i
+			i++
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.') {
+				i++
+			}
+			num, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at offset %d", src[start:i], start)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[start:i], num: num, pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for ; i < len(src) && src[i] != c; i++ {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					default:
+						sb.WriteByte(src[i])
+					}
+					continue
+				}
+				sb.WriteByte(src[i])
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: start})
+		case strings.ContainsRune("()[],", rune(c)):
+			tokens = append(tokens, token{kind: tokenPunct, text: string(c), pos: i})
+			i++
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
+
+// =====================================================
+// Parser
+// =====================================================
+
+// parser is a recursive descent parser over the grammar
+//
+//	or      = and { "||" and }
+//	and     = not { "&&" not }
+//	not     = "!" not | compare
+//	compare = primary [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" | "in" ) primary ]
+//	primary = literal | identifier | call | list | "(" or ")"
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(kind tokenKind, text string) bool {
+	if t := p.peek(); t.kind == kind && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	if !p.accept(kind, text) {
+		return fmt.Errorf("expected %q at offset %d, found %s", text, p.peek().pos, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) parseOr(depth int) (node, error) {
+	if depth > maxExpressionDepth {
+		return nil, fmt.Errorf("nested deeper than %d levels", maxExpressionDepth)
+	}
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokenOperator, "||") {
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd(depth int) (node, error) {
+	left, err := p.parseNot(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokenOperator, "&&") {
+		right, err := p.parseNot(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot(depth int) (node, error) {
+	if p.accept(tokenOperator, "!") {
+		if depth > maxExpressionDepth {
+			return nil, fmt.Errorf("nested deeper than %d levels", maxExpressionDepth)
+		}
+		operand, err := p.parseNot(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseCompare(depth)
+}
+
+func (p *parser) parseCompare(depth int) (node, error) {
+	left, err := p.parsePrimary(depth)
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.kind == tokenOperator && t.text != "&&" && t.text != "||" && t.text != "!",
+		t.kind == tokenIdent && t.text == "in":
+		p.next()
+		right, err := p.parsePrimary(depth)
+		if err != nil {
+			return nil, err
+		}
+		return &compareNode{op: t.text, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parsePrimary(depth int) (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return &literalNode{val: t.num}, nil
+	case tokenString:
+		return &literalNode{val: t.text}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{val: true}, nil
+		case "false":
+			return &literalNode{val: false}, nil
+		case "in":
+			return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+		}
+		if p.accept(tokenPunct, "(") {
+			return p.parseCall(t, depth)
+		}
+		return &identNode{name: t.text}, nil
+	case tokenPunct:
+		switch t.text {
+		case "(":
+			inner, err := p.parseOr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(tokenPunct, ")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		case "[":
+			items, err := p.parseArgs("]", depth)
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{items: items}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s at offset %d", t, t.pos)
+}
+
+func (p *parser) parseCall(name token, depth int) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at offset %d", name.text, name.pos)
+	}
+	args, err := p.parseArgs(")", depth)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != fn.arity {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", name.text, fn.arity, len(args))
+	}
+	return &callNode{name: name.text, fn: fn, args: args}, nil
+}
+
+// parseArgs parses a comma separated list of expressions up to the closing token
+func (p *parser) parseArgs(closing string, depth int) ([]node, error) {
+	var items []node
+	if p.accept(tokenPunct, closing) {
+		return items, nil
+	}
+	for {
+		item, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if p.accept(tokenPunct, closing) {
+			return items, nil
+		}
+		if err := p.expect(tokenPunct, ","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// =====================================================
+// Evaluation
+// =====================================================
+
+// value is an evaluated operand; with missing set the value is unknown
+type value struct {
+	val     interface{}
+	missing map[string]bool
+}
+
+func known(v interface{}) value {
+	return value{val: v}
+}
+
+// unknownOf merges the missing names of vs
+func unknownOf(vs ...value) value {
+	missing := make(map[string]bool)
+	for _, v := range vs {
+		for name := range v.missing {
+			missing[name] = true
+		}
+	}
+	return value{missing: missing}
+}
+
+type node interface {
+	eval(vars map[string]interface{}) (value, error)
+}
+
+type literalNode struct {
+	val interface{}
+}
+
+func (n *literalNode) eval(map[string]interface{}) (value, error) {
+	return known(n.val), nil
+}
+
+type identNode struct {
+	name string
+}
+
+func (n *identNode) eval(vars map[string]interface{}) (value, error) {
+	v, ok := vars[n.name]
+	if !ok || v == nil {
+		return value{missing: map[string]bool{n.name: true}}, nil
+	}
+	return known(normalize(v)), nil
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n *listNode) eval(vars map[string]interface{}) (value, error) {
+	items := make([]interface{}, len(n.items))
+	var unknown []value
+	for i, item := range n.items {
+		v, err := item.eval(vars)
+		if err != nil {
+			return value{}, err
+		}
+		if len(v.missing) > 0 {
+			unknown = append(unknown, v)
+		}
+		items[i] = v.val
+	}
+	if len(unknown) > 0 {
+		return unknownOf(unknown...), nil
+	}
+	return known(items), nil
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) eval(vars map[string]interface{}) (value, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil || len(v.missing) > 0 {
+		return v, err
+	}
+	b, ok := v.val.(bool)
+	if !ok {
+		return value{}, fmt.Errorf("! needs a boolean, got %s", typeName(v.val))
+	}
+	return known(!b), nil
+}
+
+// logicalNode evaluates && and || with Kleene logic: a known operand that
+// settles the result wins over a missing one
+type logicalNode struct {
+	op          string
+	left, right node
+}
+
+func (n *logicalNode) eval(vars map[string]interface{}) (value, error) {
+	// The result is settled by false for && and by true for ||
+	settles := n.op == "||"
+
+	operands := make([]value, 0, 2)
+	for _, operand := range []node{n.left, n.right} {
+		v, err := operand.eval(vars)
+		if err != nil {
+			return value{}, err
+		}
+		if len(v.missing) == 0 {
+			b, ok := v.val.(bool)
+			if !ok {
+				return value{}, fmt.Errorf("%s needs booleans, got %s", n.op, typeName(v.val))
+			}
+			if b == settles {
+				return known(settles), nil
+			}
+		}
+		operands = append(operands, v)
+	}
+	if len(operands[0].missing) > 0 || len(operands[1].missing) > 0 {
+		return unknownOf(operands...), nil
+	}
+	return known(!settles), nil
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n *compareNode) eval(vars map[string]interface{}) (value, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return value{}, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return value{}, err
+	}
+	if len(left.missing) > 0 || len(right.missing) > 0 {
+		return unknownOf(left, right), nil
+	}
+
+	if n.op == "in" {
+		list, ok := right.val.([]interface{})
+		if !ok {
+			return value{}, fmt.Errorf("in needs a list on the right, got %s", typeName(right.val))
+		}
+		for _, item := range list {
+			if c, err := compare(left.val, item); err == nil && c == 0 {
+				return known(true), nil
+			}
+		}
+		return known(false), nil
+	}
+
+	c, err := compare(left.val, right.val)
+	if err != nil {
+		if n.op == "==" || n.op == "!=" {
+			// Values of different types are never equal
+			return known(n.op == "!="), nil
+		}
+		return value{}, err
+	}
+	switch n.op {
+	case "==":
+		return known(c == 0), nil
+	case "!=":
+		return known(c != 0), nil
+	case "<":
+		return known(c < 0), nil
+	case "<=":
+		return known(c <= 0), nil
+	case ">":
+		return known(c > 0), nil
+	default:
+		return known(c >= 0), nil
+	}
+}
+
+// compare orders two values of the same type; RFC 3339 strings compare as times
+// against times
+func compare(a, b interface{}) (int, error) {
+	if t, ok := a.(time.Time); ok {
+		if s, ok := b.(string); ok {
+			parsed, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return 0, fmt.Errorf("cannot compare a time with %q", s)
+			}
+			b = parsed
+		}
+		if u, ok := b.(time.Time); ok {
+			return t.Compare(u), nil
+		}
+	}
+	if _, ok := b.(time.Time); ok {
+		if _, ok := a.(string); ok {
+			c, err := compare(b, a)
+			return -c, err
+		}
+	}
+
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+	case float64:
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1, nil
+			case x > y:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			if x == y {
+				return 0, nil
+			}
+			return 0, fmt.Errorf("booleans are not ordered")
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s with %s", typeName(a), typeName(b))
+}
+
+// =====================================================
+// Functions
+// =====================================================
+
+type function struct {
+	arity int
+	call  func(args []interface{}) (interface{}, error)
+}
+
+// functions are the only calls an expression can make
+var functions = map[string]function{
+	// ip_in_cidr(ip, cidr) reports whether ip lies in cidr, or in any of a list of ranges
+	"ip_in_cidr": {arity: 2, call: ipInCIDR},
+	// now() returns the time of the evaluation
+	"now": {arity: 0, call: func([]interface{}) (interface{}, error) { return time.Now(), nil }},
+	// timestamp(s) parses an RFC 3339 time
+	"timestamp": {arity: 1, call: func(args []interface{}) (interface{}, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("timestamp needs a string, got %s", typeName(args[0]))
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", s)
+		}
+		return t, nil
+	}},
+}
+
+func ipInCIDR(args []interface{}) (interface{}, error) {
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("ip_in_cidr needs an IP string, got %s", typeName(args[0]))
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		// A malformed client address is outside every range
+		return false, nil
+	}
+
+	ranges, ok := args[1].([]interface{})
+	if !ok {
+		ranges = []interface{}{args[1]}
+	}
+	for _, r := range ranges {
+		cidr, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("ip_in_cidr needs CIDR strings, got %s", typeName(r))
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", cidr)
+		}
+		if network.Contains(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type callNode struct {
+	name string
+	fn   function
+	args []node
+}
+
+func (n *callNode) eval(vars map[string]interface{}) (value, error) {
+	args := make([]interface{}, len(n.args))
+	var unknown []value
+	for i, arg := range n.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return value{}, err
+		}
+		if len(v.missing) > 0 {
+			unknown = append(unknown, v)
+		}
+		args[i] = v.val
+	}
+	if len(unknown) > 0 {
+		return unknownOf(unknown...), nil
+	}
+	result, err := n.fn.call(args)
+	if err != nil {
+		return value{}, err
+	}
+	return known(result), nil
+}
+
+// =====================================================
+// Helpers
+// =====================================================
+
+// normalize converts Go values to the types expressions operate on
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case int:
+		return float64(x)
+	case int32:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case uint:
+		return float64(x)
+	case uint32:
+		return float64(x)
+	case uint64:
+		return float64(x)
+	case float32:
+		return float64(x)
+	case []string:
+		items := make([]interface{}, len(x))
+		for i, s := range x {
+			items[i] = s
+		}
+		return items
+	case []interface{}:
+		items := make([]interface{}, len(x))
+		for i, item := range x {
+			items[i] = normalize(item)
+		}
+		return items
+	}
+	return v
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case time.Time:
+		return "time"
+	case []interface{}:
+		return "list"
+	case nil:
+		return "nothing"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func collectIdentifiers(n node, seen map[string]bool) {
+	switch x := n.(type) {
+	case *identNode:
+		seen[x.name] = true
+	case *listNode:
+		for _, item := range x.items {
+			collectIdentifiers(item, seen)
+		}
+	case *notNode:
+		collectIdentifiers(x.operand, seen)
+	case *logicalNode:
+		collectIdentifiers(x.left, seen)
+		collectIdentifiers(x.right, seen)
+	case *compareNode:
+		collectIdentifiers(x.left, seen)
+		collectIdentifiers(x.right, seen)
+	case *callNode:
+		for _, arg := range x.args {
+			collectIdentifiers(arg, seen)
+		}
+	}
+}
+
+func sortedNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
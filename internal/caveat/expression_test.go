@@ -0,0 +1,150 @@
+package caveat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		expr    string
+		vars    map[string]interface{}
+		want    bool
+		missing []string
+	}{
+		{
+			name: "ip in range",
+			expr: `ip_in_cidr(client_ip, cidr)`,
+			vars: map[string]interface{}{"client_ip": "10.1.2.3", "cidr": "10.0.0.0/8"},
+			want: true,
+		},
+		{
+			name: "ip outside every range",
+			expr: `ip_in_cidr(client_ip, cidrs)`,
+			vars: map[string]interface{}{"client_ip": "192.168.1.1", "cidrs": []interface{}{"10.0.0.0/8", "172.16.0.0/12"}},
+			want: false,
+		},
+		{
+			name: "inside the window",
+			expr: `now() >= window_start && now() < window_end`,
+			vars: map[string]interface{}{
+				"window_start": now.Add(-time.Hour).Format(time.RFC3339),
+				"window_end":   now.Add(time.Hour).Format(time.RFC3339),
+			},
+			want: true,
+		},
+		{
+			name: "after the window",
+			expr: `now() < timestamp(window_end)`,
+			vars: map[string]interface{}{"window_end": now.Add(-time.Hour).Format(time.RFC3339)},
+			want: false,
+		},
+		{
+			name: "purpose in list",
+			expr: `purpose in ["audit", 'legal'] && !(level > 3)`,
+			vars: map[string]interface{}{"purpose": "audit", "level": 2},
+			want: true,
+		},
+		{
+			name:    "missing context",
+			expr:    `purpose == "audit"`,
+			vars:    map[string]interface{}{},
+			missing: []string{"purpose"},
+		},
+		{
+			name:    "missing on both sides",
+			expr:    `ip_in_cidr(client_ip, cidr) && purpose == "audit"`,
+			vars:    map[string]interface{}{"cidr": "10.0.0.0/8"},
+			missing: []string{"client_ip", "purpose"},
+		},
+		{
+			name: "false operand settles and",
+			expr: `purpose == "audit" && ip_in_cidr(client_ip, cidr)`,
+			vars: map[string]interface{}{"client_ip": "192.168.1.1", "cidr": "10.0.0.0/8"},
+			want: false,
+		},
+		{
+			name: "true operand settles or",
+			expr: `purpose == "audit" || ip_in_cidr(client_ip, cidr)`,
+			vars: map[string]interface{}{"client_ip": "10.0.0.1", "cidr": "10.0.0.0/8"},
+			want: true,
+		},
+		{
+			name: "dotted identifiers",
+			expr: `user.clearance >= document.classification`,
+			vars: map[string]interface{}{"user.clearance": 3, "document.classification": 2.0},
+			want: true,
+		},
+		{
+			name: "different types are not equal",
+			expr: `level == "2"`,
+			vars: map[string]interface{}{"level": 2.0},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Compile(tt.expr)
+			require.NoError(t, err)
+
+			result, err := expr.Evaluate(tt.vars)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, result.Satisfied)
+			assert.Equal(t, tt.missing, result.Missing)
+			assert.Equal(t, len(tt.missing) == 0, result.Decided())
+		})
+	}
+}
+
+func TestCompile_Identifiers(t *testing.T) {
+	expr, err := Compile(`ip_in_cidr(client_ip, cidr) || purpose in [a, "b"] || purpose == "x"`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "cidr", "client_ip", "purpose"}, expr.Identifiers())
+}
+
+func TestCompile_Invalid(t *testing.T) {
+	inputs := []string{
+		"",
+		"purpose ==",
+		"(purpose == 'audit'",
+		"purpose == 'audit",
+		"a && || b",
+		"exec('rm -rf /')",
+		"now(1)",
+		"a = b",
+		"a b",
+		"in == 1",
+		"user. == 1",
+		"user..clearance == 1",
+	}
+
+	for _, input := range inputs {
+		_, err := Compile(input)
+		assert.ErrorIs(t, err, ErrInvalidExpression, "input %q should be rejected", input)
+	}
+}
+
+func TestEvaluate_TypeErrors(t *testing.T) {
+	inputs := []string{
+		`purpose`,
+		`!purpose`,
+		`purpose && true`,
+		`purpose < 3`,
+		`purpose in "audit"`,
+		`ip_in_cidr(client_ip, "not-a-cidr")`,
+	}
+
+	vars := map[string]interface{}{"purpose": "audit", "client_ip": "10.0.0.1"}
+	for _, input := range inputs {
+		expr, err := Compile(input)
+		require.NoError(t, err, input)
+		_, err = expr.Evaluate(vars)
+		assert.ErrorIs(t, err, ErrEvaluation, "input %q should fail", input)
+	}
+}
@@ -0,0 +1,185 @@
+package caveat
+
+import "strings"
+
+// Column maps an identifier to a SQL expression that yields a MySQL JSON value,
+// e.g. JSON_EXTRACT(documents.attributes, '$.classification'). The expression must
+// not take parameters. It reports false for identifiers not read from a column.
+type Column func(name string) (string, bool)
+
+// numericJSONTypes are the JSON_TYPE results of JSON numbers
+const numericJSONTypes = "'INTEGER', 'UNSIGNED INTEGER', 'DOUBLE', 'DECIMAL'"
+
+// flippedOperators turn "value op column" into "column op value"
+var flippedOperators = map[string]string{
+	"==": "==", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<=",
+}
+
+// MySQLFilter translates the expression into a MySQL condition over the columns
+// named by column; every other identifier takes its value from vars. A row matches
+// only if Evaluate over vars and the values of the row would be satisfied: missing
+// values are NULL and an undecided condition does not match. Where the two differ
+// the condition is stricter: a row whose column is ordered against a value of
+// another type, which Evaluate rejects, never matches.
+//
+// ok is false when part of the expression has no translation, such as a function
+// applied to a column, a comparison of two columns, a comparison of a column with
+// a boolean, a time or a list, or a part without columns that fails to evaluate.
+func (e *Expression) MySQLFilter(vars map[string]interface{}, column Column) (condition string, args []interface{}, ok bool) {
+	t := &sqlTranslator{vars: vars, column: column}
+	condition, ok = t.condition(e.root)
+	if !ok {
+		return "", nil, false
+	}
+	if len(t.typeErrors) > 0 {
+		condition = "(" + condition + ") AND NOT (" + strings.Join(t.typeErrors, " OR ") + ")"
+	}
+	return condition, t.args, true
+}
+
+// sqlTranslator collects the parameters and type checks of a translation
+type sqlTranslator struct {
+	vars       map[string]interface{}
+	column     Column
+	args       []interface{}
+	typeErrors []string // Conditions under which Evaluate would reject an ordering
+}
+
+// readsColumn reports whether n refers to a column anywhere
+func (t *sqlTranslator) readsColumn(n node) bool {
+	seen := make(map[string]bool)
+	collectIdentifiers(n, seen)
+	for name := range seen {
+		if _, ok := t.column(name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// columnOf returns the column expression of n if n is an identifier read from a column
+func (t *sqlTranslator) columnOf(n node) (string, bool) {
+	if ident, ok := n.(*identNode); ok {
+		return t.column(ident.name)
+	}
+	return "", false
+}
+
+// condition translates n into a SQL boolean. Parts without columns are evaluated
+// up front, so only the operators over columns reach SQL.
+func (t *sqlTranslator) condition(n node) (string, bool) {
+	if !t.readsColumn(n) {
+		v, err := n.eval(t.vars)
+		if err != nil {
+			return "", false
+		}
+		if len(v.missing) > 0 {
+			return "NULL", true
+		}
+		b, ok := v.val.(bool)
+		if !ok {
+			return "", false
+		}
+		if b {
+			return "TRUE", true
+		}
+		return "FALSE", true
+	}
+
+	switch x := n.(type) {
+	case *notNode:
+		operand, ok := t.condition(x.operand)
+		if !ok {
+			return "", false
+		}
+		return "(NOT " + operand + ")", true
+	case *logicalNode:
+		// SQL evaluates AND, OR and NOT with the same Kleene logic as Evaluate
+		left, ok := t.condition(x.left)
+		if !ok {
+			return "", false
+		}
+		right, ok := t.condition(x.right)
+		if !ok {
+			return "", false
+		}
+		op := " AND "
+		if x.op == "||" {
+			op = " OR "
+		}
+		return "(" + left + op + right + ")", true
+	case *compareNode:
+		return t.comparison(x)
+	}
+	// A column used as a boolean, or passed to a function
+	return "", false
+}
+
+// comparison translates a comparison of a column with a value
+func (t *sqlTranslator) comparison(n *compareNode) (string, bool) {
+	op, other := n.op, n.right
+	col, ok := t.columnOf(n.left)
+	if !ok {
+		if col, ok = t.columnOf(n.right); !ok || op == "in" {
+			return "", false
+		}
+		op, other = flippedOperators[op], n.left
+	}
+	if t.readsColumn(other) {
+		return "", false
+	}
+	v, err := other.eval(t.vars)
+	if err != nil {
+		return "", false
+	}
+	if len(v.missing) > 0 {
+		return "NULL", true
+	}
+
+	// A missing attribute or a JSON null leaves the comparison undecided
+	present := "COALESCE(JSON_TYPE(" + col + "), 'NULL') <> 'NULL'"
+
+	if op == "in" {
+		items, ok := v.val.([]interface{})
+		if !ok {
+			return "", false
+		}
+		matches := []string{"FALSE"}
+		for _, item := range items {
+			typed, operand, ok := jsonOperand(col, item)
+			if !ok {
+				return "", false
+			}
+			t.args = append(t.args, item)
+			matches = append(matches, "("+typed+" AND "+operand+" = ?)")
+		}
+		return "IF(" + present + ", " + strings.Join(matches, " OR ") + ", NULL)", true
+	}
+
+	typed, operand, ok := jsonOperand(col, v.val)
+	if !ok {
+		return "", false
+	}
+	t.args = append(t.args, v.val)
+	switch op {
+	case "==":
+		// Values of different types are never equal
+		return "IF(" + present + ", " + typed + " AND " + operand + " = ?, NULL)", true
+	case "!=":
+		return "IF(" + present + ", NOT " + typed + " OR " + operand + " <> ?, NULL)", true
+	}
+	t.typeErrors = append(t.typeErrors, "("+present+" AND NOT "+typed+")")
+	return "IF(" + typed + ", " + operand + " " + op + " ?, NULL)", true
+}
+
+// jsonOperand returns the type test of a JSON column for comparisons with v and
+// the form of the column to compare
+func jsonOperand(col string, v interface{}) (typed, operand string, ok bool) {
+	switch v.(type) {
+	case float64:
+		return "(JSON_TYPE(" + col + ") IN (" + numericJSONTypes + "))", col, true
+	case string:
+		return "(JSON_TYPE(" + col + ") = 'STRING')", "JSON_UNQUOTE(" + col + ")", true
+	}
+	return "", "", false
+}
@@ -0,0 +1,92 @@
+package caveat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// documentColumns reads document.* identifiers from documents.attributes
+func documentColumns(name string) (string, bool) {
+	if !strings.HasPrefix(name, "document.") {
+		return "", false
+	}
+	return "JSON_EXTRACT(documents.attributes, '$." + strings.TrimPrefix(name, "document.") + "')", true
+}
+
+func TestMySQLFilter(t *testing.T) {
+	const col = "JSON_EXTRACT(documents.attributes, '$.classification')"
+	const region = "JSON_EXTRACT(documents.attributes, '$.region')"
+
+	tests := []struct {
+		name string
+		expr string
+		vars map[string]interface{}
+		want string
+		args []interface{}
+	}{
+		{
+			name: "ordering against a user attribute",
+			expr: `user.clearance >= document.classification`,
+			vars: map[string]interface{}{"user.clearance": 3},
+			want: "(IF((JSON_TYPE(" + col + ") IN (" + numericJSONTypes + ")), " + col + " <= ?, NULL)) AND NOT ((" +
+				"COALESCE(JSON_TYPE(" + col + "), 'NULL') <> 'NULL' AND NOT (JSON_TYPE(" + col + ") IN (" + numericJSONTypes + "))))",
+			args: []interface{}{3.0},
+		},
+		{
+			name: "missing user attribute",
+			expr: `document.classification <= user.clearance`,
+			vars: map[string]interface{}{},
+			want: "NULL",
+		},
+		{
+			name: "equality and list membership",
+			expr: `document.region == user.region || document.region in ["global"]`,
+			vars: map[string]interface{}{"user.region": "eu"},
+			want: "(IF(COALESCE(JSON_TYPE(" + region + "), 'NULL') <> 'NULL', (JSON_TYPE(" + region + ") = 'STRING') AND JSON_UNQUOTE(" + region + ") = ?, NULL) OR " +
+				"IF(COALESCE(JSON_TYPE(" + region + "), 'NULL') <> 'NULL', FALSE OR ((JSON_TYPE(" + region + ") = 'STRING') AND JSON_UNQUOTE(" + region + ") = ?), NULL))",
+			args: []interface{}{"eu", "global"},
+		},
+		{
+			name: "parts without columns are evaluated",
+			expr: `user.admin == true || !(document.region != "eu")`,
+			vars: map[string]interface{}{"user.admin": false},
+			want: "(FALSE OR (NOT IF(COALESCE(JSON_TYPE(" + region + "), 'NULL') <> 'NULL', NOT (JSON_TYPE(" + region + ") = 'STRING') OR JSON_UNQUOTE(" + region + ") <> ?, NULL)))",
+			args: []interface{}{"eu"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Compile(tt.expr)
+			require.NoError(t, err)
+
+			condition, args, ok := expr.MySQLFilter(tt.vars, documentColumns)
+			require.True(t, ok)
+			assert.Equal(t, tt.want, condition)
+			assert.Equal(t, tt.args, args)
+		})
+	}
+}
+
+func TestMySQLFilter_Untranslatable(t *testing.T) {
+	inputs := []string{
+		`document.public`,
+		`document.level == document.clearance`,
+		`user.region in document.regions`,
+		`ip_in_cidr(client_ip, document.cidr)`,
+		`document.public == true`,
+		`document.expires > now()`,
+		`document.region in user.region`,
+	}
+
+	vars := map[string]interface{}{"user.region": "eu"}
+	for _, input := range inputs {
+		expr, err := Compile(input)
+		require.NoError(t, err, input)
+		_, _, ok := expr.MySQLFilter(vars, documentColumns)
+		assert.False(t, ok, "input %q should not translate", input)
+	}
+}
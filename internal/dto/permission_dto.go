@@ -1,10 +1,24 @@
 package dto
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // CheckPermissionRequest represents a permission check request
 type CheckPermissionRequest struct {
 	UserID         string `json:"user_id" binding:"required"`
 	DocumentID     string `json:"document_id" binding:"required"`
 	PermissionType string `json:"permission_type" binding:"required,oneof=viewer editor owner"`
+	// ManagerChainStrategy selects how the Zanzibar engine resolves the manager chain
+	// (auto, bfs or cte); ignored by the MySQL engine
+	ManagerChainStrategy string `json:"manager_chain_strategy,omitempty" binding:"omitempty,oneof=auto bfs cte"`
+	// Context is the request context caveats of conditional tuples are evaluated against,
+	// e.g. {"client_ip": "10.1.2.3", "purpose": "audit"}; ignored by the MySQL engine
+	Context map[string]interface{} `json:"context,omitempty"`
+	// Namespace of the checked object matched by the cutover namespace rules
+	// (default document); ignored by the engine-specific endpoints
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // CheckPermissionBatchRequest represents a batch permission check request
@@ -14,11 +28,21 @@ type CheckPermissionBatchRequest struct {
 	PermissionType string   `json:"permission_type" binding:"required,oneof=viewer editor owner"`
 }
 
-// GrantPermissionRequest represents a grant permission request
+// GrantPermissionRequest represents a grant permission request.
+// A time-bound grant sets either ExpiresIn or ExpiresAt; without both it never expires.
 type GrantPermissionRequest struct {
-	UserID         string `json:"user_id" binding:"required"`
-	DocumentID     string `json:"document_id" binding:"required"`
-	PermissionType string `json:"permission_type" binding:"required,oneof=viewer editor owner"`
+	UserID         string     `json:"user_id" binding:"required"`
+	DocumentID     string     `json:"document_id" binding:"required"`
+	PermissionType string     `json:"permission_type" binding:"required,oneof=viewer editor owner"`
+	ExpiresIn      string     `json:"expires_in,omitempty" binding:"excluded_with=ExpiresAt"` // Go duration, e.g. "72h"
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`                                   // RFC 3339 end time
+}
+
+// GrantPermissionResponse represents the result of a grant
+type GrantPermissionResponse struct {
+	Message          string     `json:"message"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	ExpiresInSeconds int64      `json:"expires_in_seconds,omitempty"`
 }
 
 // AddCustomerFollowerRequest represents an add customer follower request
@@ -27,12 +51,40 @@ type AddCustomerFollowerRequest struct {
 	UserID     string `json:"user_id" binding:"required"`
 }
 
+// AddCustomerFollowerResponse represents the result of adding a customer follower
+type AddCustomerFollowerResponse struct {
+	Message      string   `json:"message"`
+	Conflicts    []string `json:"conflicts,omitempty"` // Competing customers the user follows
+	OverriddenBy string   `json:"overridden_by,omitempty"`
+}
+
 // UpdateDepartmentManagerRequest represents an update department manager request
 type UpdateDepartmentManagerRequest struct {
 	DepartmentID string `json:"department_id" binding:"required"`
 	ManagerID    string `json:"manager_id" binding:"required"`
 }
 
+// MoveDepartmentRequest represents a move department request; an empty new_parent_id moves it to the root
+type MoveDepartmentRequest struct {
+	DepartmentID string `json:"department_id" binding:"required"`
+	NewParentID  string `json:"new_parent_id"`
+}
+
+// MergeDepartmentsRequest represents a merge departments request
+type MergeDepartmentsRequest struct {
+	SourceDepartmentID string `json:"source_department_id" binding:"required"`
+	TargetDepartmentID string `json:"target_department_id" binding:"required"`
+}
+
+// SplitDepartmentRequest represents a split department request
+type SplitDepartmentRequest struct {
+	DepartmentID      string   `json:"department_id" binding:"required"`
+	NewDepartmentID   string   `json:"new_department_id" binding:"required"`
+	NewDepartmentName string   `json:"new_department_name" binding:"required"`
+	ManagerID         string   `json:"manager_id"`
+	MemberIDs         []string `json:"member_ids" binding:"required,min=1"`
+}
+
 // AddUserToDepartmentRequest represents an add user to department request
 type AddUserToDepartmentRequest struct {
 	UserID       string `json:"user_id" binding:"required"`
@@ -74,6 +126,11 @@ type GetStorageComparisonResponse struct {
 	MySQL        StorageStats `json:"mysql"`
 	Zanzibar     StorageStats `json:"zanzibar"`
 	ReductionPct float64      `json:"reduction_percent"`
+	// ZanzibarEncoded is the dictionary-encoded tuple table plus its dictionaries, when enabled
+	ZanzibarEncoded     *StorageStats `json:"zanzibar_encoded,omitempty"`
+	EncodedReductionPct float64       `json:"encoded_reduction_percent,omitempty"` // vs. relation_tuples
+	// BitmapIndex is the in-memory size of the Zanzibar bitmap index, when enabled
+	BitmapIndex *BitmapIndexStats `json:"bitmap_index,omitempty"`
 }
 
 // StorageStats represents storage statistics
@@ -85,3 +142,94 @@ type StorageStats struct {
 	IndexSizeMB float64 `json:"index_size_mb"`
 	TotalSizeMB float64 `json:"total_size_mb"`
 }
+
+// BitmapIndexStats represents the memory use and rebuild time of the bitmap index
+type BitmapIndexStats struct {
+	Users         int     `json:"users"`
+	Documents     int     `json:"documents"`
+	MemoryBytes   uint64  `json:"memory_bytes"`
+	LastRebuildMs float64 `json:"last_rebuild_ms"`
+}
+
+// TupleRequest represents a relation tuple in API requests
+type TupleRequest struct {
+	Namespace        string  `json:"namespace" binding:"required"`
+	ObjectID         string  `json:"object_id" binding:"required"`
+	Relation         string  `json:"relation" binding:"required"`
+	SubjectNamespace string  `json:"subject_namespace" binding:"required"`
+	SubjectID        string  `json:"subject_id" binding:"required"`
+	UsersetNamespace *string `json:"userset_namespace,omitempty"`
+	UsersetRelation  *string `json:"userset_relation,omitempty"`
+	// ExpiresAt makes the tuple time-bound; a touch without it keeps the current end time
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// CaveatName makes the tuple conditional on a configured caveat; CaveatContext
+	// binds some of its parameters, the rest come from the check request
+	CaveatName    *string                `json:"caveat_name,omitempty"`
+	CaveatContext map[string]interface{} `json:"caveat_context,omitempty"`
+}
+
+// TupleUpdateRequest represents a single tuple mutation
+type TupleUpdateRequest struct {
+	Operation string       `json:"operation" binding:"required,oneof=touch create delete"`
+	Tuple     TupleRequest `json:"tuple" binding:"required"`
+}
+
+// TuplePreconditionRequest represents a precondition evaluated before the write is applied
+type TuplePreconditionRequest struct {
+	Operation string       `json:"operation" binding:"required,oneof=must_exist must_not_exist"`
+	Tuple     TupleRequest `json:"tuple" binding:"required"`
+}
+
+// WriteTuplesRequest represents an atomic tuple write request
+type WriteTuplesRequest struct {
+	Updates       []TupleUpdateRequest       `json:"updates" binding:"required,min=1,max=1000,dive"`
+	Preconditions []TuplePreconditionRequest `json:"preconditions" binding:"max=100,dive"`
+}
+
+// ReadTuplesRequest represents tuple query parameters
+type ReadTuplesRequest struct {
+	Namespace        string `form:"namespace"`
+	ObjectID         string `form:"object_id"`
+	Relation         string `form:"relation"`
+	SubjectNamespace string `form:"subject_namespace"`
+	SubjectID        string `form:"subject_id"`
+	UsersetNamespace string `form:"userset_namespace"`
+	UsersetRelation  string `form:"userset_relation"`
+	PageToken        string `form:"page_token"`
+	PageSize         int    `form:"page_size" binding:"omitempty,min=1,max=1000"`
+}
+
+// EnqueueJobRequest represents a background permission recompute request (MySQL engine)
+type EnqueueJobRequest struct {
+	JobType string          `json:"job_type" binding:"required,oneof=update_department_manager rebuild_department_permissions add_user_to_department remove_user_from_department move_department merge_departments split_department replace_customer_follower revoke_superuser materialize_tuples materialize_all purge_soft_deleted sweep_expired_grants"`
+	Payload json.RawMessage `json:"payload" binding:"required"`
+}
+
+// JobAcceptedResponse is returned when a recompute job is queued
+type JobAcceptedResponse struct {
+	JobID     int64  `json:"job_id"`
+	JobKey    string `json:"job_key"`
+	Status    string `json:"status"`
+	Created   bool   `json:"created"` // false when the idempotency key matched an existing job
+	StatusURL string `json:"status_url"`
+}
+
+// UpdateCutoverRequest replaces the engine cutover rules; zanzibar_percent is 0-100
+type UpdateCutoverRequest struct {
+	ZanzibarPercent *float64 `json:"zanzibar_percent" binding:"required,min=0,max=100"`
+	AllowUsers      []string `json:"allow_users"`
+	DenyUsers       []string `json:"deny_users"`
+	AllowNamespaces []string `json:"allow_namespaces"`
+	DenyNamespaces  []string `json:"deny_namespaces"`
+}
+
+// SetAttributesRequest replaces the attributes of a user, document or customer;
+// an empty object clears them
+type SetAttributesRequest struct {
+	Attributes map[string]interface{} `json:"attributes" binding:"required"`
+}
+
+// SetConflictGroupRequest replaces the customers of a conflict group
+type SetConflictGroupRequest struct {
+	CustomerIDs []string `json:"customer_ids" binding:"required,min=2"`
+}
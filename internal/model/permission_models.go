@@ -1,6 +1,11 @@
 package model
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -15,6 +20,7 @@ type User struct {
 	Email              string     `gorm:"type:varchar(100);uniqueIndex;not null" json:"email"`
 	PrimaryDepartmentID *string   `gorm:"type:varchar(36)" json:"primary_department_id,omitempty"`
 	IsSuperuser        bool       `gorm:"default:false" json:"is_superuser"`
+	Attributes         Attributes `gorm:"type:json" json:"attributes,omitempty"`
 	CreatedAt          time.Time  `json:"created_at"`
 	UpdatedAt          time.Time  `json:"updated_at"`
 	DeletedAt          *time.Time `gorm:"index" json:"deleted_at,omitempty"`
@@ -75,6 +81,7 @@ type ManagementRelation struct {
 type Customer struct {
 	ID        string     `gorm:"primaryKey;type:varchar(36)" json:"id"`
 	Name      string     `gorm:"type:varchar(100);not null" json:"name"`
+	Attributes Attributes `gorm:"type:json" json:"attributes,omitempty"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
@@ -95,12 +102,21 @@ type CustomerFollower struct {
 	User     *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
 }
 
+// CustomerConflictMember places a customer in a conflict group; the customers of a
+// group compete, and ethical walls keep the followers of one from the others
+type CustomerConflictMember struct {
+	GroupID    string    `gorm:"type:varchar(64);not null;primaryKey" json:"group_id"`
+	CustomerID string    `gorm:"type:varchar(36);not null;primaryKey;index" json:"customer_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 // Document represents a document in the system
 type Document struct {
 	ID        string     `gorm:"primaryKey;type:varchar(36)" json:"id"`
 	Title     string     `gorm:"type:varchar(200);not null" json:"title"`
 	CustomerID string    `gorm:"type:varchar(36);not null;index" json:"customer_id"`
 	CreatorID string    `gorm:"type:varchar(36);not null;index" json:"creator_id"`
+	Attributes Attributes `gorm:"type:json" json:"attributes,omitempty"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
@@ -110,20 +126,61 @@ type Document struct {
 	Creator  *User     `gorm:"foreignKey:CreatorID" json:"creator,omitempty"`
 }
 
+// Attributes are free-form properties of a user, document or customer, such as a
+// clearance or a classification, that attribute rules reference. They are stored
+// as a JSON object; nested objects are addressed with dotted names.
+type Attributes map[string]interface{}
+
+// Scan implements sql.Scanner
+func (a *Attributes) Scan(value interface{}) error {
+	var raw []byte
+	switch v := value.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into attributes", value)
+	}
+
+	var attrs map[string]interface{}
+	if err := json.Unmarshal(raw, &attrs); err != nil {
+		return fmt.Errorf("attributes must be a JSON object: %w", err)
+	}
+	*a = attrs
+	return nil
+}
+
+// Value implements driver.Valuer; no attributes are stored as NULL
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(map[string]interface{}(a))
+	if err != nil {
+		return nil, fmt.Errorf("attributes must be a JSON object: %w", err)
+	}
+	return string(raw), nil
+}
+
 // =====================================================
 // MySQL Permission Model (Expanded Storage)
 // =====================================================
 
 // DocumentPermissionMySQL represents a pre-computed permission row
 type DocumentPermissionMySQL struct {
-	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID         string    `gorm:"type:varchar(36);not null;uniqueIndex:uk_user_doc" json:"user_id"`
-	DocumentID     string    `gorm:"type:varchar(36);not null;uniqueIndex:uk_user_doc" json:"document_id"`
-	PermissionType string    `gorm:"type:enum('viewer','editor','owner');not null;uniqueIndex:uk_user_doc" json:"permission_type"`
-	SourceType     string    `gorm:"type:enum('direct','customer_follower','manager_chain','superuser');not null" json:"source_type"`
-	SourceID       *string   `gorm:"type:varchar(36)" json:"source_id,omitempty"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID         string     `gorm:"type:varchar(36);not null;uniqueIndex:uk_user_doc" json:"user_id"`
+	DocumentID     string     `gorm:"type:varchar(36);not null;uniqueIndex:uk_user_doc" json:"document_id"`
+	PermissionType string     `gorm:"type:enum('viewer','editor','owner');not null;uniqueIndex:uk_user_doc" json:"permission_type"`
+	SourceType     string     `gorm:"type:enum('direct','customer_follower','manager_chain','superuser');not null" json:"source_type"`
+	SourceID       *string    `gorm:"type:varchar(36)" json:"source_id,omitempty"`
+	ExpiresAt      *time.Time `gorm:"index" json:"expires_at,omitempty"` // Copied from the expiring tuple; NULL never expires
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
 
 	// Relations
 	User     *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
@@ -135,6 +192,143 @@ func (DocumentPermissionMySQL) TableName() string {
 	return "document_permissions_mysql"
 }
 
+// Source types of expanded permission rows, in precedence order: when several
+// sources grant the same permission, the row records the first one
+const (
+	SourceTypeDirect           = "direct"
+	SourceTypeCustomerFollower = "customer_follower"
+	SourceTypeManagerChain     = "manager_chain"
+	SourceTypeSuperuser        = "superuser"
+)
+
+// Permission job statuses
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+// PermissionJob represents a queued background recompute of MySQL expanded permissions
+type PermissionJob struct {
+	ID              int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	JobKey          string     `gorm:"type:varchar(191);not null;uniqueIndex:uk_job_key" json:"job_key"`
+	JobType         string     `gorm:"type:varchar(50);not null;index:idx_type_status" json:"job_type"`
+	Payload         string     `gorm:"type:json;not null" json:"payload"`
+	Status          string     `gorm:"type:enum('pending','running','succeeded','failed');not null;default:pending;index:idx_claim;index:idx_type_status" json:"status"`
+	Attempts        int        `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts     int        `gorm:"not null;default:5" json:"max_attempts"`
+	LastError       *string    `gorm:"type:text" json:"last_error,omitempty"`
+	ProgressDone    int64      `gorm:"not null;default:0" json:"progress_done"`
+	ProgressTotal   int64      `gorm:"not null;default:0" json:"progress_total"`
+	ProgressMessage *string    `gorm:"type:varchar(500)" json:"progress_message,omitempty"`
+	Result          *string    `gorm:"type:json" json:"result,omitempty"`
+	RunAfter        time.Time  `gorm:"not null;index:idx_claim" json:"run_after"`
+	LockedBy        *string    `gorm:"type:varchar(100)" json:"locked_by,omitempty"`
+	LockedAt        *time.Time `json:"locked_at,omitempty"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `gorm:"index:idx_finished" json:"finished_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for PermissionJob
+func (PermissionJob) TableName() string {
+	return "permission_jobs"
+}
+
+// JobStats summarizes the permission job queue and the staleness window of the expanded engine
+type JobStats struct {
+	Pending            int64   `json:"pending"`
+	Running            int64   `json:"running"`
+	Succeeded          int64   `json:"succeeded"`
+	Failed             int64   `json:"failed"`
+	OldestPendingAgeMs float64 `json:"oldest_pending_age_ms"`
+	// Staleness window: time from enqueue (the mutation) until the expanded rows are recomputed
+	StalenessSamples int64   `json:"staleness_samples"`
+	StalenessAvgMs   float64 `json:"staleness_avg_ms"`
+	StalenessP50Ms   float64 `json:"staleness_p50_ms"`
+	StalenessP95Ms   float64 `json:"staleness_p95_ms"`
+	StalenessMaxMs   float64 `json:"staleness_max_ms"`
+}
+
+// Permission engine names used by shadow evaluation
+const (
+	EngineMySQL    = "mysql"
+	EngineZanzibar = "zanzibar"
+)
+
+// ShadowMismatch records a live permission check on which the shadow engine
+// disagreed with (or failed behind) the primary engine that answered the caller
+type ShadowMismatch struct {
+	ID                int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID            string    `gorm:"type:varchar(36);not null;index:idx_user_document" json:"user_id"`
+	DocumentID        string    `gorm:"type:varchar(36);not null;index:idx_user_document" json:"document_id"`
+	PermissionType    string    `gorm:"type:varchar(20);not null" json:"permission_type"`
+	PrimaryEngine     string    `gorm:"type:varchar(20);not null" json:"primary_engine"`
+	ShadowEngine      string    `gorm:"type:varchar(20);not null" json:"shadow_engine"`
+	PrimaryResult     bool      `gorm:"not null" json:"primary_result"`
+	ShadowResult      bool      `gorm:"not null" json:"shadow_result"`
+	PrimarySources    []string  `gorm:"type:json;serializer:json" json:"primary_sources"`
+	ShadowSources     []string  `gorm:"type:json;serializer:json" json:"shadow_sources"`
+	ShadowError       *string   `gorm:"type:text" json:"shadow_error,omitempty"`
+	PrimaryDurationMs float64   `json:"primary_duration_ms"`
+	ShadowDurationMs  float64   `json:"shadow_duration_ms"`
+	CreatedAt         time.Time `gorm:"index:idx_created" json:"created_at"`
+}
+
+// TableName specifies the table name for ShadowMismatch
+func (ShadowMismatch) TableName() string {
+	return "shadow_mismatches"
+}
+
+// ShadowStats counts shadow evaluations since the server started
+type ShadowStats struct {
+	Enabled       bool    `json:"enabled"`
+	PrimaryEngine string  `json:"primary_engine"`
+	ShadowEngine  string  `json:"shadow_engine"`
+	QueueDepth    int     `json:"queue_depth"`
+	QueueCapacity int     `json:"queue_capacity"`
+	Sample        float64 `json:"sample"` // Percentage of user/document pairs re-evaluated
+	Enqueued      int64   `json:"enqueued"`
+	Skipped       int64   `json:"skipped"` // Not sampled
+	Dropped       int64   `json:"dropped"` // Queue full, shadow check not evaluated
+	Evaluated     int64   `json:"evaluated"`
+	Matched       int64   `json:"matched"`
+	Mismatched    int64   `json:"mismatched"`
+	Errors        int64   `json:"errors"`        // Shadow engine returned an error
+	RecordErrors  int64   `json:"record_errors"` // Mismatch could not be written to shadow_mismatches
+}
+
+// CutoverStats reports the engine routing rules and the traffic share per engine
+type CutoverStats struct {
+	Enabled          bool             `json:"enabled"`
+	ZanzibarPercent  float64          `json:"zanzibar_percent"`
+	AllowUsers       int              `json:"allow_users"`
+	DenyUsers        int              `json:"deny_users"`
+	AllowNamespaces  []string         `json:"allow_namespaces"`
+	DenyNamespaces   []string         `json:"deny_namespaces"`
+	RolledBack       bool             `json:"rolled_back"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+	MySQLRequests    int64            `json:"mysql_requests"`
+	ZanzibarRequests int64            `json:"zanzibar_requests"`
+	ZanzibarShare    float64          `json:"zanzibar_share"` // Percentage of requests served by Zanzibar
+	ByReason         map[string]int64 `json:"by_reason"`      // engine:reason -> requests
+}
+
+// TupleCount is the number of relation tuples stored for one namespace/relation
+type TupleCount struct {
+	Namespace string `json:"namespace"`
+	Relation  string `json:"relation"`
+	Count     int64  `json:"count"`
+}
+
+// SourceTypeCount is the number of expanded permission rows for one source type
+type SourceTypeCount struct {
+	SourceType string `json:"source_type"`
+	Count      int64  `json:"count"`
+}
+
 // =====================================================
 // Zanzibar Permission Model (Tuple-Based)
 // =====================================================
@@ -156,10 +350,72 @@ type RelationTuple struct {
 	UsersetNamespace *string    `gorm:"type:varchar(50)" json:"userset_namespace,omitempty"`
 	UsersetRelation  *string    `gorm:"type:varchar(50)" json:"userset_relation,omitempty"`
 
+	// Time-bound grants stop counting at ExpiresAt; NULL never expires
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`
+
+	// Conditional tuples only grant when the named caveat holds. CaveatContext is a
+	// JSON object binding some of its parameters; the rest come from the check request.
+	CaveatName    *string `gorm:"type:varchar(50)" json:"caveat_name,omitempty"`
+	CaveatContext *string `gorm:"type:json" json:"caveat_context,omitempty"`
+
 	CreatedAt        time.Time  `json:"created_at"`
 	UpdatedAt        time.Time  `json:"updated_at"`
 }
 
+// TupleName is a dictionary entry mapping a namespace or relation name to a small integer code
+type TupleName struct {
+	ID   uint16 `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name string `gorm:"type:varchar(50);not null;uniqueIndex:uk_name" json:"name"`
+}
+
+// TableName specifies the table name
+func (TupleName) TableName() string {
+	return "tuple_names"
+}
+
+// TupleObjectID is a dictionary entry mapping an object or subject ID to an integer surrogate
+type TupleObjectID struct {
+	ID         uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+	ExternalID string `gorm:"type:varchar(36);not null;uniqueIndex:uk_external_id" json:"external_id"`
+}
+
+// TableName specifies the table name
+func (TupleObjectID) TableName() string {
+	return "tuple_object_ids"
+}
+
+// EncodedRelationTuple is a RelationTuple stored with dictionary codes instead of strings.
+// ID is the ID of the relation_tuples row it encodes.
+type EncodedRelationTuple struct {
+	ID                 int64      `gorm:"primaryKey;autoIncrement:false" json:"id"`
+	NamespaceID        uint16     `gorm:"not null;uniqueIndex:uk_tuple" json:"namespace_id"`
+	ObjectID           uint64     `gorm:"not null;uniqueIndex:uk_tuple" json:"object_id"`
+	RelationID         uint16     `gorm:"not null;uniqueIndex:uk_tuple" json:"relation_id"`
+	SubjectNamespaceID uint16     `gorm:"not null;uniqueIndex:uk_tuple" json:"subject_namespace_id"`
+	SubjectID          uint64     `gorm:"not null;uniqueIndex:uk_tuple" json:"subject_id"`
+	UsersetNamespaceID *uint16    `json:"userset_namespace_id,omitempty"`
+	UsersetRelationID  *uint16    `json:"userset_relation_id,omitempty"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	CaveatNameID       *uint16    `json:"caveat_name_id,omitempty"`
+	CaveatContext      *string    `gorm:"type:json" json:"caveat_context,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name
+func (EncodedRelationTuple) TableName() string {
+	return "relation_tuples_encoded"
+}
+
+// EncodeTuplesResult summarizes copying relation_tuples into the encoded table
+type EncodeTuplesResult struct {
+	Tuples     int64   `json:"tuples"`
+	Names      int64   `json:"names"`      // Entries of the name dictionary afterwards
+	ObjectIDs  int64   `json:"object_ids"` // Entries of the ID dictionary afterwards
+	DurationMs float64 `json:"duration_ms"`
+}
+
 // TupleString returns the string representation of the tuple (Zanzibar format)
 func (t *RelationTuple) TupleString() string {
 	if t.UsersetNamespace != nil && t.UsersetRelation != nil {
@@ -170,6 +426,305 @@ func (t *RelationTuple) TupleString() string {
 	return t.Namespace + ":" + t.ObjectID + "#" + t.Relation + "@" + t.SubjectNamespace + ":" + t.SubjectID
 }
 
+// Text returns the canonical text format of the tuple that ParseTuple reads back.
+// Unlike TupleString it keeps the subject of userset tuples, the caveat and the expiry.
+func (t *RelationTuple) Text() string {
+	var s string
+	if t.UsersetNamespace != nil && t.UsersetRelation != nil {
+		// Userset subject: namespace:object_id#relation@subject_namespace:subject_id#userset_relation
+		s = t.Namespace + ":" + t.ObjectID + "#" + t.Relation + "@" + t.SubjectNamespace + ":" + t.SubjectID + "#" + *t.UsersetRelation
+	} else {
+		// Direct relation: namespace:object_id#relation@subject_namespace:subject_id
+		s = t.Namespace + ":" + t.ObjectID + "#" + t.Relation + "@" + t.SubjectNamespace + ":" + t.SubjectID
+	}
+	if t.CaveatName != nil {
+		// Conditional tuple: ...[caveat_name] or ...[caveat_name:{"param":"value"}]
+		s += "[" + *t.CaveatName
+		if t.CaveatContext != nil {
+			s += ":" + *t.CaveatContext
+		}
+		s += "]"
+	}
+	if t.ExpiresAt != nil {
+		// Time-bound grant: ...[expiration:2026-12-31T00:00:00Z]
+		s += "[" + tupleExpirationPrefix + t.ExpiresAt.UTC().Format(time.RFC3339Nano) + "]"
+	}
+	return s
+}
+
+// tupleExpirationPrefix starts the expiry suffix of the text format
+const tupleExpirationPrefix = "expiration:"
+
+// ParseTuple parses the canonical text format produced by Text:
+//
+//	namespace:object_id#relation@subject_namespace:subject_id
+//	namespace:object_id#relation@subject_namespace:subject_id#userset_relation
+//	namespace:object_id#relation@subject_namespace:subject_id[caveat_name:{"param":"value"}]
+//	namespace:object_id#relation@subject_namespace:subject_id[expiration:2026-12-31T00:00:00Z]
+//
+// The expiry suffix follows the caveat when a tuple has both.
+func ParseTuple(s string) (*RelationTuple, error) {
+	s = strings.TrimSpace(s)
+
+	var expiresAt *time.Time
+	if open := strings.LastIndex(s, "["+tupleExpirationPrefix); open >= 0 && strings.HasSuffix(s, "]") {
+		// A caveat named "expiration" binds a JSON object, never a timestamp
+		if at, err := time.Parse(time.RFC3339Nano, s[open+1+len(tupleExpirationPrefix):len(s)-1]); err == nil {
+			at = at.UTC()
+			expiresAt = &at
+			s = s[:open]
+		}
+	}
+
+	var caveatName, caveatContext *string
+	if open := strings.Index(s, "["); open >= 0 {
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("invalid tuple %q: unterminated caveat", s)
+		}
+		name, context, hasContext := strings.Cut(s[open+1:len(s)-1], ":")
+		caveatName = &name
+		if hasContext {
+			canonical, err := CanonicalCaveatContext(context)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tuple %q: %w", s, err)
+			}
+			caveatContext = &canonical
+		}
+		s = s[:open]
+	}
+
+	object, subject, ok := strings.Cut(s, "@")
+	if !ok {
+		return nil, fmt.Errorf("invalid tuple %q: missing '@'", s)
+	}
+
+	objectRef, relation, ok := strings.Cut(object, "#")
+	if !ok {
+		return nil, fmt.Errorf("invalid tuple %q: missing '#relation'", s)
+	}
+	namespace, objectID, ok := strings.Cut(objectRef, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid tuple %q: object must be namespace:id", s)
+	}
+
+	subjectRef, usersetRelation, hasUserset := strings.Cut(subject, "#")
+	subjectNamespace, subjectID, ok := strings.Cut(subjectRef, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid tuple %q: subject must be namespace:id", s)
+	}
+
+	tuple := &RelationTuple{
+		Namespace:        namespace,
+		ObjectID:         objectID,
+		Relation:         relation,
+		SubjectNamespace: subjectNamespace,
+		SubjectID:        subjectID,
+	}
+	if hasUserset {
+		if usersetRelation == "" {
+			return nil, fmt.Errorf("invalid tuple %q: empty userset relation", s)
+		}
+		tuple.UsersetNamespace = &subjectNamespace
+		tuple.UsersetRelation = &usersetRelation
+	}
+	tuple.CaveatName = caveatName
+	tuple.CaveatContext = caveatContext
+	tuple.ExpiresAt = expiresAt
+
+	if err := tuple.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid tuple %q: %w", s, err)
+	}
+	return tuple, nil
+}
+
+// Validate checks that all key fields of the tuple are set
+func (t *RelationTuple) Validate() error {
+	switch {
+	case t.Namespace == "":
+		return errors.New("namespace is required")
+	case t.ObjectID == "":
+		return errors.New("object_id is required")
+	case t.Relation == "":
+		return errors.New("relation is required")
+	case t.SubjectNamespace == "":
+		return errors.New("subject_namespace is required")
+	case t.SubjectID == "":
+		return errors.New("subject_id is required")
+	case (t.UsersetNamespace == nil) != (t.UsersetRelation == nil):
+		return errors.New("userset_namespace and userset_relation must be set together")
+	case t.CaveatName != nil && *t.CaveatName == "":
+		return errors.New("caveat_name must not be empty")
+	case t.CaveatContext != nil && t.CaveatName == nil:
+		return errors.New("caveat_context requires caveat_name")
+	}
+	if t.CaveatContext != nil {
+		if _, err := CanonicalCaveatContext(*t.CaveatContext); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CanonicalCaveatContext checks that raw is a JSON object and returns it compacted
+// with sorted keys, so equal contexts have equal tuple strings
+func CanonicalCaveatContext(raw string) (string, error) {
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &values); err != nil || values == nil {
+		return "", errors.New("caveat_context must be a JSON object")
+	}
+	canonical, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("caveat_context must be a JSON object: %w", err)
+	}
+	return string(canonical), nil
+}
+
+// TupleFilter selects relation tuples; empty fields match any value
+type TupleFilter struct {
+	Namespace        string `json:"namespace,omitempty"`
+	ObjectID         string `json:"object_id,omitempty"`
+	Relation         string `json:"relation,omitempty"`
+	SubjectNamespace string `json:"subject_namespace,omitempty"`
+	SubjectID        string `json:"subject_id,omitempty"`
+	UsersetNamespace string `json:"userset_namespace,omitempty"`
+	UsersetRelation  string `json:"userset_relation,omitempty"`
+}
+
+// TupleList represents a page of relation tuples
+type TupleList struct {
+	Tuples        []RelationTuple `json:"tuples"`
+	NextPageToken string          `json:"next_page_token,omitempty"`
+	DurationMs    float64         `json:"duration_ms"`
+}
+
+// Expand node kinds
+const (
+	ExpandKindUnion = "union" // Subjects of all children
+	ExpandKindLeaf  = "leaf"  // Concrete subjects
+)
+
+// ExpandNode is a node of the userset tree returned by Expand
+type ExpandNode struct {
+	Kind     string        `json:"kind"`
+	Name     string        `json:"name"`
+	Subjects []string      `json:"subjects,omitempty"`
+	Children []*ExpandNode `json:"children,omitempty"`
+}
+
+// Tuple write operations
+const (
+	TupleOperationTouch  = "touch"  // Insert the tuple, keep it if it already exists
+	TupleOperationCreate = "create" // Insert the tuple, fail if it already exists
+	TupleOperationDelete = "delete" // Delete the tuple, no-op if it does not exist
+)
+
+// Tuple precondition operations
+const (
+	PreconditionMustExist    = "must_exist"
+	PreconditionMustNotExist = "must_not_exist"
+)
+
+// TupleUpdate represents a single mutation applied by WriteTuples
+type TupleUpdate struct {
+	Operation string        `json:"operation"`
+	Tuple     RelationTuple `json:"tuple"`
+}
+
+// TuplePrecondition represents a condition that must hold before WriteTuples applies its updates
+type TuplePrecondition struct {
+	Operation string        `json:"operation"`
+	Tuple     RelationTuple `json:"tuple"`
+}
+
+// WriteTuplesResult summarizes the effect of a WriteTuples call
+type WriteTuplesResult struct {
+	Created    int     `json:"created"`
+	Touched    int     `json:"touched"`
+	Deleted    int     `json:"deleted"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// MaterializeResult summarizes a materialization of document_permissions_mysql from relation_tuples
+type MaterializeResult struct {
+	Documents  int     `json:"documents"`
+	Inserted   int64   `json:"inserted"`
+	Updated    int64   `json:"updated"`
+	Deleted    int64   `json:"deleted"`
+	Skipped    int64   `json:"skipped"` // Rows whose user does not exist in users
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// BackfillResult summarizes inferring base tuples from an expanded permission table
+type BackfillResult struct {
+	RowsScanned         int64                 `json:"rows_scanned"`
+	RowsExplained       int64                 `json:"rows_explained"`
+	RowsUnexplained     int64                 `json:"rows_unexplained"`
+	DirectTuples        int64                 `json:"direct_tuples"`
+	FollowerTuples      int64                 `json:"follower_tuples"`
+	OwnerCustomerTuples int64                 `json:"owner_customer_tuples"`
+	SuperuserTuples     int64                 `json:"superuser_tuples"`
+	DepartmentTuples    int64                 `json:"department_tuples"` // Only with org-from-tables
+	TuplesInserted      int64                 `json:"tuples_inserted"`
+	TuplesExisting      int64                 `json:"tuples_existing"`
+	Unexplained         []BackfillUnexplained `json:"unexplained"` // Capped, see RowsUnexplained for the total
+	DurationMs          float64               `json:"duration_ms"`
+}
+
+// BackfillUnexplained is an expanded row no base relationship accounts for
+type BackfillUnexplained struct {
+	RowID          int64   `json:"row_id"`
+	UserID         string  `json:"user_id"`
+	DocumentID     string  `json:"document_id"`
+	PermissionType string  `json:"permission_type"`
+	SourceType     string  `json:"source_type"`
+	SourceID       *string `json:"source_id,omitempty"`
+	Reason         string  `json:"reason"`
+}
+
+// Department reorganization operations
+const (
+	ReorgOperationMerge = "merge"
+	ReorgOperationSplit = "split"
+)
+
+// ReorgResult summarizes the write amplification of a department merge or split
+type ReorgResult struct {
+	Operation           string  `json:"operation"`
+	DepartmentID        string  `json:"department_id"`        // Merged (removed) or split department
+	TargetDepartmentID  string  `json:"target_department_id"` // Merge target or newly created department
+	MembersMoved        int     `json:"members_moved"`
+	DepartmentsMoved    int     `json:"departments_moved"`    // Child departments reparented by a merge
+	RowsTouched         int64   `json:"rows_touched"`         // departments, user_departments and management_relations rows
+	PermissionsDeleted  int64   `json:"permissions_deleted"`  // document_permissions_mysql rows
+	PermissionsInserted int64   `json:"permissions_inserted"` // document_permissions_mysql rows
+	TuplesDeleted       int64   `json:"tuples_deleted"`
+	TuplesInserted      int64   `json:"tuples_inserted"`
+	DurationMs          float64 `json:"duration_ms"`
+}
+
+// PurgeResult summarizes a purge of entities soft-deleted before the cutoff
+type PurgeResult struct {
+	Cutoff             time.Time `json:"cutoff"`
+	Users              int       `json:"users"`
+	Documents          int       `json:"documents"`
+	Customers          int       `json:"customers"`
+	TuplesDeleted      int64     `json:"tuples_deleted"`
+	PermissionsDeleted int64     `json:"permissions_deleted"` // document_permissions_mysql rows
+	DurationMs         float64   `json:"duration_ms"`
+}
+
+// SweepResult summarizes a sweep of expired grants
+type SweepResult struct {
+	TuplesDeleted      int64   `json:"tuples_deleted"`
+	PermissionsDeleted int64   `json:"permissions_deleted"` // document_permissions_mysql rows
+	DurationMs         float64 `json:"duration_ms"`
+}
+
+// Writes returns the total number of rows and tuples written
+func (r *ReorgResult) Writes() int64 {
+	return r.RowsTouched + r.PermissionsDeleted + r.PermissionsInserted + r.TuplesDeleted + r.TuplesInserted
+}
+
 // =====================================================
 // Benchmark Models
 // =====================================================
@@ -216,6 +771,17 @@ type PermissionCheckResult struct {
 	Sources       []string      `json:"sources,omitempty"` // Where the permission came from
 	CacheHit      bool          `json:"cache_hit"`
 	DurationMs    float64       `json:"duration_ms"`
+	// Conditional is set when only conditional tuples could grant the permission and
+	// their caveats need request context that was not given; HasPermission is false
+	Conditional    bool     `json:"conditional,omitempty"`
+	MissingContext []string `json:"missing_context,omitempty"` // Names of the missing context values
+	// DeniedByAttributes is set when the relationships grant the permission but the
+	// attribute rule of the permission does not hold; HasPermission is false
+	DeniedByAttributes bool `json:"denied_by_attributes,omitempty"`
+	// DeniedByEthicalWall is set when the relationships grant the permission but the
+	// user, or every subordinate the access flows through, follows a competitor of the
+	// document's customer; HasPermission is false
+	DeniedByEthicalWall bool `json:"denied_by_ethical_wall,omitempty"`
 }
 
 // UserDocumentList represents a paginated list of documents a user can access
@@ -235,9 +801,29 @@ type DocumentListItem struct {
 	CustomerName   string    `json:"customer_name,omitempty"`
 	CreatorID      string    `json:"creator_id"`
 	CreatorName    string    `json:"creator_name,omitempty"`
-	PermissionType string    `json:"permission_type"`
-	SourceType     string    `json:"source_type"`
-	CreatedAt      time.Time `json:"created_at"`
+	PermissionType string               `json:"permission_type"`
+	SourceType     string               `json:"source_type"`       // First source, kept for compatibility
+	Sources        PermissionSourceList `json:"sources,omitempty"` // Every source granting the permission
+	ExpiresAt      *time.Time           `json:"expires_at,omitempty"`         // End of a time-bound grant
+	ExpiresIn      int64                `json:"expires_in_seconds,omitempty"` // Remaining validity of a time-bound grant
+	CreatedAt      time.Time            `json:"created_at"`
+}
+
+// SetExpiry records when the access to the document ends; nil never expires
+func (d *DocumentListItem) SetExpiry(expiresAt *time.Time) {
+	d.ExpiresAt = expiresAt
+	d.ExpiresIn = SecondsUntil(expiresAt)
+}
+
+// SecondsUntil returns the whole seconds left before expiresAt, 0 for nil or past times
+func SecondsUntil(expiresAt *time.Time) int64 {
+	if expiresAt == nil {
+		return 0
+	}
+	if left := time.Until(*expiresAt); left > 0 {
+		return int64(left / time.Second)
+	}
+	return 0
 }
 
 // StorageStats represents storage statistics for comparison
@@ -250,6 +836,24 @@ type StorageStats struct {
 	TotalSizeMB  float64 `json:"total_size_mb"`
 }
 
+// BitmapIndexStats reports the size of the in-memory bitmap index of accessible documents
+
+type BitmapIndexStats struct {
+	Enabled          bool       `json:"enabled"`
+	Users            int        `json:"users"`            // Users with cached sets
+	Bitmaps          int        `json:"bitmaps"`          // Cached (user, permission type) sets
+	Documents        int        `json:"documents"`        // Entries of the dense document ID dictionary
+	Cardinality      uint64     `json:"cardinality"`      // Sum of accessible documents over all sets
+	BitmapBytes      uint64     `json:"bitmap_bytes"`     // Serialized size of the bitmaps
+	DictionaryBytes  uint64     `json:"dictionary_bytes"` // Estimated size of the document ID dictionary
+	MemoryBytes      uint64     `json:"memory_bytes"`     // BitmapBytes + DictionaryBytes
+	Hits             uint64     `json:"hits"`
+	Misses           uint64     `json:"misses"`
+	LastRebuildMs    float64    `json:"last_rebuild_ms"`
+	LastRebuildUsers int        `json:"last_rebuild_users"`
+	LastRebuiltAt    *time.Time `json:"last_rebuilt_at,omitempty"`
+}
+
 // PermissionSource represents where a permission originated from
 type PermissionSource struct {
 	Type     string `json:"type"`     // direct, customer_follower, manager_chain, superuser
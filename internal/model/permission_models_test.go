@@ -0,0 +1,206 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTuple(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  RelationTuple
+	}{
+		{
+			name:  "direct relation",
+			input: "document:doc-1#viewer@user:user-1",
+			want:  RelationTuple{Namespace: "document", ObjectID: "doc-1", Relation: "viewer", SubjectNamespace: "user", SubjectID: "user-1"},
+		},
+		{
+			name:  "system object",
+			input: "  system:root#admin@user:admin-1  ",
+			want:  RelationTuple{Namespace: "system", ObjectID: "root", Relation: "admin", SubjectNamespace: "user", SubjectID: "admin-1"},
+		},
+		{
+			name:  "userset subject",
+			input: "document:doc-1#viewer@department:dept-l1-0#member",
+			want: RelationTuple{
+				Namespace: "document", ObjectID: "doc-1", Relation: "viewer",
+				SubjectNamespace: "department", SubjectID: "dept-l1-0",
+				UsersetNamespace: strPtr("department"), UsersetRelation: strPtr("member"),
+			},
+		},
+		{
+			name:  "conditional tuple",
+			input: `document:doc-1#viewer@user:user-1[corporate_network]`,
+			want: RelationTuple{
+				Namespace: "document", ObjectID: "doc-1", Relation: "viewer",
+				SubjectNamespace: "user", SubjectID: "user-1",
+				CaveatName: strPtr("corporate_network"),
+			},
+		},
+		{
+			name:  "conditional tuple with bound parameters",
+			input: `customer:cust-1#follower@user:user-1[engagement_window:{"window_end": "2026-12-31T00:00:00Z", "window_start":"2026-01-01T00:00:00Z"}]`,
+			want: RelationTuple{
+				Namespace: "customer", ObjectID: "cust-1", Relation: "follower",
+				SubjectNamespace: "user", SubjectID: "user-1",
+				CaveatName:    strPtr("engagement_window"),
+				CaveatContext: strPtr(`{"window_end":"2026-12-31T00:00:00Z","window_start":"2026-01-01T00:00:00Z"}`),
+			},
+		},
+		{
+			name:  "expiring tuple",
+			input: "document:doc-1#viewer@user:user-1[expiration:2026-12-31T08:00:00+08:00]",
+			want: RelationTuple{
+				Namespace: "document", ObjectID: "doc-1", Relation: "viewer",
+				SubjectNamespace: "user", SubjectID: "user-1",
+				ExpiresAt: timePtr(time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)),
+			},
+		},
+		{
+			name:  "expiring conditional tuple",
+			input: `document:doc-1#viewer@user:user-1[corporate_network:{"cidr":"10.0.0.0/8"}][expiration:2026-12-31T00:00:00.5Z]`,
+			want: RelationTuple{
+				Namespace: "document", ObjectID: "doc-1", Relation: "viewer",
+				SubjectNamespace: "user", SubjectID: "user-1",
+				CaveatName: strPtr("corporate_network"), CaveatContext: strPtr(`{"cidr":"10.0.0.0/8"}`),
+				ExpiresAt: timePtr(time.Date(2026, 12, 31, 0, 0, 0, 500000000, time.UTC)),
+			},
+		},
+		{
+			name:  "caveat named expiration",
+			input: `document:doc-1#viewer@user:user-1[expiration:{"days":30}]`,
+			want: RelationTuple{
+				Namespace: "document", ObjectID: "doc-1", Relation: "viewer",
+				SubjectNamespace: "user", SubjectID: "user-1",
+				CaveatName: strPtr("expiration"), CaveatContext: strPtr(`{"days":30}`),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTuple(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, *got)
+
+			// Round trip through the canonical format
+			again, err := ParseTuple(got.Text())
+			require.NoError(t, err)
+			assert.Equal(t, *got, *again)
+		})
+	}
+}
+
+func TestRelationTuple_TupleString(t *testing.T) {
+	tests := []struct {
+		name   string
+		tuple  RelationTuple
+		legacy string // TupleString
+		text   string // Text
+	}{
+		{
+			name:   "direct relation",
+			tuple:  RelationTuple{Namespace: "document", ObjectID: "doc-1", Relation: "viewer", SubjectNamespace: "user", SubjectID: "user-1"},
+			legacy: "document:doc-1#viewer@user:user-1",
+			text:   "document:doc-1#viewer@user:user-1",
+		},
+		{
+			name: "userset subject",
+			tuple: RelationTuple{
+				Namespace: "document", ObjectID: "doc-1", Relation: "viewer",
+				SubjectNamespace: "department", SubjectID: "dept-l1-0",
+				UsersetNamespace: strPtr("department"), UsersetRelation: strPtr("member"),
+			},
+			legacy: "document:doc-1#viewer@department:member",
+			text:   "document:doc-1#viewer@department:dept-l1-0#member",
+		},
+		{
+			name: "conditional tuple",
+			tuple: RelationTuple{
+				Namespace: "document", ObjectID: "doc-1", Relation: "viewer",
+				SubjectNamespace: "user", SubjectID: "user-1",
+				CaveatName: strPtr("corporate_network"), CaveatContext: strPtr(`{"cidr":"10.0.0.0/8"}`),
+			},
+			legacy: "document:doc-1#viewer@user:user-1",
+			text:   `document:doc-1#viewer@user:user-1[corporate_network:{"cidr":"10.0.0.0/8"}]`,
+		},
+		{
+			name: "expiring tuple",
+			tuple: RelationTuple{
+				Namespace: "document", ObjectID: "doc-1", Relation: "viewer",
+				SubjectNamespace: "user", SubjectID: "user-1",
+				ExpiresAt: timePtr(time.Date(2026, 12, 31, 8, 0, 0, 0, time.FixedZone("CST", 8*3600))),
+			},
+			legacy: "document:doc-1#viewer@user:user-1",
+			text:   "document:doc-1#viewer@user:user-1[expiration:2026-12-31T00:00:00Z]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.legacy, tt.tuple.TupleString())
+			assert.Equal(t, tt.text, tt.tuple.Text())
+		})
+	}
+}
+
+func TestParseTuple_Invalid(t *testing.T) {
+	inputs := []string{
+		"",
+		"document:doc-1#viewer",
+		"document:doc-1@user:user-1",
+		"doc-1#viewer@user:user-1",
+		"document:doc-1#viewer@user-1",
+		"document:#viewer@user:user-1",
+		"document:doc-1#@user:user-1",
+		"document:doc-1#viewer@user:",
+		"document:doc-1#viewer@group:eng#",
+		"document:doc-1#viewer@user:user-1[corporate_network",
+		"document:doc-1#viewer@user:user-1[]",
+		`document:doc-1#viewer@user:user-1[corporate_network:["10.0.0.0/8"]]`,
+		`document:doc-1#viewer@user:user-1[corporate_network:{cidr}]`,
+		"document:doc-1#viewer@user:user-1[expiration:2026-12-31]",
+		"document:doc-1#viewer@user:user-1[expiration:2026-12-31T00:00:00Z",
+	}
+
+	for _, input := range inputs {
+		_, err := ParseTuple(input)
+		assert.Error(t, err, "input %q should be rejected", input)
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestAttributes_ScanValue(t *testing.T) {
+	attrs := Attributes{"classification": 2.0, "region": "eu", "project": map[string]interface{}{"code": "x1"}}
+
+	value, err := attrs.Value()
+	require.NoError(t, err)
+
+	var scanned Attributes
+	require.NoError(t, scanned.Scan(value))
+	assert.Equal(t, attrs, scanned)
+
+	require.NoError(t, scanned.Scan([]byte(`{"clearance": 3}`)))
+	assert.Equal(t, Attributes{"clearance": 3.0}, scanned)
+
+	require.NoError(t, scanned.Scan(nil))
+	assert.Nil(t, scanned)
+	value, err = Attributes(nil).Value()
+	require.NoError(t, err)
+	assert.Nil(t, value)
+
+	assert.Error(t, scanned.Scan(`["not", "an", "object"]`))
+	assert.Error(t, scanned.Scan(42))
+}
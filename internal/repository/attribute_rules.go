@@ -0,0 +1,347 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/caveat"
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// Prefixes of the attributes a rule may reference
+const (
+	userAttributePrefix     = "user."
+	documentAttributePrefix = "document."
+	customerAttributePrefix = "customer."
+)
+
+// AttributeRule requires a condition on the attributes of the user, the document and
+// the document's customer for a permission, on top of the relationships granting it
+type AttributeRule struct {
+	Permission string
+	Expression string // e.g. user.clearance >= document.classification
+}
+
+// AttributeRules are the compiled attribute rules of both engines, keyed by permission.
+// Engines apply them after resolving relationships: checks evaluate the rule on the
+// attributes of the user, the document and its customer; lists, counts and lookups push
+// the rule into SQL when it translates and evaluate it per document otherwise. A rule
+// left undecided by a missing attribute, or failing to evaluate, denies. Rules apply to
+// superusers as well; Expand and LookupSubjects report relationships only.
+type AttributeRules struct {
+	rules map[string]*caveat.Expression
+}
+
+// CompileAttributeRules compiles rules; several rules for one permission must all hold
+func CompileAttributeRules(rules []AttributeRule) (*AttributeRules, error) {
+	sources := make(map[string][]string)
+	for _, rule := range rules {
+		if rule.Permission == "" {
+			return nil, fmt.Errorf("%w: attribute rule without a permission", caveat.ErrInvalidExpression)
+		}
+		expr, err := caveat.Compile(rule.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("attribute rule for %s: %w", rule.Permission, err)
+		}
+		for _, name := range expr.Identifiers() {
+			if !isAttributeName(name) {
+				return nil, fmt.Errorf("attribute rule for %s: %w: %s is not a user, document or customer attribute",
+					rule.Permission, caveat.ErrInvalidExpression, name)
+			}
+		}
+		sources[rule.Permission] = append(sources[rule.Permission], "("+rule.Expression+")")
+	}
+
+	compiled := make(map[string]*caveat.Expression, len(sources))
+	for permission, parts := range sources {
+		expr, err := caveat.Compile(strings.Join(parts, " && "))
+		if err != nil {
+			return nil, fmt.Errorf("attribute rules for %s: %w", permission, err)
+		}
+		compiled[permission] = expr
+	}
+	return &AttributeRules{rules: compiled}, nil
+}
+
+func isAttributeName(name string) bool {
+	for _, prefix := range []string{userAttributePrefix, documentAttributePrefix, customerAttributePrefix} {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// UseAttributeRules enforces rules on checks, lists, counts and lookups; nil disables them
+func (r *ZanzibarPermissionRepository) UseAttributeRules(rules *AttributeRules) {
+	r.attributes = rules
+}
+
+// UseAttributeRules enforces rules on checks, lists and lookups; nil disables them
+func (r *MySQLPermissionRepository) UseAttributeRules(rules *AttributeRules) {
+	r.attributes = rules
+}
+
+// rule returns the rule of permissionType, or nil if there is none
+func (a *AttributeRules) rule(permissionType string) *caveat.Expression {
+	if a == nil {
+		return nil
+	}
+	return a.rules[permissionType]
+}
+
+// addAttributeVars adds attrs to the rule values under prefix. Nested objects are
+// added as a whole and by the dotted names of their members.
+func addAttributeVars(vars map[string]interface{}, prefix string, attrs map[string]interface{}) {
+	for name, v := range attrs {
+		vars[prefix+name] = v
+		if nested, ok := v.(map[string]interface{}); ok {
+			addAttributeVars(vars, prefix+name+".", nested)
+		}
+	}
+}
+
+// userAttributeVars loads the attributes of userID as rule values
+func userAttributeVars(ctx context.Context, db *gorm.DB, userID string) (map[string]interface{}, error) {
+	var users []model.User
+	if err := db.WithContext(ctx).Select("id", "attributes").Where("id = ?", userID).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to load user attributes: %w", err)
+	}
+	vars := make(map[string]interface{})
+	for _, user := range users {
+		addAttributeVars(vars, userAttributePrefix, user.Attributes)
+	}
+	return vars, nil
+}
+
+// documentAttributeRow is a document with its attributes and those of its customer
+type documentAttributeRow struct {
+	ID                 string
+	DocumentAttributes model.Attributes
+	CustomerAttributes model.Attributes
+}
+
+// documentAttributeVars loads the attributes of the documents and their customers as
+// rule values, keyed by document ID. Unknown documents have no values.
+func documentAttributeVars(ctx context.Context, db *gorm.DB, documentIDs []string) (map[string]map[string]interface{}, error) {
+	vars := make(map[string]map[string]interface{}, len(documentIDs))
+	for _, chunk := range chunkStrings(documentIDs, maxInClauseSize) {
+		var rows []documentAttributeRow
+		if err := db.WithContext(ctx).Table("documents").
+			Select("documents.id, documents.attributes AS document_attributes, customers.attributes AS customer_attributes").
+			Joins("LEFT JOIN customers ON customers.id = documents.customer_id").
+			Where("documents.id IN ?", chunk).
+			Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to load document attributes: %w", err)
+		}
+		for _, row := range rows {
+			values := make(map[string]interface{})
+			addAttributeVars(values, documentAttributePrefix, row.DocumentAttributes)
+			addAttributeVars(values, customerAttributePrefix, row.CustomerAttributes)
+			vars[row.ID] = values
+		}
+	}
+	return vars, nil
+}
+
+// attributeColumn reads document and customer attributes from the JSON columns of a
+// query over documents. Names only consist of letters, digits, underscores and dots.
+func attributeColumn(name string) (string, bool) {
+	switch {
+	case strings.HasPrefix(name, documentAttributePrefix):
+		return "JSON_EXTRACT(documents.attributes, '$." + strings.TrimPrefix(name, documentAttributePrefix) + "')", true
+	case strings.HasPrefix(name, customerAttributePrefix):
+		return "JSON_EXTRACT((SELECT customers.attributes FROM customers WHERE customers.id = documents.customer_id), '$." +
+			strings.TrimPrefix(name, customerAttributePrefix) + "')", true
+	}
+	return "", false
+}
+
+// evaluate evaluates rule per document with the attributes of the user and returns
+// the allowed documents. Evaluation errors deny and are recorded on the span.
+func (a *AttributeRules) evaluate(ctx context.Context, db *gorm.DB, rule *caveat.Expression, userVars map[string]interface{}, documentIDs []string) (map[string]bool, error) {
+	docVars, err := documentAttributeVars(ctx, db, documentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	span := trace.SpanFromContext(ctx)
+	allowed := make(map[string]bool, len(documentIDs))
+	for _, docID := range documentIDs {
+		vars := make(map[string]interface{}, len(userVars)+len(docVars[docID]))
+		for name, v := range userVars {
+			vars[name] = v
+		}
+		for name, v := range docVars[docID] {
+			vars[name] = v
+		}
+		result, err := rule.Evaluate(vars)
+		if err != nil {
+			span.RecordError(fmt.Errorf("attribute rule on document %s: %w", docID, err))
+			continue
+		}
+		if result.Satisfied {
+			allowed[docID] = true
+		}
+	}
+	return allowed, nil
+}
+
+// enforceCheck denies a granted check when the rule of permissionType does not hold
+func (a *AttributeRules) enforceCheck(ctx context.Context, db *gorm.DB, engine, userID, documentID, permissionType string, result *model.PermissionCheckResult) (*model.PermissionCheckResult, error) {
+	rule := a.rule(permissionType)
+	if rule == nil || !result.HasPermission {
+		return result, nil
+	}
+
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, engine+".check.attributes")
+	allowed, err := func() (bool, error) {
+		userVars, err := userAttributeVars(ctx, db, userID)
+		if err != nil {
+			return false, err
+		}
+		allowed, err := a.evaluate(ctx, db, rule, userVars, []string{documentID})
+		return allowed[documentID], err
+	}()
+	endSpan(span, err, attribute.Bool("allowed", allowed))
+	if err != nil {
+		return nil, err
+	}
+	if allowed {
+		return result, nil
+	}
+
+	return &model.PermissionCheckResult{
+		HasPermission:      false,
+		DeniedByAttributes: true,
+		DurationMs:         result.DurationMs + float64(time.Since(start).Milliseconds()),
+	}, nil
+}
+
+// enforceBatch clears the documents of a batch check the rule of permissionType denies
+func (a *AttributeRules) enforceBatch(ctx context.Context, db *gorm.DB, engine, userID, permissionType string, result map[string]bool) error {
+	rule := a.rule(permissionType)
+	if rule == nil {
+		return nil
+	}
+
+	granted := make([]string, 0, len(result))
+	for docID, ok := range result {
+		if ok {
+			granted = append(granted, docID)
+		}
+	}
+	if len(granted) == 0 {
+		return nil
+	}
+
+	ctx, span := tracer.Start(ctx, engine+".check_batch.attributes")
+	denied := 0
+	err := func() error {
+		userVars, err := userAttributeVars(ctx, db, userID)
+		if err != nil {
+			return err
+		}
+		allowed, err := a.evaluate(ctx, db, rule, userVars, granted)
+		if err != nil {
+			return err
+		}
+		for _, docID := range granted {
+			if !allowed[docID] {
+				result[docID] = false
+				denied++
+			}
+		}
+		return nil
+	}()
+	endSpan(span, err, attribute.Int("denied", denied))
+	return err
+}
+
+// filterDocuments returns the documents among documentIDs, in order, that the rule of
+// permissionType allows userID. MySQL evaluates rules that translate to SQL.
+func (a *AttributeRules) filterDocuments(ctx context.Context, db *gorm.DB, userID, permissionType string, documentIDs []string) ([]string, error) {
+	rule := a.rule(permissionType)
+	if rule == nil || len(documentIDs) == 0 {
+		return documentIDs, nil
+	}
+
+	ctx, span := tracer.Start(ctx, "attributes.filter")
+	var pushedDown bool
+	kept, err := func() ([]string, error) {
+		userVars, err := userAttributeVars(ctx, db, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		var allowed map[string]bool
+		condition, args, ok := rule.MySQLFilter(userVars, attributeColumn)
+		if pushedDown = ok; ok {
+			allowed = make(map[string]bool)
+			for _, chunk := range chunkStrings(documentIDs, maxInClauseSize) {
+				var ids []string
+				if err := db.WithContext(ctx).Table("documents").
+					Where("documents.id IN ?", chunk).
+					Where("("+condition+")", args...).
+					Pluck("documents.id", &ids).Error; err != nil {
+					return nil, fmt.Errorf("failed to filter documents by attributes: %w", err)
+				}
+				for _, id := range ids {
+					allowed[id] = true
+				}
+			}
+		} else if allowed, err = a.evaluate(ctx, db, rule, userVars, documentIDs); err != nil {
+			return nil, err
+		}
+
+		kept := make([]string, 0, len(allowed))
+		for _, id := range documentIDs {
+			if allowed[id] {
+				kept = append(kept, id)
+			}
+		}
+		return kept, nil
+	}()
+	endSpan(span, err, attribute.Bool("pushed_down", pushedDown),
+		attribute.Int("candidates", len(documentIDs)), attribute.Int("allowed", len(kept)))
+	return kept, err
+}
+
+// documentScope restricts a query to the documents the rule of permissionType allows
+// userID, column holding the document ID. A rule that does not translate to SQL is
+// evaluated on the documents returned by candidates. Without a rule the scope is a no-op.
+func (a *AttributeRules) documentScope(ctx context.Context, db *gorm.DB, userID, permissionType, column string, candidates func() ([]string, error)) (func(*gorm.DB) *gorm.DB, error) {
+	rule := a.rule(permissionType)
+	if rule == nil {
+		return func(db *gorm.DB) *gorm.DB { return db }, nil
+	}
+
+	userVars, err := userAttributeVars(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if condition, args, ok := rule.MySQLFilter(userVars, attributeColumn); ok {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where(column+" IN (SELECT documents.id FROM documents WHERE "+condition+")", args...)
+		}, nil
+	}
+
+	ids, err := candidates()
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := a.filterDocuments(ctx, db, userID, permissionType, ids)
+	if err != nil {
+		return nil, err
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(column+" IN ?", allowed)
+	}, nil
+}
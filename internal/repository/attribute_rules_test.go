@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/caveat"
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// TestAttributeRules tests that both engines deny what the relationships grant when the
+// attribute rule of the permission does not hold, in checks, batch checks, lists and
+// lookups, whether the rule is pushed into SQL or evaluated per document
+func TestAttributeRules(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	mysqlRepo := NewMySQLPermissionRepository(db)
+	zanzibarRepo := NewZanzibarPermissionRepository(db)
+	attributes := NewEntityAttributeRepository(db)
+	ctx := context.Background()
+
+	const (
+		userID     = "abac-user"
+		customerID = "abac-customer"
+		lowDocID   = "abac-doc-low"
+		highDocID  = "abac-doc-high"
+	)
+	docIDs := []string{lowDocID, highDocID}
+
+	cleanup := func() {
+		db.Where("document_id IN ? OR user_id = ?", docIDs, userID).Delete(&model.DocumentPermissionMySQL{})
+		db.Where("namespace = ? AND object_id IN ?", "document", docIDs).Delete(&model.RelationTuple{})
+		db.Where("namespace = ? AND object_id = ?", "customer", customerID).Delete(&model.RelationTuple{})
+		db.Where("id IN ?", docIDs).Delete(&model.Document{})
+		db.Where("id = ?", customerID).Delete(&model.Customer{})
+		db.Where("id = ?", userID).Delete(&model.User{})
+	}
+	cleanup()
+
+	createTestUser(db, userID, "ABAC User", "abac-user@test.com")
+	createTestCustomer(db, customerID, "ABAC Customer")
+	for _, id := range docIDs {
+		createTestDocument(db, id, id, customerID, userID)
+	}
+	require.NoError(t, attributes.SetAttributes(ctx, EntityUser, userID, model.Attributes{"clearance": 2, "region": "eu", "team": "red"}))
+	require.NoError(t, attributes.SetAttributes(ctx, EntityCustomer, customerID, model.Attributes{"region": "eu"}))
+	require.NoError(t, attributes.SetAttributes(ctx, EntityDocument, lowDocID, model.Attributes{"classification": 1, "teams": []string{"red"}}))
+	require.NoError(t, attributes.SetAttributes(ctx, EntityDocument, highDocID, model.Attributes{"classification": 3, "teams": []string{"blue"}}))
+
+	// The user views both documents as a follower of their customer and edits both directly
+	_, err := zanzibarRepo.BulkInsertTuples(ctx, []model.RelationTuple{
+		{Namespace: "document", ObjectID: lowDocID, Relation: "owner_customer", SubjectNamespace: "customer", SubjectID: customerID},
+		{Namespace: "document", ObjectID: highDocID, Relation: "owner_customer", SubjectNamespace: "customer", SubjectID: customerID},
+		{Namespace: "customer", ObjectID: customerID, Relation: "follower", SubjectNamespace: "user", SubjectID: userID},
+		{Namespace: "document", ObjectID: lowDocID, Relation: "editor", SubjectNamespace: "user", SubjectID: userID},
+		{Namespace: "document", ObjectID: highDocID, Relation: "editor", SubjectNamespace: "user", SubjectID: userID},
+	}, 100)
+	require.NoError(t, err)
+	require.NoError(t, mysqlRepo.AddCustomerFollowerPermissions(ctx, customerID, userID))
+	for _, id := range docIDs {
+		require.NoError(t, mysqlRepo.GrantDirectPermission(ctx, userID, id, "editor"))
+	}
+
+	// visible returns the documents each engine grants for permissionType, checking that
+	// check, batch check, list and lookup agree
+	visible := func(permissionType string) map[string][]string {
+		out := make(map[string][]string)
+		for name, engine := range map[string]interface {
+			CheckPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error)
+			CheckPermissionsBatch(ctx context.Context, userID string, documentIDs []string, permissionType string) (map[string]bool, error)
+			GetUserDocuments(ctx context.Context, userID string, permissionType string, page, pageSize int) (*model.UserDocumentList, error)
+			LookupDocuments(ctx context.Context, userID, permissionType string, batchSize int, yield func(documentIDs []string) error) error
+		}{model.EngineMySQL: mysqlRepo, model.EngineZanzibar: zanzibarRepo} {
+			batch, err := engine.CheckPermissionsBatch(ctx, userID, docIDs, permissionType)
+			require.NoError(t, err)
+			list, err := engine.GetUserDocuments(ctx, userID, permissionType, 1, 10)
+			require.NoError(t, err)
+			listed := []string{}
+			for _, doc := range list.Documents {
+				listed = append(listed, doc.ID)
+			}
+			assert.Equal(t, int64(len(listed)), list.Total, "%s list total", name)
+			looked := []string{}
+			require.NoError(t, engine.LookupDocuments(ctx, userID, permissionType, 10, func(ids []string) error {
+				looked = append(looked, ids...)
+				return nil
+			}))
+
+			granted := []string{}
+			for _, docID := range docIDs {
+				result, err := engine.CheckPermission(ctx, userID, docID, permissionType)
+				require.NoError(t, err)
+				assert.Equal(t, result.HasPermission, batch[docID], "%s batch: %s", name, docID)
+				if result.HasPermission {
+					granted = append(granted, docID)
+				}
+			}
+			sort.Strings(listed)
+			sort.Strings(granted)
+			assert.Equal(t, granted, listed, "%s list", name)
+			assert.Equal(t, granted, looked, "%s lookup", name)
+			out[name] = granted
+		}
+
+		count, err := zanzibarRepo.CountUserDocuments(ctx, userID, permissionType)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(out[model.EngineZanzibar])), count, "zanzibar count")
+		return out
+	}
+	both := func(ids ...string) map[string][]string {
+		sort.Strings(ids)
+		return map[string][]string{model.EngineMySQL: ids, model.EngineZanzibar: ids}
+	}
+
+	// Step 1: Without rules the relationships decide
+	assert.Equal(t, both(lowDocID, highDocID), visible("viewer"))
+
+	// Step 2: Rules on the user, document and customer attributes restrict the relationships
+	rules, err := CompileAttributeRules([]AttributeRule{
+		{Permission: "viewer", Expression: "user.clearance >= document.classification"},
+		{Permission: "viewer", Expression: "customer.region == user.region"},
+		{Permission: "editor", Expression: "user.team in document.teams"},
+	})
+	require.NoError(t, err)
+	mysqlRepo.UseAttributeRules(rules)
+	zanzibarRepo.UseAttributeRules(rules)
+
+	assert.Equal(t, both(lowDocID), visible("viewer"))
+	result, err := zanzibarRepo.CheckPermission(ctx, userID, highDocID, "viewer")
+	require.NoError(t, err)
+	assert.True(t, result.DeniedByAttributes)
+	assert.Empty(t, result.Sources)
+
+	// Step 3: Attribute changes apply on the next check
+	require.NoError(t, attributes.SetAttributes(ctx, EntityUser, userID, model.Attributes{"clearance": 3, "region": "eu", "team": "red"}))
+	assert.Equal(t, both(lowDocID, highDocID), visible("viewer"))
+
+	require.NoError(t, attributes.SetAttributes(ctx, EntityCustomer, customerID, model.Attributes{"region": "us"}))
+	assert.Equal(t, both(), visible("viewer"))
+	require.NoError(t, attributes.SetAttributes(ctx, EntityCustomer, customerID, model.Attributes{"region": "eu"}))
+
+	// Step 4: A rule that does not translate to SQL is evaluated per document
+	assert.Equal(t, both(lowDocID), visible("editor"))
+
+	// Step 5: Missing attributes deny
+	require.NoError(t, attributes.SetAttributes(ctx, EntityUser, userID, nil))
+	attrs, err := attributes.Attributes(ctx, EntityUser, userID)
+	require.NoError(t, err)
+	assert.Nil(t, attrs)
+	assert.Equal(t, both(), visible("viewer"))
+	assert.Equal(t, both(), visible("editor"))
+
+	// Step 6: Rules may only reference user, document and customer attributes
+	_, err = CompileAttributeRules([]AttributeRule{{Permission: "viewer", Expression: "clearance >= document.classification"}})
+	assert.ErrorIs(t, err, caveat.ErrInvalidExpression)
+	err = attributes.SetAttributes(ctx, "department", "x", model.Attributes{"a": 1})
+	assert.ErrorIs(t, err, ErrUnknownEntity)
+	err = attributes.SetAttributes(ctx, EntityUser, "abac-missing", model.Attributes{"a": 1})
+	assert.ErrorIs(t, err, ErrEntityNotFound)
+
+	cleanup()
+
+	t.Logf("✅ Test passed! Attribute rules restrict both engines consistently")
+}
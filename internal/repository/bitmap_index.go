@@ -0,0 +1,391 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/v2"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
+)
+
+// ErrBitmapIndexDisabled is returned when the bitmap index is used without being enabled
+var ErrBitmapIndexDisabled = errors.New("bitmap index is not enabled")
+
+// defaultBitmapIndexMaxUsers bounds the number of users whose document sets are kept in memory
+const defaultBitmapIndexMaxUsers = 10000
+
+// DocumentBitmapIndex keeps the documents each user can access as compressed bitmaps
+// over dense integer document IDs. Sets are built lazily from the tuples on first use
+// and dropped when a tuple change may affect them, so a lookup never returns a stale
+// set. A set also lapses when the next time-bound tuple expires. Superusers bypass the index.
+type DocumentBitmapIndex struct {
+	mu sync.RWMutex
+
+	// Dictionary of dense document IDs; ordinals are never reused
+	ordinals    map[string]uint32
+	documentIDs []string
+
+	users    map[string]map[string]*documentBitmaps // user -> permission type -> sets
+	maxUsers int
+
+	// generation is bumped on every invalidation, so that a set computed while
+	// tuples changed is not stored
+	generation uint64
+
+	hits, misses     uint64
+	lastRebuild      time.Duration
+	lastRebuildUsers int
+	lastRebuiltAt    time.Time
+}
+
+// documentBitmaps are the documents a user can access, split by the path that grants them
+type documentBitmaps struct {
+	direct   *roaring.Bitmap
+	follower *roaring.Bitmap
+	manager  *roaring.Bitmap
+	all      *roaring.Bitmap
+
+	expiresAt  map[uint32]time.Time // Documents whose every source is time-bound
+	validUntil *time.Time           // Next expiry of any tuple when the set was built
+}
+
+func (b *documentBitmaps) sizeInBytes() uint64 {
+	return b.direct.GetSizeInBytes() + b.follower.GetSizeInBytes() + b.manager.GetSizeInBytes() + b.all.GetSizeInBytes()
+}
+
+// NewDocumentBitmapIndex creates an empty index holding the sets of at most maxUsers users
+// (0 keeps the default of 10000)
+func NewDocumentBitmapIndex(maxUsers int) *DocumentBitmapIndex {
+	if maxUsers <= 0 {
+		maxUsers = defaultBitmapIndexMaxUsers
+	}
+	return &DocumentBitmapIndex{
+		ordinals: make(map[string]uint32),
+		users:    make(map[string]map[string]*documentBitmaps),
+		maxUsers: maxUsers,
+	}
+}
+
+// get returns the cached sets of userID for permissionType
+func (idx *DocumentBitmapIndex) get(userID, permissionType string) (*documentBitmaps, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	sets, ok := idx.users[userID][permissionType]
+	if ok && sets.validUntil != nil && !time.Now().Before(*sets.validUntil) {
+		// A tuple expired since the set was built and may have granted part of it
+		delete(idx.users[userID], permissionType)
+		ok = false
+	}
+	if ok {
+		idx.hits++
+	} else {
+		idx.misses++
+	}
+	return sets, ok
+}
+
+// currentGeneration returns the generation a new set is computed against
+func (idx *DocumentBitmapIndex) currentGeneration() uint64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.generation
+}
+
+// encode assigns ordinals to the accessible documents and builds their bitmaps,
+// valid until validUntil (nil while no tuple expires)
+func (idx *DocumentBitmapIndex) encode(docs *accessibleDocuments, validUntil *time.Time) *documentBitmaps {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	sets := &documentBitmaps{
+		direct:   roaring.New(),
+		follower: roaring.New(),
+		manager:  roaring.New(),
+		all:      roaring.New(),
+
+		expiresAt:  make(map[uint32]time.Time),
+		validUntil: validUntil,
+	}
+	for _, documentID := range docs.ids {
+		ordinal, ok := idx.ordinals[documentID]
+		if !ok {
+			ordinal = uint32(len(idx.documentIDs))
+			idx.ordinals[documentID] = ordinal
+			idx.documentIDs = append(idx.documentIDs, documentID)
+		}
+
+		sets.all.Add(ordinal)
+		if expiresAt := docs.expiresAt[documentID]; expiresAt != nil {
+			sets.expiresAt[ordinal] = *expiresAt
+		}
+		for _, source := range docs.sources[documentID] {
+			switch source.Type {
+			case model.SourceTypeDirect:
+				sets.direct.Add(ordinal)
+			case model.SourceTypeCustomerFollower:
+				sets.follower.Add(ordinal)
+			case model.SourceTypeManagerChain:
+				sets.manager.Add(ordinal)
+			}
+		}
+	}
+	for _, b := range []*roaring.Bitmap{sets.direct, sets.follower, sets.manager, sets.all} {
+		b.RunOptimize()
+	}
+	return sets
+}
+
+// store caches sets unless an invalidation happened since generation
+func (idx *DocumentBitmapIndex) store(userID, permissionType string, sets *documentBitmaps, generation uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if generation != idx.generation {
+		return
+	}
+	if _, ok := idx.users[userID]; !ok {
+		// Evict an arbitrary user to stay within the bound
+		for len(idx.users) >= idx.maxUsers {
+			for evicted := range idx.users {
+				delete(idx.users, evicted)
+				break
+			}
+		}
+		idx.users[userID] = make(map[string]*documentBitmaps)
+	}
+	idx.users[userID][permissionType] = sets
+}
+
+// ordinal returns the dense ID of documentID, if any set contains it
+func (idx *DocumentBitmapIndex) ordinal(documentID string) (uint32, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	ordinal, ok := idx.ordinals[documentID]
+	return ordinal, ok
+}
+
+// decode returns the document IDs of b in ordinal order
+func (idx *DocumentBitmapIndex) decode(b *roaring.Bitmap) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	ids := make([]string, 0, b.GetCardinality())
+	it := b.Iterator()
+	for it.HasNext() {
+		ids = append(ids, idx.documentIDs[it.Next()])
+	}
+	return ids
+}
+
+// sources attributes doc from the path bitmaps. The index keeps no subjects, so a
+// manager chain grant is attributed to "subordinate", like the single check does.
+func (idx *DocumentBitmapIndex) sources(sets *documentBitmaps, doc model.Document) model.PermissionSourceList {
+	ordinal, ok := idx.ordinal(doc.ID)
+	if !ok {
+		return nil
+	}
+
+	var sources model.PermissionSourceList
+	if sets.direct.Contains(ordinal) {
+		sources.Add(model.SourceTypeDirect, doc.ID)
+	}
+	if sets.follower.Contains(ordinal) {
+		sources.Add(model.SourceTypeCustomerFollower, doc.CustomerID)
+	}
+	if sets.manager.Contains(ordinal) {
+		sources.Add(model.SourceTypeManagerChain, "subordinate")
+	}
+	return sources
+}
+
+// expiry returns when the access to documentID ends, or nil if it does not
+func (idx *DocumentBitmapIndex) expiry(sets *documentBitmaps, documentID string) *time.Time {
+	ordinal, ok := idx.ordinal(documentID)
+	if !ok {
+		return nil
+	}
+	expiresAt, ok := sets.expiresAt[ordinal]
+	if !ok {
+		return nil
+	}
+	return &expiresAt
+}
+
+// Invalidate drops the sets of userIDs
+func (idx *DocumentBitmapIndex) Invalidate(userIDs ...string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.generation++
+	for _, userID := range userIDs {
+		delete(idx.users, userID)
+	}
+}
+
+// Reset drops every set. The document dictionary is kept so ordinals stay stable.
+func (idx *DocumentBitmapIndex) Reset() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.generation++
+	idx.users = make(map[string]map[string]*documentBitmaps)
+}
+
+// Stats reports the size of the index and the duration of the last rebuild
+func (idx *DocumentBitmapIndex) Stats() *model.BitmapIndexStats {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	stats := &model.BitmapIndexStats{
+		Enabled:          true,
+		Users:            len(idx.users),
+		Documents:        len(idx.documentIDs),
+		Hits:             idx.hits,
+		Misses:           idx.misses,
+		LastRebuildMs:    float64(idx.lastRebuild.Microseconds()) / 1000.0,
+		LastRebuildUsers: idx.lastRebuildUsers,
+	}
+	for _, byPermission := range idx.users {
+		for _, sets := range byPermission {
+			stats.Bitmaps++
+			stats.Cardinality += sets.all.GetCardinality()
+			stats.BitmapBytes += sets.sizeInBytes()
+		}
+	}
+	// Each dictionary entry holds the ID twice (map key and slice) plus the ordinal
+	for _, documentID := range idx.documentIDs {
+		stats.DictionaryBytes += uint64(2*len(documentID) + 4)
+	}
+	stats.MemoryBytes = stats.BitmapBytes + stats.DictionaryBytes
+	if !idx.lastRebuiltAt.IsZero() {
+		rebuiltAt := idx.lastRebuiltAt
+		stats.LastRebuiltAt = &rebuiltAt
+	}
+	return stats
+}
+
+func (idx *DocumentBitmapIndex) recordRebuild(duration time.Duration, users int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.lastRebuild = duration
+	idx.lastRebuildUsers = users
+	idx.lastRebuiltAt = time.Now()
+}
+
+// UseBitmapIndex makes batch checks, document lists and counts read the accessible
+// documents of non-superusers from idx. Tuple changes made through this repository
+// keep idx up to date.
+func (r *ZanzibarPermissionRepository) UseBitmapIndex(idx *DocumentBitmapIndex) {
+	r.bitmaps = idx
+}
+
+// BitmapIndex returns the index in use, or nil
+func (r *ZanzibarPermissionRepository) BitmapIndex() *DocumentBitmapIndex {
+	return r.bitmaps
+}
+
+// documentBitmaps returns the sets of userID for permissionType, building them on a miss
+func (r *ZanzibarPermissionRepository) documentBitmaps(ctx context.Context, userID, permissionType string) (*documentBitmaps, error) {
+	if sets, ok := r.bitmaps.get(userID, permissionType); ok {
+		return sets, nil
+	}
+
+	generation := r.bitmaps.currentGeneration()
+	validUntil, err := nextTupleExpiry(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := r.accessibleDocuments(ctx, userID, permissionType)
+	if err != nil {
+		return nil, err
+	}
+	sets := r.bitmaps.encode(docs, validUntil)
+	r.bitmaps.store(userID, permissionType, sets, generation)
+	return sets, nil
+}
+
+// RebuildBitmapIndex drops the index and builds the sets of every user for permissionType,
+// up to the index capacity. The duration is reported by the index stats.
+func (r *ZanzibarPermissionRepository) RebuildBitmapIndex(ctx context.Context, permissionType string) (_ *model.BitmapIndexStats, err error) {
+	if r.bitmaps == nil {
+		return nil, ErrBitmapIndexDisabled
+	}
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "rebuild_bitmap_index")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.rebuild_bitmap_index")
+	defer func() { endSpan(span, err) }()
+
+	startTime := time.Now()
+	r.bitmaps.Reset()
+
+	var userIDs []string
+	if err := r.db.WithContext(ctx).Model(&model.User{}).
+		Order("id").
+		Limit(r.bitmaps.maxUsers).
+		Pluck("id", &userIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load users: %w", err)
+	}
+
+	for _, userID := range userIDs {
+		if _, err := r.documentBitmaps(ctx, userID, permissionType); err != nil {
+			return nil, fmt.Errorf("failed to build document set of %s: %w", userID, err)
+		}
+	}
+
+	r.bitmaps.recordRebuild(time.Since(startTime), len(userIDs))
+	return r.bitmaps.Stats(), nil
+}
+
+// invalidateBitmaps drops the sets that changed tuples may affect: the subjects of
+// document and follower tuples, the followers of a customer whose documents changed,
+// and everyone above them in the management chain. Department changes rewire the
+// chain itself (and the previous managers can no longer be found), so they drop
+// the whole index.
+func (r *ZanzibarPermissionRepository) invalidateBitmaps(ctx context.Context, changed []model.RelationTuple) error {
+	var userIDs, customerIDs []string
+	for _, t := range changed {
+		switch t.Namespace {
+		case "department":
+			r.bitmaps.Reset()
+			return nil
+		case "document":
+			if t.SubjectNamespace == "customer" {
+				customerIDs = append(customerIDs, t.SubjectID)
+			} else if t.SubjectNamespace == "user" {
+				userIDs = append(userIDs, t.SubjectID)
+			}
+		case "customer", "system":
+			if t.SubjectNamespace == "user" {
+				userIDs = append(userIDs, t.SubjectID)
+			}
+		}
+	}
+
+	if len(customerIDs) > 0 {
+		var followerIDs []string
+		if err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+			Where("namespace = ? AND object_id IN ? AND relation = ? AND subject_namespace = ?",
+				"customer", customerIDs, "follower", "user").
+			Pluck("subject_id", &followerIDs).Error; err != nil {
+			return fmt.Errorf("failed to load customer followers: %w", err)
+		}
+		userIDs = append(userIDs, followerIDs...)
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	managerIDs, err := r.getAllManagers(ctx, userIDs, managerChainMaxDepth)
+	if err != nil {
+		return fmt.Errorf("failed to load managers: %w", err)
+	}
+	r.bitmaps.Invalidate(append(userIDs, managerIDs...)...)
+	return nil
+}
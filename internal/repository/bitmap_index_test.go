@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// TestZanzibarBitmapIndex tests that batch checks, lists and counts served from the
+// bitmap index match the tuples and follow tuple changes
+func TestZanzibarBitmapIndex(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewZanzibarPermissionRepository(db)
+	idx := NewDocumentBitmapIndex(0)
+	repo.UseBitmapIndex(idx)
+	ctx := context.Background()
+
+	const (
+		managerID = "zbm-manager"
+		memberID  = "zbm-member"
+	)
+	docIDs := []string{"zbm-doc-direct", "zbm-doc-customer", "zbm-doc-member", "zbm-doc-other"}
+
+	// Clean up leftovers from previous runs
+	db.Where("namespace = ? AND object_id IN ?", "document", docIDs).Delete(&model.RelationTuple{})
+	db.Where("subject_id IN ?", []string{managerID, memberID}).Delete(&model.RelationTuple{})
+	db.Where("namespace = ? AND object_id = ?", "department", "zbm-team").Delete(&model.RelationTuple{})
+
+	createTestUser(db, managerID, "Bitmap Manager", "zbm-manager@test.com")
+	createTestUser(db, memberID, "Bitmap Member", "zbm-member@test.com")
+	customer := createTestCustomer(db, "zbm-customer", "Bitmap Customer")
+	for _, id := range docIDs {
+		createTestDocument(db, id, id, customer.ID, memberID)
+	}
+
+	_, err := repo.BulkInsertTuples(ctx, []model.RelationTuple{
+		{Namespace: "department", ObjectID: "zbm-team", Relation: "manager", SubjectNamespace: "user", SubjectID: managerID},
+		{Namespace: "department", ObjectID: "zbm-team", Relation: "member", SubjectNamespace: "user", SubjectID: memberID},
+		{Namespace: "document", ObjectID: docIDs[0], Relation: "viewer", SubjectNamespace: "user", SubjectID: managerID},
+		{Namespace: "document", ObjectID: docIDs[1], Relation: "owner_customer", SubjectNamespace: "customer", SubjectID: customer.ID},
+		{Namespace: "customer", ObjectID: customer.ID, Relation: "follower", SubjectNamespace: "user", SubjectID: managerID},
+		{Namespace: "document", ObjectID: docIDs[2], Relation: "owner", SubjectNamespace: "user", SubjectID: memberID},
+	}, 100)
+	require.NoError(t, err)
+
+	// Step 1: Batch check, count and list agree with the tuples
+	result, err := repo.CheckPermissionsBatch(ctx, managerID, docIDs, "viewer")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{docIDs[0]: true, docIDs[1]: true, docIDs[2]: true, docIDs[3]: false}, result)
+
+	count, err := repo.CountUserDocuments(ctx, managerID, "viewer")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	list, err := repo.GetUserDocuments(ctx, managerID, "viewer", 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), list.Total)
+	for _, doc := range list.Documents {
+		switch doc.ID {
+		case docIDs[0]:
+			assert.True(t, doc.Sources.Contains(model.SourceTypeDirect, docIDs[0]))
+		case docIDs[1]:
+			assert.True(t, doc.Sources.Contains(model.SourceTypeCustomerFollower, customer.ID))
+		case docIDs[2]:
+			assert.Equal(t, model.SourceTypeManagerChain, doc.SourceType)
+		}
+	}
+
+	stats := idx.Stats()
+	assert.True(t, stats.Enabled)
+	assert.Equal(t, 1, stats.Users)
+	assert.GreaterOrEqual(t, stats.Hits, uint64(2), "count and list reuse the set of the batch check")
+	assert.Greater(t, stats.MemoryBytes, uint64(0))
+
+	// Step 2: Revoking the direct grant drops the cached set
+	require.NoError(t, repo.RevokePermission(ctx, managerID, docIDs[0]))
+	result, err = repo.CheckPermissionsBatch(ctx, managerID, docIDs, "viewer")
+	require.NoError(t, err)
+	assert.False(t, result[docIDs[0]])
+
+	// Step 3: A subordinate's new document reaches the manager's set
+	require.NoError(t, repo.GrantDirectPermission(ctx, memberID, docIDs[3], "owner"))
+	result, err = repo.CheckPermissionsBatch(ctx, managerID, docIDs, "viewer")
+	require.NoError(t, err)
+	assert.True(t, result[docIDs[3]])
+
+	// Step 4: A rebuild reports its duration
+	stats, err = repo.RebuildBitmapIndex(ctx, "viewer")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, stats.LastRebuildUsers, 2)
+	assert.NotNil(t, stats.LastRebuiltAt)
+
+	// Cleanup
+	db.Where("namespace = ? AND object_id IN ?", "document", docIDs).Delete(&model.RelationTuple{})
+	db.Where("subject_id IN ?", []string{managerID, memberID}).Delete(&model.RelationTuple{})
+	db.Where("namespace = ? AND object_id = ?", "department", "zbm-team").Delete(&model.RelationTuple{})
+
+	t.Logf("✅ Test passed! Bitmap index uses %d bytes", stats.MemoryBytes)
+}
@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/caveat"
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// ErrUnknownCaveat is returned when a tuple is written with a caveat that is not defined
+var ErrUnknownCaveat = errors.New("unknown caveat")
+
+type caveatContextKey struct{}
+
+// WithCaveatContext supplies the request context that conditional tuples are evaluated
+// against in checks made with ctx. Parameters bound on a tuple take precedence.
+func WithCaveatContext(ctx context.Context, values map[string]interface{}) context.Context {
+	return context.WithValue(ctx, caveatContextKey{}, values)
+}
+
+// CaveatContext returns the request context supplied with WithCaveatContext, or nil
+func CaveatContext(ctx context.Context) map[string]interface{} {
+	values, _ := ctx.Value(caveatContextKey{}).(map[string]interface{})
+	return values
+}
+
+// unconditional drops conditional tuples. Only checks can evaluate caveats, so every
+// other read (lists, expansion, the materializer) treats conditional tuples as not granting.
+func unconditional(db *gorm.DB) *gorm.DB {
+	return db.Where("caveat_name IS NULL")
+}
+
+// SetCaveats compiles the caveats conditional tuples may reference, keyed by name
+func (r *ZanzibarPermissionRepository) SetCaveats(definitions map[string]string) error {
+	caveats := make(map[string]*caveat.Expression, len(definitions))
+	for name, source := range definitions {
+		if name == "" {
+			return fmt.Errorf("%w: caveat without a name", caveat.ErrInvalidExpression)
+		}
+		expr, err := caveat.Compile(source)
+		if err != nil {
+			return fmt.Errorf("caveat %s: %w", name, err)
+		}
+		caveats[name] = expr
+	}
+	r.caveats = caveats
+	return nil
+}
+
+// validateCaveats checks that every conditional tuple written references a defined caveat
+func (r *ZanzibarPermissionRepository) validateCaveats(updates []model.TupleUpdate) error {
+	for i := range updates {
+		name := updates[i].Tuple.CaveatName
+		if name == nil || updates[i].Operation == model.TupleOperationDelete {
+			continue
+		}
+		if _, ok := r.caveats[*name]; !ok {
+			return fmt.Errorf("%w: %w: %s", ErrInvalidTuple, ErrUnknownCaveat, *name)
+		}
+	}
+	return nil
+}
+
+// evaluateCaveat evaluates the caveat of a conditional tuple with its bound parameters
+// over the request context of ctx. Tuples whose caveat is undefined or fails to evaluate
+// never grant; the failure is recorded on the span.
+func (r *ZanzibarPermissionRepository) evaluateCaveat(ctx context.Context, tuple *model.RelationTuple) caveat.Result {
+	span := trace.SpanFromContext(ctx)
+
+	expr, ok := r.caveats[*tuple.CaveatName]
+	if !ok {
+		span.RecordError(fmt.Errorf("%w: %s", ErrUnknownCaveat, *tuple.CaveatName))
+		return caveat.Result{}
+	}
+
+	vars := make(map[string]interface{})
+	for name, v := range CaveatContext(ctx) {
+		vars[name] = v
+	}
+	if tuple.CaveatContext != nil {
+		var bound map[string]interface{}
+		if err := json.Unmarshal([]byte(*tuple.CaveatContext), &bound); err != nil {
+			span.RecordError(fmt.Errorf("caveat %s: invalid bound context: %w", *tuple.CaveatName, err))
+			return caveat.Result{}
+		}
+		for name, v := range bound {
+			vars[name] = v
+		}
+	}
+
+	result, err := expr.Evaluate(vars)
+	if err != nil {
+		span.RecordError(fmt.Errorf("caveat %s: %w", *tuple.CaveatName, err))
+		return caveat.Result{}
+	}
+	return result
+}
+
+// conditionalGrants collects the outcome of the conditional tuples of a check
+type conditionalGrants struct {
+	missing map[string]bool
+}
+
+// evaluate evaluates tuple and reports whether it grants; undecided caveats add their
+// missing context names
+func (g *conditionalGrants) evaluate(ctx context.Context, r *ZanzibarPermissionRepository, tuple *model.RelationTuple) bool {
+	result := r.evaluateCaveat(ctx, tuple)
+	for _, name := range result.Missing {
+		g.missing[name] = true
+	}
+	return result.Satisfied
+}
+
+// missingContext returns the sorted names of the missing context values
+func (g *conditionalGrants) missingContext() []string {
+	if len(g.missing) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(g.missing))
+	for name := range g.missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkConditionalPermission is the last path of a check: conditional direct tuples on
+// the document and conditional follower tuples on its owning customer. It returns the
+// names of missing context values when a caveat could not be decided without them.
+func (r *ZanzibarPermissionRepository) checkConditionalPermission(ctx context.Context, userID, documentID, permissionType string, sources *model.PermissionSourceList) (bool, []string, error) {
+	grants := &conditionalGrants{missing: make(map[string]bool)}
+
+	var direct []model.RelationTuple
+	if err := r.db.WithContext(ctx).
+		Scopes(unexpired).
+		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id = ? AND caveat_name IS NOT NULL",
+			"document", documentID, permissionType, "user", userID).
+		Find(&direct).Error; err != nil {
+		return false, nil, fmt.Errorf("failed to load conditional tuples: %w", err)
+	}
+	for i := range direct {
+		if grants.evaluate(ctx, r, &direct[i]) {
+			sources.Add("direct", documentID)
+			return true, nil, nil
+		}
+	}
+
+	var customerIDs []string
+	if err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Scopes(unexpired, unconditional).
+		Where("namespace = ? AND object_id = ? AND relation = ?", "document", documentID, "owner_customer").
+		Pluck("subject_id", &customerIDs).Error; err != nil {
+		return false, nil, fmt.Errorf("failed to load document customer: %w", err)
+	}
+	if len(customerIDs) == 0 {
+		return false, grants.missingContext(), nil
+	}
+
+	var followers []model.RelationTuple
+	if err := r.db.WithContext(ctx).
+		Scopes(unexpired).
+		Where("namespace = ? AND object_id IN ? AND relation = ? AND subject_namespace = ? AND subject_id = ? AND caveat_name IS NOT NULL",
+			"customer", customerIDs, "follower", "user", userID).
+		Find(&followers).Error; err != nil {
+		return false, nil, fmt.Errorf("failed to load conditional tuples: %w", err)
+	}
+	for i := range followers {
+		if grants.evaluate(ctx, r, &followers[i]) {
+			sources.Add("customer_follower", followers[i].ObjectID)
+			return true, nil, nil
+		}
+	}
+
+	return false, grants.missingContext(), nil
+}
+
+// checkConditionalPermissionsBatch sets result[docID] for the documents among
+// documentIDs that a conditional direct or follower tuple grants with the request context
+func (r *ZanzibarPermissionRepository) checkConditionalPermissionsBatch(ctx context.Context, userID string, documentIDs []string, permissionType string, result map[string]bool) error {
+	ctx, span := tracer.Start(ctx, "zanzibar.check_batch.conditional")
+	grants := &conditionalGrants{missing: make(map[string]bool)}
+	granted := 0
+
+	err := func() error {
+		// Conditional follower tuples of the user, evaluated once per customer
+		var followers []model.RelationTuple
+		if err := r.db.WithContext(ctx).
+			Scopes(unexpired).
+			Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id = ? AND caveat_name IS NOT NULL",
+				"customer", "follower", "user", userID).
+			Find(&followers).Error; err != nil {
+			return fmt.Errorf("failed to load conditional tuples: %w", err)
+		}
+		var grantedCustomerIDs []string
+		for i := range followers {
+			if grants.evaluate(ctx, r, &followers[i]) {
+				grantedCustomerIDs = append(grantedCustomerIDs, followers[i].ObjectID)
+			}
+		}
+
+		for _, chunk := range chunkStrings(documentIDs, maxInClauseSize) {
+			var direct []model.RelationTuple
+			if err := r.db.WithContext(ctx).
+				Scopes(unexpired).
+				Where("namespace = ? AND object_id IN ? AND relation = ? AND subject_namespace = ? AND subject_id = ? AND caveat_name IS NOT NULL",
+					"document", chunk, permissionType, "user", userID).
+				Find(&direct).Error; err != nil {
+				return fmt.Errorf("failed to load conditional tuples: %w", err)
+			}
+			for i := range direct {
+				if !result[direct[i].ObjectID] && grants.evaluate(ctx, r, &direct[i]) {
+					result[direct[i].ObjectID] = true
+					granted++
+				}
+			}
+
+			if len(grantedCustomerIDs) == 0 {
+				continue
+			}
+			var customerDocIDs []string
+			if err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+				Scopes(unexpired, unconditional).
+				Where("namespace = ? AND object_id IN ? AND relation = ? AND subject_id IN ?",
+					"document", chunk, "owner_customer", grantedCustomerIDs).
+				Pluck("object_id", &customerDocIDs).Error; err != nil {
+				return fmt.Errorf("failed to load conditional tuples: %w", err)
+			}
+			for _, docID := range customerDocIDs {
+				if !result[docID] {
+					result[docID] = true
+					granted++
+				}
+			}
+		}
+		return nil
+	}()
+
+	endSpan(span, err, attribute.Int("granted", granted), attribute.Int("missing_context", len(grants.missing)))
+	return err
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// TestConditionalTuples tests that conditional tuples grant only when their caveat
+// holds for the request context, report the missing context otherwise, and are
+// ignored by lists and the MySQL engine
+func TestConditionalTuples(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	mysqlRepo := NewMySQLPermissionRepository(db)
+	zanzibarRepo := NewZanzibarPermissionRepository(db)
+	ctx := context.Background()
+
+	require.NoError(t, zanzibarRepo.SetCaveats(map[string]string{
+		"corporate_network": `ip_in_cidr(client_ip, cidr)`,
+		"engagement_window": `now() >= window_start && now() < window_end`,
+		"audit_purpose":     `purpose == "audit"`,
+	}))
+
+	const (
+		userID     = "cav-user"
+		customerID = "cav-customer"
+		docID      = "cav-doc"
+	)
+
+	cleanup := func() {
+		db.Where("document_id = ? OR user_id = ?", docID, userID).Delete(&model.DocumentPermissionMySQL{})
+		db.Where("namespace = ? AND object_id = ?", "document", docID).Delete(&model.RelationTuple{})
+		db.Where("namespace = ? AND object_id = ?", "customer", customerID).Delete(&model.RelationTuple{})
+		db.Where("id = ?", docID).Delete(&model.Document{})
+		db.Where("id = ?", customerID).Delete(&model.Customer{})
+		db.Where("id = ?", userID).Delete(&model.User{})
+	}
+	cleanup()
+
+	createTestUser(db, userID, "Caveat User", "cav-user@test.com")
+	createTestCustomer(db, customerID, "Caveat Customer")
+	createTestDocument(db, docID, "Caveat Doc", customerID, userID)
+	_, err := zanzibarRepo.BulkInsertTuples(ctx, []model.RelationTuple{
+		{Namespace: "document", ObjectID: docID, Relation: "owner_customer", SubjectNamespace: "customer", SubjectID: customerID},
+	}, 100)
+	require.NoError(t, err)
+
+	check := func(values map[string]interface{}) *model.PermissionCheckResult {
+		result, err := zanzibarRepo.CheckPermission(WithCaveatContext(ctx, values), userID, docID, "viewer")
+		require.NoError(t, err)
+		return result
+	}
+	write := func(operation string, tuple model.RelationTuple) {
+		_, err := zanzibarRepo.WriteTuples(ctx, []model.TupleUpdate{{Operation: operation, Tuple: tuple}}, nil)
+		require.NoError(t, err)
+	}
+	strPtr := func(s string) *string { return &s }
+
+	direct := model.RelationTuple{
+		Namespace: "document", ObjectID: docID, Relation: "viewer",
+		SubjectNamespace: "user", SubjectID: userID,
+		CaveatName:    strPtr("corporate_network"),
+		CaveatContext: strPtr(`{"cidr": "10.0.0.0/8"}`),
+	}
+
+	// Step 1: Without request context the check is conditional on the missing value
+	write(model.TupleOperationTouch, direct)
+	result := check(nil)
+	assert.False(t, result.HasPermission)
+	assert.True(t, result.Conditional)
+	assert.Equal(t, []string{"client_ip"}, result.MissingContext)
+
+	// Step 2: The request context decides; bound parameters cannot be overridden
+	result = check(map[string]interface{}{"client_ip": "10.1.2.3"})
+	assert.True(t, result.HasPermission)
+	assert.Contains(t, result.Sources, "direct:"+docID)
+
+	result = check(map[string]interface{}{"client_ip": "192.168.1.1", "cidr": "0.0.0.0/0"})
+	assert.False(t, result.HasPermission)
+	assert.False(t, result.Conditional)
+
+	batch, err := zanzibarRepo.CheckPermissionsBatch(WithCaveatContext(ctx, map[string]interface{}{"client_ip": "10.1.2.3"}),
+		userID, []string{docID}, "viewer")
+	require.NoError(t, err)
+	assert.True(t, batch[docID])
+
+	// Step 3: Conditional tuples are ignored by lists and never reach the MySQL engine
+	list, err := zanzibarRepo.GetUserDocuments(ctx, userID, "viewer", 1, 10)
+	require.NoError(t, err)
+	assert.Empty(t, list.Documents)
+	materializer := NewPermissionMaterializer(db)
+	_, err = materializer.MaterializeDocuments(ctx, []string{docID})
+	require.NoError(t, err)
+	mysqlResult, err := mysqlRepo.CheckPermission(ctx, userID, docID, "viewer")
+	require.NoError(t, err)
+	assert.False(t, mysqlResult.HasPermission)
+
+	// Step 4: Conditional followings of the owning customer are evaluated as well
+	write(model.TupleOperationDelete, direct)
+	write(model.TupleOperationTouch, model.RelationTuple{
+		Namespace: "customer", ObjectID: customerID, Relation: "follower",
+		SubjectNamespace: "user", SubjectID: userID,
+		CaveatName: strPtr("audit_purpose"),
+	})
+	result = check(nil)
+	assert.True(t, result.Conditional)
+	assert.Equal(t, []string{"purpose"}, result.MissingContext)
+	result = check(map[string]interface{}{"purpose": "audit"})
+	assert.True(t, result.HasPermission)
+	assert.Contains(t, result.Sources, "customer_follower:"+customerID)
+
+	// Step 5: A decided caveat leaves nothing missing, e.g. an engagement window that ended
+	write(model.TupleOperationTouch, model.RelationTuple{
+		Namespace: "customer", ObjectID: customerID, Relation: "follower",
+		SubjectNamespace: "user", SubjectID: userID,
+		CaveatName: strPtr("engagement_window"),
+		CaveatContext: strPtr(`{"window_start": "` + time.Now().Add(-48*time.Hour).Format(time.RFC3339) +
+			`", "window_end": "` + time.Now().Add(-24*time.Hour).Format(time.RFC3339) + `"}`),
+	})
+	result = check(map[string]interface{}{"purpose": "audit"})
+	assert.False(t, result.HasPermission)
+	assert.False(t, result.Conditional)
+
+	// Step 6: Tuples naming an undefined caveat are rejected
+	_, err = zanzibarRepo.WriteTuples(ctx, []model.TupleUpdate{{
+		Operation: model.TupleOperationTouch,
+		Tuple:     model.RelationTuple{Namespace: "document", ObjectID: docID, Relation: "viewer", SubjectNamespace: "user", SubjectID: userID, CaveatName: strPtr("undefined")},
+	}}, nil)
+	assert.ErrorIs(t, err, ErrUnknownCaveat)
+	assert.ErrorIs(t, err, ErrInvalidTuple)
+
+	cleanup()
+
+	t.Logf("✅ Test passed! Conditional tuples grant only when their caveat holds")
+}
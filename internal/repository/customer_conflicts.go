@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// ErrInvalidConflictGroup is returned for a conflict group without an ID or with fewer than two customers
+var ErrInvalidConflictGroup = errors.New("invalid conflict group")
+
+// maxConflictGroupIDLength is the width of customer_conflict_members.group_id
+const maxConflictGroupIDLength = 64
+
+// CustomerConflictRepository manages the conflict groups of competing customers that
+// ethical walls read. Walls read the groups on every check and list, so a change takes
+// effect immediately in both engines; existing followers are not re-validated.
+type CustomerConflictRepository struct {
+	db *gorm.DB
+}
+
+// NewCustomerConflictRepository creates a new customer conflict repository
+func NewCustomerConflictRepository(db *gorm.DB) *CustomerConflictRepository {
+	return &CustomerConflictRepository{db: db}
+}
+
+// Groups returns the customers of every conflict group, sorted, keyed by group
+func (r *CustomerConflictRepository) Groups(ctx context.Context) (map[string][]string, error) {
+	var members []model.CustomerConflictMember
+	if err := r.db.WithContext(ctx).Order("group_id, customer_id").Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to load conflict groups: %w", err)
+	}
+
+	groups := make(map[string][]string)
+	for _, member := range members {
+		groups[member.GroupID] = append(groups[member.GroupID], member.CustomerID)
+	}
+	return groups, nil
+}
+
+// SetGroup replaces the customers of a conflict group, creating it if needed
+func (r *CustomerConflictRepository) SetGroup(ctx context.Context, groupID string, customerIDs []string) error {
+	customerIDs = uniqueStrings(customerIDs)
+	sort.Strings(customerIDs)
+	if groupID == "" || len(groupID) > maxConflictGroupIDLength {
+		return fmt.Errorf("%w: group ID must have 1 to %d characters", ErrInvalidConflictGroup, maxConflictGroupIDLength)
+	}
+	if len(customerIDs) < 2 {
+		return fmt.Errorf("%w: group %s needs at least two customers", ErrInvalidConflictGroup, groupID)
+	}
+
+	ctx, span := tracer.Start(ctx, "customer_conflicts.set_group")
+	span.SetAttributes(attribute.String("group.id", groupID), attribute.Int("customers", len(customerIDs)))
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var found []string
+		if err := tx.Model(&model.Customer{}).Where("id IN ?", customerIDs).Pluck("id", &found).Error; err != nil {
+			return fmt.Errorf("failed to load customers: %w", err)
+		}
+		known := toSet(found)
+		for _, id := range customerIDs {
+			if !known[id] {
+				return fmt.Errorf("%w: %s %s", ErrEntityNotFound, EntityCustomer, id)
+			}
+		}
+
+		if err := tx.Where("group_id = ?", groupID).Delete(&model.CustomerConflictMember{}).Error; err != nil {
+			return fmt.Errorf("failed to clear conflict group: %w", err)
+		}
+		members := make([]model.CustomerConflictMember, len(customerIDs))
+		for i, id := range customerIDs {
+			members[i] = model.CustomerConflictMember{GroupID: groupID, CustomerID: id}
+		}
+		if err := tx.Create(&members).Error; err != nil {
+			return fmt.Errorf("failed to create conflict group: %w", err)
+		}
+		return nil
+	})
+	endSpan(span, err)
+	return err
+}
+
+// DeleteGroup removes a conflict group, lifting the walls between its customers
+func (r *CustomerConflictRepository) DeleteGroup(ctx context.Context, groupID string) error {
+	ctx, span := tracer.Start(ctx, "customer_conflicts.delete_group")
+	span.SetAttributes(attribute.String("group.id", groupID))
+
+	result := r.db.WithContext(ctx).Where("group_id = ?", groupID).Delete(&model.CustomerConflictMember{})
+	err := result.Error
+	if err != nil {
+		err = fmt.Errorf("failed to delete conflict group: %w", err)
+	} else if result.RowsAffected == 0 {
+		err = fmt.Errorf("%w: conflict group %s", ErrEntityNotFound, groupID)
+	}
+	endSpan(span, err)
+	return err
+}
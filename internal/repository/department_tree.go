@@ -0,0 +1,366 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+var (
+	// ErrDepartmentNotFound is returned when a department or the new parent does not exist
+	ErrDepartmentNotFound = errors.New("department not found")
+	// ErrDepartmentCycle is returned when a department would be moved below itself
+	ErrDepartmentCycle = errors.New("department move would create a cycle")
+	// ErrDepartmentTooDeep is returned when a move pushes the subtree below the deepest level
+	ErrDepartmentTooDeep = errors.New("department move exceeds the maximum depth")
+	// ErrDepartmentExists is returned when a split would create a department that already exists
+	ErrDepartmentExists = errors.New("department already exists")
+	// ErrNotDepartmentMember is returned when a split moves a user who is not in the department
+	ErrNotDepartmentMember = errors.New("user is not a member of the department")
+)
+
+const (
+	// maxDepartmentLevel is the deepest level allowed by the departments schema
+	maxDepartmentLevel = 5
+	// departmentParentMaxDepth is how many parent links a manager's authority is inherited
+	// across, so that parent links plus the direct manager stay within managerChainMaxDepth
+	departmentParentMaxDepth = managerChainMaxDepth - 1
+)
+
+// departmentRow is the part of a department needed to walk the tree
+type departmentRow struct {
+	ID        string
+	ParentID  *string
+	Level     int
+	ManagerID *string
+}
+
+// departmentMove describes a reparented subtree
+type departmentMove struct {
+	DepartmentID string
+	OldParentID  *string
+	NewParentID  *string
+	Subtree      []departmentRow // the moved department first, then its descendants
+	LevelDelta   int
+}
+
+// moveDepartmentRow reparents a department in the departments table and recalculates the
+// level of its whole subtree. An empty newParentID moves the department to the root.
+func moveDepartmentRow(ctx context.Context, tx *gorm.DB, departmentID, newParentID string) (*departmentMove, error) {
+	// Step 1: Load the subtree (the department itself comes first)
+	subtree, err := loadDepartmentSubtree(ctx, tx, departmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	move := &departmentMove{
+		DepartmentID: departmentID,
+		OldParentID:  subtree[0].ParentID,
+		Subtree:      subtree,
+	}
+
+	// Step 2: Validate the new parent and compute the new level
+	newLevel := 1
+	if newParentID != "" {
+		for _, d := range subtree {
+			if d.ID == newParentID {
+				return nil, fmt.Errorf("%w: %s is inside the subtree of %s", ErrDepartmentCycle, newParentID, departmentID)
+			}
+		}
+
+		var parent model.Department
+		if err := tx.WithContext(ctx).Select("id", "level").Where("id = ?", newParentID).First(&parent).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: %s", ErrDepartmentNotFound, newParentID)
+			}
+			return nil, fmt.Errorf("failed to find new parent department: %w", err)
+		}
+		newLevel = parent.Level + 1
+		move.NewParentID = &newParentID
+	}
+
+	move.LevelDelta = newLevel - subtree[0].Level
+	for _, d := range subtree {
+		if d.Level+move.LevelDelta > maxDepartmentLevel {
+			return nil, fmt.Errorf("%w: %s would be at level %d", ErrDepartmentTooDeep, d.ID, d.Level+move.LevelDelta)
+		}
+	}
+
+	// Step 3: Update the parent link and the levels of the subtree
+	if err := tx.WithContext(ctx).Table("departments").
+		Where("id = ?", departmentID).
+		Update("parent_id", move.NewParentID).Error; err != nil {
+		return nil, fmt.Errorf("failed to update department parent: %w", err)
+	}
+
+	if move.LevelDelta != 0 {
+		subtreeIDs := move.SubtreeIDs()
+		for _, chunk := range chunkStrings(subtreeIDs, maxInClauseSize) {
+			if err := tx.WithContext(ctx).Table("departments").
+				Where("id IN ?", chunk).
+				Update("level", gorm.Expr("level + ?", move.LevelDelta)).Error; err != nil {
+				return nil, fmt.Errorf("failed to update department levels: %w", err)
+			}
+		}
+	}
+
+	return move, nil
+}
+
+// loadDepartmentSubtree returns a department followed by its descendants, breadth first
+func loadDepartmentSubtree(ctx context.Context, tx *gorm.DB, departmentID string) ([]departmentRow, error) {
+	var subtree []departmentRow
+	err := tx.WithContext(ctx).Raw(`
+		WITH RECURSIVE dept_tree AS (
+			SELECT id, parent_id, level, manager_id, 0 AS depth FROM departments WHERE id = ?
+			UNION ALL
+			SELECT d.id, d.parent_id, d.level, d.manager_id, dt.depth + 1 FROM departments d
+			INNER JOIN dept_tree dt ON d.parent_id = dt.id
+		)
+		SELECT id, parent_id, level, manager_id FROM dept_tree ORDER BY depth, id
+	`, departmentID).Scan(&subtree).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get department tree: %w", err)
+	}
+	if len(subtree) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDepartmentNotFound, departmentID)
+	}
+	return subtree, nil
+}
+
+// SubtreeIDs returns the IDs of the moved department and its descendants
+func (m *departmentMove) SubtreeIDs() []string {
+	ids := make([]string, len(m.Subtree))
+	for i, d := range m.Subtree {
+		ids[i] = d.ID
+	}
+	return ids
+}
+
+// relatedDepartments expands departmentIDs along department#parent tuples, up to maxDepth links.
+// With ancestors it follows child -> parent, otherwise parent -> child. The result includes
+// departmentIDs themselves.
+func relatedDepartments(ctx context.Context, db *gorm.DB, departmentIDs []string, ancestors bool, maxDepth int) ([]string, error) {
+	fromColumn, toColumn := "subject_id", "object_id"
+	if ancestors {
+		fromColumn, toColumn = "object_id", "subject_id"
+	}
+
+	visited := make(map[string]bool, len(departmentIDs))
+	all := make([]string, 0, len(departmentIDs))
+	for _, id := range departmentIDs {
+		if !visited[id] {
+			visited[id] = true
+			all = append(all, id)
+		}
+	}
+	current := all
+
+	for depth := 0; depth < maxDepth && len(current) > 0; depth++ {
+		var next []string
+		for _, chunk := range chunkStrings(current, maxInClauseSize) {
+			var ids []string
+			if err := db.WithContext(ctx).Model(&model.RelationTuple{}).
+				Scopes(unexpired, unconditional).
+				Where("namespace = ? AND relation = ? AND subject_namespace = ? AND "+fromColumn+" IN ?",
+					"department", "parent", "department", chunk).
+				Pluck(toColumn, &ids).Error; err != nil {
+				return nil, fmt.Errorf("failed to load department parents: %w", err)
+			}
+			for _, id := range ids {
+				if !visited[id] {
+					visited[id] = true
+					all = append(all, id)
+					next = append(next, id)
+				}
+			}
+		}
+		current = next
+	}
+
+	return all, nil
+}
+
+// departmentMerge describes the departments table changes of a merge
+type departmentMerge struct {
+	SourceID    string
+	TargetID    string
+	ChildIDs    []string // direct children of the source, now below the target
+	SubtreeIDs  []string // target subtree after the merge, plus the source
+	MemberIDs   []string // members of the source, now members of the target
+	RowsTouched int64
+}
+
+// mergeDepartmentRows moves the members and child departments of sourceID into targetID.
+// The source department row itself is left for the caller to delete once its relations
+// have been unwound.
+func mergeDepartmentRows(ctx context.Context, tx *gorm.DB, sourceID, targetID string) (*departmentMerge, error) {
+	if sourceID == targetID {
+		return nil, fmt.Errorf("%w: cannot merge %s into itself", ErrDepartmentCycle, sourceID)
+	}
+
+	// Step 1: Validate both departments; the target must not be below the source
+	sourceTree, err := loadDepartmentSubtree(ctx, tx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range sourceTree {
+		if d.ID == targetID {
+			return nil, fmt.Errorf("%w: %s is inside the subtree of %s", ErrDepartmentCycle, targetID, sourceID)
+		}
+	}
+	if _, err := loadDepartmentSubtree(ctx, tx, targetID); err != nil {
+		return nil, err
+	}
+
+	merge := &departmentMerge{SourceID: sourceID, TargetID: targetID}
+
+	// Step 2: Reparent the direct children of the source
+	for _, d := range sourceTree[1:] {
+		if d.ParentID == nil || *d.ParentID != sourceID {
+			continue
+		}
+		move, err := moveDepartmentRow(ctx, tx, d.ID, targetID)
+		if err != nil {
+			return nil, err
+		}
+		merge.ChildIDs = append(merge.ChildIDs, d.ID)
+		merge.RowsTouched += int64(len(move.Subtree))
+	}
+
+	// Step 3: Move the memberships; users already in the target keep their target membership
+	var memberships []model.UserDepartment
+	if err := tx.WithContext(ctx).Where("department_id = ?", sourceID).Find(&memberships).Error; err != nil {
+		return nil, fmt.Errorf("failed to find department members: %w", err)
+	}
+	for _, ud := range memberships {
+		merge.MemberIDs = append(merge.MemberIDs, ud.UserID)
+	}
+
+	if len(merge.MemberIDs) > 0 {
+		var targetMembers []string
+		if err := tx.WithContext(ctx).Model(&model.UserDepartment{}).
+			Where("department_id = ?", targetID).
+			Pluck("user_id", &targetMembers).Error; err != nil {
+			return nil, fmt.Errorf("failed to find target members: %w", err)
+		}
+		for _, chunk := range chunkStrings(targetMembers, maxInClauseSize) {
+			res := tx.WithContext(ctx).
+				Where("department_id = ? AND user_id IN ?", sourceID, chunk).
+				Delete(&model.UserDepartment{})
+			if res.Error != nil {
+				return nil, fmt.Errorf("failed to delete duplicate memberships: %w", res.Error)
+			}
+			merge.RowsTouched += res.RowsAffected
+		}
+
+		res := tx.WithContext(ctx).Model(&model.UserDepartment{}).
+			Where("department_id = ?", sourceID).
+			Update("department_id", targetID)
+		if res.Error != nil {
+			return nil, fmt.Errorf("failed to move department members: %w", res.Error)
+		}
+		merge.RowsTouched += res.RowsAffected
+	}
+
+	targetTree, err := loadDepartmentSubtree(ctx, tx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range targetTree {
+		merge.SubtreeIDs = append(merge.SubtreeIDs, d.ID)
+	}
+	merge.SubtreeIDs = append(merge.SubtreeIDs, sourceID)
+
+	return merge, nil
+}
+
+// departmentSplit describes the departments table changes of a split
+type departmentSplit struct {
+	SourceID    string
+	NewID       string
+	ParentID    *string
+	ManagerID   *string
+	MemberIDs   []string
+	RowsTouched int64
+}
+
+// splitDepartmentRows creates newID as a sibling of sourceID and moves memberIDs into it.
+// An empty managerID leaves the new department without a manager.
+func splitDepartmentRows(ctx context.Context, tx *gorm.DB, sourceID, newID, newName, managerID string, memberIDs []string) (*departmentSplit, error) {
+	// Step 1: Validate the source and the members
+	var source model.Department
+	if err := tx.WithContext(ctx).Where("id = ?", sourceID).First(&source).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrDepartmentNotFound, sourceID)
+		}
+		return nil, fmt.Errorf("failed to find department: %w", err)
+	}
+
+	var existing int64
+	if err := tx.WithContext(ctx).Model(&model.Department{}).Where("id = ?", newID).Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check new department: %w", err)
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDepartmentExists, newID)
+	}
+
+	memberIDs = uniqueStrings(memberIDs)
+	var found []string
+	for _, chunk := range chunkStrings(memberIDs, maxInClauseSize) {
+		var ids []string
+		if err := tx.WithContext(ctx).Model(&model.UserDepartment{}).
+			Where("department_id = ? AND user_id IN ?", sourceID, chunk).
+			Pluck("user_id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to find department members: %w", err)
+		}
+		found = append(found, ids...)
+	}
+	if len(found) != len(memberIDs) {
+		foundSet := make(map[string]bool, len(found))
+		for _, id := range found {
+			foundSet[id] = true
+		}
+		for _, id := range memberIDs {
+			if !foundSet[id] {
+				return nil, fmt.Errorf("%w: %s is not in %s", ErrNotDepartmentMember, id, sourceID)
+			}
+		}
+	}
+
+	split := &departmentSplit{SourceID: sourceID, NewID: newID, ParentID: source.ParentID, MemberIDs: memberIDs}
+	if managerID != "" {
+		split.ManagerID = &managerID
+	}
+
+	// Step 2: Create the sibling department
+	dept := model.Department{
+		ID:        newID,
+		Name:      newName,
+		ParentID:  source.ParentID,
+		Level:     source.Level,
+		ManagerID: split.ManagerID,
+	}
+	if err := tx.WithContext(ctx).Omit(clause.Associations).Create(&dept).Error; err != nil {
+		return nil, fmt.Errorf("failed to create department: %w", err)
+	}
+	split.RowsTouched++
+
+	// Step 3: Move the members
+	for _, chunk := range chunkStrings(memberIDs, maxInClauseSize) {
+		res := tx.WithContext(ctx).Model(&model.UserDepartment{}).
+			Where("department_id = ? AND user_id IN ?", sourceID, chunk).
+			Update("department_id", newID)
+		if res.Error != nil {
+			return nil, fmt.Errorf("failed to move department members: %w", res.Error)
+		}
+		split.RowsTouched += res.RowsAffected
+	}
+
+	return split, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// EntityAttributeRepository reads and replaces the attributes of users, documents and
+// customers that attribute rules reference. Rules read attributes on every check and
+// list, so a change takes effect immediately in both engines.
+type EntityAttributeRepository struct {
+	db *gorm.DB
+}
+
+// NewEntityAttributeRepository creates a new entity attribute repository
+func NewEntityAttributeRepository(db *gorm.DB) *EntityAttributeRepository {
+	return &EntityAttributeRepository{db: db}
+}
+
+// Attributes returns the attributes of an entity
+func (r *EntityAttributeRepository) Attributes(ctx context.Context, entity, id string) (model.Attributes, error) {
+	table, err := softDeleteTable(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Attributes model.Attributes
+	}
+	if err := r.db.WithContext(ctx).Table(table).Select("attributes").Where("id = ?", id).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load %s attributes: %w", entity, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrEntityNotFound, entity, id)
+	}
+	return rows[0].Attributes, nil
+}
+
+// SetAttributes replaces the attributes of an entity; empty attributes clear them
+func (r *EntityAttributeRepository) SetAttributes(ctx context.Context, entity, id string, attrs model.Attributes) error {
+	table, err := softDeleteTable(entity)
+	if err != nil {
+		return err
+	}
+	ctx, span := tracer.Start(ctx, "entity.set_attributes")
+	span.SetAttributes(attribute.String("entity", entity), attribute.String("entity.id", id))
+
+	if len(attrs) == 0 {
+		attrs = nil
+	}
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Table(table).Where("id = ?", id).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to load %s: %w", entity, err)
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: %s %s", ErrEntityNotFound, entity, id)
+		}
+		if err := tx.Table(table).Where("id = ?", id).Update("attributes", attrs).Error; err != nil {
+			return fmt.Errorf("failed to update %s attributes: %w", entity, err)
+		}
+		return nil
+	})
+	endSpan(span, err)
+	return err
+}
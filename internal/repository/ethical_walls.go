@@ -0,0 +1,676 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+var (
+	// ErrCustomerConflict is returned when a new follower of a customer already follows a competitor
+	ErrCustomerConflict = errors.New("customer conflict")
+	// ErrConflictOverrideDenied is returned when a conflict override names a user who is not a superuser
+	ErrConflictOverrideDenied = errors.New("conflict override denied")
+	// ErrUnknownFollowerConflictMode is returned for a follower conflict mode other than refuse or warn
+	ErrUnknownFollowerConflictMode = errors.New("unknown follower conflict mode")
+)
+
+// Modes of adding a follower who already follows a competitor of the customer
+const (
+	FollowerConflictRefuse = "refuse" // Fail with ErrCustomerConflict unless a superuser overrides
+	FollowerConflictWarn   = "warn"   // Add the follower and record the conflict on the span
+)
+
+// EthicalWalls keep staff who follow a customer from the documents of its competitors,
+// the other customers of its conflict groups. A user is walled from a document when they
+// follow a competitor of its customer but not the customer itself, so following both,
+// which only an override allows, lifts the wall. Access through the manager chain flows
+// through a subordinate: a document reaching a manager only that way is denied when its
+// owner is walled from it and no subordinate follows its customer.
+//
+// Engines apply the walls after resolving relationships, like attribute rules, in checks,
+// batch checks, lists, counts and lookups; Expand and LookupSubjects report relationships
+// only. Conflict groups are read on every call, so changes apply immediately.
+type EthicalWalls struct {
+	followerConflict string
+}
+
+// NewEthicalWalls creates ethical walls; followerConflict is refuse (the default) or warn
+func NewEthicalWalls(followerConflict string) (*EthicalWalls, error) {
+	switch followerConflict {
+	case "":
+		followerConflict = FollowerConflictRefuse
+	case FollowerConflictRefuse, FollowerConflictWarn:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFollowerConflictMode, followerConflict)
+	}
+	return &EthicalWalls{followerConflict: followerConflict}, nil
+}
+
+// UseEthicalWalls enforces walls on checks, lists, counts and lookups and guards
+// AddCustomerFollower; nil disables them
+func (r *ZanzibarPermissionRepository) UseEthicalWalls(walls *EthicalWalls) {
+	r.walls = walls
+}
+
+// UseEthicalWalls enforces walls on checks, lists and lookups and guards
+// AddCustomerFollowerPermissions; nil disables them
+func (r *MySQLPermissionRepository) UseEthicalWalls(walls *EthicalWalls) {
+	r.walls = walls
+}
+
+type conflictOverrideKey struct{}
+
+// WithConflictOverride lets followers added with ctx follow competing customers.
+// adminID must be a superuser; the override is recorded on the span of the mutation.
+func WithConflictOverride(ctx context.Context, adminID string) context.Context {
+	return context.WithValue(ctx, conflictOverrideKey{}, adminID)
+}
+
+// conflictOverrideFor returns the admin overriding conflicts in ctx, or ""
+func conflictOverrideFor(ctx context.Context) string {
+	adminID, _ := ctx.Value(conflictOverrideKey{}).(string)
+	return adminID
+}
+
+// wallGraph is the part of an engine's relationships ethical walls read
+type wallGraph interface {
+	// followedCustomers returns the customers each of userIDs follows
+	followedCustomers(ctx context.Context, userIDs []string) (map[string]map[string]bool, error)
+	// managerChainOnly returns the documents among documentIDs that reach userID through
+	// the manager chain only, not as a superuser, a direct grant or an owner
+	managerChainOnly(ctx context.Context, userID, permissionType string, documentIDs []string) (map[string]bool, error)
+	// documentOwners returns the owners of each document
+	documentOwners(ctx context.Context, documentIDs []string) (map[string][]string, error)
+	// managesFollower reports whether a follower of customerID is a subordinate of managerID
+	managesFollower(ctx context.Context, managerID, customerID string) (bool, error)
+	// isSuperuser reports whether userID is a superuser
+	isSuperuser(ctx context.Context, userID string) (bool, error)
+}
+
+// documentConflict is the customer of a document in a conflict group and its competitors
+type documentConflict struct {
+	customerID  string
+	competitors []string
+}
+
+// walls reports whether a user following follows is walled from the document
+func (c *documentConflict) walls(follows map[string]bool) bool {
+	if follows[c.customerID] {
+		return false
+	}
+	for _, competitor := range c.competitors {
+		if follows[competitor] {
+			return true
+		}
+	}
+	return false
+}
+
+// competitorsOf returns the competitors of each of customerIDs that is in a conflict group
+func competitorsOf(ctx context.Context, db *gorm.DB, customerIDs []string) (map[string][]string, error) {
+	competitors := make(map[string][]string)
+	for _, chunk := range chunkStrings(uniqueStrings(customerIDs), maxInClauseSize) {
+		var rows []struct {
+			CustomerID   string
+			CompetitorID string
+		}
+		if err := db.WithContext(ctx).Table("customer_conflict_members AS members").
+			Select("DISTINCT members.customer_id, competitors.customer_id AS competitor_id").
+			Joins("JOIN customer_conflict_members AS competitors ON competitors.group_id = members.group_id AND competitors.customer_id <> members.customer_id").
+			Where("members.customer_id IN ?", chunk).
+			Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to load conflict groups: %w", err)
+		}
+		for _, row := range rows {
+			competitors[row.CustomerID] = append(competitors[row.CustomerID], row.CompetitorID)
+		}
+	}
+	return competitors, nil
+}
+
+// documentConflicts returns the conflicts of the documents among documentIDs whose
+// customer is in a conflict group
+func documentConflicts(ctx context.Context, db *gorm.DB, documentIDs []string) (map[string]*documentConflict, error) {
+	conflicts := make(map[string]*documentConflict)
+	for _, chunk := range chunkStrings(uniqueStrings(documentIDs), maxInClauseSize) {
+		var rows []struct {
+			DocumentID   string
+			CustomerID   string
+			CompetitorID string
+		}
+		if err := db.WithContext(ctx).Table("documents").
+			Select("DISTINCT documents.id AS document_id, documents.customer_id, competitors.customer_id AS competitor_id").
+			Joins("JOIN customer_conflict_members AS members ON members.customer_id = documents.customer_id").
+			Joins("JOIN customer_conflict_members AS competitors ON competitors.group_id = members.group_id AND competitors.customer_id <> members.customer_id").
+			Where("documents.id IN ?", chunk).
+			Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to load document conflicts: %w", err)
+		}
+		for _, row := range rows {
+			conflict, ok := conflicts[row.DocumentID]
+			if !ok {
+				conflict = &documentConflict{customerID: row.CustomerID}
+				conflicts[row.DocumentID] = conflict
+			}
+			conflict.competitors = append(conflict.competitors, row.CompetitorID)
+		}
+	}
+	return conflicts, nil
+}
+
+// walledCustomers returns the customers whose documents a user following follows is
+// walled from: the competitors of the followed customers the user does not follow
+func walledCustomers(ctx context.Context, db *gorm.DB, follows map[string]bool) ([]string, error) {
+	followed := make([]string, 0, len(follows))
+	for customerID := range follows {
+		followed = append(followed, customerID)
+	}
+	competitors, err := competitorsOf(ctx, db, followed)
+	if err != nil {
+		return nil, err
+	}
+
+	var walled []string
+	for _, ids := range competitors {
+		for _, id := range ids {
+			if !follows[id] {
+				walled = append(walled, id)
+			}
+		}
+	}
+	walled = uniqueStrings(walled)
+	sort.Strings(walled)
+	return walled, nil
+}
+
+// followConflicts returns the competitors of customerID that userID follows, unless
+// userID already follows customerID
+func followConflicts(ctx context.Context, db *gorm.DB, graph wallGraph, customerID, userID string) ([]string, error) {
+	competitors, err := competitorsOf(ctx, db, []string{customerID})
+	if err != nil || len(competitors[customerID]) == 0 {
+		return nil, err
+	}
+	follows, err := graph.followedCustomers(ctx, []string{userID})
+	if err != nil {
+		return nil, err
+	}
+	if follows[userID][customerID] {
+		return nil, nil
+	}
+
+	var conflicts []string
+	for _, competitor := range competitors[customerID] {
+		if follows[userID][competitor] {
+			conflicts = append(conflicts, competitor)
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts, nil
+}
+
+// FollowConflicts returns the competitors of customerID that userID follows; a
+// non-empty result means following customerID would need an override
+func (r *ZanzibarPermissionRepository) FollowConflicts(ctx context.Context, customerID, userID string) ([]string, error) {
+	return followConflicts(ctx, r.db, r, customerID, userID)
+}
+
+// FollowConflicts returns the competitors of customerID that userID follows; a
+// non-empty result means following customerID would need an override
+func (r *MySQLPermissionRepository) FollowConflicts(ctx context.Context, customerID, userID string) ([]string, error) {
+	return followConflicts(ctx, r.db, r, customerID, userID)
+}
+
+// guardFollow decides whether userID may start following customerID. A conflict is
+// refused with ErrCustomerConflict unless ctx carries an override by a superuser; in
+// warn mode, and when overridden, it is recorded on the span of the mutation.
+func (w *EthicalWalls) guardFollow(ctx context.Context, db *gorm.DB, graph wallGraph, customerID, userID string) error {
+	if w == nil {
+		return nil
+	}
+	conflicts, err := followConflicts(ctx, db, graph, customerID, userID)
+	if err != nil || len(conflicts) == 0 {
+		return err
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.StringSlice("conflicts", conflicts))
+	if adminID := conflictOverrideFor(ctx); adminID != "" {
+		isSuperuser, err := graph.isSuperuser(ctx, adminID)
+		if err != nil {
+			return err
+		}
+		if !isSuperuser {
+			return fmt.Errorf("%w: %s is not a superuser", ErrConflictOverrideDenied, adminID)
+		}
+		span.SetAttributes(attribute.String("conflicts.overridden_by", adminID))
+		return nil
+	}
+	if w.followerConflict == FollowerConflictWarn {
+		return nil
+	}
+	return fmt.Errorf("%w: %s follows %s, competing with %s", ErrCustomerConflict, userID, strings.Join(conflicts, ", "), customerID)
+}
+
+// denied returns the documents among documentIDs the walls keep from userID
+func (w *EthicalWalls) denied(ctx context.Context, db *gorm.DB, graph wallGraph, userID, permissionType string, documentIDs []string) (map[string]bool, error) {
+	conflicts, err := documentConflicts(ctx, db, documentIDs)
+	if err != nil || len(conflicts) == 0 {
+		return nil, err
+	}
+	follows, err := graph.followedCustomers(ctx, []string{userID})
+	if err != nil {
+		return nil, err
+	}
+
+	// The wall on the user; a follower of the customer has a route of their own
+	denied := make(map[string]bool)
+	var pending []string
+	for docID, conflict := range conflicts {
+		switch {
+		case conflict.walls(follows[userID]):
+			denied[docID] = true
+		case !follows[userID][conflict.customerID]:
+			pending = append(pending, docID)
+		}
+	}
+	if len(pending) == 0 {
+		return denied, nil
+	}
+
+	// The wall on the subordinate the manager chain runs through
+	only, err := graph.managerChainOnly(ctx, userID, permissionType, pending)
+	if err != nil || len(only) == 0 {
+		return denied, err
+	}
+	managed := make([]string, 0, len(only))
+	for docID := range only {
+		managed = append(managed, docID)
+	}
+	sort.Strings(managed)
+
+	owners, err := graph.documentOwners(ctx, managed)
+	if err != nil {
+		return nil, err
+	}
+	var ownerIDs []string
+	for _, ids := range owners {
+		ownerIDs = append(ownerIDs, ids...)
+	}
+	ownerFollows, err := graph.followedCustomers(ctx, uniqueStrings(ownerIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	followerRoutes := make(map[string]bool) // customerID -> a subordinate follows it
+	for _, docID := range managed {
+		conflict := conflicts[docID]
+		if len(owners[docID]) == 0 {
+			continue
+		}
+		walled := true
+		for _, ownerID := range owners[docID] {
+			walled = walled && conflict.walls(ownerFollows[ownerID])
+		}
+		if !walled {
+			continue
+		}
+
+		routed, ok := followerRoutes[conflict.customerID]
+		if !ok {
+			if routed, err = graph.managesFollower(ctx, userID, conflict.customerID); err != nil {
+				return nil, err
+			}
+			followerRoutes[conflict.customerID] = routed
+		}
+		if !routed {
+			denied[docID] = true
+		}
+	}
+	return denied, nil
+}
+
+// enforceCheck denies a granted check the walls keep from userID
+func (w *EthicalWalls) enforceCheck(ctx context.Context, db *gorm.DB, graph wallGraph, engine, userID, documentID, permissionType string, result *model.PermissionCheckResult) (*model.PermissionCheckResult, error) {
+	if w == nil || !result.HasPermission {
+		return result, nil
+	}
+
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, engine+".check.ethical_wall")
+	denied, err := w.denied(ctx, db, graph, userID, permissionType, []string{documentID})
+	endSpan(span, err, attribute.Bool("denied", denied[documentID]))
+	if err != nil {
+		return nil, err
+	}
+	if !denied[documentID] {
+		return result, nil
+	}
+
+	return &model.PermissionCheckResult{
+		HasPermission:       false,
+		DeniedByEthicalWall: true,
+		DurationMs:          result.DurationMs + float64(time.Since(start).Milliseconds()),
+	}, nil
+}
+
+// enforceBatch clears the documents of a batch check the walls keep from userID
+func (w *EthicalWalls) enforceBatch(ctx context.Context, db *gorm.DB, graph wallGraph, engine, userID, permissionType string, result map[string]bool) error {
+	if w == nil {
+		return nil
+	}
+
+	granted := make([]string, 0, len(result))
+	for docID, ok := range result {
+		if ok {
+			granted = append(granted, docID)
+		}
+	}
+	if len(granted) == 0 {
+		return nil
+	}
+
+	ctx, span := tracer.Start(ctx, engine+".check_batch.ethical_wall")
+	denied, err := w.denied(ctx, db, graph, userID, permissionType, granted)
+	for docID := range denied {
+		result[docID] = false
+	}
+	endSpan(span, err, attribute.Int("denied", len(denied)))
+	return err
+}
+
+// filterDocuments returns the documents among documentIDs, in order, that the walls
+// do not keep from userID
+func (w *EthicalWalls) filterDocuments(ctx context.Context, db *gorm.DB, graph wallGraph, userID, permissionType string, documentIDs []string) ([]string, error) {
+	if w == nil || len(documentIDs) == 0 {
+		return documentIDs, nil
+	}
+
+	ctx, span := tracer.Start(ctx, "ethical_wall.filter")
+	denied, err := w.denied(ctx, db, graph, userID, permissionType, documentIDs)
+	kept := documentIDs
+	if len(denied) > 0 {
+		kept = make([]string, 0, len(documentIDs))
+		for _, id := range documentIDs {
+			if !denied[id] {
+				kept = append(kept, id)
+			}
+		}
+	}
+	endSpan(span, err, attribute.Int("candidates", len(documentIDs)), attribute.Int("denied", len(denied)))
+	return kept, err
+}
+
+// documentScope restricts a query to the documents the walls do not keep from userID,
+// column holding the document ID. The wall on the user is pushed into SQL; the wall on
+// the subordinate is evaluated on the documents returned by managed, those that may
+// reach userID through the manager chain only. A nil managed skips it. Without walls
+// the scope is a no-op.
+func (w *EthicalWalls) documentScope(ctx context.Context, db *gorm.DB, graph wallGraph, userID, permissionType, column string, managed func() ([]string, error)) (func(*gorm.DB) *gorm.DB, error) {
+	if w == nil {
+		return func(db *gorm.DB) *gorm.DB { return db }, nil
+	}
+
+	follows, err := graph.followedCustomers(ctx, []string{userID})
+	if err != nil {
+		return nil, err
+	}
+	walled, err := walledCustomers(ctx, db, follows[userID])
+	if err != nil {
+		return nil, err
+	}
+
+	var denied []string
+	if managed != nil {
+		ids, err := managed()
+		if err != nil {
+			return nil, err
+		}
+		deniedSet, err := w.denied(ctx, db, graph, userID, permissionType, ids)
+		if err != nil {
+			return nil, err
+		}
+		for id := range deniedSet {
+			denied = append(denied, id)
+		}
+		sort.Strings(denied)
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		if len(walled) > 0 {
+			db = db.Where(column+" NOT IN (SELECT documents.id FROM documents WHERE documents.customer_id IN ?)", walled)
+		}
+		if len(denied) > 0 {
+			db = db.Where(column+" NOT IN ?", denied)
+		}
+		return db
+	}, nil
+}
+
+// conflictedDocuments restricts a query to documents whose customer is in a conflict
+// group, column holding the document ID
+func conflictedDocuments(column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(column + " IN (SELECT documents.id FROM documents JOIN customer_conflict_members ON customer_conflict_members.customer_id = documents.customer_id)")
+	}
+}
+
+// followedCustomers returns the customers each user follows through unexpired
+// follower tuples, conditional ones included
+func (r *ZanzibarPermissionRepository) followedCustomers(ctx context.Context, userIDs []string) (map[string]map[string]bool, error) {
+	follows := make(map[string]map[string]bool, len(userIDs))
+	for _, chunk := range chunkStrings(userIDs, maxInClauseSize) {
+		var tuples []model.RelationTuple
+		if err := r.db.WithContext(ctx).
+			Select("object_id", "subject_id").
+			Scopes(unexpired).
+			Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
+				"customer", "follower", "user", chunk).
+			Find(&tuples).Error; err != nil {
+			return nil, fmt.Errorf("failed to load followed customers: %w", err)
+		}
+		for _, tuple := range tuples {
+			if follows[tuple.SubjectID] == nil {
+				follows[tuple.SubjectID] = make(map[string]bool)
+			}
+			follows[tuple.SubjectID][tuple.ObjectID] = true
+		}
+	}
+	return follows, nil
+}
+
+// managerChainOnly drops the documents a superuser reaches and those with a tuple of
+// their own for userID, conditional ones included
+func (r *ZanzibarPermissionRepository) managerChainOnly(ctx context.Context, userID, permissionType string, documentIDs []string) (map[string]bool, error) {
+	isSuperuser, err := r.checkSuperuserPermission(ctx, userID)
+	if err != nil || isSuperuser {
+		return nil, err
+	}
+
+	only := toSet(documentIDs)
+	for _, chunk := range chunkStrings(documentIDs, maxInClauseSize) {
+		var own []string
+		if err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+			Scopes(unexpired).
+			Where("namespace = ? AND object_id IN ? AND subject_namespace = ? AND subject_id = ?",
+				"document", chunk, "user", userID).
+			Pluck("object_id", &own).Error; err != nil {
+			return nil, fmt.Errorf("failed to load document tuples: %w", err)
+		}
+		for _, docID := range own {
+			delete(only, docID)
+		}
+	}
+	return only, nil
+}
+
+// documentOwners returns the subjects of the owner tuples of each document
+func (r *ZanzibarPermissionRepository) documentOwners(ctx context.Context, documentIDs []string) (map[string][]string, error) {
+	owners := make(map[string][]string)
+	for _, chunk := range chunkStrings(documentIDs, maxInClauseSize) {
+		var tuples []model.RelationTuple
+		if err := r.db.WithContext(ctx).
+			Select("object_id", "subject_id").
+			Scopes(unexpired, unconditional).
+			Where("namespace = ? AND object_id IN ? AND relation = ? AND subject_namespace = ?",
+				"document", chunk, "owner", "user").
+			Find(&tuples).Error; err != nil {
+			return nil, fmt.Errorf("failed to load document owners: %w", err)
+		}
+		for _, tuple := range tuples {
+			owners[tuple.ObjectID] = append(owners[tuple.ObjectID], tuple.SubjectID)
+		}
+	}
+	return owners, nil
+}
+
+// managesFollower looks for a follower of customerID among the subordinates of managerID
+func (r *ZanzibarPermissionRepository) managesFollower(ctx context.Context, managerID, customerID string) (bool, error) {
+	var followerIDs []string
+	if err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Scopes(unexpired, unconditional).
+		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ?",
+			"customer", customerID, "follower", "user").
+		Pluck("subject_id", &followerIDs).Error; err != nil {
+		return false, fmt.Errorf("failed to load customer followers: %w", err)
+	}
+	if len(followerIDs) == 0 {
+		return false, nil
+	}
+
+	subordinateIDs, err := r.getAllSubordinates(ctx, managerID, managerChainMaxDepth)
+	if err != nil {
+		return false, err
+	}
+	followers := toSet(followerIDs)
+	for _, id := range subordinateIDs {
+		if followers[id] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isSuperuser reports whether userID holds system:root#admin
+func (r *ZanzibarPermissionRepository) isSuperuser(ctx context.Context, userID string) (bool, error) {
+	return r.checkSuperuserPermission(ctx, userID)
+}
+
+// followedCustomers returns the customers each user follows, from customer_followers
+// and the follower rows expanded from it
+func (r *MySQLPermissionRepository) followedCustomers(ctx context.Context, userIDs []string) (map[string]map[string]bool, error) {
+	follows := make(map[string]map[string]bool, len(userIDs))
+	add := func(userID, customerID string) {
+		if follows[userID] == nil {
+			follows[userID] = make(map[string]bool)
+		}
+		follows[userID][customerID] = true
+	}
+
+	for _, chunk := range chunkStrings(userIDs, maxInClauseSize) {
+		var followers []model.CustomerFollower
+		if err := r.db.WithContext(ctx).
+			Select("customer_id", "user_id").
+			Where("user_id IN ?", chunk).
+			Find(&followers).Error; err != nil {
+			return nil, fmt.Errorf("failed to load followed customers: %w", err)
+		}
+		for _, follower := range followers {
+			add(follower.UserID, follower.CustomerID)
+		}
+
+		var rows []model.DocumentPermissionMySQL
+		if err := r.db.WithContext(ctx).
+			Distinct("user_id", "source_id").
+			Where("user_id IN ? AND source_type = ?", chunk, model.SourceTypeCustomerFollower).
+			Scopes(unexpired).
+			Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to load follower permissions: %w", err)
+		}
+		for _, row := range rows {
+			if row.SourceID != nil {
+				add(row.UserID, *row.SourceID)
+			}
+		}
+	}
+	return follows, nil
+}
+
+// managerChainOnly returns the documents whose row for userID records the manager
+// chain; superusers reach every document as superusers
+func (r *MySQLPermissionRepository) managerChainOnly(ctx context.Context, userID, permissionType string, documentIDs []string) (map[string]bool, error) {
+	isSuperuser, err := r.isSuperuser(ctx, userID)
+	if err != nil || isSuperuser {
+		return nil, err
+	}
+
+	only := make(map[string]bool)
+	for _, chunk := range chunkStrings(documentIDs, maxInClauseSize) {
+		var ids []string
+		if err := r.db.WithContext(ctx).Model(&model.DocumentPermissionMySQL{}).
+			Where("user_id = ? AND document_id IN ? AND permission_type = ? AND source_type = ?",
+				userID, chunk, permissionType, model.SourceTypeManagerChain).
+			Scopes(liveRows).
+			Pluck("document_id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to load manager chain permissions: %w", err)
+		}
+		for _, id := range ids {
+			only[id] = true
+		}
+	}
+	return only, nil
+}
+
+// documentOwners returns the creator of each document
+func (r *MySQLPermissionRepository) documentOwners(ctx context.Context, documentIDs []string) (map[string][]string, error) {
+	owners := make(map[string][]string)
+	for _, chunk := range chunkStrings(documentIDs, maxInClauseSize) {
+		var documents []model.Document
+		if err := r.db.WithContext(ctx).
+			Select("id", "creator_id").
+			Where("id IN ?", chunk).
+			Find(&documents).Error; err != nil {
+			return nil, fmt.Errorf("failed to load document creators: %w", err)
+		}
+		for _, doc := range documents {
+			owners[doc.ID] = append(owners[doc.ID], doc.CreatorID)
+		}
+	}
+	return owners, nil
+}
+
+// managesFollower looks for a follower of customerID among the subordinates of
+// managerID in management_relations
+func (r *MySQLPermissionRepository) managesFollower(ctx context.Context, managerID, customerID string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.ManagementRelation{}).
+		Where("manager_user_id = ?", managerID).
+		Where("(subordinate_user_id IN (SELECT user_id FROM customer_followers WHERE customer_id = ?) OR "+
+			"subordinate_user_id IN (SELECT user_id FROM document_permissions_mysql WHERE source_type = ? AND source_id = ?))",
+			customerID, model.SourceTypeCustomerFollower, customerID).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to find subordinate followers: %w", err)
+	}
+	return count > 0, nil
+}
+
+// isSuperuser reports whether userID is flagged as a superuser
+func (r *MySQLPermissionRepository) isSuperuser(ctx context.Context, userID string) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&model.User{}).
+		Where("id = ? AND is_superuser = ?", userID, true).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to find user: %w", err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// TestEthicalWalls tests that both engines keep followers of a customer, and managers whose
+// access flows through such followers, from the documents of competing customers, and that
+// following a competitor is refused unless a superuser overrides
+func TestEthicalWalls(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	mysqlRepo := NewMySQLPermissionRepository(db)
+	zanzibarRepo := NewZanzibarPermissionRepository(db)
+	conflicts := NewCustomerConflictRepository(db)
+	ctx := context.Background()
+
+	const (
+		groupID   = "ew-banks"
+		bankA     = "ew-bank-a"
+		bankB     = "ew-bank-b"
+		deptID    = "ew-dept"
+		analystID = "ew-analyst" // Follows bank A, granted bank B's document directly
+		aliceID   = "ew-alice"   // Follows bank A, owns both documents
+		bobID     = "ew-bob"     // Follows bank B after joining the department
+		managerID = "ew-manager" // Manages the department
+		adminID   = "ew-admin"   // Superuser
+		docA      = "ew-doc-a"
+		docB      = "ew-doc-b"
+	)
+	userIDs := []string{analystID, aliceID, bobID, managerID, adminID}
+	docIDs := []string{docA, docB}
+	customerIDs := []string{bankA, bankB}
+
+	cleanup := func() {
+		db.Where("user_id IN ? OR document_id IN ?", userIDs, docIDs).Delete(&model.DocumentPermissionMySQL{})
+		db.Where("namespace = ? AND object_id IN ?", "document", docIDs).Delete(&model.RelationTuple{})
+		db.Where("namespace = ? AND object_id IN ?", "customer", customerIDs).Delete(&model.RelationTuple{})
+		db.Where("namespace = ? AND object_id = ?", "department", deptID).Delete(&model.RelationTuple{})
+		db.Where("namespace = ? AND object_id = ? AND subject_id = ?", "system", "root", adminID).Delete(&model.RelationTuple{})
+		db.Where("manager_user_id = ?", managerID).Delete(&model.ManagementRelation{})
+		db.Where("customer_id IN ?", customerIDs).Delete(&model.CustomerFollower{})
+		db.Where("group_id = ?", groupID).Delete(&model.CustomerConflictMember{})
+		db.Where("id IN ?", docIDs).Delete(&model.Document{})
+		db.Where("id IN ?", customerIDs).Delete(&model.Customer{})
+		db.Where("id = ?", deptID).Delete(&model.Department{})
+		db.Where("id IN ?", userIDs).Delete(&model.User{})
+	}
+	cleanup()
+
+	for _, id := range userIDs {
+		createTestUser(db, id, id, id+"@test.com")
+	}
+	db.Model(&model.User{}).Where("id = ?", adminID).Update("is_superuser", true)
+	createTestCustomer(db, bankA, "Bank A")
+	createTestCustomer(db, bankB, "Bank B")
+	createTestDocument(db, docA, "Bank A plan", bankA, aliceID)
+	createTestDocument(db, docB, "Bank B plan", bankB, aliceID)
+	createTestDepartment(db, deptID, "Ethical Wall Desk", 1, nil)
+
+	walls, err := NewEthicalWalls(FollowerConflictRefuse)
+	require.NoError(t, err)
+	mysqlRepo.UseEthicalWalls(walls)
+	zanzibarRepo.UseEthicalWalls(walls)
+
+	// Both engines hold the same relationships: the analyst and alice follow bank A, the
+	// analyst is granted bank B's document, alice owns both documents and reports to the manager
+	_, err = zanzibarRepo.BulkInsertTuples(ctx, []model.RelationTuple{
+		{Namespace: "document", ObjectID: docA, Relation: "owner_customer", SubjectNamespace: "customer", SubjectID: bankA},
+		{Namespace: "document", ObjectID: docB, Relation: "owner_customer", SubjectNamespace: "customer", SubjectID: bankB},
+		{Namespace: "document", ObjectID: docA, Relation: "owner", SubjectNamespace: "user", SubjectID: aliceID},
+		{Namespace: "document", ObjectID: docB, Relation: "owner", SubjectNamespace: "user", SubjectID: aliceID},
+		{Namespace: "document", ObjectID: docB, Relation: "viewer", SubjectNamespace: "user", SubjectID: analystID},
+		{Namespace: "customer", ObjectID: bankA, Relation: "follower", SubjectNamespace: "user", SubjectID: analystID},
+		{Namespace: "customer", ObjectID: bankA, Relation: "follower", SubjectNamespace: "user", SubjectID: aliceID},
+		{Namespace: "department", ObjectID: deptID, Relation: "manager", SubjectNamespace: "user", SubjectID: managerID},
+		{Namespace: "department", ObjectID: deptID, Relation: "member", SubjectNamespace: "user", SubjectID: aliceID},
+		{Namespace: "system", ObjectID: "root", Relation: "admin", SubjectNamespace: "user", SubjectID: adminID},
+	}, 100)
+	require.NoError(t, err)
+
+	for _, id := range []string{analystID, aliceID} {
+		db.Create(&model.CustomerFollower{CustomerID: bankA, UserID: id})
+		require.NoError(t, mysqlRepo.AddCustomerFollowerPermissions(ctx, bankA, id))
+	}
+	require.NoError(t, mysqlRepo.GrantDirectPermission(ctx, analystID, docB, "viewer"))
+	require.NoError(t, mysqlRepo.GrantDirectPermission(ctx, aliceID, docB, "viewer"))
+	db.Create(&model.ManagementRelation{ManagerUserID: managerID, SubordinateUserID: aliceID, DepartmentID: deptID, ManagementLevel: 1})
+	creator := aliceID
+	for _, id := range docIDs {
+		db.Create(&model.DocumentPermissionMySQL{
+			UserID:         managerID,
+			DocumentID:     id,
+			PermissionType: "viewer",
+			SourceType:     model.SourceTypeManagerChain,
+			SourceID:       &creator,
+		})
+	}
+
+	// visible returns the documents each engine grants userID, checking that check,
+	// batch check, list and lookup agree
+	visible := func(userID string) map[string][]string {
+		out := make(map[string][]string)
+		for name, engine := range map[string]interface {
+			CheckPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error)
+			CheckPermissionsBatch(ctx context.Context, userID string, documentIDs []string, permissionType string) (map[string]bool, error)
+			GetUserDocuments(ctx context.Context, userID string, permissionType string, page, pageSize int) (*model.UserDocumentList, error)
+			LookupDocuments(ctx context.Context, userID, permissionType string, batchSize int, yield func(documentIDs []string) error) error
+		}{model.EngineMySQL: mysqlRepo, model.EngineZanzibar: zanzibarRepo} {
+			batch, err := engine.CheckPermissionsBatch(ctx, userID, docIDs, "viewer")
+			require.NoError(t, err)
+			list, err := engine.GetUserDocuments(ctx, userID, "viewer", 1, 10)
+			require.NoError(t, err)
+			listed := []string{}
+			for _, doc := range list.Documents {
+				listed = append(listed, doc.ID)
+			}
+			assert.Equal(t, int64(len(listed)), list.Total, "%s list total: %s", name, userID)
+			looked := []string{}
+			require.NoError(t, engine.LookupDocuments(ctx, userID, "viewer", 10, func(ids []string) error {
+				looked = append(looked, ids...)
+				return nil
+			}))
+
+			granted := []string{}
+			for _, docID := range docIDs {
+				result, err := engine.CheckPermission(ctx, userID, docID, "viewer")
+				require.NoError(t, err)
+				assert.Equal(t, result.HasPermission, batch[docID], "%s batch: %s %s", name, userID, docID)
+				if result.HasPermission {
+					granted = append(granted, docID)
+				}
+			}
+			sort.Strings(listed)
+			sort.Strings(looked)
+			assert.Equal(t, granted, listed, "%s list: %s", name, userID)
+			assert.Equal(t, granted, looked, "%s lookup: %s", name, userID)
+			out[name] = granted
+		}
+
+		count, err := zanzibarRepo.CountUserDocuments(ctx, userID, "viewer")
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(out[model.EngineZanzibar])), count, "zanzibar count: %s", userID)
+		return out
+	}
+	both := func(ids ...string) map[string][]string {
+		return map[string][]string{model.EngineMySQL: ids, model.EngineZanzibar: ids}
+	}
+
+	// Step 1: Without conflict groups the relationships decide
+	assert.Equal(t, both(docA, docB), visible(analystID))
+	assert.Equal(t, both(docA, docB), visible(aliceID))
+	assert.Equal(t, both(docA, docB), visible(managerID))
+
+	// Step 2: Once the banks compete, their followers lose the other bank's documents,
+	// whether granted directly or owned, and so does the manager whose access flows through alice
+	require.NoError(t, conflicts.SetGroup(ctx, groupID, customerIDs))
+	groups, err := conflicts.Groups(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, customerIDs, groups[groupID])
+
+	assert.Equal(t, both(docA), visible(analystID))
+	assert.Equal(t, both(docA), visible(aliceID))
+	assert.Equal(t, both(docA), visible(managerID))
+	for _, engine := range []interface {
+		CheckPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error)
+	}{mysqlRepo, zanzibarRepo} {
+		result, err := engine.CheckPermission(ctx, analystID, docB, "viewer")
+		require.NoError(t, err)
+		assert.True(t, result.DeniedByEthicalWall)
+		assert.Empty(t, result.Sources)
+	}
+
+	// Step 3: A subordinate following bank B gives the manager an unwalled route
+	require.NoError(t, zanzibarRepo.AddCustomerFollower(ctx, bankB, bobID))
+	_, err = zanzibarRepo.BulkInsertTuples(ctx, []model.RelationTuple{
+		{Namespace: "department", ObjectID: deptID, Relation: "member", SubjectNamespace: "user", SubjectID: bobID},
+	}, 100)
+	require.NoError(t, err)
+	db.Create(&model.CustomerFollower{CustomerID: bankB, UserID: bobID})
+	require.NoError(t, mysqlRepo.AddCustomerFollowerPermissions(ctx, bankB, bobID))
+	db.Create(&model.ManagementRelation{ManagerUserID: managerID, SubordinateUserID: bobID, DepartmentID: deptID, ManagementLevel: 1})
+
+	assert.Equal(t, both(docA, docB), visible(managerID))
+	assert.Equal(t, both(docA), visible(aliceID))
+
+	// Step 4: Following a competitor is refused unless a superuser overrides
+	for name, follow := range map[string]func(ctx context.Context, customerID, userID string) error{
+		model.EngineMySQL:    mysqlRepo.AddCustomerFollowerPermissions,
+		model.EngineZanzibar: zanzibarRepo.AddCustomerFollower,
+	} {
+		err := follow(ctx, bankB, analystID)
+		assert.ErrorIs(t, err, ErrCustomerConflict, name)
+		err = follow(WithConflictOverride(ctx, aliceID), bankB, analystID)
+		assert.ErrorIs(t, err, ErrConflictOverrideDenied, name)
+	}
+	conflicting, err := zanzibarRepo.FollowConflicts(ctx, bankB, analystID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{bankA}, conflicting)
+	conflicting, err = mysqlRepo.FollowConflicts(ctx, bankB, analystID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{bankA}, conflicting)
+
+	overridden := WithConflictOverride(ctx, adminID)
+	require.NoError(t, zanzibarRepo.AddCustomerFollower(overridden, bankB, analystID))
+	db.Create(&model.CustomerFollower{CustomerID: bankB, UserID: analystID})
+	require.NoError(t, mysqlRepo.AddCustomerFollowerPermissions(overridden, bankB, analystID))
+	assert.Equal(t, both(docA, docB), visible(analystID))
+
+	// Step 5: In warn mode the follower is added despite the conflict
+	warn, err := NewEthicalWalls(FollowerConflictWarn)
+	require.NoError(t, err)
+	zanzibarRepo.UseEthicalWalls(warn)
+	require.NoError(t, zanzibarRepo.AddCustomerFollower(ctx, bankB, aliceID))
+	require.NoError(t, zanzibarRepo.RemoveCustomerFollower(ctx, bankB, aliceID))
+	zanzibarRepo.UseEthicalWalls(walls)
+	_, err = NewEthicalWalls("ignore")
+	assert.ErrorIs(t, err, ErrUnknownFollowerConflictMode)
+
+	// Step 6: Groups need two customers; deleting the group lifts the walls
+	err = conflicts.SetGroup(ctx, groupID, []string{bankA})
+	assert.ErrorIs(t, err, ErrInvalidConflictGroup)
+	err = conflicts.SetGroup(ctx, groupID, []string{bankA, "ew-missing"})
+	assert.ErrorIs(t, err, ErrEntityNotFound)
+
+	require.NoError(t, conflicts.DeleteGroup(ctx, groupID))
+	assert.Equal(t, both(docA, docB), visible(aliceID))
+	assert.ErrorIs(t, conflicts.DeleteGroup(ctx, groupID), ErrEntityNotFound)
+
+	cleanup()
+
+	t.Logf("✅ Test passed! Ethical walls restrict both engines consistently")
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
+)
+
+// unexpired drops tuples or expanded rows whose grant ended. Expired rows are
+// kept until the sweeper removes them, so every read resolving access applies it.
+func unexpired(db *gorm.DB) *gorm.DB {
+	return db.Where("(expires_at IS NULL OR expires_at > ?)", time.Now())
+}
+
+// earliestExpiry returns the end of a grant that needs both a and b; nil never expires
+func earliestExpiry(a, b *time.Time) *time.Time {
+	if a == nil {
+		return b
+	}
+	if b == nil || a.Before(*b) {
+		return a
+	}
+	return b
+}
+
+// outlasts reports whether a grant ending at a lasts longer than one ending at b
+func outlasts(a, b *time.Time) bool {
+	if b == nil {
+		return false
+	}
+	return a == nil || a.After(*b)
+}
+
+// equalExpiry compares end times at the second precision of TIMESTAMP columns
+func equalExpiry(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+// truncateExpiry drops the fraction a TIMESTAMP column cannot hold, so reads return
+// exactly the stored end time
+func truncateExpiry(expiresAt *time.Time) *time.Time {
+	if expiresAt == nil {
+		return nil
+	}
+	t := expiresAt.Truncate(time.Second)
+	return &t
+}
+
+// nextTupleExpiry returns the earliest end time of a tuple still in force, or nil
+func nextTupleExpiry(ctx context.Context, db *gorm.DB) (*time.Time, error) {
+	var next []time.Time
+	if err := db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Where("expires_at > ?", time.Now()).
+		Order("expires_at").
+		Limit(1).
+		Pluck("expires_at", &next).Error; err != nil {
+		return nil, fmt.Errorf("failed to load next tuple expiry: %w", err)
+	}
+	if len(next) == 0 {
+		return nil, nil
+	}
+	return &next[0], nil
+}
+
+// GrantDirectPermissionUntil grants a direct permission that ends at expiresAt (nil never
+// expires). Granting an existing permission again replaces its end time and drops any caveat.
+func (r *ZanzibarPermissionRepository) GrantDirectPermissionUntil(ctx context.Context, userID, documentID, permissionType string, expiresAt *time.Time) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "grant_direct_permission")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.grant_direct_permission")
+	defer func() { endSpan(span, err) }()
+
+	tuple := &model.RelationTuple{
+		Namespace:        "document",
+		ObjectID:         documentID,
+		Relation:         permissionType,
+		SubjectNamespace: "user",
+		SubjectID:        userID,
+		ExpiresAt:        truncateExpiry(expiresAt),
+	}
+
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			DoUpdates: clause.AssignmentColumns([]string{"expires_at", "caveat_name", "caveat_context", "updated_at"}),
+		}).
+		Create(tuple).Error; err != nil {
+		return err
+	}
+
+	r.notifyTupleChange(ctx, *tuple)
+	return nil
+}
+
+// GrantDirectPermissionUntil grants a direct permission row that ends at expiresAt (nil
+// never expires). Granting an existing permission again replaces its end time.
+func (r *MySQLPermissionRepository) GrantDirectPermissionUntil(ctx context.Context, userID, documentID, permissionType string, expiresAt *time.Time) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "grant_direct_permission")
+	defer done()
+	ctx, span := tracer.Start(ctx, "mysql.grant_direct_permission")
+	defer func() { endSpan(span, err) }()
+
+	permission := &model.DocumentPermissionMySQL{
+		UserID:         userID,
+		DocumentID:     documentID,
+		PermissionType: permissionType,
+		SourceType:     "direct",
+		ExpiresAt:      truncateExpiry(expiresAt),
+	}
+
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "document_id"}, {Name: "permission_type"}},
+			DoUpdates: clause.AssignmentColumns([]string{"source_type", "expires_at", "updated_at"}),
+		}).
+		Create(permission).Error
+}
+
+// DeleteExpiredTuples hard-deletes tuples whose grant ended, batchSize at a time.
+// Listeners are notified, so the expanded table and the bitmap index follow.
+func (r *ZanzibarPermissionRepository) DeleteExpiredTuples(ctx context.Context, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = maxInClauseSize
+	}
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "delete_expired_tuples")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.delete_expired_tuples")
+
+	now := time.Now()
+	var deleted int64
+	var err error
+	for {
+		var tuples []model.RelationTuple
+		if err = r.db.WithContext(ctx).
+			Where("expires_at <= ?", now).
+			Order("id").
+			Limit(batchSize).
+			Find(&tuples).Error; err != nil {
+			err = fmt.Errorf("failed to load expired tuples: %w", err)
+			break
+		}
+		if len(tuples) == 0 {
+			break
+		}
+
+		ids := make([]int64, len(tuples))
+		for i := range tuples {
+			ids[i] = tuples[i].ID
+		}
+		// A grant extended since the load is no longer expired and stays
+		res := r.db.WithContext(ctx).
+			Where("id IN ? AND expires_at <= ?", ids, now).
+			Delete(&model.RelationTuple{})
+		if res.Error != nil {
+			err = fmt.Errorf("failed to delete expired tuples: %w", res.Error)
+			break
+		}
+		deleted += res.RowsAffected
+		r.notifyTupleChange(ctx, tuples...)
+
+		if len(tuples) < batchSize {
+			break
+		}
+	}
+	endSpan(span, err, attribute.Int64("tuples.deleted", deleted))
+	return deleted, err
+}
+
+// DeleteExpiredPermissions hard-deletes expanded rows whose grant ended
+func (r *MySQLPermissionRepository) DeleteExpiredPermissions(ctx context.Context) (int64, error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "delete_expired_permissions")
+	defer done()
+	ctx, span := tracer.Start(ctx, "mysql.delete_expired_permissions")
+
+	res := r.db.WithContext(ctx).
+		Where("expires_at <= ?", time.Now()).
+		Delete(&model.DocumentPermissionMySQL{})
+	var err error
+	if res.Error != nil {
+		err = fmt.Errorf("failed to delete expired permissions: %w", res.Error)
+	}
+	endSpan(span, err, attribute.Int64("rows.deleted", res.RowsAffected))
+	return res.RowsAffected, err
+}
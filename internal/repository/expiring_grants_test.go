@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// TestExpiringGrants tests that both engines stop granting time-bound permissions
+// once they expire, that the materializer copies the end time onto expanded rows
+// and that the sweep deletes expired tuples and rows
+func TestExpiringGrants(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	mysqlRepo := NewMySQLPermissionRepository(db)
+	zanzibarRepo := NewZanzibarPermissionRepository(db)
+	materializer := NewPermissionMaterializer(db)
+	ctx := context.Background()
+
+	const (
+		userID     = "exp-user"
+		customerID = "exp-customer"
+		docID      = "exp-doc"
+	)
+
+	cleanup := func() {
+		db.Where("document_id = ? OR user_id = ?", docID, userID).Delete(&model.DocumentPermissionMySQL{})
+		db.Where("namespace = ? AND object_id = ?", "document", docID).Delete(&model.RelationTuple{})
+		db.Where("id = ?", docID).Delete(&model.Document{})
+		db.Where("id = ?", customerID).Delete(&model.Customer{})
+		db.Where("id = ?", userID).Delete(&model.User{})
+	}
+	cleanup()
+
+	createTestUser(db, userID, "Expiring Grant User", "exp-user@test.com")
+	createTestCustomer(db, customerID, "Expiring Grant Customer")
+	createTestDocument(db, docID, "Expiring Grant Doc", customerID, userID)
+	_, err := zanzibarRepo.BulkInsertTuples(ctx, []model.RelationTuple{
+		{Namespace: "document", ObjectID: docID, Relation: "owner", SubjectNamespace: "user", SubjectID: userID},
+	}, 100)
+	require.NoError(t, err)
+
+	// granted reports whether each engine grants viewer via check, batch check and list
+	granted := func() map[string]bool {
+		out := make(map[string]bool)
+		for name, engine := range map[string]interface {
+			CheckPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error)
+			CheckPermissionsBatch(ctx context.Context, userID string, documentIDs []string, permissionType string) (map[string]bool, error)
+			GetUserDocuments(ctx context.Context, userID string, permissionType string, page, pageSize int) (*model.UserDocumentList, error)
+		}{model.EngineMySQL: mysqlRepo, model.EngineZanzibar: zanzibarRepo} {
+			result, err := engine.CheckPermission(ctx, userID, docID, "viewer")
+			require.NoError(t, err)
+			batch, err := engine.CheckPermissionsBatch(ctx, userID, []string{docID}, "viewer")
+			require.NoError(t, err)
+			list, err := engine.GetUserDocuments(ctx, userID, "viewer", 1, 10)
+			require.NoError(t, err)
+
+			assert.Equal(t, result.HasPermission, batch[docID], "%s batch", name)
+			assert.Equal(t, result.HasPermission, len(list.Documents) == 1, "%s list", name)
+			out[name] = result.HasPermission
+		}
+		return out
+	}
+	// expire moves the end of the viewer grant into the past
+	expire := func() {
+		past := time.Now().Add(-time.Minute)
+		db.Model(&model.RelationTuple{}).Where("namespace = ? AND object_id = ? AND relation = ?", "document", docID, "viewer").Update("expires_at", past)
+		db.Model(&model.DocumentPermissionMySQL{}).Where("document_id = ? AND permission_type = ?", docID, "viewer").Update("expires_at", past)
+	}
+
+	// Step 1: A time-bound grant is in force and lists its remaining validity
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, mysqlRepo.GrantDirectPermissionUntil(ctx, userID, docID, "viewer", &expiresAt))
+	require.NoError(t, zanzibarRepo.GrantDirectPermissionUntil(ctx, userID, docID, "viewer", &expiresAt))
+	assert.Equal(t, map[string]bool{model.EngineMySQL: true, model.EngineZanzibar: true}, granted())
+
+	for _, engine := range []interface {
+		GetUserDocuments(ctx context.Context, userID string, permissionType string, page, pageSize int) (*model.UserDocumentList, error)
+	}{mysqlRepo, zanzibarRepo} {
+		list, err := engine.GetUserDocuments(ctx, userID, "viewer", 1, 10)
+		require.NoError(t, err)
+		require.Len(t, list.Documents, 1)
+		require.NotNil(t, list.Documents[0].ExpiresAt)
+		assert.True(t, expiresAt.Equal(*list.Documents[0].ExpiresAt))
+		assert.InDelta(t, time.Hour.Seconds(), float64(list.Documents[0].ExpiresIn), 5)
+	}
+
+	// Step 2: The materializer copies the end time onto the expanded row
+	db.Where("document_id = ?", docID).Delete(&model.DocumentPermissionMySQL{})
+	_, err = materializer.MaterializeDocuments(ctx, []string{docID})
+	require.NoError(t, err)
+	var row model.DocumentPermissionMySQL
+	require.NoError(t, db.Where("user_id = ? AND document_id = ? AND permission_type = ?", userID, docID, "viewer").First(&row).Error)
+	require.NotNil(t, row.ExpiresAt)
+	assert.True(t, expiresAt.Equal(*row.ExpiresAt))
+
+	// Step 3: Expired grants are ignored by check, batch check, list and lookup
+	expire()
+	assert.Equal(t, map[string]bool{model.EngineMySQL: false, model.EngineZanzibar: false}, granted())
+	subjects, err := zanzibarRepo.LookupSubjects(ctx, docID, "viewer")
+	require.NoError(t, err)
+	assert.NotContains(t, subjects, userID)
+
+	// Step 4: Granting again without an end time makes the grant permanent
+	require.NoError(t, mysqlRepo.GrantDirectPermission(ctx, userID, docID, "viewer"))
+	require.NoError(t, zanzibarRepo.GrantDirectPermission(ctx, userID, docID, "viewer"))
+	assert.Equal(t, map[string]bool{model.EngineMySQL: true, model.EngineZanzibar: true}, granted())
+
+	// Step 5: A TOUCH sets an end time, and a TOUCH without one keeps it
+	viewer := model.RelationTuple{Namespace: "document", ObjectID: docID, Relation: "viewer", SubjectNamespace: "user", SubjectID: userID}
+	touched := viewer
+	touched.ExpiresAt = &expiresAt
+	for _, tuple := range []model.RelationTuple{touched, viewer} {
+		_, err = zanzibarRepo.WriteTuples(ctx, []model.TupleUpdate{{Operation: model.TupleOperationTouch, Tuple: tuple}}, nil)
+		require.NoError(t, err)
+
+		var stored model.RelationTuple
+		require.NoError(t, db.Scopes(tupleKey(&viewer)).First(&stored).Error)
+		require.NotNil(t, stored.ExpiresAt, "touch %s", tuple.Text())
+		assert.True(t, expiresAt.Equal(*stored.ExpiresAt))
+	}
+
+	// Step 6: The sweep deletes expired tuples and expanded rows, and nothing else
+	expire()
+	tuples, err := zanzibarRepo.DeleteExpiredTuples(ctx, 100)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, tuples, int64(1))
+	rows, err := mysqlRepo.DeleteExpiredPermissions(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, rows, int64(1))
+
+	var relations []string
+	db.Model(&model.RelationTuple{}).Where("namespace = ? AND object_id = ?", "document", docID).Pluck("relation", &relations)
+	assert.Equal(t, []string{"owner"}, relations, "the owner tuple never expires")
+
+	cleanup()
+
+	t.Logf("✅ Test passed! Both engines ignore expired grants")
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// Manager chain resolution strategies of the Zanzibar engine
+const (
+	// ManagerChainStrategyAuto walks the org with BFS and switches to the CTE once
+	// the subordinate set outgrows the threshold
+	ManagerChainStrategyAuto = "auto"
+	// ManagerChainStrategyBFS resolves subordinates level by level in Go (two queries per level)
+	ManagerChainStrategyBFS = "bfs"
+	// ManagerChainStrategyCTE resolves the whole check in one recursive query
+	ManagerChainStrategyCTE = "cte"
+)
+
+// defaultCTEThreshold is the subordinate count above which auto switches to the CTE
+const defaultCTEThreshold = 500
+
+// ErrUnknownManagerChainStrategy is returned for a strategy other than auto, bfs or cte
+var ErrUnknownManagerChainStrategy = errors.New("unknown manager chain strategy")
+
+type managerChainStrategyKey struct{}
+
+// WithManagerChainStrategy overrides the manager chain strategy for checks made with ctx
+func WithManagerChainStrategy(ctx context.Context, strategy string) context.Context {
+	return context.WithValue(ctx, managerChainStrategyKey{}, strategy)
+}
+
+func validManagerChainStrategy(strategy string) bool {
+	switch strategy {
+	case ManagerChainStrategyAuto, ManagerChainStrategyBFS, ManagerChainStrategyCTE:
+		return true
+	}
+	return false
+}
+
+// SetManagerChainStrategy sets the default strategy and the subordinate count at
+// which auto switches from BFS to the CTE (0 keeps the default of 500)
+func (r *ZanzibarPermissionRepository) SetManagerChainStrategy(strategy string, cteThreshold int) error {
+	if strategy == "" {
+		strategy = ManagerChainStrategyAuto
+	}
+	if !validManagerChainStrategy(strategy) {
+		return fmt.Errorf("%w: %s", ErrUnknownManagerChainStrategy, strategy)
+	}
+	if cteThreshold <= 0 {
+		cteThreshold = defaultCTEThreshold
+	}
+	r.managerChainStrategy = strategy
+	r.cteThreshold = cteThreshold
+	return nil
+}
+
+// managerChainStrategyFor returns the strategy of ctx, falling back to the repository default
+func (r *ZanzibarPermissionRepository) managerChainStrategyFor(ctx context.Context) string {
+	if strategy, ok := ctx.Value(managerChainStrategyKey{}).(string); ok && validManagerChainStrategy(strategy) {
+		return strategy
+	}
+	if r.managerChainStrategy == "" {
+		return ManagerChainStrategyAuto
+	}
+	return r.managerChainStrategy
+}
+
+// checkManagerChainPermissionOptimized checks whether any subordinate of userID owns
+// documentID or follows its customer, using the strategy selected for ctx
+func (r *ZanzibarPermissionRepository) checkManagerChainPermissionOptimized(ctx context.Context, userID, documentID, permissionType string, sources *model.PermissionSourceList) (bool, error) {
+	strategy := r.managerChainStrategyFor(ctx)
+	span := trace.SpanFromContext(ctx)
+
+	if strategy == ManagerChainStrategyCTE {
+		span.SetAttributes(attribute.String("strategy", ManagerChainStrategyCTE))
+		return r.checkManagerChainCTE(ctx, userID, documentID, sources)
+	}
+
+	// Step 1: Get all subordinates of the current user (batch query). Auto stops
+	// once the set outgrows the threshold and lets the database walk the rest.
+	limit := 0
+	if strategy == ManagerChainStrategyAuto {
+		limit = r.cteThreshold
+		if limit <= 0 {
+			limit = defaultCTEThreshold
+		}
+	}
+	subordinateIDs, truncated, err := r.collectSubordinates(ctx, userID, managerChainMaxDepth, limit)
+	if err != nil {
+		return false, err
+	}
+	if truncated {
+		span.SetAttributes(attribute.String("strategy", ManagerChainStrategyCTE), attribute.Bool("strategy.switched", true))
+		return r.checkManagerChainCTE(ctx, userID, documentID, sources)
+	}
+	span.SetAttributes(attribute.String("strategy", ManagerChainStrategyBFS), attribute.Int("subordinates", len(subordinateIDs)))
+
+	return r.checkSubordinatesGrant(ctx, documentID, subordinateIDs, sources)
+}
+
+// managerChainCTE resolves the manager chain check in a single statement. The
+// recursive CTE walks users -> departments they manage -> departments below
+// them (up to departmentParentMaxDepth parent links) -> members, for up to
+// managerChainMaxDepth management levels, i.e. exactly what getAllSubordinates
+// does level by level. The outer query then looks for a subordinate who owns
+// the document or follows its customer. Expired and conditional tuples are
+// skipped like the unexpired and unconditional scopes do.
+const managerChainCTE = `
+WITH RECURSIVE chain (kind, id, level, hops) AS (
+	SELECT 'user', CAST(? AS CHAR(36)), 0, 0
+	UNION DISTINCT
+	SELECT 'dept', r.object_id, c.level + 1, 0
+	FROM chain c
+	JOIN relation_tuples r
+		ON r.namespace = 'department' AND r.relation = 'manager'
+		AND r.subject_namespace = 'user' AND r.subject_id = c.id
+		AND (r.expires_at IS NULL OR r.expires_at > NOW()) AND r.caveat_name IS NULL
+	WHERE c.kind = 'user' AND c.level < ?
+	UNION DISTINCT
+	SELECT 'dept', r.object_id, c.level, c.hops + 1
+	FROM chain c
+	JOIN relation_tuples r
+		ON r.namespace = 'department' AND r.relation = 'parent'
+		AND r.subject_namespace = 'department' AND r.subject_id = c.id
+		AND (r.expires_at IS NULL OR r.expires_at > NOW()) AND r.caveat_name IS NULL
+	WHERE c.kind = 'dept' AND c.hops < ?
+	UNION DISTINCT
+	SELECT 'user', r.subject_id, c.level, 0
+	FROM chain c
+	JOIN relation_tuples r
+		ON r.namespace = 'department' AND r.object_id = c.id
+		AND r.relation = 'member' AND r.subject_namespace = 'user'
+		AND (r.expires_at IS NULL OR r.expires_at > NOW()) AND r.caveat_name IS NULL
+	WHERE c.kind = 'dept'
+),
+subordinates AS (
+	SELECT DISTINCT id FROM chain WHERE kind = 'user' AND id <> ?
+)
+SELECT
+	EXISTS (
+		SELECT 1 FROM relation_tuples o
+		JOIN subordinates s ON s.id = o.subject_id
+		WHERE o.namespace = 'document' AND o.object_id = ? AND o.relation = 'owner'
+			AND o.subject_namespace = 'user'
+			AND (o.expires_at IS NULL OR o.expires_at > NOW()) AND o.caveat_name IS NULL
+	) AS via_owner,
+	EXISTS (
+		SELECT 1 FROM relation_tuples oc
+		JOIN relation_tuples f
+			ON f.namespace = 'customer' AND f.object_id = oc.subject_id
+			AND f.relation = 'follower' AND f.subject_namespace = 'user'
+			AND (f.expires_at IS NULL OR f.expires_at > NOW()) AND f.caveat_name IS NULL
+		JOIN subordinates s ON s.id = f.subject_id
+		WHERE oc.namespace = 'document' AND oc.object_id = ? AND oc.relation = 'owner_customer'
+			AND (oc.expires_at IS NULL OR oc.expires_at > NOW()) AND oc.caveat_name IS NULL
+	) AS via_follower
+`
+
+// checkManagerChainCTE runs managerChainCTE and records the matching source
+func (r *ZanzibarPermissionRepository) checkManagerChainCTE(ctx context.Context, userID, documentID string, sources *model.PermissionSourceList) (bool, error) {
+	var row struct {
+		ViaOwner    sql.NullBool
+		ViaFollower sql.NullBool
+	}
+	err := r.db.WithContext(ctx).
+		Raw(managerChainCTE, userID, managerChainMaxDepth, departmentParentMaxDepth, userID, documentID, documentID).
+		Scan(&row).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve manager chain: %w", err)
+	}
+
+	switch {
+	case row.ViaOwner.Bool:
+		sources.Add("manager_of_creator", "subordinate")
+		return true, nil
+	case row.ViaFollower.Bool:
+		sources.Add("manager_of_follower", "subordinate")
+		return true, nil
+	}
+	return false, nil
+}
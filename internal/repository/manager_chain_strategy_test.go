@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// TestManagerChainStrategies tests that BFS, the recursive CTE and auto resolve the manager chain identically
+func TestManagerChainStrategies(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewZanzibarPermissionRepository(db)
+	ctx := context.Background()
+
+	const (
+		execID   = "mcs-exec"
+		leadID   = "mcs-lead"
+		workerID = "mcs-worker"
+	)
+	deptIDs := []string{"mcs-root", "mcs-child", "mcs-team"}
+	docIDs := []string{"mcs-doc-owned", "mcs-doc-customer", "mcs-doc-none"}
+
+	// Clean up leftovers from previous runs
+	db.Where("namespace = ? AND object_id IN ?", "department", deptIDs).Delete(&model.RelationTuple{})
+	db.Where("namespace = ? AND object_id IN ?", "document", docIDs).Delete(&model.RelationTuple{})
+	db.Where("namespace = ? AND object_id = ?", "customer", "mcs-customer").Delete(&model.RelationTuple{})
+
+	// exec manages mcs-root, mcs-child hangs below it, lead (member of mcs-child) manages mcs-team
+	_, err := repo.BulkInsertTuples(ctx, []model.RelationTuple{
+		{Namespace: "department", ObjectID: "mcs-root", Relation: "manager", SubjectNamespace: "user", SubjectID: execID},
+		{Namespace: "department", ObjectID: "mcs-child", Relation: "parent", SubjectNamespace: "department", SubjectID: "mcs-root"},
+		{Namespace: "department", ObjectID: "mcs-child", Relation: "member", SubjectNamespace: "user", SubjectID: leadID},
+		{Namespace: "department", ObjectID: "mcs-team", Relation: "manager", SubjectNamespace: "user", SubjectID: leadID},
+		{Namespace: "department", ObjectID: "mcs-team", Relation: "member", SubjectNamespace: "user", SubjectID: workerID},
+		{Namespace: "document", ObjectID: docIDs[0], Relation: "owner", SubjectNamespace: "user", SubjectID: workerID},
+		{Namespace: "document", ObjectID: docIDs[1], Relation: "owner_customer", SubjectNamespace: "customer", SubjectID: "mcs-customer"},
+		{Namespace: "customer", ObjectID: "mcs-customer", Relation: "follower", SubjectNamespace: "user", SubjectID: workerID},
+		{Namespace: "document", ObjectID: docIDs[2], Relation: "owner", SubjectNamespace: "user", SubjectID: execID},
+	}, 100)
+	require.NoError(t, err)
+
+	expected := map[string][]string{
+		docIDs[0]: {"manager_of_creator:subordinate"},
+		docIDs[1]: {"manager_of_follower:subordinate"},
+		docIDs[2]: nil, // owned by exec, no subordinate involved
+	}
+
+	check := func(userID, documentID string) []string {
+		var sources model.PermissionSourceList
+		ok, err := repo.checkManagerChainPermissionOptimized(ctx, userID, documentID, "viewer", &sources)
+		require.NoError(t, err)
+		if !ok {
+			return nil
+		}
+		return sourcesToStrings(sources)
+	}
+
+	// Step 1: Every strategy sees the worker two management levels and one parent link below exec
+	for _, strategy := range []string{ManagerChainStrategyBFS, ManagerChainStrategyCTE, ManagerChainStrategyAuto} {
+		require.NoError(t, repo.SetManagerChainStrategy(strategy, 0))
+		for documentID, want := range expected {
+			assert.Equal(t, want, check(execID, documentID), "%s: %s", strategy, documentID)
+		}
+		assert.Nil(t, check(workerID, docIDs[0]), "%s: the worker has no subordinates", strategy)
+	}
+
+	// Step 2: Auto switches to the CTE once the subordinates outgrow the threshold
+	require.NoError(t, repo.SetManagerChainStrategy(ManagerChainStrategyAuto, 1))
+	_, truncated, err := repo.collectSubordinates(ctx, execID, managerChainMaxDepth, 1)
+	require.NoError(t, err)
+	assert.True(t, truncated)
+	for documentID, want := range expected {
+		assert.Equal(t, want, check(execID, documentID), "auto after switch: %s", documentID)
+	}
+
+	// Step 3: The per-call selection overrides the repository default
+	require.NoError(t, repo.SetManagerChainStrategy(ManagerChainStrategyBFS, 0))
+	assert.Equal(t, ManagerChainStrategyCTE, repo.managerChainStrategyFor(WithManagerChainStrategy(ctx, ManagerChainStrategyCTE)))
+	assert.ErrorIs(t, repo.SetManagerChainStrategy("dfs", 0), ErrUnknownManagerChainStrategy)
+
+	// Cleanup
+	db.Where("namespace = ? AND object_id IN ?", "department", deptIDs).Delete(&model.RelationTuple{})
+	db.Where("namespace = ? AND object_id IN ?", "document", docIDs).Delete(&model.RelationTuple{})
+	db.Where("namespace = ? AND object_id = ?", "customer", "mcs-customer").Delete(&model.RelationTuple{})
+
+	t.Logf("✅ Test passed! BFS, CTE and auto agree on the manager chain")
+}
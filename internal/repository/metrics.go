@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
+)
+
+// Resolution paths reported by the check latency metrics
+const (
+	checkPathSuperuser = "superuser"
+	checkPathDirect    = "direct"
+	checkPathFollower  = "follower"
+	checkPathManager   = "manager"
+	checkPathNone      = "none"
+)
+
+// observeCheck records latency, query count and cache usage of one permission check
+func observeCheck(engine string, start time.Time, queries int64, result *model.PermissionCheckResult, err error) {
+	path, outcome := checkPathNone, "denied"
+	switch {
+	case err != nil:
+		outcome = "error"
+	case result.HasPermission:
+		path, outcome = checkPath(result.Sources), "allowed"
+	}
+
+	metrics.CheckDuration.WithLabelValues(engine, path, outcome).Observe(time.Since(start).Seconds())
+	metrics.CheckQueries.WithLabelValues(engine, path).Observe(float64(queries))
+
+	if err == nil {
+		cache := "miss"
+		if result.CacheHit {
+			cache = "hit"
+		}
+		metrics.CacheRequests.WithLabelValues(engine, cache).Inc()
+	}
+}
+
+// checkPath maps the first permission source to a resolution path. MySQL
+// reports bare source types, Zanzibar reports "type:id" strings.
+func checkPath(sources []string) string {
+	if len(sources) == 0 {
+		return checkPathNone
+	}
+
+	sourceType, _, _ := strings.Cut(sources[0], ":")
+	switch {
+	case sourceType == model.SourceTypeSuperuser:
+		return checkPathSuperuser
+	case sourceType == model.SourceTypeDirect:
+		return checkPathDirect
+	case sourceType == model.SourceTypeCustomerFollower:
+		return checkPathFollower
+	case sourceType == model.SourceTypeManagerChain, strings.HasPrefix(sourceType, "manager_of_"):
+		return checkPathManager
+	default:
+		return checkPathNone
+	}
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
+)
+
+// TestPermissionMetrics tests that checks, statements and storage counts are reported
+func TestPermissionMetrics(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	require.NoError(t, db.Use(metrics.GormPlugin{}))
+
+	zanzibarRepo := NewZanzibarPermissionRepository(db)
+	ctx := context.Background()
+
+	const (
+		userID     = "test-metrics-user-1"
+		documentID = "test-metrics-doc-1"
+	)
+
+	// Clean up leftovers from previous runs
+	db.Where("subject_id = ?", userID).Delete(&model.RelationTuple{})
+
+	// Step 1: A direct grant is resolved on the direct path
+	require.NoError(t, zanzibarRepo.GrantDirectPermission(ctx, userID, documentID, "viewer"))
+
+	misses := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues(model.EngineZanzibar, "miss"))
+	tupleQueries := testutil.ToFloat64(metrics.DBQueries.WithLabelValues("query", "relation_tuples"))
+
+	result, err := zanzibarRepo.CheckPermission(ctx, userID, documentID, "viewer")
+	require.NoError(t, err)
+	require.True(t, result.HasPermission)
+	assert.Equal(t, checkPathDirect, checkPath(result.Sources))
+
+	assert.Equal(t, misses+1, testutil.ToFloat64(metrics.CacheRequests.WithLabelValues(model.EngineZanzibar, "miss")))
+	assert.Greater(t, testutil.ToFloat64(metrics.DBQueries.WithLabelValues("query", "relation_tuples")), tupleQueries)
+
+	// Step 2: Source strings of both engines map to the same paths
+	assert.Equal(t, checkPathSuperuser, checkPath([]string{"superuser:system:root"}))
+	assert.Equal(t, checkPathFollower, checkPath([]string{model.SourceTypeCustomerFollower}))
+	assert.Equal(t, checkPathManager, checkPath([]string{model.SourceTypeManagerChain}))
+	assert.Equal(t, checkPathManager, checkPath([]string{"manager_of_creator:subordinate"}))
+	assert.Equal(t, checkPathNone, checkPath(nil))
+
+	// Step 3: The storage count includes the granted tuple
+	counts, err := zanzibarRepo.CountTuplesByRelation(ctx)
+	require.NoError(t, err)
+	found := false
+	for _, c := range counts {
+		if c.Namespace == "document" && c.Relation == "viewer" {
+			found = true
+			assert.GreaterOrEqual(t, c.Count, int64(1))
+		}
+	}
+	assert.True(t, found, "document#viewer should be counted")
+
+	// Cleanup
+	require.NoError(t, zanzibarRepo.RevokePermission(ctx, userID, documentID))
+
+	t.Logf("✅ Test passed! Check, statement and storage metrics are reported")
+}
@@ -3,18 +3,25 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 
 	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
 )
 
 // MySQLPermissionRepository handles MySQL expanded permission operations
 type MySQLPermissionRepository struct {
 	db *gorm.DB
+
+	attributes *AttributeRules // nil unless attribute rules are configured
+	walls      *EthicalWalls   // nil unless ethical walls are enabled
 }
 
 // NewMySQLPermissionRepository creates a new MySQL permission repository
@@ -22,13 +29,43 @@ func NewMySQLPermissionRepository(db *gorm.DB) *MySQLPermissionRepository {
 	return &MySQLPermissionRepository{db: db}
 }
 
+// liveRows drops expanded rows of soft-deleted users and documents, and rows whose
+// grant expired. The rows themselves are kept until the purge or the sweep, so a
+// restore brings the access back.
+func liveRows(db *gorm.DB) *gorm.DB {
+	return db.Scopes(excludeDeleted("user_id", "users"), excludeDeleted("document_id", "documents"), unexpired)
+}
+
 // CheckPermission checks if a user has permission to access a document
 func (r *MySQLPermissionRepository) CheckPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error) {
+	start := time.Now()
+	ctx, queries := metrics.WithQueryCounter(ctx)
+	ctx, span := tracer.Start(ctx, "mysql.check", trace.WithAttributes(
+		attribute.String("user.id", userID),
+		attribute.String("document.id", documentID),
+		attribute.String("permission.type", permissionType),
+	))
+
+	result, err := r.checkPermission(ctx, userID, documentID, permissionType)
+	if err == nil {
+		result, err = r.attributes.enforceCheck(ctx, r.db, model.EngineMySQL, userID, documentID, permissionType, result)
+	}
+	if err == nil {
+		result, err = r.walls.enforceCheck(ctx, r.db, r, model.EngineMySQL, userID, documentID, permissionType, result)
+	}
+	observeCheck(model.EngineMySQL, start, queries.Load(), result, err)
+	endSpan(span, err, checkAttributes(result, queries.Load())...)
+	return result, err
+}
+
+// checkPermission resolves the check; CheckPermission wraps it with metrics
+func (r *MySQLPermissionRepository) checkPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error) {
 	startTime := time.Now()
 
 	var permission model.DocumentPermissionMySQL
 	err := r.db.WithContext(ctx).
 		Where("user_id = ? AND document_id = ? AND permission_type = ?", userID, documentID, permissionType).
+		Scopes(liveRows).
 		First(&permission).Error
 
 	duration := time.Since(startTime).Milliseconds()
@@ -55,9 +92,12 @@ func (r *MySQLPermissionRepository) CheckPermission(ctx context.Context, userID,
 
 // CheckPermissionsBatch checks permissions for multiple documents at once
 func (r *MySQLPermissionRepository) CheckPermissionsBatch(ctx context.Context, userID string, documentIDs []string, permissionType string) (map[string]bool, error) {
+	metrics.BatchSize.WithLabelValues("check_permissions_batch").Observe(float64(len(documentIDs)))
+
 	var permissions []model.DocumentPermissionMySQL
 	err := r.db.WithContext(ctx).
 		Where("user_id = ? AND document_id IN ? AND permission_type = ?", userID, documentIDs, permissionType).
+		Scopes(liveRows).
 		Find(&permissions).Error
 
 	if err != nil {
@@ -73,6 +113,13 @@ func (r *MySQLPermissionRepository) CheckPermissionsBatch(ctx context.Context, u
 		result[permission.DocumentID] = true
 	}
 
+	if err := r.attributes.enforceBatch(ctx, r.db, model.EngineMySQL, userID, permissionType, result); err != nil {
+		return nil, err
+	}
+	if err := r.walls.enforceBatch(ctx, r.db, r, model.EngineMySQL, userID, permissionType, result); err != nil {
+		return nil, err
+	}
+
 	return result, nil
 }
 
@@ -85,18 +132,29 @@ func (r *MySQLPermissionRepository) GetUserDocuments(ctx context.Context, userID
 	var permissions []model.DocumentPermissionMySQL
 	var total int64
 
+	allowedByAttributes, err := r.attributeScope(ctx, userID, permissionType)
+	if err != nil {
+		return nil, err
+	}
+	allowedByWalls, err := r.wallScope(ctx, userID, permissionType)
+	if err != nil {
+		return nil, err
+	}
+
 	// Count total
 	countQuery := r.db.WithContext(ctx).
 		Model(&model.DocumentPermissionMySQL{}).
-		Where("user_id = ? AND permission_type = ?", userID, permissionType)
+		Where("user_id = ? AND permission_type = ?", userID, permissionType).
+		Scopes(liveRows, allowedByAttributes, allowedByWalls)
 
 	if err := countQuery.Count(&total).Error; err != nil {
 		return nil, fmt.Errorf("failed to count user documents: %w", err)
 	}
 
 	// Fetch permissions with pagination
-	err := r.db.WithContext(ctx).
+	err = r.db.WithContext(ctx).
 		Where("user_id = ? AND permission_type = ?", userID, permissionType).
+		Scopes(liveRows, allowedByAttributes, allowedByWalls).
 		Preload("Document").
 		Preload("Document.Customer").
 		Preload("Document.Creator").
@@ -122,6 +180,13 @@ func (r *MySQLPermissionRepository) GetUserDocuments(ctx context.Context, userID
 				SourceType:     perm.SourceType,
 				CreatedAt:      perm.Document.CreatedAt,
 			}
+			// The unique key allows one row, hence one source, per document
+			source := model.PermissionSource{Type: perm.SourceType}
+			if perm.SourceID != nil {
+				source.SourceID = *perm.SourceID
+			}
+			doc.Sources = model.PermissionSourceList{source}
+			doc.SetExpiry(perm.ExpiresAt)
 
 			if perm.Document.Customer != nil {
 				doc.CustomerName = perm.Document.Customer.Name
@@ -145,33 +210,110 @@ func (r *MySQLPermissionRepository) GetUserDocuments(ctx context.Context, userID
 	}, nil
 }
 
-// GrantDirectPermission grants direct permission to a user
-func (r *MySQLPermissionRepository) GrantDirectPermission(ctx context.Context, userID, documentID, permissionType string) error {
-	permission := &model.DocumentPermissionMySQL{
-		UserID:         userID,
-		DocumentID:     documentID,
-		PermissionType: permissionType,
-		SourceType:     "direct",
+// LookupDocuments streams the IDs of all documents a user can access, in batches of batchSize.
+// Batches are passed to yield in ascending ID order; returning an error from yield stops the lookup.
+func (r *MySQLPermissionRepository) LookupDocuments(ctx context.Context, userID, permissionType string, batchSize int, yield func(documentIDs []string) error) error {
+	if batchSize <= 0 {
+		batchSize = 1000
 	}
 
-	return r.db.WithContext(ctx).
-		Clauses(clause.OnConflict{
-			Columns:   []clause.Column{{Name: "user_id"}, {Name: "document_id"}, {Name: "permission_type"}},
-			DoUpdates: clause.AssignmentColumns([]string{"source_type", "updated_at"}),
-		}).
-		Create(permission).Error
+	allowedByAttributes, err := r.attributeScope(ctx, userID, permissionType)
+	if err != nil {
+		return err
+	}
+	allowedByWalls, err := r.wallScope(ctx, userID, permissionType)
+	if err != nil {
+		return err
+	}
+
+	lastID := ""
+	for {
+		var ids []string
+		err := r.db.WithContext(ctx).
+			Model(&model.DocumentPermissionMySQL{}).
+			Where("user_id = ? AND permission_type = ? AND document_id > ?", userID, permissionType, lastID).
+			Scopes(liveRows, allowedByAttributes, allowedByWalls).
+			Order("document_id ASC").
+			Limit(batchSize).
+			Pluck("document_id", &ids).Error
+		if err != nil {
+			return fmt.Errorf("failed to lookup documents: %w", err)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := yield(ids); err != nil {
+			return err
+		}
+		lastID = ids[len(ids)-1]
+	}
+}
+
+// attributeScope restricts expanded rows of userID to the documents the attribute rule
+// of permissionType allows; a rule that does not translate to SQL is evaluated on the
+// documents of the user's rows
+func (r *MySQLPermissionRepository) attributeScope(ctx context.Context, userID, permissionType string) (func(*gorm.DB) *gorm.DB, error) {
+	return r.attributes.documentScope(ctx, r.db, userID, permissionType, "document_id", func() ([]string, error) {
+		var ids []string
+		if err := r.db.WithContext(ctx).
+			Model(&model.DocumentPermissionMySQL{}).
+			Where("user_id = ? AND permission_type = ?", userID, permissionType).
+			Scopes(liveRows).
+			Pluck("document_id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to load user documents: %w", err)
+		}
+		return ids, nil
+	})
+}
+
+// wallScope restricts expanded rows of userID to the documents the ethical walls do not
+// keep from them; the wall on the subordinate is evaluated on the user's manager chain
+// rows for customers in a conflict group
+func (r *MySQLPermissionRepository) wallScope(ctx context.Context, userID, permissionType string) (func(*gorm.DB) *gorm.DB, error) {
+	return r.walls.documentScope(ctx, r.db, r, userID, permissionType, "document_id", func() ([]string, error) {
+		var ids []string
+		if err := r.db.WithContext(ctx).
+			Model(&model.DocumentPermissionMySQL{}).
+			Where("user_id = ? AND permission_type = ? AND source_type = ?", userID, permissionType, model.SourceTypeManagerChain).
+			Scopes(liveRows, conflictedDocuments("document_id")).
+			Pluck("document_id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to load manager chain documents: %w", err)
+		}
+		return ids, nil
+	})
+}
+
+// GrantDirectPermission grants direct permission to a user
+func (r *MySQLPermissionRepository) GrantDirectPermission(ctx context.Context, userID, documentID, permissionType string) error {
+	return r.GrantDirectPermissionUntil(ctx, userID, documentID, permissionType, nil)
 }
 
 // RevokePermission revokes permission from a user
-func (r *MySQLPermissionRepository) RevokePermission(ctx context.Context, userID, documentID string) error {
+func (r *MySQLPermissionRepository) RevokePermission(ctx context.Context, userID, documentID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "revoke_permission")
+	defer done()
+	ctx, span := tracer.Start(ctx, "mysql.revoke_permission")
+	defer func() { endSpan(span, err) }()
+
 	return r.db.WithContext(ctx).
 		Where("user_id = ? AND document_id = ?", userID, documentID).
 		Delete(&model.DocumentPermissionMySQL{}).Error
 }
 
 // AddCustomerFollowerPermissions adds permissions for a customer follower
+// With ethical walls a follower of a competing customer is refused with ErrCustomerConflict
+// unless ctx carries a conflict override
 // This affects ALL documents belonging to the customer
-func (r *MySQLPermissionRepository) AddCustomerFollowerPermissions(ctx context.Context, customerID, userID string) error {
+func (r *MySQLPermissionRepository) AddCustomerFollowerPermissions(ctx context.Context, customerID, userID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "add_customer_follower_permissions")
+	defer done()
+	ctx, span := tracer.Start(ctx, "mysql.add_customer_follower_permissions")
+	defer func() { endSpan(span, err) }()
+
+	if err := r.walls.guardFollow(ctx, r.db, r, customerID, userID); err != nil {
+		return err
+	}
+
 	// Find all documents for this customer
 	var documents []model.Document
 	if err := r.db.WithContext(ctx).
@@ -204,7 +346,12 @@ func (r *MySQLPermissionRepository) AddCustomerFollowerPermissions(ctx context.C
 }
 
 // RemoveCustomerFollowerPermissions removes permissions for a customer follower
-func (r *MySQLPermissionRepository) RemoveCustomerFollowerPermissions(ctx context.Context, customerID, userID string) error {
+func (r *MySQLPermissionRepository) RemoveCustomerFollowerPermissions(ctx context.Context, customerID, userID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "remove_customer_follower_permissions")
+	defer done()
+	ctx, span := tracer.Start(ctx, "mysql.remove_customer_follower_permissions")
+	defer func() { endSpan(span, err) }()
+
 	return r.db.WithContext(ctx).
 		Where("user_id = ? AND source_type = ? AND source_id = ?", userID, "customer_follower", customerID).
 		Delete(&model.DocumentPermissionMySQL{}).Error
@@ -212,10 +359,15 @@ func (r *MySQLPermissionRepository) RemoveCustomerFollowerPermissions(ctx contex
 
 // ExpandManagerChain expands manager chain permissions for a user
 // This is called when a user creates a document - all their managers get access
-func (r *MySQLPermissionRepository) ExpandManagerChain(ctx context.Context, userID, documentID, permissionType string) error {
+func (r *MySQLPermissionRepository) ExpandManagerChain(ctx context.Context, userID, documentID, permissionType string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "expand_manager_chain")
+	defer done()
+	ctx, span := tracer.Start(ctx, "mysql.expand_manager_chain")
+	defer func() { endSpan(span, err) }()
+
 	// Find all managers for this user (through all departments)
 	var managerRelations []model.ManagementRelation
-	err := r.db.WithContext(ctx).
+	err = r.db.WithContext(ctx).
 		Joins("JOIN user_departments ON user_departments.department_id = management_relations.department_id").
 		Where("management_relations.subordinate_user_id = ? AND user_departments.user_id = ?", userID, userID).
 		Find(&managerRelations).Error
@@ -317,7 +469,12 @@ func (r *MySQLPermissionRepository) expandManagerChainRecursive(ctx context.Cont
 
 // RebuildDepartmentPermissions rebuilds permissions when department structure changes
 // This is EXPENSIVE - needs to rebuild all affected permissions
-func (r *MySQLPermissionRepository) RebuildDepartmentPermissions(ctx context.Context, departmentID string) error {
+func (r *MySQLPermissionRepository) RebuildDepartmentPermissions(ctx context.Context, departmentID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "rebuild_department_permissions")
+	defer done()
+	ctx, span := tracer.Start(ctx, "mysql.rebuild_department_permissions")
+	defer func() { endSpan(span, err) }()
+
 	// Find all users in this department
 	var userDepts []model.UserDepartment
 	if err := r.db.WithContext(ctx).
@@ -407,6 +564,22 @@ func (r *MySQLPermissionRepository) GetPermissionStats(ctx context.Context) ([]m
 	return results, nil
 }
 
+// CountRowsBySourceType counts the expanded permission rows per source type
+func (r *MySQLPermissionRepository) CountRowsBySourceType(ctx context.Context) ([]model.SourceTypeCount, error) {
+	var counts []model.SourceTypeCount
+	err := r.db.WithContext(ctx).
+		Model(&model.DocumentPermissionMySQL{}).
+		Select("source_type, COUNT(*) as count").
+		Group("source_type").
+		Scan(&counts).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to count permissions by source type: %w", err)
+	}
+
+	return counts, nil
+}
+
 // UpdateDepartmentManager updates department manager and rebuilds all affected permissions
 // This is a VERY expensive operation for MySQL - requires:
 // 1. Finding old manager and their permissions
@@ -414,12 +587,18 @@ func (r *MySQLPermissionRepository) GetPermissionStats(ctx context.Context) ([]m
 // 3. Finding all documents created by these users
 // 4. Deleting old manager's permissions (ONLY through this manager chain)
 // 5. Adding new manager's permissions (checking for duplicates)
-func (r *MySQLPermissionRepository) UpdateDepartmentManager(ctx context.Context, departmentID, newManagerID string) error {
+func (r *MySQLPermissionRepository) UpdateDepartmentManager(ctx context.Context, departmentID, newManagerID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "update_department_manager")
+	defer done()
+	ctx, op := startOperation(ctx, "mysql.update_department_manager")
+	defer func() { op.End(err) }()
+
 	startTime := time.Now()
 
 	// Step 1: Get the old manager ID for this department
+	ctx = op.Step("get_old_manager")
 	var oldManagerID sql.NullString
-	err := r.db.WithContext(ctx).
+	err = r.db.WithContext(ctx).
 		Table("departments").
 		Select("manager_id").
 		Where("id = ?", departmentID).
@@ -429,6 +608,7 @@ func (r *MySQLPermissionRepository) UpdateDepartmentManager(ctx context.Context,
 	}
 
 	// Step 2: Find all departments in the subtree (including this department and all children)
+	ctx = op.Step("find_subtree_departments")
 	var deptTree []string
 	err = r.db.WithContext(ctx).Raw(`
 		WITH RECURSIVE dept_tree AS (
@@ -444,6 +624,7 @@ func (r *MySQLPermissionRepository) UpdateDepartmentManager(ctx context.Context,
 	}
 
 	// Step 3: Find all users in the department subtree
+	ctx = op.Step("find_subtree_users")
 	var userIDs []string
 	err = r.db.WithContext(ctx).Raw(`
 		SELECT DISTINCT user_id FROM user_departments WHERE department_id IN ?
@@ -453,6 +634,7 @@ func (r *MySQLPermissionRepository) UpdateDepartmentManager(ctx context.Context,
 	}
 
 	// Step 4: Find all documents created by these users
+	ctx = op.Step("find_documents")
 	var docs []struct {
 		ID        string
 		CreatorID string
@@ -472,6 +654,7 @@ func (r *MySQLPermissionRepository) UpdateDepartmentManager(ctx context.Context,
 
 	// Step 5: For each document, find which department its creator belongs to (in our dept tree)
 	// This is needed to set the correct source_id
+	ctx = op.Step("resolve_creator_departments")
 	type DocDept struct {
 		DocID        string
 		DepartmentID string
@@ -497,6 +680,7 @@ func (r *MySQLPermissionRepository) UpdateDepartmentManager(ctx context.Context,
 	// Step 6: Delete old manager's permissions (ONLY through this manager chain)
 	// Critical: Only delete permissions where source_id is in our department tree
 	// This preserves permissions the old manager might have from other sources
+	ctx = op.Step("delete_old_manager_permissions")
 	if oldManagerID.Valid && len(documentIDs) > 0 {
 		deleteResult := r.db.WithContext(ctx).Exec(`
 			DELETE FROM document_permissions_mysql
@@ -508,11 +692,12 @@ func (r *MySQLPermissionRepository) UpdateDepartmentManager(ctx context.Context,
 		if deleteResult.Error != nil {
 			return fmt.Errorf("failed to delete old manager permissions: %w", deleteResult.Error)
 		}
-		fmt.Printf("   ℹ️  Deleted %d old manager permissions\n", deleteResult.RowsAffected)
+		reportProgress(ctx, 0, int64(len(docDepts)), "deleted %d old manager permissions", deleteResult.RowsAffected)
 	}
 
 	// Step 7: Add new manager's permissions
 	// Use INSERT IGNORE to avoid duplicates (new manager might already have some permissions via other sources)
+	ctx = op.Step("add_new_manager_permissions")
 	insertCount := 0
 
 	if len(docDepts) > 0 {
@@ -529,12 +714,13 @@ func (r *MySQLPermissionRepository) UpdateDepartmentManager(ctx context.Context,
 
 			insertCount++
 			if insertCount%1000 == 0 {
-				// Progress indicator every 1000 inserts
+				reportProgress(ctx, int64(insertCount), int64(len(docDepts)), "inserted %d new manager permissions", insertCount)
 			}
 		}
 	}
 
 	// Step 8: Update the department's manager_id
+	ctx = op.Step("update_department")
 	err = r.db.WithContext(ctx).
 		Table("departments").
 		Where("id = ?", departmentID).
@@ -543,12 +729,9 @@ func (r *MySQLPermissionRepository) UpdateDepartmentManager(ctx context.Context,
 		return fmt.Errorf("failed to update department manager: %w", err)
 	}
 
-	duration := time.Since(startTime)
-	fmt.Printf("   📊 MySQL UpdateDepartmentManager completed in %v\n", duration)
-	fmt.Printf("      - Processed %d departments in subtree\n", len(deptTree))
-	fmt.Printf("      - Processed %d users\n", len(userIDs))
-	fmt.Printf("      - Processed %d documents\n", len(docs))
-	fmt.Printf("      - Inserted %d new manager permissions\n", len(docDepts))
+	reportProgress(ctx, int64(len(docDepts)), int64(len(docDepts)),
+		"UpdateDepartmentManager completed in %v: %d departments, %d users, %d documents, %d new manager permissions",
+		time.Since(startTime), len(deptTree), len(userIDs), len(docs), len(docDepts))
 
 	return nil
 }
@@ -558,10 +741,16 @@ func (r *MySQLPermissionRepository) UpdateDepartmentManager(ctx context.Context,
 // 1. Find all managers in the department's parent chain (recursive)
 // 2. For each manager, find all their documents
 // 3. Insert permissions for the user (checking for duplicates)
-func (r *MySQLPermissionRepository) AddUserToDepartment(ctx context.Context, userID, departmentID, role string, isPrimary bool) error {
+func (r *MySQLPermissionRepository) AddUserToDepartment(ctx context.Context, userID, departmentID, role string, isPrimary bool) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "add_user_to_department")
+	defer done()
+	ctx, op := startOperation(ctx, "mysql.add_user_to_department")
+	defer func() { op.End(err) }()
+
 	startTime := time.Now()
 
 	// Step 1: Add user-department relationship
+	ctx = op.Step("add_membership")
 	userDept := model.UserDepartment{
 		UserID:       userID,
 		DepartmentID: departmentID,
@@ -575,12 +764,13 @@ func (r *MySQLPermissionRepository) AddUserToDepartment(ctx context.Context, use
 
 	// Step 2: Build manager chain permissions for this user
 	// Find all managers in this department's parent chain (recursive up to root)
+	ctx = op.Step("build_manager_chain")
 	type Manager struct {
 		ManagerID    string
 		DepartmentID string
 	}
 	var managers []Manager
-	err := r.db.WithContext(ctx).Raw(`
+	err = r.db.WithContext(ctx).Raw(`
 		WITH RECURSIVE dept_tree AS (
 			SELECT id, manager_id FROM departments WHERE id = ?
 			UNION ALL
@@ -597,6 +787,7 @@ func (r *MySQLPermissionRepository) AddUserToDepartment(ctx context.Context, use
 
 	// Step 3: For each manager, find their documents and grant permission to this user
 	// Use INSERT IGNORE to avoid duplicates (user might already have some permissions via other sources)
+	ctx = op.Step("grant_manager_permissions")
 	totalInserted := 0
 
 	for _, manager := range managers {
@@ -630,10 +821,9 @@ func (r *MySQLPermissionRepository) AddUserToDepartment(ctx context.Context, use
 		}
 	}
 
-	duration := time.Since(startTime)
-	fmt.Printf("   📊 MySQL AddUserToDepartment completed in %v\n", duration)
-	fmt.Printf("      - Found %d managers in parent chain\n", len(managers))
-	fmt.Printf("      - Inserted %d permissions\n", totalInserted)
+	reportProgress(ctx, int64(len(managers)), int64(len(managers)),
+		"AddUserToDepartment completed in %v: %d managers in parent chain, %d permissions inserted",
+		time.Since(startTime), len(managers), totalInserted)
 
 	return nil
 }
@@ -650,11 +840,17 @@ func (r *MySQLPermissionRepository) AddUserToDepartment(ctx context.Context, use
 // 3. Creator's manager chain permissions
 // 4. ALL followers' manager chain permissions (MISSING in old version!)
 // 5. Superuser permissions (MISSING in old version!)
-func (r *MySQLPermissionRepository) AddDocumentPermissionsComplete(ctx context.Context, document *model.Document) error {
+func (r *MySQLPermissionRepository) AddDocumentPermissionsComplete(ctx context.Context, document *model.Document) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "add_document_permissions_complete")
+	defer done()
+	ctx, op := startOperation(ctx, "mysql.add_document_permissions_complete")
+	defer func() { op.End(err) }()
+
 	startTime := time.Now()
 	permissionCount := 0
 
 	// Step 1: Add creator permissions (owner and viewer)
+	ctx = op.Step("creator_permissions")
 	creatorPerms := []model.DocumentPermissionMySQL{
 		{
 			UserID:         document.CreatorID,
@@ -677,6 +873,7 @@ func (r *MySQLPermissionRepository) AddDocumentPermissionsComplete(ctx context.C
 	permissionCount += 2
 
 	// Step 2: Add customer follower permissions
+	ctx = op.Step("follower_permissions")
 	var followers []model.CustomerFollower
 	if err := r.db.WithContext(ctx).Where("customer_id = ?", document.CustomerID).Find(&followers).Error; err != nil {
 		return fmt.Errorf("failed to find customer followers: %w", err)
@@ -705,6 +902,7 @@ func (r *MySQLPermissionRepository) AddDocumentPermissionsComplete(ctx context.C
 	}
 
 	// Step 3: Add creator's manager chain permissions
+	ctx = op.Step("creator_manager_chain")
 	creatorManagerIDs, err := r.getManagerChain(ctx, document.CreatorID)
 	if err != nil {
 		return fmt.Errorf("failed to get creator manager chain: %w", err)
@@ -728,6 +926,7 @@ func (r *MySQLPermissionRepository) AddDocumentPermissionsComplete(ctx context.C
 	}
 
 	// Step 4: Add ALL followers' manager chain permissions (CRITICAL - was missing!)
+	ctx = op.Step("follower_manager_chain")
 	followerManagerIDs := make(map[string]bool) // Deduplicate
 	for _, followerID := range followerIDs {
 		managerIDs, err := r.getManagerChain(ctx, followerID)
@@ -758,6 +957,7 @@ func (r *MySQLPermissionRepository) AddDocumentPermissionsComplete(ctx context.C
 	}
 
 	// Step 5: Add superuser permissions (CRITICAL - was completely missing!)
+	ctx = op.Step("superuser_permissions")
 	var superusers []model.User
 	if err := r.db.WithContext(ctx).Where("is_superuser = ?", true).Find(&superusers).Error; err != nil {
 		return fmt.Errorf("failed to find superusers: %w", err)
@@ -780,14 +980,9 @@ func (r *MySQLPermissionRepository) AddDocumentPermissionsComplete(ctx context.C
 		permissionCount += len(superusers)
 	}
 
-	duration := time.Since(startTime)
-	fmt.Printf("   📊 AddDocumentPermissionsComplete completed in %v\n", duration)
-	fmt.Printf("      - Creator: 1\n")
-	fmt.Printf("      - Followers: %d\n", len(followerIDs))
-	fmt.Printf("      - Creator's managers: %d\n", len(creatorManagerIDs))
-	fmt.Printf("      - Followers' managers: %d\n", len(followerManagerIDs))
-	fmt.Printf("      - Superusers: %d\n", len(superusers))
-	fmt.Printf("      - Total permissions added: %d\n", permissionCount)
+	reportProgress(ctx, int64(permissionCount), int64(permissionCount),
+		"AddDocumentPermissionsComplete completed in %v: 1 creator, %d followers, %d creator managers, %d follower managers, %d superusers, %d permissions added",
+		time.Since(startTime), len(followerIDs), len(creatorManagerIDs), len(followerManagerIDs), len(superusers), permissionCount)
 
 	return nil
 }
@@ -838,10 +1033,16 @@ func (r *MySQLPermissionRepository) getManagerChain(ctx context.Context, userID
 // 2. Remove old follower's manager chain permissions (CRITICAL - was missing!)
 // 3. Add new follower's customer_follower permissions
 // 4. Add new follower's manager chain permissions (CRITICAL - was missing!)
-func (r *MySQLPermissionRepository) ReplaceCustomerFollowerComplete(ctx context.Context, customerID, oldFollowerID, newFollowerID string) error {
+func (r *MySQLPermissionRepository) ReplaceCustomerFollowerComplete(ctx context.Context, customerID, oldFollowerID, newFollowerID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "replace_customer_follower_complete")
+	defer done()
+	ctx, op := startOperation(ctx, "mysql.replace_customer_follower_complete")
+	defer func() { op.End(err) }()
+
 	startTime := time.Now()
 
 	// Step 1: Get all documents for this customer
+	ctx = op.Step("find_documents")
 	var documents []model.Document
 	if err := r.db.WithContext(ctx).
 		Select("id").
@@ -851,7 +1052,7 @@ func (r *MySQLPermissionRepository) ReplaceCustomerFollowerComplete(ctx context.
 	}
 
 	if len(documents) == 0 {
-		fmt.Println("   📊 No documents found for customer")
+		reportProgress(ctx, 0, 0, "no documents found for customer")
 		return nil
 	}
 
@@ -861,6 +1062,7 @@ func (r *MySQLPermissionRepository) ReplaceCustomerFollowerComplete(ctx context.
 	}
 
 	// Step 2: Remove old follower's customer_follower permissions
+	ctx = op.Step("remove_old_follower")
 	deleteResult1 := r.db.WithContext(ctx).Exec(`
 		DELETE FROM document_permissions_mysql
 		WHERE user_id = ?
@@ -871,10 +1073,11 @@ func (r *MySQLPermissionRepository) ReplaceCustomerFollowerComplete(ctx context.
 	if deleteResult1.Error != nil {
 		return fmt.Errorf("failed to delete old follower permissions: %w", deleteResult1.Error)
 	}
-	fmt.Printf("   ℹ️  Deleted %d old follower's customer_follower permissions\n", deleteResult1.RowsAffected)
+	reportProgress(ctx, 1, 4, "deleted %d old follower's customer_follower permissions", deleteResult1.RowsAffected)
 
 	// Step 3: Remove old follower's manager chain permissions (CRITICAL - was missing!)
 	// Get old follower's manager chain
+	ctx = op.Step("remove_old_manager_chain")
 	oldFollowerManagerIDs, err := r.getManagerChain(ctx, oldFollowerID)
 	if err != nil {
 		return fmt.Errorf("failed to get old follower's manager chain: %w", err)
@@ -897,10 +1100,11 @@ func (r *MySQLPermissionRepository) ReplaceCustomerFollowerComplete(ctx context.
 			}
 			totalDeleted += int(deleteResult.RowsAffected)
 		}
-		fmt.Printf("   ℹ️  Deleted %d old follower's manager chain permissions\n", totalDeleted)
+		reportProgress(ctx, 2, 4, "deleted %d old follower's manager chain permissions", totalDeleted)
 	}
 
 	// Step 4: Add new follower's customer_follower permissions
+	ctx = op.Step("add_new_follower")
 	newFollowerPerms := make([]model.DocumentPermissionMySQL, len(documentIDs))
 	for i, docID := range documentIDs {
 		newFollowerPerms[i] = model.DocumentPermissionMySQL{
@@ -917,10 +1121,11 @@ func (r *MySQLPermissionRepository) ReplaceCustomerFollowerComplete(ctx context.
 		CreateInBatches(newFollowerPerms, 100).Error; err != nil {
 		return fmt.Errorf("failed to add new follower permissions: %w", err)
 	}
-	fmt.Printf("   ℹ️  Added %d new follower's customer_follower permissions\n", len(documentIDs))
+	reportProgress(ctx, 3, 4, "added %d new follower's customer_follower permissions", len(documentIDs))
 
 	// Step 5: Add new follower's manager chain permissions (CRITICAL - was missing!)
 	// Get new follower's manager chain
+	ctx = op.Step("add_new_manager_chain")
 	newFollowerManagerIDs, err := r.getManagerChain(ctx, newFollowerID)
 	if err != nil {
 		return fmt.Errorf("failed to get new follower's manager chain: %w", err)
@@ -948,14 +1153,12 @@ func (r *MySQLPermissionRepository) ReplaceCustomerFollowerComplete(ctx context.
 			}
 			totalAdded += len(documentIDs)
 		}
-		fmt.Printf("   ℹ️  Added %d new follower's manager chain permissions\n", totalAdded)
+		reportProgress(ctx, 3, 4, "added %d new follower's manager chain permissions", totalAdded)
 	}
 
-	duration := time.Since(startTime)
-	fmt.Printf("   📊 ReplaceCustomerFollowerComplete completed in %v\n", duration)
-	fmt.Printf("      - Customer documents: %d\n", len(documentIDs))
-	fmt.Printf("      - Old follower's managers: %d\n", len(oldFollowerManagerIDs))
-	fmt.Printf("      - New follower's managers: %d\n", len(newFollowerManagerIDs))
+	reportProgress(ctx, 4, 4,
+		"ReplaceCustomerFollowerComplete completed in %v: %d customer documents, %d old follower managers, %d new follower managers",
+		time.Since(startTime), len(documentIDs), len(oldFollowerManagerIDs), len(newFollowerManagerIDs))
 
 	return nil
 }
@@ -965,10 +1168,16 @@ func (r *MySQLPermissionRepository) ReplaceCustomerFollowerComplete(ctx context.
 // 1. 查询该超管的所有权限
 // 2. 对每个权限，检查是否有其他来源
 // 3. 只删除那些"仅通过超管身份"获得的权限
-func (r *MySQLPermissionRepository) RevokeSuperuserPermissionsComplete(ctx context.Context, userID string) error {
+func (r *MySQLPermissionRepository) RevokeSuperuserPermissionsComplete(ctx context.Context, userID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "revoke_superuser_permissions_complete")
+	defer done()
+	ctx, op := startOperation(ctx, "mysql.revoke_superuser_permissions_complete")
+	defer func() { op.End(err) }()
+
 	startTime := time.Now()
 
 	// Step 1: Get all superuser permissions for this user
+	ctx = op.Step("find_superuser_permissions")
 	var superuserPerms []model.DocumentPermissionMySQL
 	if err := r.db.WithContext(ctx).
 		Where("user_id = ? AND source_type = 'superuser'", userID).
@@ -977,14 +1186,15 @@ func (r *MySQLPermissionRepository) RevokeSuperuserPermissionsComplete(ctx conte
 	}
 
 	if len(superuserPerms) == 0 {
-		fmt.Println("   ℹ️  No superuser permissions found for user")
+		reportProgress(ctx, 0, 0, "no superuser permissions found for user")
 		return nil
 	}
 
-	fmt.Printf("   ℹ️  Found %d superuser permissions to check\n", len(superuserPerms))
+	reportProgress(ctx, 0, int64(len(superuserPerms)), "found %d superuser permissions to check", len(superuserPerms))
 
 	// Step 2: For each superuser permission, check if user has permission from other sources
 	// If yes, keep it. If no, delete it.
+	ctx = op.Step("revoke_or_keep")
 	deletedCount := 0
 	keptCount := 0
 
@@ -1018,9 +1228,14 @@ func (r *MySQLPermissionRepository) RevokeSuperuserPermissionsComplete(ctx conte
 			// (or we could choose to delete it since they have access anyway)
 			keptCount++
 		}
+
+		if checked := deletedCount + keptCount; checked%1000 == 0 {
+			reportProgress(ctx, int64(checked), int64(len(superuserPerms)), "checked %d superuser permissions", checked)
+		}
 	}
 
 	// Step 3: Remove superuser flag from user
+	ctx = op.Step("clear_superuser_flag")
 	if err := r.db.WithContext(ctx).
 		Table("users").
 		Where("id = ?", userID).
@@ -1028,11 +1243,775 @@ func (r *MySQLPermissionRepository) RevokeSuperuserPermissionsComplete(ctx conte
 		return fmt.Errorf("failed to remove superuser flag: %w", err)
 	}
 
-	duration := time.Since(startTime)
-	fmt.Printf("   📊 RevokeSuperuserPermissionsComplete completed in %v\n", duration)
-	fmt.Printf("      - Total superuser permissions: %d\n", len(superuserPerms))
-	fmt.Printf("      - Deleted (no other sources): %d\n", deletedCount)
-	fmt.Printf("      - Kept (has other sources): %d\n", keptCount)
+	reportProgress(ctx, int64(len(superuserPerms)), int64(len(superuserPerms)),
+		"RevokeSuperuserPermissionsComplete completed in %v: %d superuser permissions, %d deleted (no other sources), %d kept (has other sources)",
+		time.Since(startTime), len(superuserPerms), deletedCount, keptCount)
 
 	return nil
 }
+
+// RemoveUserFromDepartment removes a user from a department with complete logic
+// This handles:
+// 1. Remove the membership and the user's management relations through this department
+// 2. If the user manages the department, remove the manager and their relations to the subtree
+// 3. Unwind manager_chain permissions that were granted through the removed relations
+// 4. Restore viewer permissions the affected managers still have from other sources
+func (r *MySQLPermissionRepository) RemoveUserFromDepartment(ctx context.Context, userID, departmentID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "remove_user_from_department")
+	defer done()
+	ctx, op := startOperation(ctx, "mysql.remove_user_from_department")
+	defer func() { op.End(err) }()
+
+	startTime := time.Now()
+	var deleted, restored int64
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txRepo := &MySQLPermissionRepository{db: tx}
+
+		// Step 1: Managers who reach the user through this department
+		ctx = op.Step("find_managers")
+		tx = tx.WithContext(ctx)
+		var relations []model.ManagementRelation
+		if err := tx.Where("subordinate_user_id = ? AND department_id = ?", userID, departmentID).
+			Find(&relations).Error; err != nil {
+			return fmt.Errorf("failed to find management relations: %w", err)
+		}
+
+		managerSubjects := make(map[string][]string) // manager -> subordinates that lose this manager
+		for _, rel := range relations {
+			managerSubjects[rel.ManagerUserID] = append(managerSubjects[rel.ManagerUserID], rel.SubordinateUserID)
+		}
+
+		// Step 2: If the user manages this department, the subtree loses them as manager
+		ctx = op.Step("find_managed_subtree")
+		tx = tx.WithContext(ctx)
+		var dept model.Department
+		if err := tx.Where("id = ?", departmentID).First(&dept).Error; err != nil {
+			return fmt.Errorf("failed to find department: %w", err)
+		}
+
+		var subtree []string
+		if dept.ManagerID != nil && *dept.ManagerID == userID {
+			if err := tx.Raw(`
+				WITH RECURSIVE dept_tree AS (
+					SELECT id FROM departments WHERE id = ?
+					UNION ALL
+					SELECT d.id FROM departments d
+					INNER JOIN dept_tree dt ON d.parent_id = dt.id
+				)
+				SELECT id FROM dept_tree
+			`, departmentID).Scan(&subtree).Error; err != nil {
+				return fmt.Errorf("failed to get department tree: %w", err)
+			}
+
+			var subordinateIDs []string
+			if err := tx.Model(&model.ManagementRelation{}).
+				Where("manager_user_id = ? AND department_id IN ?", userID, subtree).
+				Distinct().
+				Pluck("subordinate_user_id", &subordinateIDs).Error; err != nil {
+				return fmt.Errorf("failed to find subordinates: %w", err)
+			}
+			managerSubjects[userID] = append(managerSubjects[userID], subordinateIDs...)
+		}
+
+		// Step 3: Remove membership, management relations and the manager assignment
+		ctx = op.Step("remove_relations")
+		tx = tx.WithContext(ctx)
+		if err := tx.Where("user_id = ? AND department_id = ?", userID, departmentID).
+			Delete(&model.UserDepartment{}).Error; err != nil {
+			return fmt.Errorf("failed to remove user from department: %w", err)
+		}
+
+		if err := tx.Where("subordinate_user_id = ? AND department_id = ?", userID, departmentID).
+			Delete(&model.ManagementRelation{}).Error; err != nil {
+			return fmt.Errorf("failed to delete management relations: %w", err)
+		}
+
+		if len(subtree) > 0 {
+			if err := tx.Where("manager_user_id = ? AND department_id IN ?", userID, subtree).
+				Delete(&model.ManagementRelation{}).Error; err != nil {
+				return fmt.Errorf("failed to delete managed relations: %w", err)
+			}
+			if err := tx.Table("departments").Where("id = ?", departmentID).
+				Update("manager_id", nil).Error; err != nil {
+				return fmt.Errorf("failed to clear department manager: %w", err)
+			}
+		}
+
+		// Step 4: Unwind manager_chain permissions and restore other sources
+		ctx = op.Step("unwind_manager_chain")
+		for managerID, subjects := range managerSubjects {
+			documentIDs, err := txRepo.documentsReachableBy(ctx, subjects)
+			if err != nil {
+				return err
+			}
+
+			d, rs, err := txRepo.unwindManagerChain(ctx, managerID, documentIDs)
+			if err != nil {
+				return err
+			}
+			deleted += d
+			restored += rs
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	reportProgress(ctx, 1, 1,
+		"RemoveUserFromDepartment completed in %v: %d manager_chain permissions deleted, %d restored from other sources",
+		time.Since(startTime), deleted, restored)
+
+	return nil
+}
+
+// DeleteDocument deletes a document and every expanded permission row that references it
+func (r *MySQLPermissionRepository) DeleteDocument(ctx context.Context, documentID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "delete_document")
+	defer done()
+	ctx, op := startOperation(ctx, "mysql.delete_document")
+	defer func() { op.End(err) }()
+
+	startTime := time.Now()
+	var deleted int64
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Step 1: Delete permission rows of every source
+		ctx = op.Step("delete_permissions")
+		tx = tx.WithContext(ctx)
+		res := tx.Where("document_id = ?", documentID).Delete(&model.DocumentPermissionMySQL{})
+		if res.Error != nil {
+			return fmt.Errorf("failed to delete document permissions: %w", res.Error)
+		}
+		deleted = res.RowsAffected
+
+		// Step 2: Delete read history and the document itself
+		ctx = op.Step("delete_document")
+		tx = tx.WithContext(ctx)
+		if err := tx.Where("document_id = ?", documentID).Delete(&model.DocumentRead{}).Error; err != nil {
+			return fmt.Errorf("failed to delete document reads: %w", err)
+		}
+		if err := tx.Where("id = ?", documentID).Delete(&model.Document{}).Error; err != nil {
+			return fmt.Errorf("failed to delete document: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	reportProgress(ctx, 1, 1, "DeleteDocument completed in %v: %d permissions deleted", time.Since(startTime), deleted)
+
+	return nil
+}
+
+// ErrUserHasDocuments is returned when deleting a user who still created documents
+// without asking for the documents to be deleted too
+var ErrUserHasDocuments = errors.New("user has created documents")
+
+// DeleteUser deletes a user with complete logic
+// This handles:
+// 1. The user's own permissions, memberships and followings
+// 2. Documents created by the user, only when deleteDocuments is set: documents
+//    cascade with their creator, so a user who created documents is otherwise
+//    rejected with ErrUserHasDocuments (transfer or soft-delete them first)
+// 3. Departments managed by the user lose their manager
+// 4. Managers who reached documents through the user (as creator's peer or follower)
+//    lose those manager_chain permissions, keeping access from other sources
+func (r *MySQLPermissionRepository) DeleteUser(ctx context.Context, userID string, deleteDocuments bool) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "delete_user")
+	defer done()
+	ctx, op := startOperation(ctx, "mysql.delete_user")
+	defer func() { op.End(err) }()
+
+	startTime := time.Now()
+	var ownDeleted, deleted, restored int64
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txRepo := &MySQLPermissionRepository{db: tx}
+
+		// Step 1: Documents created by the user are deleted only on request
+		ctx = op.Step("find_created_documents")
+		tx = tx.WithContext(ctx)
+		var createdIDs []string
+		if err := tx.Model(&model.Document{}).Where("creator_id = ?", userID).Pluck("id", &createdIDs).Error; err != nil {
+			return fmt.Errorf("failed to find created documents: %w", err)
+		}
+		if len(createdIDs) > 0 && !deleteDocuments {
+			return fmt.Errorf("%w: %s created %d documents", ErrUserHasDocuments, userID, len(createdIDs))
+		}
+
+		// Step 2: Managers of the user and the documents they reach through the user.
+		// Must be collected before the user's followings are deleted.
+		ctx = op.Step("find_managers")
+		tx = tx.WithContext(ctx)
+		var managerIDs []string
+		if err := tx.Model(&model.ManagementRelation{}).
+			Where("subordinate_user_id = ?", userID).
+			Distinct().
+			Pluck("manager_user_id", &managerIDs).Error; err != nil {
+			return fmt.Errorf("failed to find managers: %w", err)
+		}
+
+		documentIDs, err := txRepo.documentsReachableBy(ctx, []string{userID})
+		if err != nil {
+			return err
+		}
+
+		// Step 3: Delete the user's own rows and relationships
+		ctx = op.Step("delete_own_rows")
+		tx = tx.WithContext(ctx)
+		res := tx.Where("user_id = ?", userID).Delete(&model.DocumentPermissionMySQL{})
+		if res.Error != nil {
+			return fmt.Errorf("failed to delete user permissions: %w", res.Error)
+		}
+		ownDeleted = res.RowsAffected
+
+		if err := tx.Where("user_id = ?", userID).Delete(&model.CustomerFollower{}).Error; err != nil {
+			return fmt.Errorf("failed to delete customer followings: %w", err)
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.UserDepartment{}).Error; err != nil {
+			return fmt.Errorf("failed to delete department memberships: %w", err)
+		}
+		if err := tx.Where("manager_user_id = ? OR subordinate_user_id = ?", userID, userID).
+			Delete(&model.ManagementRelation{}).Error; err != nil {
+			return fmt.Errorf("failed to delete management relations: %w", err)
+		}
+		if err := tx.Table("departments").Where("manager_id = ?", userID).
+			Update("manager_id", nil).Error; err != nil {
+			return fmt.Errorf("failed to clear managed departments: %w", err)
+		}
+
+		// Step 4: Delete documents created by the user (with all their permission rows)
+		ctx = op.Step("delete_created_documents")
+		tx = tx.WithContext(ctx)
+		for _, chunk := range chunkStrings(createdIDs, maxInClauseSize) {
+			if err := tx.Where("document_id IN ?", chunk).Delete(&model.DocumentPermissionMySQL{}).Error; err != nil {
+				return fmt.Errorf("failed to delete created document permissions: %w", err)
+			}
+			if err := tx.Where("document_id IN ?", chunk).Delete(&model.DocumentRead{}).Error; err != nil {
+				return fmt.Errorf("failed to delete created document reads: %w", err)
+			}
+			if err := tx.Where("id IN ?", chunk).Delete(&model.Document{}).Error; err != nil {
+				return fmt.Errorf("failed to delete created documents: %w", err)
+			}
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.DocumentRead{}).Error; err != nil {
+			return fmt.Errorf("failed to delete user reads: %w", err)
+		}
+
+		if err := tx.Where("id = ?", userID).Delete(&model.User{}).Error; err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+
+		// Step 5: Unwind the managers' manager_chain permissions and restore other sources
+		ctx = op.Step("unwind_manager_chain")
+		for _, managerID := range managerIDs {
+			d, rs, err := txRepo.unwindManagerChain(ctx, managerID, documentIDs)
+			if err != nil {
+				return err
+			}
+			deleted += d
+			restored += rs
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	reportProgress(ctx, 1, 1,
+		"DeleteUser completed in %v: %d own permissions deleted, %d manager_chain permissions deleted, %d restored from other sources",
+		time.Since(startTime), ownDeleted, deleted, restored)
+
+	return nil
+}
+
+// MoveDepartment moves a department and its subtree under newParentID with complete logic.
+// An empty newParentID moves the department to the root.
+// This handles:
+// 1. Reject moves into the department's own subtree or below the deepest level
+// 2. Update parent_id and recalculate the levels of the subtree
+// 3. Rebuild the management relations of the subtree's members from the new parent chain
+// 4. Unwind manager_chain permissions of managers who lost subordinates, keeping other sources
+// 5. Grant manager_chain permissions to managers who gained subordinates
+func (r *MySQLPermissionRepository) MoveDepartment(ctx context.Context, departmentID, newParentID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "move_department")
+	defer done()
+	ctx, span := tracer.Start(ctx, "mysql.move_department", trace.WithAttributes(
+		attribute.String("department.id", departmentID), attribute.String("department.target_id", newParentID)))
+	defer func() { endSpan(span, err) }()
+
+	startTime := time.Now()
+	result := &model.ReorgResult{DepartmentID: departmentID, TargetDepartmentID: newParentID}
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txRepo := &MySQLPermissionRepository{db: tx}
+
+		move, err := moveDepartmentRow(ctx, tx, departmentID, newParentID)
+		if err != nil {
+			return err
+		}
+		result.DepartmentsMoved = len(move.Subtree)
+
+		return txRepo.rebuildDepartmentRelations(ctx, move.SubtreeIDs(), result)
+	})
+	if err != nil {
+		return err
+	}
+
+	reportProgress(ctx, 1, 1,
+		"MoveDepartment completed in %v: %d departments moved, %d relation rows touched, %d permissions deleted, %d inserted",
+		time.Since(startTime), result.DepartmentsMoved, result.RowsTouched, result.PermissionsDeleted, result.PermissionsInserted)
+
+	return nil
+}
+
+// MergeDepartments merges sourceID into targetID with complete logic
+// This handles:
+// 1. Move the source's members and child departments to the target
+// 2. Rebuild the management relations of the target subtree
+// 3. Unwind and grant the affected manager_chain permissions
+// 4. Delete the source department
+func (r *MySQLPermissionRepository) MergeDepartments(ctx context.Context, sourceID, targetID string) (_ *model.ReorgResult, err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "merge_departments")
+	defer done()
+	ctx, span := tracer.Start(ctx, "mysql.merge_departments", trace.WithAttributes(
+		attribute.String("department.id", sourceID), attribute.String("department.target_id", targetID)))
+	defer func() { endSpan(span, err) }()
+
+	startTime := time.Now()
+	result := &model.ReorgResult{
+		Operation:          model.ReorgOperationMerge,
+		DepartmentID:       sourceID,
+		TargetDepartmentID: targetID,
+	}
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txRepo := &MySQLPermissionRepository{db: tx}
+
+		merge, err := mergeDepartmentRows(ctx, tx, sourceID, targetID)
+		if err != nil {
+			return err
+		}
+		result.MembersMoved = len(merge.MemberIDs)
+		result.DepartmentsMoved = len(merge.ChildIDs)
+		result.RowsTouched += merge.RowsTouched
+
+		// The source has no members left, so its relations are removed here
+		if err := txRepo.rebuildDepartmentRelations(ctx, merge.SubtreeIDs, result); err != nil {
+			return err
+		}
+
+		res := tx.Where("id = ?", sourceID).Delete(&model.Department{})
+		if res.Error != nil {
+			return fmt.Errorf("failed to delete merged department: %w", res.Error)
+		}
+		result.RowsTouched += res.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.DurationMs = float64(time.Since(startTime).Microseconds()) / 1000.0
+	reportProgress(ctx, 1, 1,
+		"MergeDepartments completed in %v: %d members, %d child departments, %d rows touched, %d permissions deleted, %d inserted",
+		time.Since(startTime), result.MembersMoved, result.DepartmentsMoved, result.RowsTouched, result.PermissionsDeleted, result.PermissionsInserted)
+
+	return result, nil
+}
+
+// SplitDepartment splits memberIDs out of departmentID into a new sibling department with complete logic.
+// An empty managerID leaves the new department without a manager.
+// This handles:
+// 1. Create the new department next to the source and move the members
+// 2. Rebuild the management relations of both departments
+// 3. Unwind and grant the affected manager_chain permissions
+func (r *MySQLPermissionRepository) SplitDepartment(ctx context.Context, departmentID, newDepartmentID, newName, managerID string, memberIDs []string) (_ *model.ReorgResult, err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "split_department")
+	defer done()
+	ctx, span := tracer.Start(ctx, "mysql.split_department", trace.WithAttributes(
+		attribute.String("department.id", departmentID), attribute.String("department.target_id", newDepartmentID)))
+	defer func() { endSpan(span, err) }()
+
+	startTime := time.Now()
+	result := &model.ReorgResult{
+		Operation:          model.ReorgOperationSplit,
+		DepartmentID:       departmentID,
+		TargetDepartmentID: newDepartmentID,
+	}
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txRepo := &MySQLPermissionRepository{db: tx}
+
+		split, err := splitDepartmentRows(ctx, tx, departmentID, newDepartmentID, newName, managerID, memberIDs)
+		if err != nil {
+			return err
+		}
+		result.MembersMoved = len(split.MemberIDs)
+		result.RowsTouched += split.RowsTouched
+
+		return txRepo.rebuildDepartmentRelations(ctx, []string{departmentID, newDepartmentID}, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.DurationMs = float64(time.Since(startTime).Microseconds()) / 1000.0
+	reportProgress(ctx, 1, 1,
+		"SplitDepartment completed in %v: %d members, %d rows touched, %d permissions deleted, %d inserted",
+		time.Since(startTime), result.MembersMoved, result.RowsTouched, result.PermissionsDeleted, result.PermissionsInserted)
+
+	return result, nil
+}
+
+// rebuildDepartmentRelations recomputes the management relations of every member of departmentIDs
+// from the departments table, then re-derives the manager_chain permissions of managers who lost
+// or gained subordinates. Counts are accumulated in result.
+func (r *MySQLPermissionRepository) rebuildDepartmentRelations(ctx context.Context, departmentIDs []string, result *model.ReorgResult) (err error) {
+	ctx, op := startOperation(ctx, "mysql.rebuild_department_relations",
+		attribute.Int("departments", len(departmentIDs)))
+	defer func() { op.End(err) }()
+
+	// Step 1: Current relations of the departments
+	ctx = op.Step("load_relations")
+	existing := make(map[string]model.ManagementRelation)
+	for _, chunk := range chunkStrings(departmentIDs, maxInClauseSize) {
+		var relations []model.ManagementRelation
+		if err := r.db.WithContext(ctx).Where("department_id IN ?", chunk).Find(&relations).Error; err != nil {
+			return fmt.Errorf("failed to find management relations: %w", err)
+		}
+		for _, rel := range relations {
+			existing[managementRelationKey(&rel)] = rel
+		}
+	}
+
+	// Step 2: Relations implied by the department tree
+	ctx = op.Step("derive_relations")
+	desired, err := r.deriveManagementRelations(ctx, departmentIDs)
+	if err != nil {
+		return err
+	}
+
+	// Step 3: Apply the difference
+	ctx = op.Step("apply_difference")
+	lost := make(map[string][]string)   // manager -> subordinates no longer managed
+	gained := make(map[string][]string) // manager -> newly managed subordinates
+	var staleIDs []int64
+	for key, rel := range existing {
+		want, ok := desired[key]
+		if !ok {
+			staleIDs = append(staleIDs, rel.ID)
+			lost[rel.ManagerUserID] = append(lost[rel.ManagerUserID], rel.SubordinateUserID)
+			continue
+		}
+		if want.ManagementLevel != rel.ManagementLevel {
+			if err := r.db.WithContext(ctx).Model(&model.ManagementRelation{}).
+				Where("id = ?", rel.ID).
+				Update("management_level", want.ManagementLevel).Error; err != nil {
+				return fmt.Errorf("failed to update management level: %w", err)
+			}
+			result.RowsTouched++
+		}
+	}
+
+	var inserts []model.ManagementRelation
+	for key, rel := range desired {
+		if _, ok := existing[key]; !ok {
+			inserts = append(inserts, rel)
+			gained[rel.ManagerUserID] = append(gained[rel.ManagerUserID], rel.SubordinateUserID)
+		}
+	}
+
+	if len(staleIDs) > 0 {
+		res := r.db.WithContext(ctx).Where("id IN ?", staleIDs).Delete(&model.ManagementRelation{})
+		if res.Error != nil {
+			return fmt.Errorf("failed to delete management relations: %w", res.Error)
+		}
+		result.RowsTouched += res.RowsAffected
+	}
+	if len(inserts) > 0 {
+		res := r.db.WithContext(ctx).CreateInBatches(inserts, 1000)
+		if res.Error != nil {
+			return fmt.Errorf("failed to insert management relations: %w", res.Error)
+		}
+		result.RowsTouched += res.RowsAffected
+	}
+
+	// Step 4: Unwind managers who lost subordinates, restoring access they keep through other sources
+	ctx = op.Step("unwind_lost")
+	for managerID, subjects := range lost {
+		documentIDs, err := r.documentsReachableBy(ctx, subjects)
+		if err != nil {
+			return err
+		}
+
+		deleted, restored, err := r.unwindManagerChain(ctx, managerID, documentIDs)
+		if err != nil {
+			return err
+		}
+		result.PermissionsDeleted += deleted
+		result.PermissionsInserted += restored
+	}
+
+	// Step 5: Grant managers who gained subordinates access to their documents
+	ctx = op.Step("grant_gained")
+	for managerID, subjects := range gained {
+		documentIDs, err := r.documentsReachableBy(ctx, subjects)
+		if err != nil {
+			return err
+		}
+
+		granted, err := r.restoreViewerPermissions(ctx, managerID, documentIDs)
+		if err != nil {
+			return err
+		}
+		result.PermissionsInserted += granted
+	}
+
+	return nil
+}
+
+// deriveManagementRelations builds the management relations of the members of departmentIDs:
+// the department's manager manages its members at level 1, and the manager of the department
+// h parent links above manages them at level h+1, for up to departmentParentMaxDepth links
+func (r *MySQLPermissionRepository) deriveManagementRelations(ctx context.Context, departmentIDs []string) (map[string]model.ManagementRelation, error) {
+	// Step 1: The departments and their parent chains
+	departments := make(map[string]departmentRow)
+	for _, chunk := range chunkStrings(departmentIDs, maxInClauseSize) {
+		var rows []departmentRow
+		err := r.db.WithContext(ctx).Raw(`
+			WITH RECURSIVE chain AS (
+				SELECT id, parent_id, level, manager_id, 0 AS depth FROM departments WHERE id IN ?
+				UNION ALL
+				SELECT d.id, d.parent_id, d.level, d.manager_id, c.depth + 1 FROM departments d
+				INNER JOIN chain c ON d.id = c.parent_id
+				WHERE c.depth < ?
+			)
+			SELECT DISTINCT id, parent_id, level, manager_id FROM chain
+		`, chunk, departmentParentMaxDepth).Scan(&rows).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent chains: %w", err)
+		}
+		for _, d := range rows {
+			departments[d.ID] = d
+		}
+	}
+
+	// Step 2: Members of the departments
+	var memberships []model.UserDepartment
+	for _, chunk := range chunkStrings(departmentIDs, maxInClauseSize) {
+		var batch []model.UserDepartment
+		if err := r.db.WithContext(ctx).Where("department_id IN ?", chunk).Find(&batch).Error; err != nil {
+			return nil, fmt.Errorf("failed to find department members: %w", err)
+		}
+		memberships = append(memberships, batch...)
+	}
+
+	// Step 3: Walk each member's department upwards; the lowest level wins
+	relations := make(map[string]model.ManagementRelation)
+	add := func(managerID *string, ud model.UserDepartment, level int) {
+		if managerID == nil || *managerID == ud.UserID {
+			return
+		}
+		rel := model.ManagementRelation{
+			ManagerUserID:     *managerID,
+			SubordinateUserID: ud.UserID,
+			DepartmentID:      ud.DepartmentID,
+			ManagementLevel:   level,
+		}
+		key := managementRelationKey(&rel)
+		if current, ok := relations[key]; !ok || current.ManagementLevel > level {
+			relations[key] = rel
+		}
+	}
+
+	for _, ud := range memberships {
+		dept, ok := departments[ud.DepartmentID]
+		if !ok {
+			continue
+		}
+		add(dept.ManagerID, ud, 1)
+
+		parentID := dept.ParentID
+		for hop := 1; hop <= departmentParentMaxDepth && parentID != nil; hop++ {
+			parent, ok := departments[*parentID]
+			if !ok {
+				break
+			}
+			add(parent.ManagerID, ud, hop+1)
+			parentID = parent.ParentID
+		}
+	}
+
+	return relations, nil
+}
+
+func managementRelationKey(rel *model.ManagementRelation) string {
+	return rel.ManagerUserID + "|" + rel.SubordinateUserID + "|" + rel.DepartmentID
+}
+
+// documentsReachableBy returns the documents a manager reaches through the given subordinates:
+// documents they created and documents of customers they follow
+func (r *MySQLPermissionRepository) documentsReachableBy(ctx context.Context, userIDs []string) ([]string, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	var documentIDs []string
+	for _, chunk := range chunkStrings(uniqueStrings(userIDs), maxInClauseSize) {
+		var ids []string
+		if err := r.db.WithContext(ctx).Raw(`
+			SELECT id FROM documents WHERE creator_id IN ?
+			UNION
+			SELECT d.id FROM documents d
+			JOIN customer_followers cf ON cf.customer_id = d.customer_id
+			WHERE cf.user_id IN ?
+		`, chunk, chunk).Scan(&ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to find reachable documents: %w", err)
+		}
+		documentIDs = append(documentIDs, ids...)
+	}
+
+	return uniqueStrings(documentIDs), nil
+}
+
+// unwindManagerChain deletes a manager's manager_chain rows on documentIDs, then restores
+// viewer access the manager still has through other sources
+func (r *MySQLPermissionRepository) unwindManagerChain(ctx context.Context, managerID string, documentIDs []string) (deleted, restored int64, err error) {
+	for _, chunk := range chunkStrings(documentIDs, maxInClauseSize) {
+		res := r.db.WithContext(ctx).
+			Where("user_id = ? AND document_id IN ? AND source_type = ?", managerID, chunk, model.SourceTypeManagerChain).
+			Delete(&model.DocumentPermissionMySQL{})
+		if res.Error != nil {
+			return 0, 0, fmt.Errorf("failed to delete manager %s permissions: %w", managerID, res.Error)
+		}
+		deleted += res.RowsAffected
+	}
+
+	restored, err = r.restoreViewerPermissions(ctx, managerID, documentIDs)
+	if err != nil {
+		return 0, 0, err
+	}
+	return deleted, restored, nil
+}
+
+// restoreViewerPermissions re-derives viewer rows for documents the user no longer has a viewer
+// row on, using the remaining sources in precedence order: creator, customer follower,
+// manager chain (via a subordinate's document or followed customer), superuser
+func (r *MySQLPermissionRepository) restoreViewerPermissions(ctx context.Context, userID string, documentIDs []string) (int64, error) {
+	if len(documentIDs) == 0 {
+		return 0, nil
+	}
+
+	// Step 1: Documents without a viewer row
+	var docs []model.Document
+	for _, chunk := range chunkStrings(documentIDs, maxInClauseSize) {
+		var batch []model.Document
+		if err := r.db.WithContext(ctx).
+			Select("id", "creator_id", "customer_id").
+			Where("id IN ?", chunk).
+			Where("NOT EXISTS (SELECT 1 FROM document_permissions_mysql p WHERE p.user_id = ? AND p.document_id = documents.id AND p.permission_type = 'viewer')", userID).
+			Find(&batch).Error; err != nil {
+			return 0, fmt.Errorf("failed to find documents without viewer permission: %w", err)
+		}
+		docs = append(docs, batch...)
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	// Step 2: Remaining sources of the user
+	var user model.User
+	if err := r.db.WithContext(ctx).Select("id", "is_superuser").Where("id = ?", userID).First(&user).Error; err != nil {
+		return 0, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	var followed []string
+	if err := r.db.WithContext(ctx).Model(&model.CustomerFollower{}).
+		Where("user_id = ?", userID).
+		Pluck("customer_id", &followed).Error; err != nil {
+		return 0, fmt.Errorf("failed to find followed customers: %w", err)
+	}
+
+	var subordinateIDs []string
+	if err := r.db.WithContext(ctx).Model(&model.ManagementRelation{}).
+		Where("manager_user_id = ?", userID).
+		Distinct().
+		Pluck("subordinate_user_id", &subordinateIDs).Error; err != nil {
+		return 0, fmt.Errorf("failed to find subordinates: %w", err)
+	}
+
+	// Manager chain rows record the subordinate user, so keep one follower per customer
+	subordinateByCustomer := make(map[string]string)
+	for _, chunk := range chunkStrings(subordinateIDs, maxInClauseSize) {
+		var follows []model.CustomerFollower
+		if err := r.db.WithContext(ctx).
+			Select("user_id", "customer_id").
+			Where("user_id IN ?", chunk).
+			Order("user_id").
+			Find(&follows).Error; err != nil {
+			return 0, fmt.Errorf("failed to find subordinate followed customers: %w", err)
+		}
+		for _, follow := range follows {
+			if _, ok := subordinateByCustomer[follow.CustomerID]; !ok {
+				subordinateByCustomer[follow.CustomerID] = follow.UserID
+			}
+		}
+	}
+
+	followedSet := toSet(followed)
+	subordinateSet := toSet(subordinateIDs)
+
+	// Step 3: Pick the first remaining source for each document
+	perms := make([]model.DocumentPermissionMySQL, 0, len(docs))
+	for i := range docs {
+		doc := &docs[i]
+		perm := model.DocumentPermissionMySQL{
+			UserID:         userID,
+			DocumentID:     doc.ID,
+			PermissionType: "viewer",
+		}
+
+		switch {
+		case doc.CreatorID == userID:
+			perm.SourceType, perm.SourceID = model.SourceTypeDirect, &doc.ID
+		case followedSet[doc.CustomerID]:
+			perm.SourceType, perm.SourceID = model.SourceTypeCustomerFollower, &doc.CustomerID
+		case subordinateSet[doc.CreatorID]:
+			perm.SourceType, perm.SourceID = model.SourceTypeManagerChain, &doc.CreatorID
+		case subordinateByCustomer[doc.CustomerID] != "":
+			subordinateID := subordinateByCustomer[doc.CustomerID]
+			perm.SourceType, perm.SourceID = model.SourceTypeManagerChain, &subordinateID
+		case user.IsSuperuser:
+			perm.SourceType = model.SourceTypeSuperuser
+		default:
+			continue
+		}
+		perms = append(perms, perm)
+	}
+
+	if len(perms) == 0 {
+		return 0, nil
+	}
+
+	res := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(perms, 1000)
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to restore permissions: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+func toSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
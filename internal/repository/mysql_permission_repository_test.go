@@ -646,3 +646,321 @@ func TestRevokeSuperuserPermissionsComplete(t *testing.T) {
 	t.Logf("   - User still has access to doc2 (customer_follower source)")
 	t.Logf("   - User lost access to doc3 (only had superuser source)")
 }
+
+// TestRemoveUserFromDepartmentComplete tests removing a user from a department
+// This verifies:
+// 1. The membership and management relations through the department are removed
+// 2. The manager loses manager_chain permissions reached only through the removed user
+// 3. The manager keeps access to documents reachable through another subordinate
+func TestRemoveUserFromDepartmentComplete(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewMySQLPermissionRepository(db)
+	ctx := context.Background()
+
+	member := createTestUser(db, "rm-member", "Removed Member", "rm-member@example.com")
+	peer := createTestUser(db, "rm-peer", "Remaining Peer", "rm-peer@example.com")
+	manager := createTestUser(db, "rm-manager", "Department Manager", "rm-manager@example.com")
+
+	customer := createTestCustomer(db, "customer-rm", "Customer Remove Test")
+	dept := createTestDepartment(db, "dept-rm", "Sales", 3, nil)
+
+	// doc1 is created by the member only; doc2 is created by the member but the peer follows its customer
+	doc1 := createTestDocument(db, "doc-rm-1", "Doc 1", "customer-rm-other", member.ID)
+	doc2 := createTestDocument(db, "doc-rm-2", "Doc 2", customer.ID, member.ID)
+
+	for _, userID := range []string{member.ID, peer.ID} {
+		db.Create(&model.UserDepartment{UserID: userID, DepartmentID: dept.ID, Role: "member", IsPrimary: true})
+		db.Create(&model.ManagementRelation{ManagerUserID: manager.ID, SubordinateUserID: userID, DepartmentID: dept.ID, ManagementLevel: 1})
+	}
+	db.Create(&model.CustomerFollower{UserID: peer.ID, CustomerID: customer.ID})
+
+	db.Create(&[]model.DocumentPermissionMySQL{
+		{UserID: member.ID, DocumentID: doc1.ID, PermissionType: "owner", SourceType: "direct", SourceID: &doc1.ID},
+		{UserID: member.ID, DocumentID: doc2.ID, PermissionType: "owner", SourceType: "direct", SourceID: &doc2.ID},
+		{UserID: manager.ID, DocumentID: doc1.ID, PermissionType: "viewer", SourceType: "manager_chain", SourceID: &member.ID},
+		{UserID: manager.ID, DocumentID: doc2.ID, PermissionType: "viewer", SourceType: "manager_chain", SourceID: &member.ID},
+		{UserID: peer.ID, DocumentID: doc2.ID, PermissionType: "viewer", SourceType: "customer_follower", SourceID: &customer.ID},
+	})
+
+	// Execute the removal
+	err := repo.RemoveUserFromDepartment(ctx, member.ID, dept.ID)
+	require.NoError(t, err)
+
+	// Verify membership and management relations are gone
+	var membershipCount, relationCount int64
+	db.Model(&model.UserDepartment{}).Where("user_id = ? AND department_id = ?", member.ID, dept.ID).Count(&membershipCount)
+	db.Model(&model.ManagementRelation{}).Where("subordinate_user_id = ?", member.ID).Count(&relationCount)
+	assert.Equal(t, int64(0), membershipCount, "Member should no longer be in the department")
+	assert.Equal(t, int64(0), relationCount, "Member should have no managers")
+
+	// Verify the manager lost doc1 but kept doc2 through the peer's customer
+	var doc1Count int64
+	db.Table("document_permissions_mysql").Where("user_id = ? AND document_id = ?", manager.ID, doc1.ID).Count(&doc1Count)
+	assert.Equal(t, int64(0), doc1Count, "Manager should lose access to doc1")
+
+	var doc2Perm model.DocumentPermissionMySQL
+	err = db.Where("user_id = ? AND document_id = ?", manager.ID, doc2.ID).First(&doc2Perm).Error
+	require.NoError(t, err, "Manager should keep access to doc2")
+	assert.Equal(t, "manager_chain", doc2Perm.SourceType)
+	assert.Equal(t, customer.ID, *doc2Perm.SourceID, "doc2 access should now come from the peer's customer")
+
+	// Verify the member keeps their own documents
+	var ownerCount int64
+	db.Table("document_permissions_mysql").Where("user_id = ? AND permission_type = ?", member.ID, "owner").Count(&ownerCount)
+	assert.Equal(t, int64(2), ownerCount, "Member should keep owner permissions")
+
+	t.Logf("✅ Test passed! Manager lost doc1 and kept doc2 via %s", *doc2Perm.SourceID)
+}
+
+// TestDeleteDocumentComplete tests deleting a document with permissions from every source
+func TestDeleteDocumentComplete(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewMySQLPermissionRepository(db)
+	ctx := context.Background()
+
+	creator := createTestUser(db, "deldoc-creator", "Creator", "deldoc-creator@example.com")
+	follower := createTestUser(db, "deldoc-follower", "Follower", "deldoc-follower@example.com")
+	customer := createTestCustomer(db, "customer-deldoc", "Customer Delete Doc Test")
+	doc := createTestDocument(db, "doc-deldoc-1", "Doc To Delete", customer.ID, creator.ID)
+
+	db.Create(&[]model.DocumentPermissionMySQL{
+		{UserID: creator.ID, DocumentID: doc.ID, PermissionType: "owner", SourceType: "direct", SourceID: &doc.ID},
+		{UserID: follower.ID, DocumentID: doc.ID, PermissionType: "viewer", SourceType: "customer_follower", SourceID: &customer.ID},
+	})
+
+	err := repo.DeleteDocument(ctx, doc.ID)
+	require.NoError(t, err)
+
+	var permCount, docCount int64
+	db.Table("document_permissions_mysql").Where("document_id = ?", doc.ID).Count(&permCount)
+	db.Model(&model.Document{}).Where("id = ?", doc.ID).Count(&docCount)
+	assert.Equal(t, int64(0), permCount, "All permissions of the document should be deleted")
+	assert.Equal(t, int64(0), docCount, "Document should be deleted")
+
+	// Deleting again is a no-op
+	require.NoError(t, repo.DeleteDocument(ctx, doc.ID))
+
+	t.Logf("✅ Test passed! Document %s and its permissions were deleted", doc.ID)
+}
+
+// TestDeleteUserComplete tests deleting a user
+// This verifies:
+// 1. The user's own rows, documents and relations are deleted, documents only on request
+// 2. Departments managed by the user lose their manager
+// 3. Managers lose manager_chain access reached through the user, keeping other sources
+func TestDeleteUserComplete(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewMySQLPermissionRepository(db)
+	ctx := context.Background()
+
+	victim := createTestUser(db, "deluser-victim", "Deleted User", "deluser-victim@example.com")
+	manager := createTestUser(db, "deluser-manager", "Manager", "deluser-manager@example.com")
+	other := createTestUser(db, "deluser-other", "Other Creator", "deluser-other@example.com")
+
+	customer := createTestCustomer(db, "customer-deluser", "Customer Delete User Test")
+	dept := createTestDepartment(db, "dept-deluser", "Support", 3, nil)
+	managedDept := createTestDepartment(db, "dept-deluser-managed", "Support Team", 4, &dept.ID)
+	db.Model(managedDept).Update("manager_id", victim.ID)
+
+	// victimDoc is created by the victim; followedDoc belongs to the customer the victim follows
+	victimDoc := createTestDocument(db, "doc-deluser-1", "Victim Doc", "customer-deluser-other", victim.ID)
+	followedDoc := createTestDocument(db, "doc-deluser-2", "Followed Doc", customer.ID, other.ID)
+
+	db.Create(&model.UserDepartment{UserID: victim.ID, DepartmentID: dept.ID, Role: "member", IsPrimary: true})
+	db.Create(&model.ManagementRelation{ManagerUserID: manager.ID, SubordinateUserID: victim.ID, DepartmentID: dept.ID, ManagementLevel: 1})
+	db.Create(&model.CustomerFollower{UserID: victim.ID, CustomerID: customer.ID})
+
+	db.Create(&[]model.DocumentPermissionMySQL{
+		{UserID: victim.ID, DocumentID: victimDoc.ID, PermissionType: "owner", SourceType: "direct", SourceID: &victimDoc.ID},
+		{UserID: victim.ID, DocumentID: followedDoc.ID, PermissionType: "viewer", SourceType: "customer_follower", SourceID: &customer.ID},
+		{UserID: manager.ID, DocumentID: victimDoc.ID, PermissionType: "viewer", SourceType: "manager_chain", SourceID: &victim.ID},
+		{UserID: manager.ID, DocumentID: followedDoc.ID, PermissionType: "viewer", SourceType: "manager_chain", SourceID: &customer.ID},
+	})
+
+	// Without deleteDocuments the user's documents block the delete
+	err := repo.DeleteUser(ctx, victim.ID, false)
+	assert.ErrorIs(t, err, ErrUserHasDocuments)
+
+	err = repo.DeleteUser(ctx, victim.ID, true)
+	require.NoError(t, err)
+
+	// Verify the user and their document are gone
+	var userCount, docCount, victimPermCount int64
+	db.Model(&model.User{}).Where("id = ?", victim.ID).Count(&userCount)
+	db.Model(&model.Document{}).Where("id = ?", victimDoc.ID).Count(&docCount)
+	db.Table("document_permissions_mysql").Where("user_id = ?", victim.ID).Count(&victimPermCount)
+	assert.Equal(t, int64(0), userCount, "User should be deleted")
+	assert.Equal(t, int64(0), docCount, "Documents created by the user should be deleted")
+	assert.Equal(t, int64(0), victimPermCount, "User permissions should be deleted")
+
+	// Verify the managed department has no manager
+	var reloaded model.Department
+	require.NoError(t, db.Where("id = ?", managedDept.ID).First(&reloaded).Error)
+	assert.Nil(t, reloaded.ManagerID, "Managed department should lose its manager")
+
+	// Verify the manager lost access reached through the user
+	var managerCount int64
+	db.Table("document_permissions_mysql").Where("user_id = ? AND document_id IN ?", manager.ID, []string{victimDoc.ID, followedDoc.ID}).Count(&managerCount)
+	assert.Equal(t, int64(0), managerCount, "Manager should lose manager_chain permissions through the deleted user")
+
+	t.Logf("✅ Test passed! User %s deleted, manager permissions unwound", victim.ID)
+}
+
+// TestMoveDepartmentComplete tests moving a department subtree to a new parent
+// This verifies:
+// 1. Levels of the subtree are recalculated
+// 2. Inherited management relations follow the new parent chain
+// 3. The old parent's manager loses manager_chain permissions; the new one gains them
+// 4. Moving a department below itself is rejected
+func TestMoveDepartmentComplete(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewMySQLPermissionRepository(db)
+	ctx := context.Background()
+
+	oldManager := createTestUser(db, "move-old-manager", "Old Parent Manager", "move-old@example.com")
+	newManager := createTestUser(db, "move-new-manager", "New Parent Manager", "move-new@example.com")
+	lead := createTestUser(db, "move-lead", "Team Lead", "move-lead@example.com")
+	member := createTestUser(db, "move-member", "Sub-team Member", "move-member@example.com")
+
+	// Tree: old-hq (L1) -> team (L2) -> sub (L3); root (L1) -> new-parent (L2)
+	oldHQ := createTestDepartment(db, "dept-move-old-hq", "Old HQ", 1, nil)
+	root := createTestDepartment(db, "dept-move-root", "Root", 1, nil)
+	newParent := createTestDepartment(db, "dept-move-new", "New Parent", 2, &root.ID)
+	team := createTestDepartment(db, "dept-move-team", "Team", 2, &oldHQ.ID)
+	sub := createTestDepartment(db, "dept-move-sub", "Sub-team", 3, &team.ID)
+
+	// Reset the tree and relations left over from previous runs
+	db.Model(&model.Department{}).Where("id = ?", oldHQ.ID).Update("manager_id", oldManager.ID)
+	db.Model(&model.Department{}).Where("id = ?", newParent.ID).Update("manager_id", newManager.ID)
+	db.Model(&model.Department{}).Where("id = ?", team.ID).Updates(map[string]interface{}{"parent_id": oldHQ.ID, "level": 2, "manager_id": lead.ID})
+	db.Model(&model.Department{}).Where("id = ?", sub.ID).Updates(map[string]interface{}{"parent_id": team.ID, "level": 3})
+	db.Where("subordinate_user_id IN ?", []string{lead.ID, member.ID}).Delete(&model.ManagementRelation{})
+
+	db.Create(&model.UserDepartment{UserID: lead.ID, DepartmentID: team.ID, Role: "leader", IsPrimary: true})
+	db.Create(&model.UserDepartment{UserID: member.ID, DepartmentID: sub.ID, Role: "member", IsPrimary: true})
+	db.Create(&[]model.ManagementRelation{
+		{ManagerUserID: oldManager.ID, SubordinateUserID: lead.ID, DepartmentID: team.ID, ManagementLevel: 2},
+		{ManagerUserID: lead.ID, SubordinateUserID: member.ID, DepartmentID: sub.ID, ManagementLevel: 2},
+		{ManagerUserID: oldManager.ID, SubordinateUserID: member.ID, DepartmentID: sub.ID, ManagementLevel: 3},
+	})
+
+	doc := createTestDocument(db, "doc-move-1", "Member Doc", "customer-move", member.ID)
+	db.Where("document_id = ?", doc.ID).Delete(&model.DocumentPermissionMySQL{})
+	db.Create(&[]model.DocumentPermissionMySQL{
+		{UserID: member.ID, DocumentID: doc.ID, PermissionType: "owner", SourceType: "direct", SourceID: &doc.ID},
+		{UserID: lead.ID, DocumentID: doc.ID, PermissionType: "viewer", SourceType: "manager_chain", SourceID: &member.ID},
+		{UserID: oldManager.ID, DocumentID: doc.ID, PermissionType: "viewer", SourceType: "manager_chain", SourceID: &member.ID},
+	})
+
+	// Moving a department below its own subtree is rejected
+	err := repo.MoveDepartment(ctx, team.ID, sub.ID)
+	require.ErrorIs(t, err, ErrDepartmentCycle)
+
+	// Execute the move
+	err = repo.MoveDepartment(ctx, team.ID, newParent.ID)
+	require.NoError(t, err)
+
+	// Verify levels were recalculated
+	var moved []model.Department
+	db.Where("id IN ?", []string{team.ID, sub.ID}).Order("level").Find(&moved)
+	require.Len(t, moved, 2)
+	assert.Equal(t, newParent.ID, *moved[0].ParentID)
+	assert.Equal(t, 3, moved[0].Level, "Team should move to level 3")
+	assert.Equal(t, 4, moved[1].Level, "Sub-team should move to level 4")
+
+	// Verify inherited relations follow the new parent
+	var oldRelations, newRelations int64
+	db.Model(&model.ManagementRelation{}).Where("manager_user_id = ? AND subordinate_user_id IN ?", oldManager.ID, []string{lead.ID, member.ID}).Count(&oldRelations)
+	db.Model(&model.ManagementRelation{}).Where("manager_user_id = ? AND subordinate_user_id IN ?", newManager.ID, []string{lead.ID, member.ID}).Count(&newRelations)
+	assert.Equal(t, int64(0), oldRelations, "Old parent's manager should no longer manage the subtree")
+	assert.Equal(t, int64(2), newRelations, "New parent's manager should manage the lead and the member")
+
+	// Verify manager_chain permissions moved with the relations
+	var oldCount, leadCount int64
+	db.Table("document_permissions_mysql").Where("user_id = ? AND document_id = ?", oldManager.ID, doc.ID).Count(&oldCount)
+	db.Table("document_permissions_mysql").Where("user_id = ? AND document_id = ?", lead.ID, doc.ID).Count(&leadCount)
+	assert.Equal(t, int64(0), oldCount, "Old parent's manager should lose access")
+	assert.Equal(t, int64(1), leadCount, "Team lead should keep access")
+
+	var newPerm model.DocumentPermissionMySQL
+	err = db.Where("user_id = ? AND document_id = ?", newManager.ID, doc.ID).First(&newPerm).Error
+	require.NoError(t, err, "New parent's manager should gain access")
+	assert.Equal(t, "manager_chain", newPerm.SourceType)
+
+	t.Logf("✅ Test passed! Team moved under %s, %d inherited relations rebuilt", newParent.ID, newRelations)
+}
+
+// TestMergeAndSplitDepartmentsComplete tests splitting a department and merging it back
+// This verifies:
+// 1. Split creates a sibling department, moves members and rebuilds their relations
+// 2. The new department's manager gains manager_chain permissions; the old one loses them
+// 3. Merge moves the members back, removes the department and restores the permissions
+func TestMergeAndSplitDepartmentsComplete(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewMySQLPermissionRepository(db)
+	ctx := context.Background()
+
+	manager := createTestUser(db, "reorg-manager", "Original Manager", "reorg-manager@example.com")
+	newManager := createTestUser(db, "reorg-new-manager", "Split Manager", "reorg-new-manager@example.com")
+	stay := createTestUser(db, "reorg-stay", "Staying Member", "reorg-stay@example.com")
+	leave := createTestUser(db, "reorg-leave", "Leaving Member", "reorg-leave@example.com")
+
+	parent := createTestDepartment(db, "dept-reorg-parent", "Reorg Parent", 1, nil)
+	dept := createTestDepartment(db, "dept-reorg", "Reorg Team", 2, &parent.ID)
+	db.Model(&model.Department{}).Where("id = ?", dept.ID).Update("manager_id", manager.ID)
+
+	// Reset leftovers from previous runs
+	const splitID = "dept-reorg-split"
+	db.Where("department_id = ?", splitID).Delete(&model.UserDepartment{})
+	db.Where("id = ?", splitID).Delete(&model.Department{})
+	db.Where("subordinate_user_id IN ?", []string{stay.ID, leave.ID, newManager.ID}).Delete(&model.ManagementRelation{})
+
+	for _, userID := range []string{stay.ID, leave.ID, newManager.ID} {
+		db.Create(&model.UserDepartment{UserID: userID, DepartmentID: dept.ID, Role: "member", IsPrimary: true})
+		db.Create(&model.ManagementRelation{ManagerUserID: manager.ID, SubordinateUserID: userID, DepartmentID: dept.ID, ManagementLevel: 1})
+	}
+
+	doc := createTestDocument(db, "doc-reorg-1", "Leaving Member Doc", "customer-reorg", leave.ID)
+	db.Where("document_id = ?", doc.ID).Delete(&model.DocumentPermissionMySQL{})
+	db.Create(&[]model.DocumentPermissionMySQL{
+		{UserID: leave.ID, DocumentID: doc.ID, PermissionType: "owner", SourceType: "direct", SourceID: &doc.ID},
+		{UserID: manager.ID, DocumentID: doc.ID, PermissionType: "viewer", SourceType: "manager_chain", SourceID: &leave.ID},
+	})
+
+	hasAccess := func(userID string) bool {
+		var count int64
+		db.Table("document_permissions_mysql").Where("user_id = ? AND document_id = ?", userID, doc.ID).Count(&count)
+		return count > 0
+	}
+
+	// Moving a user who is not a member is rejected
+	_, err := repo.SplitDepartment(ctx, dept.ID, splitID, "Split Team", newManager.ID, []string{"reorg-unknown"})
+	require.ErrorIs(t, err, ErrNotDepartmentMember)
+
+	// Step 1: Split the leaving member and the new manager out
+	split, err := repo.SplitDepartment(ctx, dept.ID, splitID, "Split Team", newManager.ID, []string{leave.ID, newManager.ID})
+	require.NoError(t, err)
+	assert.Equal(t, 2, split.MembersMoved)
+	assert.Greater(t, split.RowsTouched, int64(0))
+
+	var created model.Department
+	require.NoError(t, db.Where("id = ?", splitID).First(&created).Error)
+	assert.Equal(t, parent.ID, *created.ParentID, "Split department should be a sibling")
+	assert.Equal(t, dept.Level, created.Level)
+
+	assert.False(t, hasAccess(manager.ID), "Original manager should lose access to the leaving member's doc")
+	assert.True(t, hasAccess(newManager.ID), "Split manager should gain access")
+
+	// Step 2: Merge the split department back
+	merge, err := repo.MergeDepartments(ctx, splitID, dept.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, merge.MembersMoved)
+
+	var splitCount int64
+	db.Model(&model.Department{}).Where("id = ?", splitID).Count(&splitCount)
+	assert.Equal(t, int64(0), splitCount, "Merged department should be deleted")
+	assert.True(t, hasAccess(manager.ID), "Original manager should regain access")
+	assert.False(t, hasAccess(newManager.ID), "Split manager should lose access")
+
+	t.Logf("✅ Test passed! Split wrote %d rows, merge wrote %d rows", split.Writes(), merge.Writes())
+}
@@ -0,0 +1,438 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// maxBackfillUnexplained bounds how many unexplained rows are kept in BackfillResult
+const maxBackfillUnexplained = 1000
+
+// tableNamePattern restricts the source table to a plain (optionally schema-qualified) identifier
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+(\.[A-Za-z0-9_]+)?$`)
+
+// BackfillOptions controls a tuple backfill
+type BackfillOptions struct {
+	SourceTable    string // Expanded table to read (default document_permissions_mysql)
+	BatchSize      int    // Rows per read and tuples per INSERT batch (default 1000)
+	OrgFromTables  bool   // Derive department tuples from departments/user_departments instead of relation_tuples
+	DryRun         bool   // Infer and verify only - nothing is written
+	MaxUnexplained int    // Unexplained rows kept in the result (default 1000)
+}
+
+// PermissionBackfiller infers the minimal base tuples behind an expanded
+// permission table - the inverse of PermissionMaterializer. Direct rows map
+// one-to-one to document tuples, customer_follower rows collapse into
+// customer#follower and document#owner_customer tuples, superuser rows into
+// system:root#admin, and manager_chain rows create no tuples at all: they are
+// verified against the department graph. Rows that no base relationship
+// explains are reported instead of being turned into tuples.
+type PermissionBackfiller struct {
+	db           *gorm.DB
+	zanzibarRepo *ZanzibarPermissionRepository
+}
+
+// NewPermissionBackfiller creates a new permission backfiller
+func NewPermissionBackfiller(db *gorm.DB) *PermissionBackfiller {
+	return &PermissionBackfiller{
+		db:           db,
+		zanzibarRepo: NewZanzibarPermissionRepository(db),
+	}
+}
+
+// backfillState accumulates what the scan of the expanded table has established
+type backfillState struct {
+	opts    BackfillOptions
+	result  *model.BackfillResult
+	pending []model.RelationTuple
+	seen    map[string]bool
+
+	owners       map[string]map[string]bool // document -> owners
+	docCustomer  map[string]string          // document -> owning customer
+	followers    map[string]map[string]bool // customer -> followers
+	deptMembers  map[string][]string        // department -> members, nil for source IDs that are no department
+	graph        *managerGraph
+	managerCache map[string]map[string]bool // subordinate -> managers
+}
+
+// Backfill scans the source table twice: first to infer base tuples from
+// direct, customer_follower and superuser rows, then to verify that every
+// manager_chain row follows from those tuples and the department graph.
+func (b *PermissionBackfiller) Backfill(ctx context.Context, opts BackfillOptions) (*model.BackfillResult, error) {
+	startTime := time.Now()
+
+	if opts.SourceTable == "" {
+		opts.SourceTable = model.DocumentPermissionMySQL{}.TableName()
+	}
+	if !tableNamePattern.MatchString(opts.SourceTable) {
+		return nil, fmt.Errorf("invalid source table name %q", opts.SourceTable)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.MaxUnexplained <= 0 {
+		opts.MaxUnexplained = maxBackfillUnexplained
+	}
+
+	s := &backfillState{
+		opts:         opts,
+		result:       &model.BackfillResult{Unexplained: []model.BackfillUnexplained{}},
+		seen:         make(map[string]bool),
+		owners:       make(map[string]map[string]bool),
+		docCustomer:  make(map[string]string),
+		followers:    make(map[string]map[string]bool),
+		deptMembers:  make(map[string][]string),
+		graph:        newManagerGraph(),
+		managerCache: make(map[string]map[string]bool),
+	}
+
+	var total int64
+	if err := b.db.WithContext(ctx).Table(opts.SourceTable).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count %s: %w", opts.SourceTable, err)
+	}
+
+	// Step 1: Department tuples from the business tables, if requested
+	if opts.OrgFromTables {
+		if err := b.loadOrgFromTables(ctx, s); err != nil {
+			return nil, err
+		}
+	}
+
+	// Step 2: Infer tuples from direct, customer_follower and superuser rows
+	err := b.scan(ctx, opts, "source_type <> ?", model.SourceTypeManagerChain, func(rows []model.DocumentPermissionMySQL) error {
+		for i := range rows {
+			b.inferRow(s, &rows[i])
+		}
+		reportProgress(ctx, s.result.RowsScanned, total, "Scanned %d/%d rows (%d unexplained)",
+			s.result.RowsScanned, total, s.result.RowsUnexplained)
+		return b.flush(ctx, s, false)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := b.flush(ctx, s, true); err != nil {
+		return nil, err
+	}
+
+	// Step 3: Verify manager_chain rows against the inferred roots and the department graph
+	err = b.scan(ctx, opts, "source_type = ?", model.SourceTypeManagerChain, func(rows []model.DocumentPermissionMySQL) error {
+		if !opts.OrgFromTables {
+			var sourceIDs []string
+			for i := range rows {
+				if rows[i].SourceID != nil {
+					sourceIDs = append(sourceIDs, *rows[i].SourceID)
+				}
+			}
+			sourceIDs = uniqueStrings(sourceIDs)
+			if err := b.loadDepartmentMembers(ctx, s, sourceIDs); err != nil {
+				return err
+			}
+
+			var subordinateIDs []string
+			for _, id := range sourceIDs {
+				subordinateIDs = append(subordinateIDs, s.subordinatesOf(id)...)
+			}
+			if err := s.graph.load(ctx, b.db.WithContext(ctx), uniqueStrings(subordinateIDs)); err != nil {
+				return err
+			}
+		}
+		for i := range rows {
+			b.verifyManagerRow(s, &rows[i])
+		}
+		reportProgress(ctx, s.result.RowsScanned, total, "Verified %d/%d rows (%d unexplained)",
+			s.result.RowsScanned, total, s.result.RowsUnexplained)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.result.DurationMs = float64(time.Since(startTime).Microseconds()) / 1000.0
+	return s.result, nil
+}
+
+// scan reads the source table matching where in id order, batchSize rows at a time
+func (b *PermissionBackfiller) scan(ctx context.Context, opts BackfillOptions, where string, arg interface{}, fn func([]model.DocumentPermissionMySQL) error) error {
+	var lastID int64
+	for {
+		var rows []model.DocumentPermissionMySQL
+		if err := b.db.WithContext(ctx).Table(opts.SourceTable).
+			Where(where, arg).
+			Where("id > ?", lastID).
+			Order("id").
+			Limit(opts.BatchSize).
+			Find(&rows).Error; err != nil {
+			return fmt.Errorf("failed to read %s: %w", opts.SourceTable, err)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		if err := fn(rows); err != nil {
+			return err
+		}
+		lastID = rows[len(rows)-1].ID
+	}
+}
+
+// inferRow turns one non-manager row into its base tuples, or reports it
+func (b *PermissionBackfiller) inferRow(s *backfillState, row *model.DocumentPermissionMySQL) {
+	s.result.RowsScanned++
+
+	switch row.SourceType {
+	case model.SourceTypeDirect:
+		// Direct rows are unique per (user, document, permission), so they skip the dedupe set.
+		// A time-bound row keeps its end time on the tuple.
+		s.pending = append(s.pending, model.RelationTuple{Namespace: "document", ObjectID: row.DocumentID, Relation: row.PermissionType, SubjectNamespace: "user", SubjectID: row.UserID, ExpiresAt: row.ExpiresAt})
+		s.result.DirectTuples++
+		if row.PermissionType == "owner" {
+			addToSet(s.owners, row.DocumentID, row.UserID)
+		}
+
+	case model.SourceTypeCustomerFollower:
+		if row.PermissionType != "viewer" {
+			s.unexplained(row, "customer followers are only granted viewer")
+			return
+		}
+		if row.SourceID == nil || *row.SourceID == "" {
+			s.unexplained(row, "customer_follower row has no customer in source_id")
+			return
+		}
+		customerID := *row.SourceID
+		if existing, ok := s.docCustomer[row.DocumentID]; ok && existing != customerID {
+			s.unexplained(row, fmt.Sprintf("document is already owned by customer %s", existing))
+			return
+		}
+		s.docCustomer[row.DocumentID] = customerID
+		addToSet(s.followers, customerID, row.UserID)
+
+		if s.add(model.RelationTuple{Namespace: "customer", ObjectID: customerID, Relation: "follower", SubjectNamespace: "user", SubjectID: row.UserID}) {
+			s.result.FollowerTuples++
+		}
+		if s.add(model.RelationTuple{Namespace: "document", ObjectID: row.DocumentID, Relation: "owner_customer", SubjectNamespace: "customer", SubjectID: customerID}) {
+			s.result.OwnerCustomerTuples++
+		}
+
+	case model.SourceTypeSuperuser:
+		if row.PermissionType != "viewer" {
+			s.unexplained(row, "superusers are only granted viewer")
+			return
+		}
+		if s.add(model.RelationTuple{Namespace: "system", ObjectID: "root", Relation: "admin", SubjectNamespace: "user", SubjectID: row.UserID}) {
+			s.result.SuperuserTuples++
+		}
+
+	default:
+		s.unexplained(row, fmt.Sprintf("unknown source_type %q", row.SourceType))
+		return
+	}
+
+	s.result.RowsExplained++
+}
+
+// verifyManagerRow checks that a subordinate behind the row's source reaches the
+// document as owner or customer follower, and that the row's user manages that
+// subordinate. The writers record the subordinate itself, the followed customer
+// (follower paths) or the department (department manager and membership paths)
+// as source, so customers resolve to their followers and departments to their members.
+func (b *PermissionBackfiller) verifyManagerRow(s *backfillState, row *model.DocumentPermissionMySQL) {
+	s.result.RowsScanned++
+
+	if row.PermissionType != "viewer" {
+		s.unexplained(row, "the manager chain only grants viewer")
+		return
+	}
+	if row.SourceID == nil || *row.SourceID == "" {
+		s.unexplained(row, "manager_chain row has no subordinate in source_id")
+		return
+	}
+	sourceID := *row.SourceID
+
+	if _, isCustomer := s.followers[sourceID]; isCustomer && s.docCustomer[row.DocumentID] != sourceID {
+		s.unexplained(row, fmt.Sprintf("document is not owned by customer %s", sourceID))
+		return
+	}
+
+	rooted := false
+	for _, subordinateID := range s.subordinatesOf(sourceID) {
+		isRoot := s.owners[row.DocumentID][subordinateID]
+		if !isRoot {
+			if customerID, ok := s.docCustomer[row.DocumentID]; ok {
+				isRoot = s.followers[customerID][subordinateID]
+			}
+		}
+		if !isRoot {
+			continue
+		}
+		rooted = true
+		if s.manages(row.UserID, subordinateID) {
+			s.result.RowsExplained++
+			return
+		}
+	}
+
+	if !rooted {
+		s.unexplained(row, fmt.Sprintf("no subordinate behind %s owns the document or follows its customer", sourceID))
+		return
+	}
+	s.unexplained(row, fmt.Sprintf("user does not manage the subordinates behind %s through any department", sourceID))
+}
+
+// subordinatesOf resolves a manager_chain source to the users it stands for: the
+// followers of a customer, the members of a department, or the user itself
+func (s *backfillState) subordinatesOf(sourceID string) []string {
+	if followers, ok := s.followers[sourceID]; ok {
+		ids := make([]string, 0, len(followers))
+		for id := range followers {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	if members := s.deptMembers[sourceID]; len(members) > 0 {
+		return members
+	}
+	return []string{sourceID}
+}
+
+// manages reports whether managerID manages subordinateID through the department graph
+func (s *backfillState) manages(managerID, subordinateID string) bool {
+	managers, ok := s.managerCache[subordinateID]
+	if !ok {
+		managers = make(map[string]bool)
+		for _, id := range s.graph.managersOf(subordinateID, managerChainMaxDepth) {
+			managers[id] = true
+		}
+		s.managerCache[subordinateID] = managers
+	}
+	return managers[managerID]
+}
+
+// loadDepartmentMembers caches the department#member tuples of the source IDs that are
+// neither known customers nor looked up before; IDs without members stay plain users
+func (b *PermissionBackfiller) loadDepartmentMembers(ctx context.Context, s *backfillState, sourceIDs []string) error {
+	var ids []string
+	for _, id := range sourceIDs {
+		if _, isCustomer := s.followers[id]; isCustomer {
+			continue
+		}
+		if _, ok := s.deptMembers[id]; !ok {
+			s.deptMembers[id] = nil
+			ids = append(ids, id)
+		}
+	}
+
+	for _, chunk := range chunkStrings(ids, maxInClauseSize) {
+		var memberships []model.RelationTuple
+		if err := b.db.WithContext(ctx).Select("object_id", "subject_id").Scopes(unexpired, unconditional).
+			Where("namespace = ? AND relation = ? AND subject_namespace = ? AND object_id IN ?",
+				"department", "member", "user", chunk).
+			Order("id").
+			Find(&memberships).Error; err != nil {
+			return fmt.Errorf("failed to load department members: %w", err)
+		}
+		for _, t := range memberships {
+			s.deptMembers[t.ObjectID] = append(s.deptMembers[t.ObjectID], t.SubjectID)
+		}
+	}
+	return nil
+}
+
+// loadOrgFromTables builds the whole department graph from the business tables
+// and queues the matching department tuples
+func (b *PermissionBackfiller) loadOrgFromTables(ctx context.Context, s *backfillState) error {
+	var memberships []model.UserDepartment
+	if err := b.db.WithContext(ctx).Select("user_id", "department_id").Order("id").Find(&memberships).Error; err != nil {
+		return fmt.Errorf("failed to load department memberships: %w", err)
+	}
+	for _, m := range memberships {
+		s.graph.departments[m.UserID] = append(s.graph.departments[m.UserID], m.DepartmentID)
+		s.deptMembers[m.DepartmentID] = append(s.deptMembers[m.DepartmentID], m.UserID)
+		if s.add(model.RelationTuple{Namespace: "department", ObjectID: m.DepartmentID, Relation: "member", SubjectNamespace: "user", SubjectID: m.UserID}) {
+			s.result.DepartmentTuples++
+		}
+	}
+
+	var departments []model.Department
+	if err := b.db.WithContext(ctx).Select("id", "parent_id", "manager_id").Order("id").Find(&departments).Error; err != nil {
+		return fmt.Errorf("failed to load departments: %w", err)
+	}
+	for _, d := range departments {
+		if d.ManagerID != nil {
+			s.graph.managers[d.ID] = append(s.graph.managers[d.ID], *d.ManagerID)
+			if s.add(model.RelationTuple{Namespace: "department", ObjectID: d.ID, Relation: "manager", SubjectNamespace: "user", SubjectID: *d.ManagerID}) {
+				s.result.DepartmentTuples++
+			}
+		}
+		if d.ParentID != nil {
+			s.graph.parents[d.ID] = append(s.graph.parents[d.ID], *d.ParentID)
+			if s.add(model.RelationTuple{Namespace: "department", ObjectID: d.ID, Relation: "parent", SubjectNamespace: "department", SubjectID: *d.ParentID}) {
+				s.result.DepartmentTuples++
+			}
+		}
+	}
+
+	return nil
+}
+
+// flush writes the queued tuples once a batch is full, or unconditionally when final is set
+func (b *PermissionBackfiller) flush(ctx context.Context, s *backfillState, final bool) error {
+	if len(s.pending) == 0 || (!final && len(s.pending) < s.opts.BatchSize) {
+		return nil
+	}
+
+	if !s.opts.DryRun {
+		inserted, err := b.zanzibarRepo.BulkInsertTuples(ctx, s.pending, s.opts.BatchSize)
+		if err != nil {
+			return err
+		}
+		s.result.TuplesInserted += inserted
+		s.result.TuplesExisting += int64(len(s.pending)) - inserted
+	}
+
+	s.pending = s.pending[:0]
+	return nil
+}
+
+// add queues a tuple unless it was already inferred; it reports whether the tuple is new
+func (s *backfillState) add(tuple model.RelationTuple) bool {
+	key := tuple.Text()
+	if s.seen[key] {
+		return false
+	}
+	s.seen[key] = true
+	s.pending = append(s.pending, tuple)
+	return true
+}
+
+// unexplained counts a row no base relationship accounts for and keeps it up to the cap
+func (s *backfillState) unexplained(row *model.DocumentPermissionMySQL, reason string) {
+	s.result.RowsUnexplained++
+	if len(s.result.Unexplained) >= s.opts.MaxUnexplained {
+		return
+	}
+	s.result.Unexplained = append(s.result.Unexplained, model.BackfillUnexplained{
+		RowID:          row.ID,
+		UserID:         row.UserID,
+		DocumentID:     row.DocumentID,
+		PermissionType: row.PermissionType,
+		SourceType:     row.SourceType,
+		SourceID:       row.SourceID,
+		Reason:         reason,
+	})
+}
+
+func addToSet(sets map[string]map[string]bool, key, value string) {
+	set, ok := sets[key]
+	if !ok {
+		set = make(map[string]bool)
+		sets[key] = set
+	}
+	set[value] = true
+}
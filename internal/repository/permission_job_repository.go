@@ -0,0 +1,341 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// ErrJobNotFound is returned when a permission job does not exist
+var ErrJobNotFound = errors.New("permission job not found")
+
+// ErrJobLeaseLost is returned when a job is no longer leased with the given token,
+// because the lease expired and the job was requeued or claimed again
+var ErrJobLeaseLost = errors.New("permission job lease lost")
+
+// stalenessSampleSize bounds how many recently finished jobs feed the staleness percentiles
+const stalenessSampleSize = 1000
+
+// PermissionJobRepository stores the durable permission recompute queue (permission_jobs)
+type PermissionJobRepository struct {
+	db *gorm.DB
+}
+
+// NewPermissionJobRepository creates a new permission job repository
+func NewPermissionJobRepository(db *gorm.DB) *PermissionJobRepository {
+	return &PermissionJobRepository{db: db}
+}
+
+// Enqueue inserts a job unless a job with the same key already exists.
+// It returns the stored job and whether it was newly created.
+func (r *PermissionJobRepository) Enqueue(ctx context.Context, job *model.PermissionJob) (*model.PermissionJob, bool, error) {
+	if job.Status == "" {
+		job.Status = model.JobStatusPending
+	}
+	if job.RunAfter.IsZero() {
+		job.RunAfter = time.Now()
+	}
+
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "job_key"}}, DoNothing: true}).
+		Create(job)
+	if result.Error != nil {
+		return nil, false, fmt.Errorf("failed to enqueue job: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return job, true, nil
+	}
+
+	existing, err := r.GetByKey(ctx, job.JobKey)
+	if err != nil {
+		return nil, false, err
+	}
+	return existing, false, nil
+}
+
+// Get returns a job by ID
+func (r *PermissionJobRepository) Get(ctx context.Context, id int64) (*model.PermissionJob, error) {
+	var job model.PermissionJob
+	err := r.db.WithContext(ctx).Where("id = ?", id).Take(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return &job, nil
+}
+
+// GetByKey returns a job by its idempotency key
+func (r *PermissionJobRepository) GetByKey(ctx context.Context, key string) (*model.PermissionJob, error) {
+	var job model.PermissionJob
+	err := r.db.WithContext(ctx).Where("job_key = ?", key).Take(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return &job, nil
+}
+
+// Claim leases the next runnable job to workerID. It returns nil when no job is due.
+// SKIP LOCKED lets concurrent workers claim different jobs without blocking each other.
+// Every claim gets its own lease token in LockedBy; Renew, UpdateProgress, Complete
+// and Fail only act while the job still holds that token.
+func (r *PermissionJobRepository) Claim(ctx context.Context, workerID string) (*model.PermissionJob, error) {
+	var claimed *model.PermissionJob
+	lease := fmt.Sprintf("%.63s/%s", workerID, uuid.NewString())
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var job model.PermissionJob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND run_after <= ?", model.JobStatusPending, now).
+			Order("run_after, id").
+			Take(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&model.PermissionJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status":     model.JobStatusRunning,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"locked_by":  lease,
+			"locked_at":  now,
+			"started_at": gorm.Expr("COALESCE(started_at, ?)", now),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ?", job.ID).Take(&job).Error; err != nil {
+			return err
+		}
+		claimed = &job
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	return claimed, nil
+}
+
+// Complete marks a leased job as succeeded, storing the JSON result of the operation if any
+func (r *PermissionJobRepository) Complete(ctx context.Context, id int64, lease string, result *string) error {
+	res := r.db.WithContext(ctx).Model(&model.PermissionJob{}).
+		Where("id = ? AND locked_by = ?", id, lease).
+		Updates(map[string]interface{}{
+			"status":      model.JobStatusSucceeded,
+			"last_error":  nil,
+			"result":      result,
+			"locked_by":   nil,
+			"locked_at":   nil,
+			"finished_at": time.Now(),
+		})
+	if res.Error != nil {
+		return fmt.Errorf("failed to complete job: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: job %d", ErrJobLeaseLost, id)
+	}
+	return nil
+}
+
+// Fail records a failed attempt. A non-nil retryAt puts the job back in the queue,
+// otherwise the job is marked as permanently failed.
+func (r *PermissionJobRepository) Fail(ctx context.Context, id int64, lease, errMsg string, retryAt *time.Time) error {
+	updates := map[string]interface{}{
+		"last_error": errMsg,
+		"locked_by":  nil,
+		"locked_at":  nil,
+	}
+	if retryAt != nil {
+		updates["status"] = model.JobStatusPending
+		updates["run_after"] = *retryAt
+	} else {
+		updates["status"] = model.JobStatusFailed
+		updates["finished_at"] = time.Now()
+	}
+
+	res := r.db.WithContext(ctx).Model(&model.PermissionJob{}).
+		Where("id = ? AND locked_by = ?", id, lease).
+		Updates(updates)
+	if res.Error != nil {
+		return fmt.Errorf("failed to record job failure: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: job %d", ErrJobLeaseLost, id)
+	}
+	return nil
+}
+
+// Renew extends the lease of a running job so RecoverStale does not requeue it
+func (r *PermissionJobRepository) Renew(ctx context.Context, id int64, lease string) error {
+	return r.updateLeased(ctx, id, lease, map[string]interface{}{"locked_at": time.Now()})
+}
+
+// UpdateProgress stores the progress reported by a running job and extends its lease
+func (r *PermissionJobRepository) UpdateProgress(ctx context.Context, id int64, lease string, done, total int64, message string) error {
+	if len(message) > 500 {
+		message = message[:500]
+	}
+
+	return r.updateLeased(ctx, id, lease, map[string]interface{}{
+		"progress_done":    done,
+		"progress_total":   total,
+		"progress_message": message,
+		"locked_at":        time.Now(),
+	})
+}
+
+// updateLeased applies updates to a job that still holds lease
+func (r *PermissionJobRepository) updateLeased(ctx context.Context, id int64, lease string, updates map[string]interface{}) error {
+	res := r.db.WithContext(ctx).Model(&model.PermissionJob{}).
+		Where("id = ? AND locked_by = ?", id, lease).
+		Updates(updates)
+	if res.Error != nil {
+		return fmt.Errorf("failed to update leased job: %w", res.Error)
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+
+	// MySQL reports unchanged rows as unaffected, e.g. a renewal within the same second
+	var held int64
+	err := r.db.WithContext(ctx).Model(&model.PermissionJob{}).
+		Where("id = ? AND locked_by = ?", id, lease).
+		Count(&held).Error
+	if err != nil {
+		return fmt.Errorf("failed to check job lease: %w", err)
+	}
+	if held == 0 {
+		return fmt.Errorf("%w: job %d", ErrJobLeaseLost, id)
+	}
+	return nil
+}
+
+// RecoverStale releases jobs whose lease was taken before lockedBefore (crashed or stuck workers).
+// Jobs that have used up their attempts are failed, the rest are requeued.
+func (r *PermissionJobRepository) RecoverStale(ctx context.Context, lockedBefore time.Time) (int64, error) {
+	var recovered int64
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		result := tx.Model(&model.PermissionJob{}).
+			Where("status = ? AND locked_at < ? AND attempts >= max_attempts", model.JobStatusRunning, lockedBefore).
+			Updates(map[string]interface{}{
+				"status":      model.JobStatusFailed,
+				"last_error":  "lease expired",
+				"locked_by":   nil,
+				"locked_at":   nil,
+				"finished_at": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		recovered += result.RowsAffected
+
+		result = tx.Model(&model.PermissionJob{}).
+			Where("status = ? AND locked_at < ?", model.JobStatusRunning, lockedBefore).
+			Updates(map[string]interface{}{
+				"status":     model.JobStatusPending,
+				"last_error": "lease expired",
+				"locked_by":  nil,
+				"locked_at":  nil,
+				"run_after":  now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		recovered += result.RowsAffected
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to recover stale jobs: %w", err)
+	}
+	return recovered, nil
+}
+
+// Stats returns queue depth per status and the staleness window of recently finished jobs
+func (r *PermissionJobRepository) Stats(ctx context.Context) (*model.JobStats, error) {
+	stats := &model.JobStats{}
+
+	var counts []struct {
+		Status string
+		Count  int64
+	}
+	err := r.db.WithContext(ctx).Model(&model.PermissionJob{}).
+		Select("status, COUNT(*) as count").
+		Group("status").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count jobs: %w", err)
+	}
+	for _, c := range counts {
+		switch c.Status {
+		case model.JobStatusPending:
+			stats.Pending = c.Count
+		case model.JobStatusRunning:
+			stats.Running = c.Count
+		case model.JobStatusSucceeded:
+			stats.Succeeded = c.Count
+		case model.JobStatusFailed:
+			stats.Failed = c.Count
+		}
+	}
+
+	var oldest model.PermissionJob
+	err = r.db.WithContext(ctx).
+		Where("status = ?", model.JobStatusPending).
+		Order("created_at").
+		Take(&oldest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get oldest pending job: %w", err)
+	}
+	if err == nil {
+		stats.OldestPendingAgeMs = float64(time.Since(oldest.CreatedAt).Microseconds()) / 1000
+	}
+
+	// Staleness window: from enqueue (the mutation) to the end of the recompute
+	var windows []float64
+	err = r.db.WithContext(ctx).Model(&model.PermissionJob{}).
+		Where("status = ? AND finished_at IS NOT NULL", model.JobStatusSucceeded).
+		Order("finished_at DESC").
+		Limit(stalenessSampleSize).
+		Pluck("TIMESTAMPDIFF(MICROSECOND, created_at, finished_at) / 1000", &windows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get staleness window: %w", err)
+	}
+
+	if len(windows) > 0 {
+		sort.Float64s(windows)
+
+		var sum float64
+		for _, w := range windows {
+			sum += w
+		}
+
+		stats.StalenessSamples = int64(len(windows))
+		stats.StalenessAvgMs = sum / float64(len(windows))
+		stats.StalenessP50Ms = windows[len(windows)*50/100]
+		stats.StalenessP95Ms = windows[len(windows)*95/100]
+		stats.StalenessMaxMs = windows[len(windows)-1]
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// TestPermissionJobLifecycle tests idempotent enqueue, claiming, retry and completion
+func TestPermissionJobLifecycle(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewPermissionJobRepository(db)
+	ctx := context.Background()
+
+	const key = "test:job-lifecycle-1"
+	const worker = "test-worker"
+
+	// Clean up leftovers from previous runs
+	db.Where("job_key = ?", key).Delete(&model.PermissionJob{})
+
+	// Step 1: Enqueue twice with the same key
+	job, created, err := repo.Enqueue(ctx, &model.PermissionJob{
+		JobKey:      key,
+		JobType:     "test_job",
+		Payload:     `{"department_id":"dept-1"}`,
+		MaxAttempts: 2,
+	})
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, model.JobStatusPending, job.Status)
+
+	again, created, err := repo.Enqueue(ctx, &model.PermissionJob{
+		JobKey:      key,
+		JobType:     "test_job",
+		Payload:     `{"department_id":"dept-2"}`,
+		MaxAttempts: 2,
+	})
+	require.NoError(t, err)
+	assert.False(t, created, "same key must not create a second job")
+	assert.Equal(t, job.ID, again.ID)
+
+	// Step 2: Claim, fail and requeue
+	claimed := claimJob(t, repo, worker, job.ID)
+	assert.Equal(t, model.JobStatusRunning, claimed.Status)
+	assert.Equal(t, 1, claimed.Attempts)
+
+	retryAt := time.Now().Add(-time.Second)
+	require.NotNil(t, claimed.LockedBy)
+	require.NoError(t, repo.Fail(ctx, job.ID, *claimed.LockedBy, "boom", &retryAt))
+
+	stored, err := repo.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.JobStatusPending, stored.Status)
+	require.NotNil(t, stored.LastError)
+	assert.Equal(t, "boom", *stored.LastError)
+
+	// Step 3: Claim again, report progress and complete
+	claimed = claimJob(t, repo, worker, job.ID)
+	assert.Equal(t, 2, claimed.Attempts)
+
+	require.NoError(t, repo.UpdateProgress(ctx, job.ID, *claimed.LockedBy, 5, 10, "halfway"))
+	result := `{"members_moved":3}`
+	require.NoError(t, repo.Complete(ctx, job.ID, *claimed.LockedBy, &result))
+
+	stored, err = repo.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.JobStatusSucceeded, stored.Status)
+	assert.Equal(t, int64(5), stored.ProgressDone)
+	require.NotNil(t, stored.Result)
+	assert.JSONEq(t, result, *stored.Result)
+	assert.NotNil(t, stored.FinishedAt)
+	assert.Nil(t, stored.LockedBy)
+
+	// Step 4: Staleness window includes the finished job
+	stats, err := repo.Stats(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, stats.Succeeded, int64(1))
+	assert.GreaterOrEqual(t, stats.StalenessSamples, int64(1))
+	assert.GreaterOrEqual(t, stats.StalenessMaxMs, stats.StalenessP50Ms)
+
+	_, err = repo.Get(ctx, -1)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+
+	t.Logf("✅ Test passed! Job %d succeeded after %d attempts", job.ID, claimed.Attempts)
+}
+
+// TestPermissionJobRecoverStale tests that expired leases are requeued and that the
+// worker that lost its lease can no longer renew, complete or fail the job
+func TestPermissionJobRecoverStale(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewPermissionJobRepository(db)
+	ctx := context.Background()
+
+	const key = "test:job-stale-1"
+	db.Where("job_key = ?", key).Delete(&model.PermissionJob{})
+
+	job, _, err := repo.Enqueue(ctx, &model.PermissionJob{JobKey: key, JobType: "test_job", Payload: `{}`, MaxAttempts: 3})
+	require.NoError(t, err)
+	// Step 1: A renewed lease is not recovered
+	first := claimJob(t, repo, "slow-worker", job.ID)
+	require.NoError(t, repo.Renew(ctx, job.ID, *first.LockedBy))
+
+	recovered, err := repo.RecoverStale(ctx, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	stored, err := repo.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.JobStatusRunning, stored.Status)
+
+	// Step 2: An expired lease is requeued
+	recovered, err = repo.RecoverStale(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, recovered, int64(1))
+
+	stored, err = repo.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.JobStatusPending, stored.Status)
+	assert.Nil(t, stored.LockedBy)
+
+	// Step 3: The same worker claims it again under a new lease; the old run is fenced off
+	second := claimJob(t, repo, "slow-worker", job.ID)
+	assert.NotEqual(t, *first.LockedBy, *second.LockedBy)
+
+	assert.ErrorIs(t, repo.Renew(ctx, job.ID, *first.LockedBy), ErrJobLeaseLost)
+	assert.ErrorIs(t, repo.UpdateProgress(ctx, job.ID, *first.LockedBy, 1, 2, "stale"), ErrJobLeaseLost)
+	assert.ErrorIs(t, repo.Complete(ctx, job.ID, *first.LockedBy, nil), ErrJobLeaseLost)
+	assert.ErrorIs(t, repo.Fail(ctx, job.ID, *first.LockedBy, "stale", nil), ErrJobLeaseLost)
+
+	require.NoError(t, repo.Complete(ctx, job.ID, *second.LockedBy, nil))
+	stored, err = repo.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.JobStatusSucceeded, stored.Status)
+
+	t.Logf("✅ Test passed! Recovered %d stale jobs", recovered)
+}
+
+// claimJob claims until the given job is leased; other due jobs are released untouched
+func claimJob(t *testing.T, repo *PermissionJobRepository, worker string, id int64) *model.PermissionJob {
+	t.Helper()
+	ctx := context.Background()
+
+	var others []*model.PermissionJob
+	defer func() {
+		for _, other := range others {
+			now := time.Now()
+			_ = repo.Fail(ctx, other.ID, *other.LockedBy, "released by test", &now)
+		}
+	}()
+
+	for {
+		job, err := repo.Claim(ctx, worker)
+		require.NoError(t, err)
+		require.NotNil(t, job, "job %d was not claimable", id)
+		if job.ID == id {
+			return job
+		}
+		others = append(others, job)
+	}
+}
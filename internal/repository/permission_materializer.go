@@ -0,0 +1,818 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
+)
+
+const (
+	// managerChainMaxDepth matches the depth of the Zanzibar manager chain check
+	managerChainMaxDepth = 5
+	// materializeBatchSize is the number of documents recomputed per transaction
+	materializeBatchSize = 500
+	// maxInClauseSize bounds the number of values bound into a single IN clause
+	maxInClauseSize = 1000
+)
+
+// PermissionMaterializer maintains document_permissions_mysql from relation_tuples.
+// The tuples are the source of truth: for every document it derives the expanded
+// rows (with source_type/source_id) the same way the Zanzibar engine resolves them
+// and reconciles the stored rows with an insert/update/delete diff.
+type PermissionMaterializer struct {
+	db *gorm.DB
+}
+
+// NewPermissionMaterializer creates a new permission materializer
+func NewPermissionMaterializer(db *gorm.DB) *PermissionMaterializer {
+	return &PermissionMaterializer{db: db}
+}
+
+// Rebuild re-materializes every document (full rebuild mode)
+func (m *PermissionMaterializer) Rebuild(ctx context.Context) (_ *model.MaterializeResult, err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "materialize_rebuild")
+	defer done()
+	ctx, span := tracer.Start(ctx, "materializer.materialize_rebuild")
+	defer func() { endSpan(span, err) }()
+
+	startTime := time.Now()
+	result := &model.MaterializeResult{}
+	graph := newManagerGraph()
+
+	var total int64
+	if err := m.db.WithContext(ctx).Model(&model.Document{}).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count documents: %w", err)
+	}
+
+	lastID := ""
+	for {
+		var documentIDs []string
+		if err := m.db.WithContext(ctx).Model(&model.Document{}).
+			Where("id > ?", lastID).
+			Order("id").
+			Limit(materializeBatchSize).
+			Pluck("id", &documentIDs).Error; err != nil {
+			return nil, fmt.Errorf("failed to load documents: %w", err)
+		}
+		if len(documentIDs) == 0 {
+			break
+		}
+
+		if err := m.materializeDocuments(ctx, documentIDs, graph, result); err != nil {
+			return nil, err
+		}
+
+		lastID = documentIDs[len(documentIDs)-1]
+		reportProgress(ctx, int64(result.Documents), total, "Materialized %d/%d documents (+%d ~%d -%d rows)",
+			result.Documents, total, result.Inserted, result.Updated, result.Deleted)
+	}
+
+	result.DurationMs = float64(time.Since(startTime).Microseconds()) / 1000.0
+	return result, nil
+}
+
+// MaterializeDocuments re-materializes the given documents
+func (m *PermissionMaterializer) MaterializeDocuments(ctx context.Context, documentIDs []string) (_ *model.MaterializeResult, err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "materialize_documents")
+	defer done()
+	ctx, span := tracer.Start(ctx, "materializer.materialize_documents")
+	defer func() { endSpan(span, err) }()
+	metrics.BatchSize.WithLabelValues("materialize_documents").Observe(float64(len(documentIDs)))
+
+	startTime := time.Now()
+	result := &model.MaterializeResult{}
+
+	if err := m.materializeDocumentSet(ctx, documentIDs, newManagerGraph(), result); err != nil {
+		return nil, err
+	}
+
+	result.DurationMs = float64(time.Since(startTime).Microseconds()) / 1000.0
+	return result, nil
+}
+
+// ApplyTupleChanges incrementally updates the expanded table after the given tuples were
+// written or deleted. Only the key of each tuple matters, so the same call handles both.
+func (m *PermissionMaterializer) ApplyTupleChanges(ctx context.Context, changes []model.RelationTuple) (_ *model.MaterializeResult, err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "apply_tuple_changes")
+	defer done()
+	ctx, span := tracer.Start(ctx, "materializer.apply_tuple_changes")
+	defer func() { endSpan(span, err) }()
+	metrics.BatchSize.WithLabelValues("apply_tuple_changes").Observe(float64(len(changes)))
+
+	startTime := time.Now()
+	result := &model.MaterializeResult{}
+
+	documentIDs := make(map[string]bool)
+	var customerIDs, departmentIDs, userIDs, superuserIDs []string
+
+	for _, t := range changes {
+		switch t.Namespace {
+		case "document":
+			documentIDs[t.ObjectID] = true
+		case "customer":
+			if t.Relation == "follower" {
+				customerIDs = append(customerIDs, t.ObjectID)
+			}
+		case "department":
+			switch t.Relation {
+			case "member":
+				// The user's manager chain changed, and so did the chain of everyone below the user
+				userIDs = append(userIDs, t.SubjectID)
+			case "manager", "parent":
+				departmentIDs = append(departmentIDs, t.ObjectID)
+			}
+		case "system":
+			if t.ObjectID == "root" && t.Relation == "admin" {
+				superuserIDs = append(superuserIDs, t.SubjectID)
+			}
+		}
+	}
+
+	// A new or removed manager or parent link affects the chain of every member of the subtree
+	if len(departmentIDs) > 0 {
+		var err error
+		departmentIDs, err = relatedDepartments(ctx, m.db, departmentIDs, false, departmentParentMaxDepth)
+		if err != nil {
+			return nil, err
+		}
+
+		members, err := m.pluckTuples(ctx, "subject_id",
+			"namespace = ? AND relation = ? AND subject_namespace = ? AND object_id IN ?",
+			[]interface{}{"department", "member", "user"}, departmentIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load department members: %w", err)
+		}
+		userIDs = append(userIDs, members...)
+	}
+
+	// Documents reached through the changed users: their own documents and their customers' documents
+	if len(userIDs) > 0 {
+		subordinateIDs, err := m.subordinatesOf(ctx, userIDs, managerChainMaxDepth)
+		if err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, subordinateIDs...)
+
+		ownedDocIDs, err := m.pluckTuples(ctx, "object_id",
+			"namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
+			[]interface{}{"document", "owner", "user"}, userIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load owned documents: %w", err)
+		}
+		for _, id := range ownedDocIDs {
+			documentIDs[id] = true
+		}
+
+		followed, err := m.pluckTuples(ctx, "object_id",
+			"namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
+			[]interface{}{"customer", "follower", "user"}, userIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load followed customers: %w", err)
+		}
+		customerIDs = append(customerIDs, followed...)
+	}
+
+	if len(customerIDs) > 0 {
+		customerDocIDs, err := m.pluckTuples(ctx, "object_id",
+			"namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
+			[]interface{}{"document", "owner_customer", "customer"}, customerIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load customer documents: %w", err)
+		}
+		for _, id := range customerDocIDs {
+			documentIDs[id] = true
+		}
+	}
+
+	// Superuser rows span every document - they are reconciled per user instead
+	for _, userID := range uniqueStrings(superuserIDs) {
+		if err := m.materializeSuperuser(ctx, userID, result); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]string, 0, len(documentIDs))
+	for id := range documentIDs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	if err := m.materializeDocumentSet(ctx, ids, newManagerGraph(), result); err != nil {
+		return nil, err
+	}
+
+	result.DurationMs = float64(time.Since(startTime).Microseconds()) / 1000.0
+	return result, nil
+}
+
+// materializeDocumentSet recomputes documents in batches, reporting progress
+func (m *PermissionMaterializer) materializeDocumentSet(ctx context.Context, documentIDs []string, graph *managerGraph, result *model.MaterializeResult) error {
+	total := int64(len(documentIDs))
+	for _, batch := range chunkStrings(documentIDs, materializeBatchSize) {
+		if err := m.materializeDocuments(ctx, batch, graph, result); err != nil {
+			return err
+		}
+		reportProgress(ctx, int64(result.Documents), total, "Materialized %d/%d documents", result.Documents, total)
+	}
+	return nil
+}
+
+// materializeSuperuser grants or revokes the superuser rows of a single user.
+// Superuser is the lowest-precedence source, so a superuser row only exists
+// where no other source grants viewer, and revoking never uncovers another source.
+func (m *PermissionMaterializer) materializeSuperuser(ctx context.Context, userID string, result *model.MaterializeResult) error {
+	var tuples []model.RelationTuple
+	if err := m.db.WithContext(ctx).
+		Scopes(unexpired, unconditional).
+		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
+			"system", "root", "admin", "user", userID).
+		Find(&tuples).Error; err != nil {
+		return fmt.Errorf("failed to check superuser tuple: %w", err)
+	}
+
+	if len(tuples) == 0 {
+		res := m.db.WithContext(ctx).
+			Where("user_id = ? AND source_type = ?", userID, model.SourceTypeSuperuser).
+			Delete(&model.DocumentPermissionMySQL{})
+		if res.Error != nil {
+			return fmt.Errorf("failed to delete superuser permissions: %w", res.Error)
+		}
+		result.Deleted += res.RowsAffected
+		return nil
+	}
+
+	var users int64
+	if err := m.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Count(&users).Error; err != nil {
+		return fmt.Errorf("failed to check user: %w", err)
+	}
+	if users == 0 {
+		result.Skipped++
+		return nil
+	}
+
+	// A time-bound superuser grant ends on every row at once
+	expiresAt := tuples[0].ExpiresAt
+	res := m.db.WithContext(ctx).
+		Model(&model.DocumentPermissionMySQL{}).
+		Where("user_id = ? AND source_type = ?", userID, model.SourceTypeSuperuser).
+		Update("expires_at", expiresAt)
+	if res.Error != nil {
+		return fmt.Errorf("failed to update superuser permissions: %w", res.Error)
+	}
+	result.Updated += res.RowsAffected
+
+	res = m.db.WithContext(ctx).Exec(`
+		INSERT IGNORE INTO document_permissions_mysql
+			(user_id, document_id, permission_type, source_type, expires_at, created_at, updated_at)
+		SELECT ?, id, 'viewer', ?, ?, NOW(), NOW() FROM documents`,
+		userID, model.SourceTypeSuperuser, expiresAt)
+	if res.Error != nil {
+		return fmt.Errorf("failed to insert superuser permissions: %w", res.Error)
+	}
+	result.Inserted += res.RowsAffected
+	return nil
+}
+
+// materializeDocuments derives the expanded rows of a batch of documents and reconciles them
+func (m *PermissionMaterializer) materializeDocuments(ctx context.Context, documentIDs []string, graph *managerGraph, result *model.MaterializeResult) error {
+	desired, err := m.derivePermissions(ctx, documentIDs, graph, result)
+	if err != nil {
+		return err
+	}
+
+	var existing []model.DocumentPermissionMySQL
+	if err := m.db.WithContext(ctx).
+		Where("document_id IN ?", documentIDs).
+		Find(&existing).Error; err != nil {
+		return fmt.Errorf("failed to load expanded permissions: %w", err)
+	}
+
+	current := make(map[string]*model.DocumentPermissionMySQL, len(existing))
+	var deleteIDs []int64
+	for i := range existing {
+		row := &existing[i]
+		key := permissionRowKey(row)
+		if _, ok := desired[key]; !ok {
+			deleteIDs = append(deleteIDs, row.ID)
+			continue
+		}
+		current[key] = row
+	}
+
+	var inserts []model.DocumentPermissionMySQL
+	var updates []*model.DocumentPermissionMySQL
+	for _, key := range sortedKeys(desired) {
+		want := desired[key]
+		have, ok := current[key]
+		if !ok {
+			inserts = append(inserts, *want)
+			continue
+		}
+		if have.SourceType != want.SourceType || !equalStringPtr(have.SourceID, want.SourceID) ||
+			!equalExpiry(have.ExpiresAt, want.ExpiresAt) {
+			have.SourceType = want.SourceType
+			have.SourceID = want.SourceID
+			have.ExpiresAt = want.ExpiresAt
+			updates = append(updates, have)
+		}
+	}
+
+	err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(deleteIDs) > 0 {
+			if err := tx.Where("id IN ?", deleteIDs).Delete(&model.DocumentPermissionMySQL{}).Error; err != nil {
+				return fmt.Errorf("failed to delete stale permissions: %w", err)
+			}
+		}
+
+		for _, row := range updates {
+			if err := tx.Model(&model.DocumentPermissionMySQL{}).
+				Where("id = ?", row.ID).
+				Updates(map[string]interface{}{
+					"source_type": row.SourceType,
+					"source_id":   row.SourceID,
+					"expires_at":  row.ExpiresAt,
+				}).Error; err != nil {
+				return fmt.Errorf("failed to update permission source: %w", err)
+			}
+		}
+
+		if len(inserts) > 0 {
+			if err := tx.CreateInBatches(inserts, 1000).Error; err != nil {
+				return fmt.Errorf("failed to insert permissions: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	result.Documents += len(documentIDs)
+	result.Inserted += int64(len(inserts))
+	result.Updated += int64(len(updates))
+	result.Deleted += int64(len(deleteIDs))
+	return nil
+}
+
+// derivePermissions computes the expanded rows of documents from the unexpired, unconditional
+// relation_tuples (conditional tuples need request context and never reach the expanded table),
+// keyed by user|document|permission. Sources are applied in precedence order, so the first
+// source wins unless a later one lasts longer. Rows end with the tuples that grant them;
+// department memberships are not tracked, their expiry reaches the rows through the sweep.
+func (m *PermissionMaterializer) derivePermissions(ctx context.Context, documentIDs []string, graph *managerGraph, result *model.MaterializeResult) (map[string]*model.DocumentPermissionMySQL, error) {
+	db := m.db.WithContext(ctx)
+
+	// Documents that no longer exist get no rows (their rows are deleted by the diff)
+	var existingDocIDs []string
+	if err := db.Model(&model.Document{}).Where("id IN ?", documentIDs).Pluck("id", &existingDocIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load documents: %w", err)
+	}
+
+	var docTuples []model.RelationTuple
+	if len(existingDocIDs) > 0 {
+		if err := db.Scopes(unexpired, unconditional).Where("namespace = ? AND object_id IN ? AND relation IN ?",
+			"document", existingDocIDs, []string{"owner", "editor", "viewer", "owner_customer"}).
+			Order("id").
+			Find(&docTuples).Error; err != nil {
+			return nil, fmt.Errorf("failed to load document tuples: %w", err)
+		}
+	}
+
+	direct := make(map[string][]model.RelationTuple)
+	docCustomers := make(map[string][]model.RelationTuple)
+	owners := make(map[string][]model.RelationTuple)
+	var customerIDs []string
+	for _, t := range docTuples {
+		if t.Relation == "owner_customer" {
+			docCustomers[t.ObjectID] = append(docCustomers[t.ObjectID], t)
+			customerIDs = append(customerIDs, t.SubjectID)
+			continue
+		}
+		if t.SubjectNamespace != "user" {
+			continue
+		}
+		direct[t.ObjectID] = append(direct[t.ObjectID], t)
+		if t.Relation == "owner" {
+			owners[t.ObjectID] = append(owners[t.ObjectID], t)
+		}
+	}
+
+	followers := make(map[string][]model.RelationTuple)
+	if len(customerIDs) > 0 {
+		var followerTuples []model.RelationTuple
+		for _, chunk := range chunkStrings(uniqueStrings(customerIDs), maxInClauseSize) {
+			var tuples []model.RelationTuple
+			if err := db.Scopes(unexpired, unconditional).Where("namespace = ? AND relation = ? AND subject_namespace = ? AND object_id IN ?",
+				"customer", "follower", "user", chunk).
+				Order("id").
+				Find(&tuples).Error; err != nil {
+				return nil, fmt.Errorf("failed to load customer followers: %w", err)
+			}
+			followerTuples = append(followerTuples, tuples...)
+		}
+		for _, t := range followerTuples {
+			followers[t.ObjectID] = append(followers[t.ObjectID], t)
+		}
+	}
+
+	var superusers []model.RelationTuple
+	if err := db.Scopes(unexpired, unconditional).
+		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ?", "system", "root", "admin", "user").
+		Order("subject_id").
+		Find(&superusers).Error; err != nil {
+		return nil, fmt.Errorf("failed to load superusers: %w", err)
+	}
+
+	// Manager chains start at the owners and the customer followers of each document
+	var chainRoots []string
+	for _, docID := range existingDocIDs {
+		for _, t := range owners[docID] {
+			chainRoots = append(chainRoots, t.SubjectID)
+		}
+		for _, oc := range docCustomers[docID] {
+			for _, t := range followers[oc.SubjectID] {
+				chainRoots = append(chainRoots, t.SubjectID)
+			}
+		}
+	}
+	if err := graph.load(ctx, db, uniqueStrings(chainRoots)); err != nil {
+		return nil, err
+	}
+
+	desired := make(map[string]*model.DocumentPermissionMySQL)
+	add := func(userID, documentID, permissionType, sourceType string, sourceID *string, expiresAt *time.Time) {
+		row := &model.DocumentPermissionMySQL{
+			UserID:         userID,
+			DocumentID:     documentID,
+			PermissionType: permissionType,
+			SourceType:     sourceType,
+			SourceID:       sourceID,
+			ExpiresAt:      expiresAt,
+		}
+		key := permissionRowKey(row)
+		if have, ok := desired[key]; !ok || outlasts(expiresAt, have.ExpiresAt) {
+			desired[key] = row
+		}
+	}
+
+	for _, docID := range existingDocIDs {
+		docID := docID
+
+		// 1. Direct tuples grant their own relation
+		for _, t := range direct[docID] {
+			add(t.SubjectID, docID, t.Relation, model.SourceTypeDirect, &docID, t.ExpiresAt)
+		}
+
+		// 2. Followers of the owning customer get viewer, while both tuples hold
+		type subordinate struct {
+			userID    string
+			expiresAt *time.Time
+		}
+		var subordinates []subordinate
+		for _, t := range owners[docID] {
+			subordinates = append(subordinates, subordinate{t.SubjectID, t.ExpiresAt})
+		}
+		for _, oc := range docCustomers[docID] {
+			customerID := oc.SubjectID
+			for _, t := range followers[customerID] {
+				expiresAt := earliestExpiry(oc.ExpiresAt, t.ExpiresAt)
+				add(t.SubjectID, docID, "viewer", model.SourceTypeCustomerFollower, &customerID, expiresAt)
+				subordinates = append(subordinates, subordinate{t.SubjectID, expiresAt})
+			}
+		}
+
+		// 3. Managers of an owner or follower get viewer; source is that subordinate
+		for _, s := range subordinates {
+			subordinateID := s.userID
+			for _, managerID := range graph.managersOf(subordinateID, managerChainMaxDepth) {
+				add(managerID, docID, "viewer", model.SourceTypeManagerChain, &subordinateID, s.expiresAt)
+			}
+		}
+
+		// 4. Superusers get viewer on everything
+		for _, t := range superusers {
+			add(t.SubjectID, docID, "viewer", model.SourceTypeSuperuser, nil, t.ExpiresAt)
+		}
+	}
+
+	// Rows must reference existing users (foreign key)
+	userSet := make(map[string]bool)
+	for _, row := range desired {
+		userSet[row.UserID] = true
+	}
+	userIDs := make([]string, 0, len(userSet))
+	for id := range userSet {
+		userIDs = append(userIDs, id)
+	}
+
+	existingUsers := make(map[string]bool, len(userIDs))
+	for _, chunk := range chunkStrings(userIDs, maxInClauseSize) {
+		var ids []string
+		if err := db.Model(&model.User{}).Where("id IN ?", chunk).Pluck("id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to load users: %w", err)
+		}
+		for _, id := range ids {
+			existingUsers[id] = true
+		}
+	}
+	for key, row := range desired {
+		if !existingUsers[row.UserID] {
+			delete(desired, key)
+			result.Skipped++
+		}
+	}
+
+	return desired, nil
+}
+
+// subordinatesOf returns every user below userIDs in the management hierarchy, up to maxDepth levels
+func (m *PermissionMaterializer) subordinatesOf(ctx context.Context, userIDs []string, maxDepth int) ([]string, error) {
+	var subordinates []string
+	visited := make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		visited[id] = true
+	}
+	current := uniqueStrings(userIDs)
+
+	for depth := 0; depth < maxDepth && len(current) > 0; depth++ {
+		managedDeptIDs, err := m.pluckTuples(ctx, "object_id",
+			"namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
+			[]interface{}{"department", "manager", "user"}, current)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load managed departments: %w", err)
+		}
+		if len(managedDeptIDs) == 0 {
+			break
+		}
+
+		managedDeptIDs, err = relatedDepartments(ctx, m.db, managedDeptIDs, false, departmentParentMaxDepth)
+		if err != nil {
+			return nil, err
+		}
+
+		memberIDs, err := m.pluckTuples(ctx, "subject_id",
+			"namespace = ? AND relation = ? AND subject_namespace = ? AND object_id IN ?",
+			[]interface{}{"department", "member", "user"}, managedDeptIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load department members: %w", err)
+		}
+
+		next := make([]string, 0)
+		for _, id := range memberIDs {
+			if !visited[id] {
+				visited[id] = true
+				subordinates = append(subordinates, id)
+				next = append(next, id)
+			}
+		}
+		current = next
+	}
+
+	return subordinates, nil
+}
+
+// pluckTuples plucks column from the tuples matching query, binding values as the final
+// IN argument in chunks of maxInClauseSize
+func (m *PermissionMaterializer) pluckTuples(ctx context.Context, column, query string, args []interface{}, values []string) ([]string, error) {
+	var out []string
+	for _, chunk := range chunkStrings(uniqueStrings(values), maxInClauseSize) {
+		var ids []string
+		queryArgs := append(append([]interface{}{}, args...), chunk)
+		if err := m.db.WithContext(ctx).Model(&model.RelationTuple{}).
+			Where(query, queryArgs...).
+			Pluck(column, &ids).Error; err != nil {
+			return nil, err
+		}
+		out = append(out, ids...)
+	}
+	return uniqueStrings(out), nil
+}
+
+// managerGraph caches the department tuples needed to walk manager chains upwards
+type managerGraph struct {
+	departments map[string][]string // user -> departments the user is a member of
+	parents     map[string][]string // department -> parent departments
+	managers    map[string][]string // department -> managers of the department
+}
+
+func newManagerGraph() *managerGraph {
+	return &managerGraph{
+		departments: make(map[string][]string),
+		parents:     make(map[string][]string),
+		managers:    make(map[string][]string),
+	}
+}
+
+// load fetches the upward closure of userIDs (memberships, then managers, then their
+// memberships, ...) for every user and department that is not cached yet
+func (g *managerGraph) load(ctx context.Context, db *gorm.DB, userIDs []string) error {
+	users := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if _, ok := g.departments[id]; !ok {
+			users = append(users, id)
+		}
+	}
+
+	for len(users) > 0 {
+		for _, id := range users {
+			g.departments[id] = nil
+		}
+
+		var newDepts []string
+		for _, chunk := range chunkStrings(users, maxInClauseSize) {
+			var memberships []model.RelationTuple
+			if err := db.Select("object_id", "subject_id").Scopes(unexpired, unconditional).
+				Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
+					"department", "member", "user", chunk).
+				Order("id").
+				Find(&memberships).Error; err != nil {
+				return fmt.Errorf("failed to load department memberships: %w", err)
+			}
+			for _, t := range memberships {
+				g.departments[t.SubjectID] = append(g.departments[t.SubjectID], t.ObjectID)
+				if _, ok := g.managers[t.ObjectID]; !ok {
+					g.managers[t.ObjectID] = nil
+					newDepts = append(newDepts, t.ObjectID)
+				}
+			}
+		}
+
+		newDepts, err := g.loadParents(ctx, db, newDepts)
+		if err != nil {
+			return err
+		}
+
+		var next []string
+		for _, chunk := range chunkStrings(newDepts, maxInClauseSize) {
+			var managers []model.RelationTuple
+			if err := db.Select("object_id", "subject_id").Scopes(unexpired, unconditional).
+				Where("namespace = ? AND relation = ? AND subject_namespace = ? AND object_id IN ?",
+					"department", "manager", "user", chunk).
+				Order("id").
+				Find(&managers).Error; err != nil {
+				return fmt.Errorf("failed to load department managers: %w", err)
+			}
+			for _, t := range managers {
+				g.managers[t.ObjectID] = append(g.managers[t.ObjectID], t.SubjectID)
+				if _, ok := g.departments[t.SubjectID]; !ok {
+					next = append(next, t.SubjectID)
+				}
+			}
+		}
+		users = uniqueStrings(next)
+	}
+
+	return nil
+}
+
+// loadParents caches the department#parent links above deptIDs and returns deptIDs
+// extended with every ancestor department seen for the first time
+func (g *managerGraph) loadParents(ctx context.Context, db *gorm.DB, deptIDs []string) ([]string, error) {
+	all := deptIDs
+	current := deptIDs
+
+	for len(current) > 0 {
+		for _, id := range current {
+			g.parents[id] = nil
+		}
+
+		var next []string
+		for _, chunk := range chunkStrings(current, maxInClauseSize) {
+			var links []model.RelationTuple
+			if err := db.Select("object_id", "subject_id").Scopes(unexpired, unconditional).
+				Where("namespace = ? AND relation = ? AND subject_namespace = ? AND object_id IN ?",
+					"department", "parent", "department", chunk).
+				Order("id").
+				Find(&links).Error; err != nil {
+				return nil, fmt.Errorf("failed to load department parents: %w", err)
+			}
+			for _, t := range links {
+				g.parents[t.ObjectID] = append(g.parents[t.ObjectID], t.SubjectID)
+				if _, ok := g.parents[t.SubjectID]; !ok {
+					next = append(next, t.SubjectID)
+				}
+			}
+		}
+
+		current = uniqueStrings(next)
+		for _, id := range current {
+			if _, ok := g.managers[id]; !ok {
+				g.managers[id] = nil
+				all = append(all, id)
+			}
+		}
+	}
+
+	return all, nil
+}
+
+// ancestorsOf returns deptID and the departments above it, up to departmentParentMaxDepth links
+func (g *managerGraph) ancestorsOf(deptID string) []string {
+	ancestors := []string{deptID}
+	visited := map[string]bool{deptID: true}
+	current := []string{deptID}
+
+	for depth := 0; depth < departmentParentMaxDepth && len(current) > 0; depth++ {
+		var next []string
+		for _, id := range current {
+			for _, parentID := range g.parents[id] {
+				if !visited[parentID] {
+					visited[parentID] = true
+					ancestors = append(ancestors, parentID)
+					next = append(next, parentID)
+				}
+			}
+		}
+		current = next
+	}
+
+	return ancestors
+}
+
+// managersOf walks the cached graph upwards from userID, one department level per step.
+// Managers of parent departments count as managers of the members of the subtree.
+func (g *managerGraph) managersOf(userID string, maxDepth int) []string {
+	var managers []string
+	visited := map[string]bool{userID: true}
+	current := []string{userID}
+
+	for depth := 0; depth < maxDepth && len(current) > 0; depth++ {
+		var next []string
+		seenDepts := make(map[string]bool)
+		for _, id := range current {
+			var deptIDs []string
+			for _, memberDeptID := range g.departments[id] {
+				for _, deptID := range g.ancestorsOf(memberDeptID) {
+					if !seenDepts[deptID] {
+						seenDepts[deptID] = true
+						deptIDs = append(deptIDs, deptID)
+					}
+				}
+			}
+			for _, deptID := range deptIDs {
+				for _, managerID := range g.managers[deptID] {
+					if !visited[managerID] {
+						visited[managerID] = true
+						managers = append(managers, managerID)
+						next = append(next, managerID)
+					}
+				}
+			}
+		}
+		current = next
+	}
+
+	return managers
+}
+
+func permissionRowKey(row *model.DocumentPermissionMySQL) string {
+	return row.UserID + "|" + row.DocumentID + "|" + row.PermissionType
+}
+
+func sortedKeys(m map[string]*model.DocumentPermissionMySQL) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func equalStringPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// uniqueStrings returns ids without duplicates, keeping the first occurrence
+func uniqueStrings(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// chunkStrings splits ids into slices of at most size elements
+func chunkStrings(ids []string, size int) [][]string {
+	var chunks [][]string
+	for len(ids) > size {
+		chunks = append(chunks, ids[:size])
+		ids = ids[size:]
+	}
+	if len(ids) > 0 {
+		chunks = append(chunks, ids)
+	}
+	return chunks
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// ProgressFunc receives progress updates from long-running maintenance operations.
+// total is 0 when the amount of work is not known yet.
+type ProgressFunc func(done, total int64, message string)
+
+type progressKey struct{}
+
+// WithProgress returns a context that reports the progress of repository operations to fn
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// reportProgress forwards a progress update to the reporter in ctx, if any
+func reportProgress(ctx context.Context, done, total int64, format string, args ...interface{}) {
+	fn, ok := ctx.Value(progressKey{}).(ProgressFunc)
+	if !ok || fn == nil {
+		return
+	}
+	fn(done, total, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// ShadowMismatchRepository stores disagreements found by shadow evaluation (shadow_mismatches)
+type ShadowMismatchRepository struct {
+	db *gorm.DB
+}
+
+// NewShadowMismatchRepository creates a new shadow mismatch repository
+func NewShadowMismatchRepository(db *gorm.DB) *ShadowMismatchRepository {
+	return &ShadowMismatchRepository{db: db}
+}
+
+// Record inserts one mismatch
+func (r *ShadowMismatchRepository) Record(ctx context.Context, mismatch *model.ShadowMismatch) error {
+	if err := r.db.WithContext(ctx).Create(mismatch).Error; err != nil {
+		return fmt.Errorf("failed to record shadow mismatch: %w", err)
+	}
+	return nil
+}
+
+// List returns the most recent mismatches, newest first. A non-empty userID
+// or documentID narrows the result to that user or document.
+func (r *ShadowMismatchRepository) List(ctx context.Context, userID, documentID string, limit int) ([]model.ShadowMismatch, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	query := r.db.WithContext(ctx).Model(&model.ShadowMismatch{})
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if documentID != "" {
+		query = query.Where("document_id = ?", documentID)
+	}
+
+	var mismatches []model.ShadowMismatch
+	if err := query.Order("id DESC").Limit(limit).Find(&mismatches).Error; err != nil {
+		return nil, fmt.Errorf("failed to list shadow mismatches: %w", err)
+	}
+	return mismatches, nil
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// TestShadowMismatchRecordAndList tests recording mismatches and filtering them newest first
+func TestShadowMismatchRecordAndList(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewShadowMismatchRepository(db)
+	ctx := context.Background()
+
+	const userID = "test-shadow-user-1"
+
+	// Clean up leftovers from previous runs
+	db.Where("user_id = ?", userID).Delete(&model.ShadowMismatch{})
+
+	// Step 1: Record a disagreement and a shadow failure
+	disagreement := &model.ShadowMismatch{
+		UserID:         userID,
+		DocumentID:     "test-shadow-doc-1",
+		PermissionType: "viewer",
+		PrimaryEngine:  model.EngineMySQL,
+		ShadowEngine:   model.EngineZanzibar,
+		PrimaryResult:  true,
+		ShadowResult:   false,
+		PrimarySources: []string{model.SourceTypeManagerChain},
+	}
+	require.NoError(t, repo.Record(ctx, disagreement))
+
+	shadowErr := "context deadline exceeded"
+	failure := &model.ShadowMismatch{
+		UserID:         userID,
+		DocumentID:     "test-shadow-doc-2",
+		PermissionType: "editor",
+		PrimaryEngine:  model.EngineMySQL,
+		ShadowEngine:   model.EngineZanzibar,
+		ShadowError:    &shadowErr,
+	}
+	require.NoError(t, repo.Record(ctx, failure))
+
+	// Step 2: List newest first, sources round-trip through JSON
+	mismatches, err := repo.List(ctx, userID, "", 10)
+	require.NoError(t, err)
+	require.Len(t, mismatches, 2)
+	assert.Equal(t, failure.ID, mismatches[0].ID)
+	require.NotNil(t, mismatches[0].ShadowError)
+	assert.Equal(t, shadowErr, *mismatches[0].ShadowError)
+	assert.Equal(t, []string{model.SourceTypeManagerChain}, mismatches[1].PrimarySources)
+	assert.True(t, mismatches[1].PrimaryResult)
+	assert.False(t, mismatches[1].ShadowResult)
+
+	// Step 3: Filter by document
+	mismatches, err = repo.List(ctx, userID, "test-shadow-doc-1", 10)
+	require.NoError(t, err)
+	require.Len(t, mismatches, 1)
+	assert.Equal(t, disagreement.ID, mismatches[0].ID)
+
+	db.Where("user_id = ?", userID).Delete(&model.ShadowMismatch{})
+	t.Logf("✅ Test passed! Shadow mismatches recorded and listed")
+}
@@ -0,0 +1,329 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
+)
+
+// Soft-deletable entities. The names double as their tuple namespaces.
+const (
+	EntityUser     = "user"
+	EntityDocument = "document"
+	EntityCustomer = "customer"
+)
+
+var (
+	// ErrUnknownEntity is returned for an entity other than user, document or customer
+	ErrUnknownEntity = errors.New("unknown entity")
+	// ErrEntityNotFound is returned when soft-deleting or restoring a missing entity
+	ErrEntityNotFound = errors.New("entity not found")
+)
+
+// softDeleteTables maps each soft-deletable entity to its table
+var softDeleteTables = map[string]string{
+	EntityUser:     "users",
+	EntityDocument: "documents",
+	EntityCustomer: "customers",
+}
+
+func softDeleteTable(entity string) (string, error) {
+	table, ok := softDeleteTables[entity]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownEntity, entity)
+	}
+	return table, nil
+}
+
+// excludeDeleted drops rows whose column references a soft-deleted row of table
+func excludeDeleted(column, table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(column + " NOT IN (SELECT id FROM " + table + " WHERE deleted_at IS NOT NULL)")
+	}
+}
+
+// checkTargetsDeleted reports whether the user or the document of a check is soft-deleted
+func checkTargetsDeleted(ctx context.Context, db *gorm.DB, userID, documentID string) (bool, error) {
+	var deleted bool
+	err := db.WithContext(ctx).Raw(`SELECT
+		EXISTS (SELECT 1 FROM users WHERE id = ? AND deleted_at IS NOT NULL) OR
+		EXISTS (SELECT 1 FROM documents WHERE id = ? AND deleted_at IS NOT NULL)`,
+		userID, documentID).Scan(&deleted).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check soft deletes: %w", err)
+	}
+	return deleted, nil
+}
+
+// userDeleted reports whether userID is soft-deleted
+func userDeleted(ctx context.Context, db *gorm.DB, userID string) (bool, error) {
+	var count int64
+	err := db.WithContext(ctx).Model(&model.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", userID).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check soft-deleted user: %w", err)
+	}
+	return count > 0, nil
+}
+
+// deletedAmong returns the soft-deleted rows of table among ids
+func deletedAmong(ctx context.Context, db *gorm.DB, table string, ids []string) (map[string]bool, error) {
+	deleted := make(map[string]bool)
+	for _, chunk := range chunkStrings(ids, maxInClauseSize) {
+		var found []string
+		if err := db.WithContext(ctx).Table(table).
+			Where("id IN ? AND deleted_at IS NOT NULL", chunk).
+			Pluck("id", &found).Error; err != nil {
+			return nil, fmt.Errorf("failed to load soft-deleted %s: %w", table, err)
+		}
+		for _, id := range found {
+			deleted[id] = true
+		}
+	}
+	return deleted, nil
+}
+
+// EntityChangeFunc is called after an entity was soft-deleted or restored
+type EntityChangeFunc func(ctx context.Context, entity, id string)
+
+// SoftDeleteRepository soft-deletes and restores users, documents and customers.
+// Both engines ignore soft-deleted entities when resolving access, so tuples and
+// expanded rows are kept until the purge removes them after the retention period.
+type SoftDeleteRepository struct {
+	db       *gorm.DB
+	onChange EntityChangeFunc
+}
+
+// NewSoftDeleteRepository creates a new soft delete repository
+func NewSoftDeleteRepository(db *gorm.DB) *SoftDeleteRepository {
+	return &SoftDeleteRepository{db: db}
+}
+
+// OnChange registers fn to be notified of soft deletes and restores,
+// e.g. to drop cached document sets
+func (r *SoftDeleteRepository) OnChange(fn EntityChangeFunc) {
+	r.onChange = fn
+}
+
+func (r *SoftDeleteRepository) notifyChange(ctx context.Context, entity, id string) {
+	if r.onChange != nil {
+		r.onChange(ctx, entity, id)
+	}
+}
+
+// SoftDelete marks an entity deleted. Soft-deleting a customer also soft-deletes
+// its live documents with the same timestamp, so Restore can bring back exactly those.
+// Deleting an already deleted entity is a no-op.
+func (r *SoftDeleteRepository) SoftDelete(ctx context.Context, entity, id string) error {
+	table, err := softDeleteTable(entity)
+	if err != nil {
+		return err
+	}
+	ctx, span := tracer.Start(ctx, "entity.soft_delete")
+	span.SetAttributes(attribute.String("entity", entity), attribute.String("entity.id", id))
+
+	// deleted_at is a TIMESTAMP with second precision
+	now := time.Now().Truncate(time.Second)
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Table(table).Where("id = ? AND deleted_at IS NULL", id).Update("deleted_at", now)
+		if res.Error != nil {
+			return fmt.Errorf("failed to soft-delete %s: %w", entity, res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return r.requireExists(tx, table, entity, id)
+		}
+
+		if entity == EntityCustomer {
+			if err := tx.Model(&model.Document{}).
+				Where("customer_id = ? AND deleted_at IS NULL", id).
+				Update("deleted_at", now).Error; err != nil {
+				return fmt.Errorf("failed to soft-delete customer documents: %w", err)
+			}
+		}
+		return nil
+	})
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	r.notifyChange(ctx, entity, id)
+	return nil
+}
+
+// Restore clears the deleted mark of an entity, which brings its access back.
+// Restoring a customer restores the documents deleted together with it.
+func (r *SoftDeleteRepository) Restore(ctx context.Context, entity, id string) error {
+	table, err := softDeleteTable(entity)
+	if err != nil {
+		return err
+	}
+	ctx, span := tracer.Start(ctx, "entity.restore")
+	span.SetAttributes(attribute.String("entity", entity), attribute.String("entity.id", id))
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var deletedAt []time.Time
+		if err := tx.Table(table).Where("id = ? AND deleted_at IS NOT NULL", id).
+			Pluck("deleted_at", &deletedAt).Error; err != nil {
+			return fmt.Errorf("failed to load %s: %w", entity, err)
+		}
+		if len(deletedAt) == 0 {
+			return r.requireExists(tx, table, entity, id)
+		}
+
+		if entity == EntityCustomer {
+			if err := tx.Model(&model.Document{}).
+				Where("customer_id = ? AND deleted_at = ?", id, deletedAt[0]).
+				Update("deleted_at", nil).Error; err != nil {
+				return fmt.Errorf("failed to restore customer documents: %w", err)
+			}
+		}
+		if err := tx.Table(table).Where("id = ?", id).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore %s: %w", entity, err)
+		}
+		return nil
+	})
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	r.notifyChange(ctx, entity, id)
+	return nil
+}
+
+// requireExists returns ErrEntityNotFound unless the entity exists
+func (r *SoftDeleteRepository) requireExists(tx *gorm.DB, table, entity, id string) error {
+	var count int64
+	if err := tx.Table(table).Where("id = ?", id).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to load %s: %w", entity, err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: %s %s", ErrEntityNotFound, entity, id)
+	}
+	return nil
+}
+
+// DeletedBefore returns the IDs of entities soft-deleted before cutoff
+func (r *SoftDeleteRepository) DeletedBefore(ctx context.Context, entity string, cutoff time.Time) ([]string, error) {
+	table, err := softDeleteTable(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	if err := r.db.WithContext(ctx).Table(table).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Order("id").
+		Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to load soft-deleted %s: %w", table, err)
+	}
+	return ids, nil
+}
+
+// SoftDeleteChanged drops the cached document sets a soft delete or restore made stale.
+// Users are checked on every request, documents and customers are baked into the sets.
+func (r *ZanzibarPermissionRepository) SoftDeleteChanged(ctx context.Context, entity, id string) {
+	if r.bitmaps != nil && entity != EntityUser {
+		r.bitmaps.Reset()
+	}
+}
+
+// PurgeTuples hard-deletes every tuple that has one of the entities as object or subject
+func (r *ZanzibarPermissionRepository) PurgeTuples(ctx context.Context, entity string, ids []string) (int64, error) {
+	if _, err := softDeleteTable(entity); err != nil {
+		return 0, err
+	}
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "purge_tuples")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.purge_tuples")
+	span.SetAttributes(attribute.String("entity", entity), attribute.Int("entities", len(ids)))
+
+	var deleted int64
+	var changed []model.RelationTuple
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, chunk := range chunkStrings(ids, maxInClauseSize) {
+			var tuples []model.RelationTuple
+			if err := tx.Where("(namespace = ? AND object_id IN ?) OR (subject_namespace = ? AND subject_id IN ?)",
+				entity, chunk, entity, chunk).
+				Find(&tuples).Error; err != nil {
+				return fmt.Errorf("failed to load tuples: %w", err)
+			}
+			if len(tuples) == 0 {
+				continue
+			}
+
+			tupleIDs := make([]int64, len(tuples))
+			for i := range tuples {
+				tupleIDs[i] = tuples[i].ID
+			}
+			res := tx.Where("id IN ?", tupleIDs).Delete(&model.RelationTuple{})
+			if res.Error != nil {
+				return fmt.Errorf("failed to purge tuples: %w", res.Error)
+			}
+			deleted += res.RowsAffected
+			changed = append(changed, tuples...)
+		}
+		return nil
+	})
+	endSpan(span, err, attribute.Int64("tuples.deleted", deleted))
+	if err != nil {
+		return 0, err
+	}
+
+	r.notifyTupleChange(ctx, changed...)
+	return deleted, nil
+}
+
+// PurgePermissions hard-deletes the expanded rows of the entities: rows of the
+// users, rows on the documents, and every row granted through following the
+// customers - customer_follower rows, manager_chain rows recording the customer
+// and manager_chain rows recording a follower on a document it did not create
+func (r *MySQLPermissionRepository) PurgePermissions(ctx context.Context, entity string, ids []string) (int64, error) {
+	var conditions []string
+	switch entity {
+	case EntityUser:
+		conditions = []string{"user_id IN @ids"}
+	case EntityDocument:
+		conditions = []string{"document_id IN @ids"}
+	case EntityCustomer:
+		conditions = []string{
+			"source_type IN ('customer_follower', 'manager_chain') AND source_id IN @ids",
+			"source_type = 'manager_chain'" +
+				" AND source_id IN (SELECT user_id FROM customer_followers WHERE customer_id IN @ids)" +
+				" AND document_id IN (SELECT id FROM documents WHERE customer_id IN @ids AND creator_id <> document_permissions_mysql.source_id)",
+		}
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnknownEntity, entity)
+	}
+	ctx, done := metrics.TrackMutation(ctx, model.EngineMySQL, "purge_permissions")
+	defer done()
+	ctx, span := tracer.Start(ctx, "mysql.purge_permissions")
+	span.SetAttributes(attribute.String("entity", entity), attribute.Int("entities", len(ids)))
+
+	var deleted int64
+	var err error
+purge:
+	for _, chunk := range chunkStrings(ids, maxInClauseSize) {
+		for _, condition := range conditions {
+			res := r.db.WithContext(ctx).
+				Where(condition, map[string]interface{}{"ids": chunk}).
+				Delete(&model.DocumentPermissionMySQL{})
+			if res.Error != nil {
+				err = fmt.Errorf("failed to purge expanded permissions: %w", res.Error)
+				break purge
+			}
+			deleted += res.RowsAffected
+		}
+	}
+	endSpan(span, err, attribute.Int64("rows.deleted", deleted))
+	return deleted, err
+}
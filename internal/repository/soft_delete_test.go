@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// TestSoftDelete tests that both engines ignore soft-deleted users, documents and
+// customers, that a restore brings the access back and that the purge removes
+// the tuples and expanded rows
+func TestSoftDelete(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	mysqlRepo := NewMySQLPermissionRepository(db)
+	zanzibarRepo := NewZanzibarPermissionRepository(db)
+	softDeletes := NewSoftDeleteRepository(db)
+	softDeletes.OnChange(zanzibarRepo.SoftDeleteChanged)
+	ctx := context.Background()
+
+	const (
+		userID     = "sd-user"
+		customerID = "sd-customer"
+	)
+	docIDs := []string{"sd-doc-direct", "sd-doc-customer"}
+
+	cleanup := func() {
+		db.Where("document_id IN ? OR user_id = ?", docIDs, userID).Delete(&model.DocumentPermissionMySQL{})
+		db.Where("namespace = ? AND object_id IN ?", "document", docIDs).Delete(&model.RelationTuple{})
+		db.Where("namespace = ? AND object_id = ?", "customer", customerID).Delete(&model.RelationTuple{})
+		db.Where("id IN ?", docIDs).Delete(&model.Document{})
+		db.Where("id = ?", customerID).Delete(&model.Customer{})
+		db.Where("id = ?", userID).Delete(&model.User{})
+	}
+	cleanup()
+
+	createTestUser(db, userID, "Soft Delete User", "sd-user@test.com")
+	createTestCustomer(db, customerID, "Soft Delete Customer")
+	for _, id := range docIDs {
+		createTestDocument(db, id, id, customerID, userID)
+	}
+
+	_, err := zanzibarRepo.BulkInsertTuples(ctx, []model.RelationTuple{
+		{Namespace: "document", ObjectID: docIDs[0], Relation: "viewer", SubjectNamespace: "user", SubjectID: userID},
+		{Namespace: "document", ObjectID: docIDs[1], Relation: "owner_customer", SubjectNamespace: "customer", SubjectID: customerID},
+		{Namespace: "customer", ObjectID: customerID, Relation: "follower", SubjectNamespace: "user", SubjectID: userID},
+	}, 100)
+	require.NoError(t, err)
+	require.NoError(t, mysqlRepo.GrantDirectPermission(ctx, userID, docIDs[0], "viewer"))
+	require.NoError(t, mysqlRepo.AddCustomerFollowerPermissions(ctx, customerID, userID))
+
+	// visible returns the documents each engine grants, via check, batch check and list
+	visible := func() map[string][]string {
+		out := make(map[string][]string)
+		for name, engine := range map[string]interface {
+			CheckPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error)
+			CheckPermissionsBatch(ctx context.Context, userID string, documentIDs []string, permissionType string) (map[string]bool, error)
+			GetUserDocuments(ctx context.Context, userID string, permissionType string, page, pageSize int) (*model.UserDocumentList, error)
+		}{model.EngineMySQL: mysqlRepo, model.EngineZanzibar: zanzibarRepo} {
+			batch, err := engine.CheckPermissionsBatch(ctx, userID, docIDs, "viewer")
+			require.NoError(t, err)
+			list, err := engine.GetUserDocuments(ctx, userID, "viewer", 1, 10)
+			require.NoError(t, err)
+			listed := make(map[string]bool)
+			for _, doc := range list.Documents {
+				listed[doc.ID] = true
+			}
+
+			granted := []string{}
+			for _, docID := range docIDs {
+				result, err := engine.CheckPermission(ctx, userID, docID, "viewer")
+				require.NoError(t, err)
+				assert.Equal(t, result.HasPermission, batch[docID], "%s batch: %s", name, docID)
+				assert.Equal(t, result.HasPermission, listed[docID], "%s list: %s", name, docID)
+				if result.HasPermission {
+					granted = append(granted, docID)
+				}
+			}
+			out[name] = granted
+		}
+		return out
+	}
+	all := map[string][]string{model.EngineMySQL: docIDs, model.EngineZanzibar: docIDs}
+
+	// Step 1: Both engines grant both documents
+	assert.Equal(t, all, visible())
+
+	// Step 2: A soft-deleted document disappears and comes back on restore
+	require.NoError(t, softDeletes.SoftDelete(ctx, EntityDocument, docIDs[0]))
+	assert.Equal(t, map[string][]string{model.EngineMySQL: {docIDs[1]}, model.EngineZanzibar: {docIDs[1]}}, visible())
+	subjects, err := zanzibarRepo.LookupSubjects(ctx, docIDs[0], "viewer")
+	require.NoError(t, err)
+	assert.Empty(t, subjects)
+
+	require.NoError(t, softDeletes.Restore(ctx, EntityDocument, docIDs[0]))
+	assert.Equal(t, all, visible())
+
+	// Step 3: A soft-deleted user has no access at all
+	require.NoError(t, softDeletes.SoftDelete(ctx, EntityUser, userID))
+	assert.Equal(t, map[string][]string{model.EngineMySQL: {}, model.EngineZanzibar: {}}, visible())
+	count, err := zanzibarRepo.CountUserDocuments(ctx, userID, "viewer")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	subjects, err = zanzibarRepo.LookupSubjects(ctx, docIDs[0], "viewer")
+	require.NoError(t, err)
+	assert.NotContains(t, subjects, userID)
+	require.NoError(t, softDeletes.Restore(ctx, EntityUser, userID))
+
+	// Step 4: Soft-deleting the customer hides its documents; restoring brings back exactly those
+	require.NoError(t, softDeletes.SoftDelete(ctx, EntityDocument, docIDs[0]))
+	// Backdate the document so it is not mistaken for one deleted with the customer
+	db.Model(&model.Document{}).Where("id = ?", docIDs[0]).Update("deleted_at", time.Now().Add(-time.Hour))
+	require.NoError(t, softDeletes.SoftDelete(ctx, EntityCustomer, customerID))
+	assert.Equal(t, map[string][]string{model.EngineMySQL: {}, model.EngineZanzibar: {}}, visible())
+	require.NoError(t, softDeletes.Restore(ctx, EntityCustomer, customerID))
+	assert.Equal(t, map[string][]string{model.EngineMySQL: {docIDs[1]}, model.EngineZanzibar: {docIDs[1]}}, visible())
+
+	// Step 5: Unknown and missing entities are rejected
+	assert.ErrorIs(t, softDeletes.SoftDelete(ctx, "department", "sd-dept"), ErrUnknownEntity)
+	assert.ErrorIs(t, softDeletes.Restore(ctx, EntityDocument, "sd-doc-missing"), ErrEntityNotFound)
+
+	// Step 6: Purging the deleted document removes its tuples and expanded rows
+	deletedIDs, err := softDeletes.DeletedBefore(ctx, EntityDocument, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Contains(t, deletedIDs, docIDs[0])
+
+	tuples, err := zanzibarRepo.PurgeTuples(ctx, EntityDocument, []string{docIDs[0]})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), tuples)
+	rows, err := mysqlRepo.PurgePermissions(ctx, EntityDocument, []string{docIDs[0]})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), rows)
+
+	require.NoError(t, softDeletes.Restore(ctx, EntityDocument, docIDs[0]))
+	assert.Equal(t, map[string][]string{model.EngineMySQL: {docIDs[1]}, model.EngineZanzibar: {docIDs[1]}}, visible(),
+		"a purged document stays inaccessible after a restore")
+
+	cleanup()
+
+	t.Logf("✅ Test passed! Both engines ignore soft-deleted entities")
+}
+
+// TestPurgeCustomerPermissions tests that purging a customer removes the rows granted
+// through following it, whichever source the manager chain recorded, and keeps the rest
+func TestPurgeCustomerPermissions(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	mysqlRepo := NewMySQLPermissionRepository(db)
+	ctx := context.Background()
+
+	const customerID = "sdp-customer"
+	userIDs := []string{"sdp-creator", "sdp-follower", "sdp-manager", "sdp-restored-manager"}
+	docID := "sdp-doc"
+
+	cleanup := func() {
+		db.Where("document_id = ?", docID).Delete(&model.DocumentPermissionMySQL{})
+		db.Where("customer_id = ?", customerID).Delete(&model.CustomerFollower{})
+		db.Where("id = ?", docID).Delete(&model.Document{})
+		db.Where("id = ?", customerID).Delete(&model.Customer{})
+		db.Where("id IN ?", userIDs).Delete(&model.User{})
+	}
+	cleanup()
+
+	for _, id := range userIDs {
+		createTestUser(db, id, id, id+"@test.com")
+	}
+	createTestCustomer(db, customerID, "Purge Customer")
+	createTestDocument(db, docID, "Purge Doc", customerID, "sdp-creator")
+	db.Create(&model.CustomerFollower{UserID: "sdp-follower", CustomerID: customerID})
+
+	customer, creator, follower := customerID, "sdp-creator", "sdp-follower"
+	db.Create(&[]model.DocumentPermissionMySQL{
+		{UserID: creator, DocumentID: docID, PermissionType: "owner", SourceType: model.SourceTypeDirect, SourceID: &docID},
+		{UserID: follower, DocumentID: docID, PermissionType: "viewer", SourceType: model.SourceTypeCustomerFollower, SourceID: &customer},
+		// Follower paths record the customer, the restore path the follower itself
+		{UserID: "sdp-manager", DocumentID: docID, PermissionType: "viewer", SourceType: model.SourceTypeManagerChain, SourceID: &customer},
+		{UserID: "sdp-restored-manager", DocumentID: docID, PermissionType: "viewer", SourceType: model.SourceTypeManagerChain, SourceID: &follower},
+	})
+
+	// Step 1: Purge the customer
+	rows, err := mysqlRepo.PurgePermissions(ctx, EntityCustomer, []string{customerID})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), rows)
+
+	// Step 2: Only the creator's own row is left
+	var left []model.DocumentPermissionMySQL
+	require.NoError(t, db.Where("document_id = ?", docID).Find(&left).Error)
+	require.Len(t, left, 1)
+	assert.Equal(t, model.SourceTypeDirect, left[0].SourceType)
+
+	cleanup()
+
+	t.Logf("✅ Test passed! Purging %s removed %d rows granted through following it", customerID, rows)
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// tracer creates the resolution and mutation spans. It resolves the global
+// provider lazily, so spans are no-ops unless tracing is initialized.
+var tracer = otel.Tracer("github.com/d60-Lab/gin-template/internal/repository")
+
+// endSpan records err (if any) and attrs on span and ends it
+func endSpan(span trace.Span, err error, attrs ...attribute.KeyValue) {
+	span.SetAttributes(attrs...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// operationTrace is the span of a multi-step operation. Each Step ends the
+// previous step span and starts the next one as a child of the operation, so
+// the SQL spans of a step are nested under it.
+type operationTrace struct {
+	name string
+	ctx  context.Context
+	span trace.Span
+	step trace.Span
+}
+
+// startOperation starts the span of a multi-step operation
+func startOperation(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, *operationTrace) {
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	return ctx, &operationTrace{name: name, ctx: ctx, span: span}
+}
+
+// Step starts the span of the next step and returns the context its queries must use
+func (o *operationTrace) Step(name string) context.Context {
+	if o.step != nil {
+		o.step.End()
+	}
+	ctx, step := tracer.Start(o.ctx, o.name+"."+name)
+	o.step = step
+	return ctx
+}
+
+// End records err (if any) on the last step and the operation span and ends both
+func (o *operationTrace) End(err error) {
+	if o.step != nil {
+		endSpan(o.step, err)
+	}
+	endSpan(o.span, err)
+}
+
+// checkAttributes describes the outcome of a permission check on its span
+func checkAttributes(result *model.PermissionCheckResult, queries int64) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.Int64("db.queries", queries)}
+	if result != nil {
+		attrs = append(attrs,
+			attribute.Bool("permission.granted", result.HasPermission),
+			attribute.String("permission.path", checkPath(result.Sources)),
+		)
+	}
+	return attrs
+}
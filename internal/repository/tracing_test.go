@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/pkg/database"
+)
+
+// TestCheckPermissionSpans tests that a check emits a span per resolution step with nested SQL spans
+func TestCheckPermissionSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	db := setupMySQLTestDB(t)
+	require.NoError(t, db.Use(database.TracingPlugin{}))
+
+	zanzibarRepo := NewZanzibarPermissionRepository(db)
+	ctx := context.Background()
+
+	const (
+		userID     = "test-tracing-user-1"
+		documentID = "test-tracing-doc-1"
+	)
+
+	// Clean up leftovers from previous runs
+	db.Where("subject_id = ?", userID).Delete(&model.RelationTuple{})
+	require.NoError(t, zanzibarRepo.GrantDirectPermission(ctx, userID, documentID, "viewer"))
+
+	// Step 1: The check resolves on the direct path
+	result, err := zanzibarRepo.CheckPermission(ctx, userID, documentID, "viewer")
+	require.NoError(t, err)
+	require.True(t, result.HasPermission)
+
+	// Step 2: Superuser and direct steps are children of the check span, SQL spans of the steps
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	check, ok := spans["zanzibar.check"]
+	require.True(t, ok, "zanzibar.check span should be recorded")
+	for _, name := range []string{"zanzibar.check.superuser", "zanzibar.check.direct"} {
+		step, ok := spans[name]
+		require.True(t, ok, "%s span should be recorded", name)
+		assert.Equal(t, check.SpanContext().SpanID(), step.Parent().SpanID())
+	}
+	assert.NotContains(t, spans, "zanzibar.check.follower", "resolution stops at the direct path")
+
+	sqlSpans := 0
+	for _, span := range recorder.Ended() {
+		if span.Name() == "gorm.query" && span.Parent().SpanID() == spans["zanzibar.check.direct"].SpanContext().SpanID() {
+			sqlSpans++
+		}
+	}
+	assert.Equal(t, 1, sqlSpans, "the direct step issues one query")
+
+	// Cleanup
+	require.NoError(t, zanzibarRepo.RevokePermission(ctx, userID, documentID))
+
+	t.Logf("✅ Test passed! Resolution steps and SQL statements are traced")
+}
+
+// TestMutationSpanRecordsError tests that a failed mutation marks its span as an error
+func TestMutationSpanRecordsError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	db := setupMySQLTestDB(t)
+	mysqlRepo := NewMySQLPermissionRepository(db)
+	ctx := context.Background()
+
+	// Step 1: Moving an unknown department fails
+	err := mysqlRepo.MoveDepartment(ctx, "test-tracing-missing-dept", "test-tracing-missing-parent")
+	require.ErrorIs(t, err, ErrDepartmentNotFound)
+
+	// Step 2: The reorg span carries the departments and the error
+	var move sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "mysql.move_department" {
+			move = span
+		}
+	}
+	require.NotNil(t, move, "mysql.move_department span should be recorded")
+	assert.Equal(t, codes.Error, move.Status().Code)
+	assert.Contains(t, move.Attributes(), attribute.String("department.id", "test-tracing-missing-dept"))
+	require.NotEmpty(t, move.Events())
+	assert.Equal(t, "exception", move.Events()[0].Name)
+
+	t.Logf("✅ Test passed! Failed mutations record their error on the span")
+}
@@ -2,25 +2,91 @@ package repository
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 
+	"github.com/d60-Lab/gin-template/internal/caveat"
 	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
+)
+
+var (
+	// ErrPreconditionFailed is returned when a WriteTuples precondition does not hold
+	ErrPreconditionFailed = errors.New("tuple precondition failed")
+	// ErrTupleAlreadyExists is returned when a create operation targets an existing tuple
+	ErrTupleAlreadyExists = errors.New("tuple already exists")
+	// ErrInvalidTuple is returned when a tuple or operation is malformed
+	ErrInvalidTuple = errors.New("invalid tuple")
+	// ErrInvalidPageToken is returned when a ReadTuples page token cannot be decoded
+	ErrInvalidPageToken = errors.New("invalid page token")
+)
+
+const (
+	defaultTuplePageSize = 100
+	maxTuplePageSize     = 1000
 )
 
 // ZanzibarPermissionRepository handles Zanzibar-style tuple-based permissions
 type ZanzibarPermissionRepository struct {
-	db *gorm.DB
+	db       *gorm.DB
+	onChange TupleChangeFunc
+
+	managerChainStrategy string
+	cteThreshold         int
+
+	bitmaps *DocumentBitmapIndex // nil unless the bitmap index is enabled
+	encoded *EncodedTupleStore   // nil unless encoded tuple storage is enabled
+
+	caveats    map[string]*caveat.Expression // Conditions conditional tuples may reference
+	attributes *AttributeRules               // nil unless attribute rules are configured
+	walls      *EthicalWalls                 // nil unless ethical walls are enabled
 }
 
+// TupleChangeFunc is called after tuples were written or deleted and the change is committed.
+// Only the tuple keys are meaningful; Relation is empty when every relation between an
+// object and a subject was removed.
+type TupleChangeFunc func(ctx context.Context, changed []model.RelationTuple)
+
 // NewZanzibarPermissionRepository creates a new Zanzibar permission repository
 func NewZanzibarPermissionRepository(db *gorm.DB) *ZanzibarPermissionRepository {
 	return &ZanzibarPermissionRepository{
-		db: db,
+		db:                   db,
+		managerChainStrategy: ManagerChainStrategyAuto,
+		cteThreshold:         defaultCTEThreshold,
+	}
+}
+
+// OnTupleChange registers fn to be notified of committed tuple changes,
+// e.g. to keep the materialized MySQL table in sync
+func (r *ZanzibarPermissionRepository) OnTupleChange(fn TupleChangeFunc) {
+	r.onChange = fn
+}
+
+// notifyTupleChange forwards committed tuple changes to the registered hook
+func (r *ZanzibarPermissionRepository) notifyTupleChange(ctx context.Context, changed ...model.RelationTuple) {
+	if r.encoded != nil && len(changed) > 0 {
+		r.syncEncodedTuples(ctx, changed)
+	}
+	if r.bitmaps != nil && len(changed) > 0 {
+		if err := r.invalidateBitmaps(ctx, changed); err != nil {
+			// Without the affected users nothing in the index can be trusted
+			r.bitmaps.Reset()
+		}
+	}
+	if r.onChange == nil || len(changed) == 0 {
+		return
 	}
+	r.onChange(ctx, changed)
 }
 
 // CheckPermission checks if a user has permission to access a document
@@ -28,12 +94,50 @@ func NewZanzibarPermissionRepository(db *gorm.DB) *ZanzibarPermissionRepository
 // then check if target document is in the set. This is much faster than "backward checking"
 // which requires traversing all followers of the document's customer.
 func (r *ZanzibarPermissionRepository) CheckPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error) {
+	start := time.Now()
+	ctx, queries := metrics.WithQueryCounter(ctx)
+	ctx, span := tracer.Start(ctx, "zanzibar.check", trace.WithAttributes(
+		attribute.String("user.id", userID),
+		attribute.String("document.id", documentID),
+		attribute.String("permission.type", permissionType),
+	))
+
+	result, err := r.checkPermission(ctx, userID, documentID, permissionType)
+	if err == nil {
+		result, err = r.attributes.enforceCheck(ctx, r.db, model.EngineZanzibar, userID, documentID, permissionType, result)
+	}
+	if err == nil {
+		result, err = r.walls.enforceCheck(ctx, r.db, r, model.EngineZanzibar, userID, documentID, permissionType, result)
+	}
+	observeCheck(model.EngineZanzibar, start, queries.Load(), result, err)
+	endSpan(span, err, checkAttributes(result, queries.Load())...)
+	return result, err
+}
+
+// checkPermission resolves the check; CheckPermission wraps it with metrics
+func (r *ZanzibarPermissionRepository) checkPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error) {
 	startTime := time.Now()
 
 	sources := make(model.PermissionSourceList, 0)
 
+	// Path 0: Soft-deleted users have no access and soft-deleted documents are invisible
+	stepCtx, span := tracer.Start(ctx, "zanzibar.check.deleted")
+	deleted, err := checkTargetsDeleted(stepCtx, r.db, userID, documentID)
+	endSpan(span, err, attribute.Bool("matched", deleted))
+	if err != nil {
+		return nil, err
+	}
+	if deleted {
+		return &model.PermissionCheckResult{
+			HasPermission: false,
+			DurationMs:    float64(time.Since(startTime).Milliseconds()),
+		}, nil
+	}
+
 	// Path 1: Superuser check (fastest path - single query)
-	hasSuperuser, err := r.checkSuperuserPermission(ctx, userID)
+	stepCtx, span = tracer.Start(ctx, "zanzibar.check.superuser")
+	hasSuperuser, err := r.checkSuperuserPermission(stepCtx, userID)
+	endSpan(span, err, attribute.Bool("matched", hasSuperuser))
 	if err != nil {
 		return nil, err
 	}
@@ -48,7 +152,9 @@ func (r *ZanzibarPermissionRepository) CheckPermission(ctx context.Context, user
 	}
 
 	// Path 2: Direct permission (single query)
-	hasDirect, err := r.checkDirectPermission(ctx, userID, documentID, permissionType, &sources)
+	stepCtx, span = tracer.Start(ctx, "zanzibar.check.direct")
+	hasDirect, err := r.checkDirectPermission(stepCtx, userID, documentID, permissionType, &sources)
+	endSpan(span, err, attribute.Bool("matched", hasDirect))
 	if err != nil {
 		return nil, err
 	}
@@ -62,7 +168,9 @@ func (r *ZanzibarPermissionRepository) CheckPermission(ctx context.Context, user
 	}
 
 	// Path 3: Customer follower permission (2 queries)
-	hasCustomer, err := r.checkCustomerFollowerPermission(ctx, userID, documentID, permissionType, &sources)
+	stepCtx, span = tracer.Start(ctx, "zanzibar.check.follower")
+	hasCustomer, err := r.checkCustomerFollowerPermission(stepCtx, userID, documentID, permissionType, &sources)
+	endSpan(span, err, attribute.Bool("matched", hasCustomer))
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +186,9 @@ func (r *ZanzibarPermissionRepository) CheckPermission(ctx context.Context, user
 	// Path 4: Manager chain permission - OPTIMIZED with forward expansion
 	// Instead of checking "who has access to this document and am I their manager",
 	// we check "what documents can my subordinates access and is this document in that set"
-	hasManager, err := r.checkManagerChainPermissionOptimized(ctx, userID, documentID, permissionType, &sources)
+	stepCtx, span = tracer.Start(ctx, "zanzibar.check.manager")
+	hasManager, err := r.checkManagerChainPermissionOptimized(stepCtx, userID, documentID, permissionType, &sources)
+	endSpan(span, err, attribute.Bool("matched", hasManager))
 	if err != nil {
 		return nil, err
 	}
@@ -91,10 +201,28 @@ func (r *ZanzibarPermissionRepository) CheckPermission(ctx context.Context, user
 		}, nil
 	}
 
-	// No permission found
+	// Path 5: Conditional tuples, evaluated against the request context
+	stepCtx, span = tracer.Start(ctx, "zanzibar.check.conditional")
+	hasConditional, missing, err := r.checkConditionalPermission(stepCtx, userID, documentID, permissionType, &sources)
+	endSpan(span, err, attribute.Bool("matched", hasConditional), attribute.StringSlice("missing_context", missing))
+	if err != nil {
+		return nil, err
+	}
+	if hasConditional {
+		return &model.PermissionCheckResult{
+			HasPermission:  true,
+			PermissionType: permissionType,
+			Sources:        sourcesToStrings(sources),
+			DurationMs:     float64(time.Since(startTime).Milliseconds()),
+		}, nil
+	}
+
+	// No permission found; a caveat lacking context leaves the check conditional
 	return &model.PermissionCheckResult{
-		HasPermission: false,
-		DurationMs:    float64(time.Since(startTime).Milliseconds()),
+		HasPermission:  false,
+		Conditional:    len(missing) > 0,
+		MissingContext: missing,
+		DurationMs:     float64(time.Since(startTime).Milliseconds()),
 	}, nil
 }
 
@@ -102,6 +230,7 @@ func (r *ZanzibarPermissionRepository) CheckPermission(ctx context.Context, user
 func (r *ZanzibarPermissionRepository) checkDirectPermission(ctx context.Context, userID, documentID, permissionType string, sources *model.PermissionSourceList) (bool, error) {
 	var tuple model.RelationTuple
 	err := r.db.WithContext(ctx).
+		Scopes(unexpired, unconditional).
 		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
 			"document", documentID, permissionType, "user", userID).
 		First(&tuple).Error
@@ -122,6 +251,7 @@ func (r *ZanzibarPermissionRepository) checkCustomerFollowerPermission(ctx conte
 	// Step 1: Find which customer owns this document
 	var ownerTuple model.RelationTuple
 	err := r.db.WithContext(ctx).
+		Scopes(unexpired, unconditional).
 		Where("namespace = ? AND object_id = ? AND relation = ?", "document", documentID, "owner_customer").
 		First(&ownerTuple).Error
 
@@ -137,6 +267,7 @@ func (r *ZanzibarPermissionRepository) checkCustomerFollowerPermission(ctx conte
 	// Step 2: Check if user is a follower of this customer
 	var followerTuple model.RelationTuple
 	err = r.db.WithContext(ctx).
+		Scopes(unexpired, unconditional).
 		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
 			"customer", customerID, "follower", "user", userID).
 		First(&followerTuple).Error
@@ -163,6 +294,7 @@ func (r *ZanzibarPermissionRepository) checkManagerChainPermission(ctx context.C
 	// Step 1.1: Find the customer that owns this document
 	var docCustomerTuple model.RelationTuple
 	err := r.db.WithContext(ctx).
+		Scopes(unexpired, unconditional).
 		Where("namespace = ? AND object_id = ? AND relation = ?", "document", documentID, "owner_customer").
 		First(&docCustomerTuple).Error
 
@@ -176,6 +308,7 @@ func (r *ZanzibarPermissionRepository) checkManagerChainPermission(ctx context.C
 		// Step 1.2: Find all followers of this customer
 		var followerTuples []model.RelationTuple
 		err = r.db.WithContext(ctx).
+			Scopes(unexpired, unconditional).
 			Where("namespace = ? AND object_id = ? AND relation = ?", "customer", customerID, "follower").
 			Find(&followerTuples).Error
 
@@ -206,6 +339,7 @@ func (r *ZanzibarPermissionRepository) checkManagerChainPermission(ctx context.C
 	// Condition 2: Check if user manages the document creator
 	var creatorTuple model.RelationTuple
 	err = r.db.WithContext(ctx).
+		Scopes(unexpired, unconditional).
 		Where("namespace = ? AND object_id = ? AND relation = ?", "document", documentID, "owner").
 		First(&creatorTuple).Error
 
@@ -223,23 +357,17 @@ func (r *ZanzibarPermissionRepository) checkManagerChainPermission(ctx context.C
 	return false, nil // Neither condition satisfied
 }
 
-// checkManagerChainPermissionOptimized uses forward expansion strategy
-// Instead of: "find all followers of document's customer, check if I manage any of them" (slow)
-// We do: "find all my subordinates, check if any of them have access to this document" (fast)
-func (r *ZanzibarPermissionRepository) checkManagerChainPermissionOptimized(ctx context.Context, userID, documentID, permissionType string, sources *model.PermissionSourceList) (bool, error) {
-	// Step 1: Get all subordinates of the current user (batch query)
-	subordinateIDs, err := r.getAllSubordinates(ctx, userID, 5)
-	if err != nil {
-		return false, err
-	}
-
+// checkSubordinatesGrant is the BFS remainder of the manager chain check: whether any of
+// subordinateIDs owns documentID or follows its customer
+func (r *ZanzibarPermissionRepository) checkSubordinatesGrant(ctx context.Context, documentID string, subordinateIDs []string, sources *model.PermissionSourceList) (bool, error) {
 	if len(subordinateIDs) == 0 {
 		return false, nil
 	}
 
-	// Step 2: Check if any subordinate is the document owner
+	// Step 1: Check if any subordinate is the document owner
 	var ownerCount int64
-	err = r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+	err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Scopes(unexpired, unconditional).
 		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
 			"document", documentID, "owner", "user", subordinateIDs).
 		Count(&ownerCount).Error
@@ -251,10 +379,11 @@ func (r *ZanzibarPermissionRepository) checkManagerChainPermissionOptimized(ctx
 		return true, nil
 	}
 
-	// Step 3: Check if any subordinate follows the document's customer
+	// Step 2: Check if any subordinate follows the document's customer
 	// First get document's customer
 	var docCustomerTuple model.RelationTuple
 	err = r.db.WithContext(ctx).
+		Scopes(unexpired, unconditional).
 		Where("namespace = ? AND object_id = ? AND relation = ?", "document", documentID, "owner_customer").
 		First(&docCustomerTuple).Error
 	if err != nil {
@@ -267,6 +396,7 @@ func (r *ZanzibarPermissionRepository) checkManagerChainPermissionOptimized(ctx
 	// Check if any subordinate follows this customer
 	var followerCount int64
 	err = r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Scopes(unexpired, unconditional).
 		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
 			"customer", docCustomerTuple.SubjectID, "follower", "user", subordinateIDs).
 		Count(&followerCount).Error
@@ -331,6 +461,7 @@ func (r *ZanzibarPermissionRepository) isInManagementChain(ctx context.Context,
 func (r *ZanzibarPermissionRepository) checkSuperuserPermission(ctx context.Context, userID string) (bool, error) {
 	var tuple model.RelationTuple
 	err := r.db.WithContext(ctx).
+		Scopes(unexpired, unconditional).
 		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
 			"system", "root", "admin", "user", userID).
 		First(&tuple).Error
@@ -347,6 +478,8 @@ func (r *ZanzibarPermissionRepository) checkSuperuserPermission(ctx context.Cont
 
 // CheckPermissionsBatch checks permissions for multiple documents
 func (r *ZanzibarPermissionRepository) CheckPermissionsBatch(ctx context.Context, userID string, documentIDs []string, permissionType string) (map[string]bool, error) {
+	metrics.BatchSize.WithLabelValues("check_permissions_batch").Observe(float64(len(documentIDs)))
+
 	result := make(map[string]bool)
 	for _, docID := range documentIDs {
 		result[docID] = false
@@ -356,26 +489,88 @@ func (r *ZanzibarPermissionRepository) CheckPermissionsBatch(ctx context.Context
 		return result, nil
 	}
 
+	// Soft-deleted users have no access
+	deleted, err := userDeleted(ctx, r.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if deleted {
+		return result, nil
+	}
+
+	if err := r.checkPermissionsBatch(ctx, userID, documentIDs, permissionType, result); err != nil {
+		return nil, err
+	}
+
+	// Conditional tuples can only add documents no other path grants
+	pending := make([]string, 0, len(documentIDs))
+	for _, docID := range documentIDs {
+		if !result[docID] {
+			pending = append(pending, docID)
+		}
+	}
+	if len(pending) > 0 {
+		if err := r.checkConditionalPermissionsBatch(ctx, userID, uniqueStrings(pending), permissionType, result); err != nil {
+			return nil, err
+		}
+	}
+
+	// Soft-deleted documents are invisible to every path
+	deletedDocs, err := deletedAmong(ctx, r.db, "documents", documentIDs)
+	if err != nil {
+		return nil, err
+	}
+	for docID := range deletedDocs {
+		result[docID] = false
+	}
+
+	if err := r.attributes.enforceBatch(ctx, r.db, model.EngineZanzibar, userID, permissionType, result); err != nil {
+		return nil, err
+	}
+	if err := r.walls.enforceBatch(ctx, r.db, r, model.EngineZanzibar, userID, permissionType, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// checkPermissionsBatch sets result[docID] for every document userID can access
+func (r *ZanzibarPermissionRepository) checkPermissionsBatch(ctx context.Context, userID string, documentIDs []string, permissionType string, result map[string]bool) error {
 	// Path 1: Superuser check
 	isSuperuser, err := r.checkSuperuserPermission(ctx, userID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if isSuperuser {
 		for _, docID := range documentIDs {
 			result[docID] = true
 		}
-		return result, nil
+		return nil
+	}
+
+	// With the bitmap index every remaining path is a single membership test
+	if r.bitmaps != nil {
+		sets, err := r.documentBitmaps(ctx, userID, permissionType)
+		if err != nil {
+			return err
+		}
+		for _, docID := range documentIDs {
+			if ordinal, ok := r.bitmaps.ordinal(docID); ok && sets.all.Contains(ordinal) {
+				result[docID] = true
+			}
+		}
+		return nil
 	}
 
 	// Path 2: Direct permissions
 	var directDocIDs []string
 	err = r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Scopes(unexpired, unconditional).
 		Where("namespace = ? AND object_id IN ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
 			"document", documentIDs, permissionType, "user", userID).
 		Pluck("object_id", &directDocIDs).Error
 	if err != nil {
-		return nil, err
+		return err
 	}
 	for _, docID := range directDocIDs {
 		result[docID] = true
@@ -385,21 +580,23 @@ func (r *ZanzibarPermissionRepository) CheckPermissionsBatch(ctx context.Context
 	// 3.1 Find customers user follows
 	var followedCustomerIDs []string
 	err = r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Scopes(unexpired, unconditional).
 		Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
 			"customer", "follower", "user", userID).
 		Pluck("object_id", &followedCustomerIDs).Error
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if len(followedCustomerIDs) > 0 {
 		var customerDocIDs []string
 		err = r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+			Scopes(unexpired, unconditional).
 			Where("namespace = ? AND object_id IN ? AND relation = ? AND subject_id IN ?",
 				"document", documentIDs, "owner_customer", followedCustomerIDs).
 			Pluck("object_id", &customerDocIDs).Error
 		if err != nil {
-			return nil, err
+			return err
 		}
 		for _, docID := range customerDocIDs {
 			result[docID] = true
@@ -409,18 +606,19 @@ func (r *ZanzibarPermissionRepository) CheckPermissionsBatch(ctx context.Context
 	// Path 4: Manager chain permissions
 	subordinateIDs, err := r.getAllSubordinates(ctx, userID, 5)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if len(subordinateIDs) > 0 {
 		// 4.1 Subordinate is owner
 		var subOwnerDocIDs []string
 		err = r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+			Scopes(unexpired, unconditional).
 			Where("namespace = ? AND object_id IN ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
 				"document", documentIDs, "owner", "user", subordinateIDs).
 			Pluck("object_id", &subOwnerDocIDs).Error
 		if err != nil {
-			return nil, err
+			return err
 		}
 		for _, docID := range subOwnerDocIDs {
 			result[docID] = true
@@ -429,21 +627,23 @@ func (r *ZanzibarPermissionRepository) CheckPermissionsBatch(ctx context.Context
 		// 4.2 Subordinate follows owner customer
 		var subFollowedCustomerIDs []string
 		err = r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+			Scopes(unexpired, unconditional).
 			Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
 				"customer", "follower", "user", subordinateIDs).
 			Pluck("object_id", &subFollowedCustomerIDs).Error
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		if len(subFollowedCustomerIDs) > 0 {
 			var subCustomerDocIDs []string
 			err = r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+				Scopes(unexpired, unconditional).
 				Where("namespace = ? AND object_id IN ? AND relation = ? AND subject_id IN ?",
 					"document", documentIDs, "owner_customer", subFollowedCustomerIDs).
 				Pluck("object_id", &subCustomerDocIDs).Error
 			if err != nil {
-				return nil, err
+				return err
 			}
 			for _, docID := range subCustomerDocIDs {
 				result[docID] = true
@@ -451,7 +651,7 @@ func (r *ZanzibarPermissionRepository) CheckPermissionsBatch(ctx context.Context
 		}
 	}
 
-	return result, nil
+	return nil
 }
 
 // GetUserDocuments returns paginated list of documents user can access
@@ -466,6 +666,20 @@ func (r *ZanzibarPermissionRepository) GetUserDocuments(ctx context.Context, use
 	// 3. Customer follower permissions
 	// 4. Manager chain permissions (subordinates' documents)
 
+	// Soft-deleted users have no access
+	deleted, err := userDeleted(ctx, r.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if deleted {
+		return &model.UserDocumentList{
+			Documents:  []model.DocumentListItem{},
+			Page:       page,
+			PageSize:   pageSize,
+			DurationMs: float64(time.Since(startTime).Milliseconds()),
+		}, nil
+	}
+
 	// Path 0: Check if user is superuser
 	isSuperuser, err := r.checkSuperuserPermission(ctx, userID)
 	if err != nil {
@@ -473,12 +687,23 @@ func (r *ZanzibarPermissionRepository) GetUserDocuments(ctx context.Context, use
 	}
 
 	if isSuperuser {
-		// Superuser has access to ALL documents
+		// Superuser has access to ALL live documents the attribute rule allows
+		allowedByAttributes, err := r.superuserAttributeScope(ctx, userID, permissionType)
+		if err != nil {
+			return nil, err
+		}
+		allowedByWalls, err := r.walls.documentScope(ctx, r.db, r, userID, permissionType, "id", nil)
+		if err != nil {
+			return nil, err
+		}
+
 		var total int64
-		r.db.WithContext(ctx).Model(&model.Document{}).Count(&total)
+		r.db.WithContext(ctx).Model(&model.Document{}).Where("deleted_at IS NULL").Scopes(allowedByAttributes, allowedByWalls).Count(&total)
 
 		var documents []model.Document
 		err = r.db.WithContext(ctx).
+			Where("deleted_at IS NULL").
+			Scopes(allowedByAttributes, allowedByWalls).
 			Preload("Customer").
 			Preload("Creator").
 			Order("created_at DESC").
@@ -498,7 +723,8 @@ func (r *ZanzibarPermissionRepository) GetUserDocuments(ctx context.Context, use
 				CustomerID:     doc.CustomerID,
 				CreatorID:      doc.CreatorID,
 				PermissionType: permissionType,
-				SourceType:     "superuser",
+				SourceType:     model.SourceTypeSuperuser,
+				Sources:        model.PermissionSourceList{{Type: model.SourceTypeSuperuser, SourceID: "system:root"}},
 				CreatedAt:      doc.CreatedAt,
 			}
 			if doc.Customer != nil {
@@ -519,79 +745,52 @@ func (r *ZanzibarPermissionRepository) GetUserDocuments(ctx context.Context, use
 		}, nil
 	}
 
-	var documentIDs []string
-
-	// Path 1: Direct permissions
-	r.db.WithContext(ctx).
-		Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
-			"document", permissionType, "user", userID).
-		Pluck("object_id", &documentIDs)
-
-	// Path 2: Customer follower permissions
-	var customerIDs []string
-	r.db.WithContext(ctx).
-		Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
-			"customer", "follower", "user", userID).
-		Pluck("object_id", &customerIDs)
-
-	if len(customerIDs) > 0 {
-		var customerDocIDs []string
-		r.db.WithContext(ctx).
-			Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
-				"document", "owner_customer", "customer", customerIDs).
-			Pluck("object_id", &customerDocIDs)
-		documentIDs = append(documentIDs, customerDocIDs...)
+	var (
+		documentIDs []string
+		sourcesOf   func(doc model.Document) model.PermissionSourceList
+		expiryOf    func(doc model.Document) *time.Time
+	)
+	if r.bitmaps != nil {
+		sets, err := r.documentBitmaps(ctx, userID, permissionType)
+		if err != nil {
+			return nil, err
+		}
+		documentIDs = r.bitmaps.decode(sets.all)
+		sourcesOf = func(doc model.Document) model.PermissionSourceList {
+			return r.bitmaps.sources(sets, doc)
+		}
+		expiryOf = func(doc model.Document) *time.Time {
+			return r.bitmaps.expiry(sets, doc.ID)
+		}
+	} else {
+		accessible, err := r.accessibleDocuments(ctx, userID, permissionType)
+		if err != nil {
+			return nil, err
+		}
+		documentIDs = accessible.ids
+		sourcesOf = func(doc model.Document) model.PermissionSourceList {
+			return accessible.sources[doc.ID]
+		}
+		expiryOf = func(doc model.Document) *time.Time {
+			return accessible.expiresAt[doc.ID]
+		}
 	}
 
-	// Path 3: Manager chain permissions (documents accessible by subordinates)
-	// Find all subordinates
-	subordinateIDs, err := r.getAllSubordinates(ctx, userID, 5)
+	documentIDs, err = r.attributes.filterDocuments(ctx, r.db, userID, permissionType, documentIDs)
 	if err != nil {
 		return nil, err
 	}
-
-	if len(subordinateIDs) > 0 {
-		// 3.1: Documents directly owned by subordinates
-		var subordinateDocIDs []string
-		r.db.WithContext(ctx).
-			Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
-				"document", "owner", "user", subordinateIDs).
-			Pluck("object_id", &subordinateDocIDs)
-		documentIDs = append(documentIDs, subordinateDocIDs...)
-
-		// 3.2: Documents accessible via subordinates' customer followings
-		var subordinateCustomerIDs []string
-		r.db.WithContext(ctx).
-			Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
-				"customer", "follower", "user", subordinateIDs).
-			Pluck("object_id", &subordinateCustomerIDs)
-
-		if len(subordinateCustomerIDs) > 0 {
-			var subordinateCustomerDocIDs []string
-			r.db.WithContext(ctx).
-				Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
-					"document", "owner_customer", "customer", subordinateCustomerIDs).
-				Pluck("object_id", &subordinateCustomerDocIDs)
-			documentIDs = append(documentIDs, subordinateCustomerDocIDs...)
-		}
-	}
-
-	// Deduplicate
-	uniqueDocIDs := make([]string, 0, len(documentIDs))
-	seen := make(map[string]bool)
-	for _, id := range documentIDs {
-		if !seen[id] {
-			seen[id] = true
-			uniqueDocIDs = append(uniqueDocIDs, id)
-		}
+	documentIDs, err = r.walls.filterDocuments(ctx, r.db, r, userID, permissionType, documentIDs)
+	if err != nil {
+		return nil, err
 	}
 
-	total := int64(len(uniqueDocIDs))
+	total := int64(len(documentIDs))
 
 	// Fetch documents with pagination
 	var documents []model.Document
 	err = r.db.WithContext(ctx).
-		Where("id IN ?", uniqueDocIDs).
+		Where("id IN ?", documentIDs).
 		Preload("Customer").
 		Preload("Creator").
 		Order("created_at DESC").
@@ -603,18 +802,10 @@ func (r *ZanzibarPermissionRepository) GetUserDocuments(ctx context.Context, use
 		return nil, fmt.Errorf("failed to fetch user documents: %w", err)
 	}
 
-	// Convert to document list items
+	// Convert to document list items; sources were attributed during expansion
 	documentItems := make([]model.DocumentListItem, 0, len(documents))
 	for _, doc := range documents {
-		// Determine permission source
-		var sourceType string
-		if r.hasDirectPermission(ctx, userID, doc.ID, permissionType) {
-			sourceType = "direct"
-		} else if r.hasCustomerPermission(ctx, userID, doc.ID, permissionType) {
-			sourceType = "customer_follower"
-		} else {
-			sourceType = "manager_chain"
-		}
+		sources := sourcesOf(doc)
 
 		docItem := model.DocumentListItem{
 			ID:             doc.ID,
@@ -622,9 +813,13 @@ func (r *ZanzibarPermissionRepository) GetUserDocuments(ctx context.Context, use
 			CustomerID:     doc.CustomerID,
 			CreatorID:      doc.CreatorID,
 			PermissionType: permissionType,
-			SourceType:     sourceType,
+			Sources:        sources,
 			CreatedAt:      doc.CreatedAt,
 		}
+		if len(sources) > 0 {
+			docItem.SourceType = sources[0].Type
+		}
+		docItem.SetExpiry(expiryOf(doc))
 
 		if doc.Customer != nil {
 			docItem.CustomerName = doc.Customer.Name
@@ -647,146 +842,736 @@ func (r *ZanzibarPermissionRepository) GetUserDocuments(ctx context.Context, use
 	}, nil
 }
 
-// getAllSubordinates gets all subordinates of a manager using RelationTuple with BFS to avoid N+1 queries
-// This implements the Zanzibar way: department#manager manages department#member
-func (r *ZanzibarPermissionRepository) getAllSubordinates(ctx context.Context, managerUserID string, maxDepth int) ([]string, error) {
-	allSubordinateIDs := make([]string, 0)
-	visited := map[string]bool{managerUserID: true}
-	currentManagers := []string{managerUserID}
+// CountUserDocuments returns the number of documents a user can access
+func (r *ZanzibarPermissionRepository) CountUserDocuments(ctx context.Context, userID, permissionType string) (int64, error) {
+	deleted, err := userDeleted(ctx, r.db, userID)
+	if err != nil || deleted {
+		return 0, err
+	}
 
-	for depth := 0; depth < maxDepth; depth++ {
-		if len(currentManagers) == 0 {
-			break
+	isSuperuser, err := r.checkSuperuserPermission(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if isSuperuser {
+		allowedByAttributes, err := r.superuserAttributeScope(ctx, userID, permissionType)
+		if err != nil {
+			return 0, err
 		}
-
-		// Step 1: Find all departments where these users are managers
-		var managedDeptIDs []string
-		err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
-			Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
-				"department", "manager", "user", currentManagers).
-			Pluck("object_id", &managedDeptIDs).Error
-
+		allowedByWalls, err := r.walls.documentScope(ctx, r.db, r, userID, permissionType, "id", nil)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
-
-		if len(managedDeptIDs) == 0 {
-			break
+		var total int64
+		if err := r.db.WithContext(ctx).Model(&model.Document{}).Where("deleted_at IS NULL").Scopes(allowedByAttributes, allowedByWalls).Count(&total).Error; err != nil {
+			return 0, fmt.Errorf("failed to count documents: %w", err)
 		}
+		return total, nil
+	}
 
-		// Step 2: Find all members of these departments
-		var memberIDs []string
-		err = r.db.WithContext(ctx).Model(&model.RelationTuple{}).
-			Where("namespace = ? AND object_id IN ? AND relation = ? AND subject_namespace = ?",
-				"department", managedDeptIDs, "member", "user").
-			Pluck("subject_id", &memberIDs).Error
-
+	var documentIDs []string
+	if r.bitmaps != nil {
+		sets, err := r.documentBitmaps(ctx, userID, permissionType)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
-
-		// Step 3: Filter out already visited members and prepare for next level
-		nextManagers := make([]string, 0)
-		for _, id := range memberIDs {
-			if !visited[id] {
-				visited[id] = true
-				allSubordinateIDs = append(allSubordinateIDs, id)
-				nextManagers = append(nextManagers, id)
-			}
+		if r.attributes.rule(permissionType) == nil && r.walls == nil {
+			return int64(sets.all.GetCardinality()), nil
 		}
-		currentManagers = nextManagers
+		documentIDs = r.bitmaps.decode(sets.all)
+	} else if documentIDs, err = r.accessibleDocumentIDs(ctx, userID, permissionType); err != nil {
+		return 0, err
 	}
 
-	return allSubordinateIDs, nil
+	documentIDs, err = r.attributes.filterDocuments(ctx, r.db, userID, permissionType, documentIDs)
+	if err != nil {
+		return 0, err
+	}
+	documentIDs, err = r.walls.filterDocuments(ctx, r.db, r, userID, permissionType, documentIDs)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(documentIDs)), nil
 }
 
-// hasDirectPermission helper for GetUserDocuments
-func (r *ZanzibarPermissionRepository) hasDirectPermission(ctx context.Context, userID, documentID, permissionType string) bool {
-	var tuple model.RelationTuple
-	err := r.db.WithContext(ctx).
-		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
-			"document", documentID, permissionType, "user", userID).
-		First(&tuple).Error
-	return err == nil
+// superuserAttributeScope restricts a query over documents to those the attribute rule of
+// permissionType allows a superuser; a rule that does not translate to SQL is evaluated
+// on every live document
+func (r *ZanzibarPermissionRepository) superuserAttributeScope(ctx context.Context, userID, permissionType string) (func(*gorm.DB) *gorm.DB, error) {
+	return r.attributes.documentScope(ctx, r.db, userID, permissionType, "id", func() ([]string, error) {
+		var ids []string
+		if err := r.db.WithContext(ctx).Model(&model.Document{}).
+			Where("deleted_at IS NULL").
+			Pluck("id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to load documents: %w", err)
+		}
+		return ids, nil
+	})
 }
 
-// hasCustomerPermission helper for GetUserDocuments
-func (r *ZanzibarPermissionRepository) hasCustomerPermission(ctx context.Context, userID, documentID, permissionType string) bool {
-	var ownerTuple model.RelationTuple
-	err := r.db.WithContext(ctx).
-		Where("namespace = ? AND object_id = ? AND relation = ?", "document", documentID, "owner_customer").
-		First(&ownerTuple).Error
-	if err != nil {
-		return false
-	}
-
-	var followerTuple model.RelationTuple
-	err = r.db.WithContext(ctx).
-		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
-			"customer", ownerTuple.SubjectID, "follower", "user", userID).
-		First(&followerTuple).Error
-	return err == nil
+// accessibleDocuments holds the documents a non-superuser can access together
+// with every source that grants each of them, collected during expansion
+type accessibleDocuments struct {
+	ids       []string // Deduplicated, in discovery order
+	sources   map[string]model.PermissionSourceList
+	expiresAt map[string]*time.Time // Only documents whose every source is time-bound
 }
 
-// GrantDirectPermission grants direct permission using tuple
-func (r *ZanzibarPermissionRepository) GrantDirectPermission(ctx context.Context, userID, documentID, permissionType string) error {
-	tuple := &model.RelationTuple{
-		Namespace:        "document",
-		ObjectID:         documentID,
-		Relation:         permissionType,
-		SubjectNamespace: "user",
-		SubjectID:        userID,
+func newAccessibleDocuments() *accessibleDocuments {
+	return &accessibleDocuments{
+		sources:   make(map[string]model.PermissionSourceList),
+		expiresAt: make(map[string]*time.Time),
 	}
-
-	return r.db.WithContext(ctx).
-		Clauses(clause.OnConflict{
-			DoNothing: true,
-		}).
-		Create(tuple).Error
 }
 
-// RevokePermission revokes permission by deleting tuple
-func (r *ZanzibarPermissionRepository) RevokePermission(ctx context.Context, userID, documentID string) error {
-	return r.db.WithContext(ctx).
-		Where("namespace = ? AND object_id = ? AND subject_namespace = ? AND subject_id = ?",
-			"document", documentID, "user", userID).
-		Delete(&model.RelationTuple{}).Error
+// add records that sourceType/sourceID grants access to documentID until expiresAt
+// (nil never expires). The access lasts as long as its longest-lasting source.
+func (a *accessibleDocuments) add(documentID, sourceType, sourceID string, expiresAt *time.Time) {
+	list, ok := a.sources[documentID]
+	if !ok {
+		a.ids = append(a.ids, documentID)
+		if expiresAt != nil {
+			a.expiresAt[documentID] = expiresAt
+		}
+	} else if current := a.expiresAt[documentID]; outlasts(expiresAt, current) {
+		if expiresAt == nil {
+			delete(a.expiresAt, documentID)
+		} else {
+			a.expiresAt[documentID] = expiresAt
+		}
+	}
+	if !list.Contains(sourceType, sourceID) {
+		list.Add(sourceType, sourceID)
+		a.sources[documentID] = list
+	}
 }
 
-// AddCustomerFollower adds a follower tuple to customer
-func (r *ZanzibarPermissionRepository) AddCustomerFollower(ctx context.Context, customerID, userID string) error {
-	tuple := &model.RelationTuple{
-		Namespace:        "customer",
-		ObjectID:         customerID,
-		Relation:         "follower",
-		SubjectNamespace: "user",
-		SubjectID:        userID,
+// drop removes the documents in ids
+func (a *accessibleDocuments) drop(ids map[string]bool) {
+	if len(ids) == 0 {
+		return
+	}
+	kept := a.ids[:0]
+	for _, id := range a.ids {
+		if ids[id] {
+			delete(a.sources, id)
+			delete(a.expiresAt, id)
+			continue
+		}
+		kept = append(kept, id)
 	}
+	a.ids = kept
+}
 
-	return r.db.WithContext(ctx).
-		Clauses(clause.OnConflict{
-			DoNothing: true,
-		}).
-		Create(tuple).Error
+// accessibleDocumentIDs returns the deduplicated IDs of documents a non-superuser can access
+// through direct tuples, customer followings and the manager chain
+func (r *ZanzibarPermissionRepository) accessibleDocumentIDs(ctx context.Context, userID, permissionType string) ([]string, error) {
+	docs, err := r.accessibleDocuments(ctx, userID, permissionType)
+	if err != nil {
+		return nil, err
+	}
+	return docs.ids, nil
 }
 
-// RemoveCustomerFollower removes a follower from customer
-func (r *ZanzibarPermissionRepository) RemoveCustomerFollower(ctx context.Context, customerID, userID string) error {
-	return r.db.WithContext(ctx).
-		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
+// accessibleDocuments expands a non-superuser's access in a fixed number of queries
+// (plus one BFS level per management level). Sources use the expanded table's
+// conventions: direct (document), customer_follower (customer) and manager_chain
+// (the subordinate who owns or follows the document). Soft-deleted documents are dropped.
+func (r *ZanzibarPermissionRepository) accessibleDocuments(ctx context.Context, userID, permissionType string) (*accessibleDocuments, error) {
+	docs := newAccessibleDocuments()
+
+	// Path 1: Direct permissions
+	var direct []model.RelationTuple
+	if err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Scopes(unexpired, unconditional).
+		Select("object_id, expires_at").
+		Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
+			"document", permissionType, "user", userID).
+		Scan(&direct).Error; err != nil {
+		return nil, fmt.Errorf("failed to load direct permissions: %w", err)
+	}
+	for _, t := range direct {
+		docs.add(t.ObjectID, model.SourceTypeDirect, t.ObjectID, t.ExpiresAt)
+	}
+
+	// Path 2: Customer follower permissions
+	var following []model.RelationTuple
+	if err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Scopes(unexpired, unconditional).
+		Select("object_id, expires_at").
+		Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
+			"customer", "follower", "user", userID).
+		Scan(&following).Error; err != nil {
+		return nil, fmt.Errorf("failed to load customer followings: %w", err)
+	}
+
+	if len(following) > 0 {
+		customerIDs := make([]string, len(following))
+		followingEnds := make(map[string]*time.Time, len(following))
+		for i, t := range following {
+			customerIDs[i] = t.ObjectID
+			followingEnds[t.ObjectID] = t.ExpiresAt
+		}
+		customerDocs, err := r.customerDocuments(ctx, customerIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load customer documents: %w", err)
+		}
+		for _, t := range customerDocs {
+			docs.add(t.ObjectID, model.SourceTypeCustomerFollower, t.SubjectID,
+				earliestExpiry(t.ExpiresAt, followingEnds[t.SubjectID]))
+		}
+	}
+
+	// Path 3: Manager chain permissions (documents accessible by subordinates)
+	subordinateIDs, err := r.getAllSubordinates(ctx, userID, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(subordinateIDs) > 0 {
+		// 3.1: Documents directly owned by subordinates
+		var owned []model.RelationTuple
+		if err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+			Scopes(unexpired, unconditional).
+			Select("object_id, subject_id, expires_at").
+			Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
+				"document", "owner", "user", subordinateIDs).
+			Scan(&owned).Error; err != nil {
+			return nil, fmt.Errorf("failed to load subordinate documents: %w", err)
+		}
+		for _, t := range owned {
+			docs.add(t.ObjectID, model.SourceTypeManagerChain, t.SubjectID, t.ExpiresAt)
+		}
+
+		// 3.2: Documents accessible via subordinates' customer followings
+		var followings []model.RelationTuple
+		if err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+			Scopes(unexpired, unconditional).
+			Select("object_id, subject_id, expires_at").
+			Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
+				"customer", "follower", "user", subordinateIDs).
+			Scan(&followings).Error; err != nil {
+			return nil, fmt.Errorf("failed to load subordinate customer followings: %w", err)
+		}
+
+		if len(followings) > 0 {
+			followersOf := make(map[string][]model.RelationTuple) // customer -> followings of subordinates
+			for _, t := range followings {
+				followersOf[t.ObjectID] = append(followersOf[t.ObjectID], t)
+			}
+			subordinateCustomerIDs := make([]string, 0, len(followersOf))
+			for customerID := range followersOf {
+				subordinateCustomerIDs = append(subordinateCustomerIDs, customerID)
+			}
+
+			customerDocs, err := r.customerDocuments(ctx, subordinateCustomerIDs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load subordinate customer documents: %w", err)
+			}
+			for _, t := range customerDocs {
+				for _, f := range followersOf[t.SubjectID] {
+					docs.add(t.ObjectID, model.SourceTypeManagerChain, f.SubjectID, earliestExpiry(t.ExpiresAt, f.ExpiresAt))
+				}
+			}
+		}
+	}
+
+	deleted, err := deletedAmong(ctx, r.db, "documents", docs.ids)
+	if err != nil {
+		return nil, err
+	}
+	docs.drop(deleted)
+
+	return docs, nil
+}
+
+// customerDocuments returns the owner_customer tuples of customerIDs as (document, customer) pairs
+// with their end times
+func (r *ZanzibarPermissionRepository) customerDocuments(ctx context.Context, customerIDs []string) ([]model.RelationTuple, error) {
+	var tuples []model.RelationTuple
+	err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Scopes(unexpired, unconditional).
+		Select("object_id, subject_id, expires_at").
+		Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
+			"document", "owner_customer", "customer", customerIDs).
+		Scan(&tuples).Error
+	return tuples, err
+}
+
+// LookupDocuments streams the IDs of all documents a user can access, in batches of batchSize.
+// Batches are passed to yield in ascending ID order; returning an error from yield stops the lookup.
+func (r *ZanzibarPermissionRepository) LookupDocuments(ctx context.Context, userID, permissionType string, batchSize int, yield func(documentIDs []string) error) error {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	deleted, err := userDeleted(ctx, r.db, userID)
+	if err != nil || deleted {
+		return err
+	}
+
+	isSuperuser, err := r.checkSuperuserPermission(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if isSuperuser {
+		// Superuser: walk the live documents the attribute rule allows with keyset pagination
+		allowedByAttributes, err := r.superuserAttributeScope(ctx, userID, permissionType)
+		if err != nil {
+			return err
+		}
+		allowedByWalls, err := r.walls.documentScope(ctx, r.db, r, userID, permissionType, "id", nil)
+		if err != nil {
+			return err
+		}
+		lastID := ""
+		for {
+			var ids []string
+			if err := r.db.WithContext(ctx).Model(&model.Document{}).
+				Where("id > ? AND deleted_at IS NULL", lastID).
+				Scopes(allowedByAttributes, allowedByWalls).
+				Order("id ASC").
+				Limit(batchSize).
+				Pluck("id", &ids).Error; err != nil {
+				return fmt.Errorf("failed to lookup documents for superuser: %w", err)
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+			if err := yield(ids); err != nil {
+				return err
+			}
+			lastID = ids[len(ids)-1]
+		}
+	}
+
+	documentIDs, err := r.accessibleDocumentIDs(ctx, userID, permissionType)
+	if err != nil {
+		return err
+	}
+	documentIDs, err = r.attributes.filterDocuments(ctx, r.db, userID, permissionType, documentIDs)
+	if err != nil {
+		return err
+	}
+	documentIDs, err = r.walls.filterDocuments(ctx, r.db, r, userID, permissionType, documentIDs)
+	if err != nil {
+		return err
+	}
+	sort.Strings(documentIDs)
+
+	for start := 0; start < len(documentIDs); start += batchSize {
+		end := start + batchSize
+		if end > len(documentIDs) {
+			end = len(documentIDs)
+		}
+		if err := yield(documentIDs[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Expand returns the userset tree of users that hold permissionType on a document:
+// direct tuples, followers of the owning customer, managers of the owner and followers, and superusers.
+// Soft-deleted users are left out; a soft-deleted document has an empty tree.
+func (r *ZanzibarPermissionRepository) Expand(ctx context.Context, documentID, permissionType string) (*model.ExpandNode, error) {
+	root := &model.ExpandNode{
+		Kind: model.ExpandKindUnion,
+		Name: "document:" + documentID + "#" + permissionType,
+	}
+
+	deletedDocs, err := deletedAmong(ctx, r.db, "documents", []string{documentID})
+	if err != nil {
+		return nil, err
+	}
+	if deletedDocs[documentID] {
+		return root, nil
+	}
+
+	// Branch 1: Direct tuples
+	var directIDs []string
+	if err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Scopes(unexpired, unconditional).
+		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ?",
+			"document", documentID, permissionType, "user").
+		Order("subject_id").
+		Pluck("subject_id", &directIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to expand direct tuples: %w", err)
+	}
+	root.Children = append(root.Children, expandLeaf("document:"+documentID+"#"+permissionType, directIDs))
+
+	// Branch 2: Followers of the owning customer
+	var followerIDs []string
+	var ownerCustomer model.RelationTuple
+	err = r.db.WithContext(ctx).
+		Scopes(unexpired, unconditional).
+		Where("namespace = ? AND object_id = ? AND relation = ?", "document", documentID, "owner_customer").
+		First(&ownerCustomer).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load owning customer: %w", err)
+	}
+	if err == nil {
+		if err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+			Scopes(unexpired, unconditional).
+			Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ?",
+				"customer", ownerCustomer.SubjectID, "follower", "user").
+			Order("subject_id").
+			Pluck("subject_id", &followerIDs).Error; err != nil {
+			return nil, fmt.Errorf("failed to expand customer followers: %w", err)
+		}
+		root.Children = append(root.Children, expandLeaf("customer:"+ownerCustomer.SubjectID+"#follower", followerIDs))
+	}
+
+	// Branch 3: Managers of the document owner and of the customer followers
+	var ownerIDs []string
+	if err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Scopes(unexpired, unconditional).
+		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ?",
+			"document", documentID, "owner", "user").
+		Pluck("subject_id", &ownerIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load document owners: %w", err)
+	}
+	managerIDs, err := r.getAllManagers(ctx, append(ownerIDs, followerIDs...), 5)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(managerIDs)
+	root.Children = append(root.Children, expandLeaf("manager_chain", managerIDs))
+
+	// Branch 4: Superusers
+	var superuserIDs []string
+	if err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Scopes(unexpired, unconditional).
+		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ?",
+			"system", "root", "admin", "user").
+		Order("subject_id").
+		Pluck("subject_id", &superuserIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to expand superusers: %w", err)
+	}
+	root.Children = append(root.Children, expandLeaf("system:root#admin", superuserIDs))
+
+	if err := r.dropDeletedSubjects(ctx, root); err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// dropDeletedSubjects removes soft-deleted users from the leaves of an expand tree
+func (r *ZanzibarPermissionRepository) dropDeletedSubjects(ctx context.Context, root *model.ExpandNode) error {
+	var userIDs []string
+	for _, leaf := range root.Children {
+		for _, subject := range leaf.Subjects {
+			userIDs = append(userIDs, strings.TrimPrefix(subject, "user:"))
+		}
+	}
+	deleted, err := deletedAmong(ctx, r.db, "users", uniqueStrings(userIDs))
+	if err != nil || len(deleted) == 0 {
+		return err
+	}
+
+	for _, leaf := range root.Children {
+		kept := leaf.Subjects[:0]
+		for _, subject := range leaf.Subjects {
+			if !deleted[strings.TrimPrefix(subject, "user:")] {
+				kept = append(kept, subject)
+			}
+		}
+		leaf.Subjects = kept
+	}
+	return nil
+}
+
+// LookupSubjects returns the sorted IDs of all users that hold permissionType on a document
+func (r *ZanzibarPermissionRepository) LookupSubjects(ctx context.Context, documentID, permissionType string) ([]string, error) {
+	tree, err := r.Expand(ctx, documentID, permissionType)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	userIDs := make([]string, 0)
+	for _, leaf := range tree.Children {
+		for _, subject := range leaf.Subjects {
+			userID := strings.TrimPrefix(subject, "user:")
+			if !seen[userID] {
+				seen[userID] = true
+				userIDs = append(userIDs, userID)
+			}
+		}
+	}
+	sort.Strings(userIDs)
+
+	return userIDs, nil
+}
+
+// expandLeaf builds a leaf node of user subjects
+func expandLeaf(name string, userIDs []string) *model.ExpandNode {
+	subjects := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		subjects[i] = "user:" + id
+	}
+	return &model.ExpandNode{
+		Kind:     model.ExpandKindLeaf,
+		Name:     name,
+		Subjects: subjects,
+	}
+}
+
+// getAllManagers walks the management chain upwards from the given users with BFS.
+// It is the reverse of getAllSubordinates: department#member -> department#parent -> department#manager.
+func (r *ZanzibarPermissionRepository) getAllManagers(ctx context.Context, userIDs []string, maxDepth int) ([]string, error) {
+	allManagerIDs := make([]string, 0)
+	visited := make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		visited[id] = true
+	}
+	currentUsers := userIDs
+
+	for depth := 0; depth < maxDepth; depth++ {
+		if len(currentUsers) == 0 {
+			break
+		}
+
+		// Step 1: Find all departments these users are members of
+		var deptIDs []string
+		err := r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+			Scopes(unexpired, unconditional).
+			Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
+				"department", "member", "user", currentUsers).
+			Pluck("object_id", &deptIDs).Error
+		if err != nil {
+			return nil, err
+		}
+
+		if len(deptIDs) == 0 {
+			break
+		}
+
+		// Managers of parent departments inherit authority over the subtree
+		deptIDs, err = relatedDepartments(ctx, r.db, deptIDs, true, departmentParentMaxDepth)
+		if err != nil {
+			return nil, err
+		}
+
+		// Step 2: Find the managers of these departments
+		var managerIDs []string
+		err = r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+			Scopes(unexpired, unconditional).
+			Where("namespace = ? AND object_id IN ? AND relation = ? AND subject_namespace = ?",
+				"department", deptIDs, "manager", "user").
+			Pluck("subject_id", &managerIDs).Error
+		if err != nil {
+			return nil, err
+		}
+
+		// Step 3: Filter out already visited managers and prepare for next level
+		nextUsers := make([]string, 0)
+		for _, id := range managerIDs {
+			if !visited[id] {
+				visited[id] = true
+				allManagerIDs = append(allManagerIDs, id)
+				nextUsers = append(nextUsers, id)
+			}
+		}
+		currentUsers = nextUsers
+	}
+
+	return allManagerIDs, nil
+}
+
+// getAllSubordinates gets all subordinates of a manager using RelationTuple with BFS to avoid N+1 queries
+// This implements the Zanzibar way: department#manager manages department#member,
+// including the members of departments linked below it through department#parent
+func (r *ZanzibarPermissionRepository) getAllSubordinates(ctx context.Context, managerUserID string, maxDepth int) ([]string, error) {
+	subordinateIDs, _, err := r.collectSubordinates(ctx, managerUserID, maxDepth, 0)
+	return subordinateIDs, err
+}
+
+// collectSubordinates runs the BFS of getAllSubordinates. With a positive limit it
+// stops after the level on which the subordinate count exceeds limit and reports
+// the result as truncated.
+func (r *ZanzibarPermissionRepository) collectSubordinates(ctx context.Context, managerUserID string, maxDepth, limit int) ([]string, bool, error) {
+	allSubordinateIDs := make([]string, 0)
+	visited := map[string]bool{managerUserID: true}
+	currentManagers := []string{managerUserID}
+
+	for depth := 0; depth < maxDepth; depth++ {
+		if len(currentManagers) == 0 {
+			break
+		}
+
+		levelCtx, span := tracer.Start(ctx, "zanzibar.subordinates.level", trace.WithAttributes(
+			attribute.Int("depth", depth+1),
+			attribute.Int("managers", len(currentManagers)),
+		))
+		managedDeptIDs, memberIDs, err := r.subordinateLevel(levelCtx, currentManagers)
+		if err != nil {
+			endSpan(span, err)
+			return nil, false, err
+		}
+
+		// Step 3: Filter out already visited members and prepare for next level
+		nextManagers := make([]string, 0)
+		for _, id := range memberIDs {
+			if !visited[id] {
+				visited[id] = true
+				allSubordinateIDs = append(allSubordinateIDs, id)
+				nextManagers = append(nextManagers, id)
+			}
+		}
+		currentManagers = nextManagers
+
+		endSpan(span, nil,
+			attribute.Int("departments", len(managedDeptIDs)),
+			attribute.Int("members", len(memberIDs)),
+			attribute.Int("subordinates.new", len(nextManagers)),
+			attribute.Int("subordinates.total", len(allSubordinateIDs)),
+		)
+		if len(managedDeptIDs) == 0 {
+			break
+		}
+		if limit > 0 && len(allSubordinateIDs) > limit {
+			return allSubordinateIDs, true, nil
+		}
+	}
+
+	return allSubordinateIDs, false, nil
+}
+
+// subordinateLevel runs one BFS level of getAllSubordinates: the departments
+// managed by managers (including the departments below them) and their members
+func (r *ZanzibarPermissionRepository) subordinateLevel(ctx context.Context, managers []string) (managedDeptIDs, memberIDs []string, err error) {
+	// Step 1: Find all departments where these users are managers
+	err = r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Scopes(unexpired, unconditional).
+		Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
+			"department", "manager", "user", managers).
+		Pluck("object_id", &managedDeptIDs).Error
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(managedDeptIDs) == 0 {
+		return nil, nil, nil
+	}
+
+	// A manager also manages every department below the managed one
+	managedDeptIDs, err = relatedDepartments(ctx, r.db, managedDeptIDs, false, departmentParentMaxDepth)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Step 2: Find all members of these departments
+	err = r.db.WithContext(ctx).Model(&model.RelationTuple{}).
+		Scopes(unexpired, unconditional).
+		Where("namespace = ? AND object_id IN ? AND relation = ? AND subject_namespace = ?",
+			"department", managedDeptIDs, "member", "user").
+		Pluck("subject_id", &memberIDs).Error
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return managedDeptIDs, memberIDs, nil
+}
+
+// GrantDirectPermission grants direct permission using tuple
+func (r *ZanzibarPermissionRepository) GrantDirectPermission(ctx context.Context, userID, documentID, permissionType string) error {
+	return r.GrantDirectPermissionUntil(ctx, userID, documentID, permissionType, nil)
+}
+
+// RevokePermission revokes permission by deleting tuple
+func (r *ZanzibarPermissionRepository) RevokePermission(ctx context.Context, userID, documentID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "revoke_permission")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.revoke_permission")
+	defer func() { endSpan(span, err) }()
+
+	if err := r.db.WithContext(ctx).
+		Where("namespace = ? AND object_id = ? AND subject_namespace = ? AND subject_id = ?",
+			"document", documentID, "user", userID).
+		Delete(&model.RelationTuple{}).Error; err != nil {
+		return err
+	}
+
+	r.notifyTupleChange(ctx, model.RelationTuple{
+		Namespace:        "document",
+		ObjectID:         documentID,
+		SubjectNamespace: "user",
+		SubjectID:        userID,
+	})
+	return nil
+}
+
+// AddCustomerFollower adds a follower tuple to customer
+// With ethical walls a follower of a competing customer is refused with ErrCustomerConflict
+// unless ctx carries a conflict override
+func (r *ZanzibarPermissionRepository) AddCustomerFollower(ctx context.Context, customerID, userID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "add_customer_follower")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.add_customer_follower")
+	defer func() { endSpan(span, err) }()
+
+	if err := r.walls.guardFollow(ctx, r.db, r, customerID, userID); err != nil {
+		return err
+	}
+
+	tuple := &model.RelationTuple{
+		Namespace:        "customer",
+		ObjectID:         customerID,
+		Relation:         "follower",
+		SubjectNamespace: "user",
+		SubjectID:        userID,
+	}
+
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			DoNothing: true,
+		}).
+		Create(tuple).Error; err != nil {
+		return err
+	}
+
+	r.notifyTupleChange(ctx, *tuple)
+	return nil
+}
+
+// RemoveCustomerFollower removes a follower from customer
+func (r *ZanzibarPermissionRepository) RemoveCustomerFollower(ctx context.Context, customerID, userID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "remove_customer_follower")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.remove_customer_follower")
+	defer func() { endSpan(span, err) }()
+
+	if err := r.db.WithContext(ctx).
+		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
 			"customer", customerID, "follower", "user", userID).
-		Delete(&model.RelationTuple{}).Error
+		Delete(&model.RelationTuple{}).Error; err != nil {
+		return err
+	}
+
+	r.notifyTupleChange(ctx, model.RelationTuple{
+		Namespace:        "customer",
+		ObjectID:         customerID,
+		Relation:         "follower",
+		SubjectNamespace: "user",
+		SubjectID:        userID,
+	})
+	return nil
 }
 
 // UpdateDepartmentManager updates department manager - SINGLE TUPLE UPDATE!
-func (r *ZanzibarPermissionRepository) UpdateDepartmentManager(ctx context.Context, departmentID, newManagerID string) error {
-	// Delete old manager tuple
-	r.db.WithContext(ctx).
-		Where("namespace = ? AND object_id = ? AND relation = ?", "department", departmentID, "manager").
-		Delete(&model.RelationTuple{})
+func (r *ZanzibarPermissionRepository) UpdateDepartmentManager(ctx context.Context, departmentID, newManagerID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "update_department_manager")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.update_department_manager")
+	defer func() { endSpan(span, err) }()
 
-	// Add new manager tuple
-	tuple := &model.RelationTuple{
+	tuple := model.RelationTuple{
 		Namespace:        "department",
 		ObjectID:         departmentID,
 		Relation:         "manager",
@@ -794,11 +1579,303 @@ func (r *ZanzibarPermissionRepository) UpdateDepartmentManager(ctx context.Conte
 		SubjectID:        newManagerID,
 	}
 
-	return r.db.WithContext(ctx).Create(tuple).Error
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Delete old manager tuple
+		if err := tx.
+			Where("namespace = ? AND object_id = ? AND relation = ?", "department", departmentID, "manager").
+			Delete(&model.RelationTuple{}).Error; err != nil {
+			return fmt.Errorf("failed to delete old manager tuple: %w", err)
+		}
+
+		// Add new manager tuple
+		newTuple := tuple
+		if err := tx.Create(&newTuple).Error; err != nil {
+			return fmt.Errorf("failed to create manager tuple: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.notifyTupleChange(ctx, tuple)
+	return nil
+}
+
+// WriteTuples applies a list of tuple updates atomically in a single transaction.
+// All preconditions are evaluated first (with row locks); if any of them fails the
+// whole write is aborted and ErrPreconditionFailed is returned.
+func (r *ZanzibarPermissionRepository) WriteTuples(ctx context.Context, updates []model.TupleUpdate, preconditions []model.TuplePrecondition) (_ *model.WriteTuplesResult, err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "write_tuples")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.write_tuples")
+	defer func() { endSpan(span, err) }()
+	metrics.BatchSize.WithLabelValues("write_tuples").Observe(float64(len(updates)))
+
+	startTime := time.Now()
+
+	if err := validateTupleWrite(updates, preconditions); err != nil {
+		return nil, err
+	}
+	if err := r.validateCaveats(updates); err != nil {
+		return nil, err
+	}
+
+	result := &model.WriteTuplesResult{}
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Step 1: Evaluate preconditions
+		for _, p := range preconditions {
+			var count int64
+			if err := tx.Model(&model.RelationTuple{}).
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Scopes(tupleKey(&p.Tuple)).
+				Count(&count).Error; err != nil {
+				return fmt.Errorf("failed to evaluate precondition: %w", err)
+			}
+
+			exists := count > 0
+			if (p.Operation == model.PreconditionMustExist && !exists) ||
+				(p.Operation == model.PreconditionMustNotExist && exists) {
+				return fmt.Errorf("%w: %s %s", ErrPreconditionFailed, p.Operation, p.Tuple.Text())
+			}
+		}
+
+		// Step 2: Apply updates in order
+		for i := range updates {
+			tuple := updates[i].Tuple
+			tuple.ID = 0
+			tuple.ExpiresAt = truncateExpiry(tuple.ExpiresAt)
+			if tuple.CaveatContext != nil {
+				canonical, _ := model.CanonicalCaveatContext(*tuple.CaveatContext) // validated above
+				tuple.CaveatContext = &canonical
+			}
+
+			switch updates[i].Operation {
+			case model.TupleOperationCreate:
+				res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tuple)
+				if res.Error != nil {
+					return fmt.Errorf("failed to create tuple: %w", res.Error)
+				}
+				if res.RowsAffected == 0 {
+					return fmt.Errorf("%w: %s", ErrTupleAlreadyExists, tuple.Text())
+				}
+				result.Created++
+
+			case model.TupleOperationTouch:
+				// A touch without an expiry keeps the one already on the tuple
+				columns := []string{"userset_namespace", "userset_relation", "caveat_name", "caveat_context", "updated_at"}
+				if tuple.ExpiresAt != nil {
+					columns = append(columns, "expires_at")
+				}
+				if err := tx.Clauses(clause.OnConflict{
+					DoUpdates: clause.AssignmentColumns(columns),
+				}).Create(&tuple).Error; err != nil {
+					return fmt.Errorf("failed to touch tuple: %w", err)
+				}
+				result.Touched++
+
+			case model.TupleOperationDelete:
+				res := tx.Scopes(tupleKey(&tuple)).Delete(&model.RelationTuple{})
+				if res.Error != nil {
+					return fmt.Errorf("failed to delete tuple: %w", res.Error)
+				}
+				result.Deleted += int(res.RowsAffected)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make([]model.RelationTuple, 0, len(updates))
+	for _, u := range updates {
+		changed = append(changed, u.Tuple)
+	}
+	r.notifyTupleChange(ctx, changed...)
+
+	result.DurationMs = float64(time.Since(startTime).Microseconds()) / 1000.0
+	return result, nil
+}
+
+// ReadTuples returns the tuples matching filter, ordered by id.
+// Pagination is keyset based: pass the NextPageToken of the previous page to continue.
+func (r *ZanzibarPermissionRepository) ReadTuples(ctx context.Context, filter model.TupleFilter, pageToken string, limit int) (*model.TupleList, error) {
+	startTime := time.Now()
+
+	if limit <= 0 {
+		limit = defaultTuplePageSize
+	}
+	if limit > maxTuplePageSize {
+		limit = maxTuplePageSize
+	}
+
+	afterID, err := decodeTuplePageToken(pageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra row to know whether another page exists
+	tuples := make([]model.RelationTuple, 0, limit+1)
+	if r.encoded != nil && !r.encoded.Stale() {
+		if tuples, err = r.encoded.readTuples(ctx, filter, afterID, limit+1); err != nil {
+			return nil, err
+		}
+	} else {
+		query := r.db.WithContext(ctx).Model(&model.RelationTuple{}).Scopes(tupleFilter(filter))
+		if afterID > 0 {
+			query = query.Where("id > ?", afterID)
+		}
+		if err := query.Order("id ASC").Limit(limit + 1).Find(&tuples).Error; err != nil {
+			return nil, fmt.Errorf("failed to read tuples: %w", err)
+		}
+	}
+
+	result := &model.TupleList{Tuples: tuples}
+	if len(tuples) > limit {
+		result.Tuples = tuples[:limit]
+		result.NextPageToken = encodeTuplePageToken(tuples[limit-1].ID)
+	}
+
+	result.DurationMs = float64(time.Since(startTime).Microseconds()) / 1000.0
+	return result, nil
+}
+
+// tupleFilter scopes a query to the non-empty fields of filter
+func tupleFilter(filter model.TupleFilter) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filter.Namespace != "" {
+			db = db.Where("namespace = ?", filter.Namespace)
+		}
+		if filter.ObjectID != "" {
+			db = db.Where("object_id = ?", filter.ObjectID)
+		}
+		if filter.Relation != "" {
+			db = db.Where("relation = ?", filter.Relation)
+		}
+		if filter.SubjectNamespace != "" {
+			db = db.Where("subject_namespace = ?", filter.SubjectNamespace)
+		}
+		if filter.SubjectID != "" {
+			db = db.Where("subject_id = ?", filter.SubjectID)
+		}
+		if filter.UsersetNamespace != "" {
+			db = db.Where("userset_namespace = ?", filter.UsersetNamespace)
+		}
+		if filter.UsersetRelation != "" {
+			db = db.Where("userset_relation = ?", filter.UsersetRelation)
+		}
+		return db
+	}
+}
+
+// encodeTuplePageToken builds an opaque page token from the last returned tuple id
+func encodeTuplePageToken(lastID int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(lastID, 10)))
+}
+
+// decodeTuplePageToken extracts the last returned tuple id from a page token
+func decodeTuplePageToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, ErrInvalidPageToken
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id < 0 {
+		return 0, ErrInvalidPageToken
+	}
+	return id, nil
+}
+
+// BulkInsertTuples inserts tuples in batches, skipping tuples that already exist.
+// It returns the number of newly inserted tuples.
+func (r *ZanzibarPermissionRepository) BulkInsertTuples(ctx context.Context, tuples []model.RelationTuple, batchSize int) (_ int64, err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "bulk_insert_tuples")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.bulk_insert_tuples")
+	defer func() { endSpan(span, err) }()
+	metrics.BatchSize.WithLabelValues("bulk_insert_tuples").Observe(float64(len(tuples)))
+
+	if len(tuples) == 0 {
+		return 0, nil
+	}
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			DoNothing: true,
+		}).
+		CreateInBatches(tuples, batchSize)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to bulk insert tuples: %w", result.Error)
+	}
+
+	r.notifyTupleChange(ctx, tuples...)
+	return result.RowsAffected, nil
+}
+
+// validateTupleWrite checks operations and tuples of a WriteTuples call before touching the database
+func validateTupleWrite(updates []model.TupleUpdate, preconditions []model.TuplePrecondition) error {
+	seen := make(map[string]bool, len(updates))
+	for i := range updates {
+		switch updates[i].Operation {
+		case model.TupleOperationTouch, model.TupleOperationCreate, model.TupleOperationDelete:
+		default:
+			return fmt.Errorf("%w: unknown operation %q", ErrInvalidTuple, updates[i].Operation)
+		}
+		if err := updates[i].Tuple.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTuple, err)
+		}
+
+		// The same tuple may only be mutated once per write, otherwise the result depends on ordering
+		key := tupleKeyString(&updates[i].Tuple)
+		if seen[key] {
+			return fmt.Errorf("%w: duplicate update for %s", ErrInvalidTuple, key)
+		}
+		seen[key] = true
+	}
+
+	for i := range preconditions {
+		switch preconditions[i].Operation {
+		case model.PreconditionMustExist, model.PreconditionMustNotExist:
+		default:
+			return fmt.Errorf("%w: unknown precondition %q", ErrInvalidTuple, preconditions[i].Operation)
+		}
+		if err := preconditions[i].Tuple.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTuple, err)
+		}
+	}
+
+	return nil
+}
+
+// tupleKey scopes a query to the unique key of the given tuple
+func tupleKey(t *model.RelationTuple) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
+			t.Namespace, t.ObjectID, t.Relation, t.SubjectNamespace, t.SubjectID)
+	}
+}
+
+// tupleKeyString renders the unique key of a tuple (ignores userset columns)
+func tupleKeyString(t *model.RelationTuple) string {
+	return t.Namespace + ":" + t.ObjectID + "#" + t.Relation + "@" + t.SubjectNamespace + ":" + t.SubjectID
 }
 
 // AddUserToDepartment adds user to department
-func (r *ZanzibarPermissionRepository) AddUserToDepartment(ctx context.Context, userID, departmentID, role string, isPrimary bool) error {
+func (r *ZanzibarPermissionRepository) AddUserToDepartment(ctx context.Context, userID, departmentID, role string, isPrimary bool) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "add_user_to_department")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.add_user_to_department")
+	defer func() { endSpan(span, err) }()
+
 	// Add to user_departments table
 	userDept := &model.UserDepartment{
 		UserID:       userID,
@@ -824,15 +1901,25 @@ func (r *ZanzibarPermissionRepository) AddUserToDepartment(ctx context.Context,
 		SubjectID:        userID,
 	}
 
-	return r.db.WithContext(ctx).
+	if err := r.db.WithContext(ctx).
 		Clauses(clause.OnConflict{
 			DoNothing: true,
 		}).
-		Create(tuple).Error
+		Create(tuple).Error; err != nil {
+		return err
+	}
+
+	r.notifyTupleChange(ctx, *tuple)
+	return nil
 }
 
 // RemoveUserFromDepartment removes user from department
-func (r *ZanzibarPermissionRepository) RemoveUserFromDepartment(ctx context.Context, userID, departmentID string) error {
+func (r *ZanzibarPermissionRepository) RemoveUserFromDepartment(ctx context.Context, userID, departmentID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "remove_user_from_department")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.remove_user_from_department")
+	defer func() { endSpan(span, err) }()
+
 	// Delete from user_departments table
 	if err := r.db.WithContext(ctx).
 		Where("user_id = ? AND department_id = ?", userID, departmentID).
@@ -841,10 +1928,286 @@ func (r *ZanzibarPermissionRepository) RemoveUserFromDepartment(ctx context.Cont
 	}
 
 	// Delete membership tuple
-	return r.db.WithContext(ctx).
+	if err := r.db.WithContext(ctx).
 		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
 			"department", departmentID, "member", "user", userID).
-		Delete(&model.RelationTuple{}).Error
+		Delete(&model.RelationTuple{}).Error; err != nil {
+		return err
+	}
+
+	r.notifyTupleChange(ctx, model.RelationTuple{
+		Namespace:        "department",
+		ObjectID:         departmentID,
+		Relation:         "member",
+		SubjectNamespace: "user",
+		SubjectID:        userID,
+	})
+	return nil
+}
+
+// MoveDepartment moves a department and its subtree under newParentID, or to the root when
+// newParentID is empty. Levels are recalculated in the departments table and the
+// department#parent tuple is replaced, so inherited management follows the new tree.
+func (r *ZanzibarPermissionRepository) MoveDepartment(ctx context.Context, departmentID, newParentID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "move_department")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.move_department", trace.WithAttributes(
+		attribute.String("department.id", departmentID), attribute.String("department.target_id", newParentID)))
+	defer func() { endSpan(span, err) }()
+
+	var changed []model.RelationTuple
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Reject parent links that would close a loop in the tuple graph as well
+		if newParentID != "" {
+			below, err := relatedDepartments(ctx, tx, []string{departmentID}, false, maxDepartmentLevel)
+			if err != nil {
+				return err
+			}
+			for _, id := range below {
+				if id == newParentID {
+					return fmt.Errorf("%w: %s is below %s", ErrDepartmentCycle, newParentID, departmentID)
+				}
+			}
+		}
+
+		if _, err := moveDepartmentRow(ctx, tx, departmentID, newParentID); err != nil {
+			return err
+		}
+
+		// Replace the parent tuple
+		var oldTuples []model.RelationTuple
+		if err := tx.Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ?",
+			"department", departmentID, "parent", "department").
+			Find(&oldTuples).Error; err != nil {
+			return fmt.Errorf("failed to find parent tuple: %w", err)
+		}
+		if len(oldTuples) > 0 {
+			if err := tx.Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ?",
+				"department", departmentID, "parent", "department").
+				Delete(&model.RelationTuple{}).Error; err != nil {
+				return fmt.Errorf("failed to delete parent tuple: %w", err)
+			}
+			changed = append(changed, oldTuples...)
+		}
+
+		if newParentID != "" {
+			tuple := model.RelationTuple{
+				Namespace:        "department",
+				ObjectID:         departmentID,
+				Relation:         "parent",
+				SubjectNamespace: "department",
+				SubjectID:        newParentID,
+			}
+			if err := tx.Create(&tuple).Error; err != nil {
+				return fmt.Errorf("failed to create parent tuple: %w", err)
+			}
+			changed = append(changed, tuple)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.notifyTupleChange(ctx, changed...)
+	return nil
+}
+
+// MergeDepartments merges sourceID into targetID: member tuples, the parent tuples of child
+// departments and userset grants to department:<source>#member on other objects are re-pointed
+// to the target, and the source's tuples are removed. The departments and user_departments
+// tables are updated in the same transaction.
+func (r *ZanzibarPermissionRepository) MergeDepartments(ctx context.Context, sourceID, targetID string) (_ *model.ReorgResult, err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "merge_departments")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.merge_departments", trace.WithAttributes(
+		attribute.String("department.id", sourceID), attribute.String("department.target_id", targetID)))
+	defer func() { endSpan(span, err) }()
+
+	startTime := time.Now()
+	result := &model.ReorgResult{
+		Operation:          model.ReorgOperationMerge,
+		DepartmentID:       sourceID,
+		TargetDepartmentID: targetID,
+	}
+	var changed []model.RelationTuple
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		merge, err := mergeDepartmentRows(ctx, tx, sourceID, targetID)
+		if err != nil {
+			return err
+		}
+		result.DepartmentsMoved = len(merge.ChildIDs)
+		result.RowsTouched += merge.RowsTouched
+
+		// Step 1: Re-point member tuples and the parent tuples of the children
+		var memberTuples []model.RelationTuple
+		if err := tx.Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ?",
+			"department", sourceID, "member", "user").
+			Find(&memberTuples).Error; err != nil {
+			return fmt.Errorf("failed to find member tuples: %w", err)
+		}
+		result.MembersMoved = len(memberTuples)
+
+		var childTuples []model.RelationTuple
+		if err := tx.Where("namespace = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
+			"department", "parent", "department", sourceID).
+			Find(&childTuples).Error; err != nil {
+			return fmt.Errorf("failed to find child department tuples: %w", err)
+		}
+
+		// Userset grants such as document:doc-1#viewer@department:<source>#member keep
+		// their relation, expiry and caveat and now name the target
+		var usersetTuples []model.RelationTuple
+		if err := tx.Where("namespace <> ? AND subject_namespace = ? AND subject_id = ?",
+			"department", "department", sourceID).
+			Find(&usersetTuples).Error; err != nil {
+			return fmt.Errorf("failed to find userset tuples: %w", err)
+		}
+
+		var inserts []model.RelationTuple
+		for _, t := range memberTuples {
+			inserts = append(inserts, model.RelationTuple{
+				Namespace: "department", ObjectID: targetID, Relation: "member",
+				SubjectNamespace: "user", SubjectID: t.SubjectID,
+			})
+		}
+		for _, t := range usersetTuples {
+			t.ID = 0
+			t.SubjectID = targetID
+			inserts = append(inserts, t)
+		}
+		for _, t := range childTuples {
+			inserts = append(inserts, model.RelationTuple{
+				Namespace: "department", ObjectID: t.ObjectID, Relation: "parent",
+				SubjectNamespace: "department", SubjectID: targetID,
+			})
+		}
+
+		// Step 2: Delete every tuple of the source department (members, manager, parent,
+		// children's links and userset grants naming it)
+		var sourceTuples []model.RelationTuple
+		if err := tx.Where("namespace = ? AND object_id = ?", "department", sourceID).
+			Or("subject_namespace = ? AND subject_id = ?", "department", sourceID).
+			Find(&sourceTuples).Error; err != nil {
+			return fmt.Errorf("failed to find source tuples: %w", err)
+		}
+		res := tx.Where("namespace = ? AND object_id = ?", "department", sourceID).
+			Or("subject_namespace = ? AND subject_id = ?", "department", sourceID).
+			Delete(&model.RelationTuple{})
+		if res.Error != nil {
+			return fmt.Errorf("failed to delete source tuples: %w", res.Error)
+		}
+		result.TuplesDeleted = res.RowsAffected
+		changed = append(changed, sourceTuples...)
+
+		if len(inserts) > 0 {
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(inserts, 1000)
+			if res.Error != nil {
+				return fmt.Errorf("failed to create merged tuples: %w", res.Error)
+			}
+			result.TuplesInserted = res.RowsAffected
+			changed = append(changed, inserts...)
+		}
+
+		// Step 3: Delete the source department row
+		res = tx.Where("id = ?", sourceID).Delete(&model.Department{})
+		if res.Error != nil {
+			return fmt.Errorf("failed to delete merged department: %w", res.Error)
+		}
+		result.RowsTouched += res.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.notifyTupleChange(ctx, changed...)
+	result.DurationMs = float64(time.Since(startTime).Microseconds()) / 1000.0
+	return result, nil
+}
+
+// SplitDepartment creates newDepartmentID next to departmentID and moves the member tuples of
+// memberIDs into it. The new department gets the source's parent tuple and, when managerID is
+// not empty, a manager tuple.
+func (r *ZanzibarPermissionRepository) SplitDepartment(ctx context.Context, departmentID, newDepartmentID, newName, managerID string, memberIDs []string) (_ *model.ReorgResult, err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "split_department")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.split_department", trace.WithAttributes(
+		attribute.String("department.id", departmentID), attribute.String("department.target_id", newDepartmentID)))
+	defer func() { endSpan(span, err) }()
+
+	startTime := time.Now()
+	result := &model.ReorgResult{
+		Operation:          model.ReorgOperationSplit,
+		DepartmentID:       departmentID,
+		TargetDepartmentID: newDepartmentID,
+	}
+	var changed []model.RelationTuple
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		split, err := splitDepartmentRows(ctx, tx, departmentID, newDepartmentID, newName, managerID, memberIDs)
+		if err != nil {
+			return err
+		}
+		result.MembersMoved = len(split.MemberIDs)
+		result.RowsTouched += split.RowsTouched
+
+		// Step 1: Move the member tuples
+		for _, chunk := range chunkStrings(split.MemberIDs, maxInClauseSize) {
+			res := tx.Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id IN ?",
+				"department", departmentID, "member", "user", chunk).
+				Delete(&model.RelationTuple{})
+			if res.Error != nil {
+				return fmt.Errorf("failed to delete member tuples: %w", res.Error)
+			}
+			result.TuplesDeleted += res.RowsAffected
+		}
+
+		var inserts []model.RelationTuple
+		for _, userID := range split.MemberIDs {
+			changed = append(changed, model.RelationTuple{
+				Namespace: "department", ObjectID: departmentID, Relation: "member",
+				SubjectNamespace: "user", SubjectID: userID,
+			})
+			inserts = append(inserts, model.RelationTuple{
+				Namespace: "department", ObjectID: newDepartmentID, Relation: "member",
+				SubjectNamespace: "user", SubjectID: userID,
+			})
+		}
+
+		// Step 2: Place the new department in the tree and give it a manager
+		if split.ParentID != nil {
+			inserts = append(inserts, model.RelationTuple{
+				Namespace: "department", ObjectID: newDepartmentID, Relation: "parent",
+				SubjectNamespace: "department", SubjectID: *split.ParentID,
+			})
+		}
+		if split.ManagerID != nil {
+			inserts = append(inserts, model.RelationTuple{
+				Namespace: "department", ObjectID: newDepartmentID, Relation: "manager",
+				SubjectNamespace: "user", SubjectID: *split.ManagerID,
+			})
+		}
+
+		if len(inserts) > 0 {
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(inserts, 1000)
+			if res.Error != nil {
+				return fmt.Errorf("failed to create split tuples: %w", res.Error)
+			}
+			result.TuplesInserted = res.RowsAffected
+			changed = append(changed, inserts...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.notifyTupleChange(ctx, changed...)
+	result.DurationMs = float64(time.Since(startTime).Microseconds()) / 1000.0
+	return result, nil
 }
 
 // GetStorageStats returns storage statistics for Zanzibar tuples
@@ -889,6 +2252,22 @@ func (r *ZanzibarPermissionRepository) GetTupleStats(ctx context.Context) ([]map
 	return results, nil
 }
 
+// CountTuplesByRelation counts the stored tuples per namespace and relation
+func (r *ZanzibarPermissionRepository) CountTuplesByRelation(ctx context.Context) ([]model.TupleCount, error) {
+	var counts []model.TupleCount
+	err := r.db.WithContext(ctx).
+		Model(&model.RelationTuple{}).
+		Select("namespace, relation, COUNT(*) as count").
+		Group("namespace, relation").
+		Scan(&counts).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tuples by relation: %w", err)
+	}
+
+	return counts, nil
+}
+
 // sourcesToStrings converts PermissionSourceList to []string
 func sourcesToStrings(sources model.PermissionSourceList) []string {
 	result := make([]string, len(sources))
@@ -899,7 +2278,12 @@ func sourcesToStrings(sources model.PermissionSourceList) []string {
 }
 
 // GrantSuperuser grants superuser privileges to a user
-func (r *ZanzibarPermissionRepository) GrantSuperuser(ctx context.Context, userID string) error {
+func (r *ZanzibarPermissionRepository) GrantSuperuser(ctx context.Context, userID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "grant_superuser")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.grant_superuser")
+	defer func() { endSpan(span, err) }()
+
 	// Add superuser tuple
 	tuple := model.RelationTuple{
 		Namespace:        "system",
@@ -909,14 +2293,35 @@ func (r *ZanzibarPermissionRepository) GrantSuperuser(ctx context.Context, userI
 		SubjectID:        userID,
 	}
 
-	return r.db.WithContext(ctx).Create(&tuple).Error
+	if err := r.db.WithContext(ctx).Create(&tuple).Error; err != nil {
+		return err
+	}
+
+	r.notifyTupleChange(ctx, tuple)
+	return nil
 }
 
 // RevokeSuperuser revokes superuser privileges from a user
-func (r *ZanzibarPermissionRepository) RevokeSuperuser(ctx context.Context, userID string) error {
+func (r *ZanzibarPermissionRepository) RevokeSuperuser(ctx context.Context, userID string) (err error) {
+	ctx, done := metrics.TrackMutation(ctx, model.EngineZanzibar, "revoke_superuser")
+	defer done()
+	ctx, span := tracer.Start(ctx, "zanzibar.revoke_superuser")
+	defer func() { endSpan(span, err) }()
+
 	// Remove superuser tuple
-	return r.db.WithContext(ctx).
+	if err := r.db.WithContext(ctx).
 		Where("namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_id = ?",
 			"system", "root", "admin", "user", userID).
-		Delete(&model.RelationTuple{}).Error
+		Delete(&model.RelationTuple{}).Error; err != nil {
+		return err
+	}
+
+	r.notifyTupleChange(ctx, model.RelationTuple{
+		Namespace:        "system",
+		ObjectID:         "root",
+		Relation:         "admin",
+		SubjectNamespace: "user",
+		SubjectID:        userID,
+	})
+	return nil
 }
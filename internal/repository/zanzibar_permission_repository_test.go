@@ -0,0 +1,374 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
+)
+
+// TestZanzibarWriteTuples tests atomic tuple writes with preconditions
+func TestZanzibarWriteTuples(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewZanzibarPermissionRepository(db)
+	ctx := context.Background()
+
+	viewer := model.RelationTuple{Namespace: "document", ObjectID: "doc-write-1", Relation: "viewer", SubjectNamespace: "user", SubjectID: "user-write-1"}
+	editor := model.RelationTuple{Namespace: "document", ObjectID: "doc-write-1", Relation: "editor", SubjectNamespace: "user", SubjectID: "user-write-1"}
+	follower := model.RelationTuple{Namespace: "customer", ObjectID: "customer-write-1", Relation: "follower", SubjectNamespace: "user", SubjectID: "user-write-1"}
+
+	// Clean up leftovers from previous runs
+	for _, tuple := range []model.RelationTuple{viewer, editor, follower} {
+		db.Scopes(tupleKey(&tuple)).Delete(&model.RelationTuple{})
+	}
+
+	countTuple := func(tuple model.RelationTuple) int64 {
+		var count int64
+		db.Model(&model.RelationTuple{}).Scopes(tupleKey(&tuple)).Count(&count)
+		return count
+	}
+
+	// Step 1: Create two tuples atomically
+	result, err := repo.WriteTuples(ctx, []model.TupleUpdate{
+		{Operation: model.TupleOperationCreate, Tuple: viewer},
+		{Operation: model.TupleOperationTouch, Tuple: follower},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Created)
+	assert.Equal(t, 1, result.Touched)
+	assert.Equal(t, int64(1), countTuple(viewer))
+	assert.Equal(t, int64(1), countTuple(follower))
+
+	// Step 2: Failed precondition aborts the whole write
+	_, err = repo.WriteTuples(ctx, []model.TupleUpdate{
+		{Operation: model.TupleOperationCreate, Tuple: editor},
+		{Operation: model.TupleOperationDelete, Tuple: viewer},
+	}, []model.TuplePrecondition{
+		{Operation: model.PreconditionMustNotExist, Tuple: follower},
+	})
+	require.ErrorIs(t, err, ErrPreconditionFailed)
+	assert.Equal(t, int64(0), countTuple(editor), "Editor tuple must not be created when precondition fails")
+	assert.Equal(t, int64(1), countTuple(viewer), "Viewer tuple must survive when precondition fails")
+
+	// Step 3: Create on an existing tuple rolls back earlier updates in the same write
+	_, err = repo.WriteTuples(ctx, []model.TupleUpdate{
+		{Operation: model.TupleOperationCreate, Tuple: editor},
+		{Operation: model.TupleOperationCreate, Tuple: viewer},
+	}, nil)
+	require.ErrorIs(t, err, ErrTupleAlreadyExists)
+	assert.Equal(t, int64(0), countTuple(editor), "Editor tuple must be rolled back")
+
+	// Step 4: Passing precondition applies the write
+	result, err = repo.WriteTuples(ctx, []model.TupleUpdate{
+		{Operation: model.TupleOperationCreate, Tuple: editor},
+		{Operation: model.TupleOperationDelete, Tuple: viewer},
+	}, []model.TuplePrecondition{
+		{Operation: model.PreconditionMustExist, Tuple: follower},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Created)
+	assert.Equal(t, 1, result.Deleted)
+	assert.Equal(t, int64(1), countTuple(editor))
+	assert.Equal(t, int64(0), countTuple(viewer))
+
+	// Step 5: Invalid operations are rejected before touching the database
+	_, err = repo.WriteTuples(ctx, []model.TupleUpdate{
+		{Operation: model.TupleOperationDelete, Tuple: editor},
+		{Operation: model.TupleOperationTouch, Tuple: editor},
+	}, nil)
+	require.ErrorIs(t, err, ErrInvalidTuple)
+	assert.Equal(t, int64(1), countTuple(editor))
+
+	t.Logf("✅ Test passed! WriteTuples applies updates atomically with preconditions.")
+}
+
+// TestZanzibarReadTuples tests filtered tuple reads with keyset pagination
+func TestZanzibarReadTuples(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewZanzibarPermissionRepository(db)
+	ctx := context.Background()
+
+	db.Where("namespace = ? AND object_id = ?", "customer", "customer-read-1").Delete(&model.RelationTuple{})
+
+	updates := make([]model.TupleUpdate, 0, 5)
+	for _, userID := range []string{"user-read-1", "user-read-2", "user-read-3", "user-read-4", "user-read-5"} {
+		updates = append(updates, model.TupleUpdate{
+			Operation: model.TupleOperationTouch,
+			Tuple:     model.RelationTuple{Namespace: "customer", ObjectID: "customer-read-1", Relation: "follower", SubjectNamespace: "user", SubjectID: userID},
+		})
+	}
+	_, err := repo.WriteTuples(ctx, updates, nil)
+	require.NoError(t, err)
+
+	filter := model.TupleFilter{Namespace: "customer", ObjectID: "customer-read-1"}
+
+	// Walk all pages of size 2
+	seen := make([]string, 0, 5)
+	pageToken := ""
+	pages := 0
+	for {
+		page, err := repo.ReadTuples(ctx, filter, pageToken, 2)
+		require.NoError(t, err)
+		pages++
+		for _, tuple := range page.Tuples {
+			seen = append(seen, tuple.SubjectID)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, []string{"user-read-1", "user-read-2", "user-read-3", "user-read-4", "user-read-5"}, seen)
+
+	// Subject filter narrows the result
+	page, err := repo.ReadTuples(ctx, model.TupleFilter{Namespace: "customer", ObjectID: "customer-read-1", SubjectID: "user-read-3"}, "", 0)
+	require.NoError(t, err)
+	require.Len(t, page.Tuples, 1)
+	assert.Equal(t, "follower", page.Tuples[0].Relation)
+
+	// Garbage page tokens are rejected
+	_, err = repo.ReadTuples(ctx, filter, "not-a-token!", 2)
+	require.ErrorIs(t, err, ErrInvalidPageToken)
+
+	t.Logf("✅ Test passed! ReadTuples paginates %d tuples over %d pages.", len(seen), pages)
+}
+
+// TestZanzibarMoveDepartment tests that inherited management follows department#parent tuples
+func TestZanzibarMoveDepartment(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewZanzibarPermissionRepository(db)
+	ctx := context.Background()
+
+	deptIDs := []string{"zmove-hq-a", "zmove-hq-b", "zmove-team"}
+	db.Where("namespace = ? AND object_id IN ?", "department", deptIDs).Delete(&model.RelationTuple{})
+	db.Where("namespace = ? AND object_id = ?", "document", "zmove-doc-1").Delete(&model.RelationTuple{})
+
+	hqA := createTestDepartment(db, "zmove-hq-a", "HQ A", 1, nil)
+	hqB := createTestDepartment(db, "zmove-hq-b", "HQ B", 1, nil)
+	team := createTestDepartment(db, "zmove-team", "Team", 2, &hqA.ID)
+	db.Model(&model.Department{}).Where("id = ?", team.ID).Updates(map[string]interface{}{"parent_id": hqA.ID, "level": 2})
+
+	_, err := repo.BulkInsertTuples(ctx, []model.RelationTuple{
+		{Namespace: "department", ObjectID: hqA.ID, Relation: "manager", SubjectNamespace: "user", SubjectID: "zmove-manager-a"},
+		{Namespace: "department", ObjectID: hqB.ID, Relation: "manager", SubjectNamespace: "user", SubjectID: "zmove-manager-b"},
+		{Namespace: "department", ObjectID: team.ID, Relation: "parent", SubjectNamespace: "department", SubjectID: hqA.ID},
+		{Namespace: "department", ObjectID: team.ID, Relation: "member", SubjectNamespace: "user", SubjectID: "zmove-member"},
+		{Namespace: "document", ObjectID: "zmove-doc-1", Relation: "owner", SubjectNamespace: "user", SubjectID: "zmove-member"},
+	}, 100)
+	require.NoError(t, err)
+
+	canView := func(userID string) bool {
+		result, err := repo.CheckPermissionsBatch(ctx, userID, []string{"zmove-doc-1"}, "viewer")
+		require.NoError(t, err)
+		return result["zmove-doc-1"]
+	}
+
+	// Step 1: The parent department's manager inherits the team member
+	assert.True(t, canView("zmove-manager-a"))
+	assert.False(t, canView("zmove-manager-b"))
+
+	// Step 2: Move the team under HQ B
+	require.NoError(t, repo.MoveDepartment(ctx, team.ID, hqB.ID))
+	assert.False(t, canView("zmove-manager-a"), "Old parent's manager should lose access")
+	assert.True(t, canView("zmove-manager-b"), "New parent's manager should gain access")
+
+	var parents []string
+	db.Model(&model.RelationTuple{}).
+		Where("namespace = ? AND object_id = ? AND relation = ?", "department", team.ID, "parent").
+		Pluck("subject_id", &parents)
+	assert.Equal(t, []string{hqB.ID}, parents)
+
+	// Step 3: Cycles are rejected
+	err = repo.MoveDepartment(ctx, hqB.ID, team.ID)
+	assert.ErrorIs(t, err, ErrDepartmentCycle)
+
+	t.Logf("✅ Test passed! Team moved under %s", hqB.ID)
+}
+
+// TestZanzibarMergeAndSplitDepartments tests that merge and split re-point member and parent tuples
+func TestZanzibarMergeAndSplitDepartments(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewZanzibarPermissionRepository(db)
+	ctx := context.Background()
+
+	const splitID = "zreorg-split"
+	deptIDs := []string{"zreorg-parent", "zreorg-team", splitID}
+	db.Where("namespace = ? AND (object_id IN ? OR subject_id IN ?)", "department", deptIDs, deptIDs).Delete(&model.RelationTuple{})
+	db.Where("namespace = ? AND object_id = ?", "document", "zreorg-doc-1").Delete(&model.RelationTuple{})
+	db.Where("department_id = ?", splitID).Delete(&model.UserDepartment{})
+	db.Where("id = ?", splitID).Delete(&model.Department{})
+
+	parent := createTestDepartment(db, "zreorg-parent", "Parent", 1, nil)
+	team := createTestDepartment(db, "zreorg-team", "Team", 2, &parent.ID)
+	for _, userID := range []string{"zreorg-stay", "zreorg-leave"} {
+		createTestUser(db, userID, userID, userID+"@example.com")
+		db.Create(&model.UserDepartment{UserID: userID, DepartmentID: team.ID, Role: "member", IsPrimary: true})
+	}
+
+	_, err := repo.BulkInsertTuples(ctx, []model.RelationTuple{
+		{Namespace: "department", ObjectID: team.ID, Relation: "parent", SubjectNamespace: "department", SubjectID: parent.ID},
+		{Namespace: "department", ObjectID: team.ID, Relation: "manager", SubjectNamespace: "user", SubjectID: "zreorg-manager"},
+		{Namespace: "department", ObjectID: team.ID, Relation: "member", SubjectNamespace: "user", SubjectID: "zreorg-stay"},
+		{Namespace: "department", ObjectID: team.ID, Relation: "member", SubjectNamespace: "user", SubjectID: "zreorg-leave"},
+		{Namespace: "document", ObjectID: "zreorg-doc-1", Relation: "owner", SubjectNamespace: "user", SubjectID: "zreorg-leave"},
+	}, 100)
+	require.NoError(t, err)
+
+	canView := func(userID string) bool {
+		result, err := repo.CheckPermissionsBatch(ctx, userID, []string{"zreorg-doc-1"}, "viewer")
+		require.NoError(t, err)
+		return result["zreorg-doc-1"]
+	}
+
+	// Step 1: Split the leaving member into a sibling department with its own manager
+	split, err := repo.SplitDepartment(ctx, team.ID, splitID, "Split Team", "zreorg-new-manager", []string{"zreorg-leave"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), split.TuplesDeleted)
+	assert.Equal(t, int64(3), split.TuplesInserted, "member, parent and manager tuples")
+	assert.False(t, canView("zreorg-manager"))
+	assert.True(t, canView("zreorg-new-manager"))
+
+	// Step 2: Merge it back
+	merge, err := repo.MergeDepartments(ctx, splitID, team.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, merge.MembersMoved)
+	assert.Equal(t, int64(3), merge.TuplesDeleted)
+	assert.True(t, canView("zreorg-manager"))
+	assert.False(t, canView("zreorg-new-manager"))
+
+	var remaining int64
+	db.Model(&model.RelationTuple{}).Where("namespace = ? AND object_id = ?", "department", splitID).Count(&remaining)
+	assert.Equal(t, int64(0), remaining, "Merged department should have no tuples left")
+
+	t.Logf("✅ Test passed! Split wrote %d tuples, merge wrote %d tuples", split.TuplesDeleted+split.TuplesInserted, merge.TuplesDeleted+merge.TuplesInserted)
+}
+
+// TestZanzibarMergeDepartmentsUsersetGrants tests that merge re-points userset grants on
+// documents from department:<source>#member to the target, keeping expiry and caveat
+func TestZanzibarMergeDepartmentsUsersetGrants(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	repo := NewZanzibarPermissionRepository(db)
+	ctx := context.Background()
+
+	deptIDs := []string{"zmerge-source", "zmerge-target"}
+	docIDs := []string{"zmerge-doc-1", "zmerge-doc-2"}
+	db.Where("namespace = ? AND (object_id IN ? OR subject_id IN ?)", "department", deptIDs, deptIDs).Delete(&model.RelationTuple{})
+	db.Where("namespace = ? AND object_id IN ?", "document", docIDs).Delete(&model.RelationTuple{})
+	db.Where("department_id IN ?", deptIDs).Delete(&model.UserDepartment{})
+
+	source := createTestDepartment(db, deptIDs[0], "Merge Source", 1, nil)
+	target := createTestDepartment(db, deptIDs[1], "Merge Target", 1, nil)
+
+	department, member := "department", "member"
+	caveat := "business_hours"
+	expiresAt := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	_, err := repo.BulkInsertTuples(ctx, []model.RelationTuple{
+		{Namespace: "department", ObjectID: source.ID, Relation: "member", SubjectNamespace: "user", SubjectID: "zmerge-member"},
+		{Namespace: "document", ObjectID: docIDs[0], Relation: "viewer", SubjectNamespace: "department", SubjectID: source.ID,
+			UsersetNamespace: &department, UsersetRelation: &member},
+		{Namespace: "document", ObjectID: docIDs[1], Relation: "editor", SubjectNamespace: "department", SubjectID: source.ID,
+			UsersetNamespace: &department, UsersetRelation: &member, ExpiresAt: &expiresAt, CaveatName: &caveat},
+	}, 100)
+	require.NoError(t, err)
+
+	// Step 1: Merge the source into the target
+	merge, err := repo.MergeDepartments(ctx, source.ID, target.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), merge.TuplesDeleted, "member and both userset grants")
+	assert.Equal(t, int64(3), merge.TuplesInserted)
+
+	// Step 2: No tuple names the source any more
+	var remaining int64
+	db.Model(&model.RelationTuple{}).Where("subject_namespace = ? AND subject_id = ?", "department", source.ID).Count(&remaining)
+	assert.Equal(t, int64(0), remaining, "Userset grants should no longer name the merged department")
+
+	// Step 3: The grants name the target with their relation, expiry and caveat intact
+	var grants []model.RelationTuple
+	require.NoError(t, db.Where("namespace = ? AND object_id IN ?", "document", docIDs).Order("object_id").Find(&grants).Error)
+	require.Len(t, grants, 2)
+	for _, g := range grants {
+		assert.Equal(t, target.ID, g.SubjectID)
+		require.NotNil(t, g.UsersetRelation)
+		assert.Equal(t, "member", *g.UsersetRelation)
+	}
+	assert.Equal(t, "viewer", grants[0].Relation)
+	assert.Nil(t, grants[0].ExpiresAt)
+	assert.Equal(t, "editor", grants[1].Relation)
+	require.NotNil(t, grants[1].ExpiresAt)
+	assert.True(t, expiresAt.Equal(*grants[1].ExpiresAt))
+	require.NotNil(t, grants[1].CaveatName)
+	assert.Equal(t, caveat, *grants[1].CaveatName)
+
+	t.Logf("✅ Test passed! %d userset grants re-pointed to %s", len(grants), target.ID)
+}
+
+// TestZanzibarGetUserDocumentsSources tests that every source of a listed document is attributed
+// and that the number of queries does not depend on the page size
+func TestZanzibarGetUserDocumentsSources(t *testing.T) {
+	db := setupMySQLTestDB(t)
+	require.NoError(t, db.Use(metrics.GormPlugin{}))
+	repo := NewZanzibarPermissionRepository(db)
+	ctx := context.Background()
+
+	const (
+		managerID = "zsrc-manager"
+		memberID  = "zsrc-member"
+	)
+	docIDs := []string{"zsrc-doc-owned", "zsrc-doc-customer"}
+	db.Where("namespace = ? AND object_id IN ?", "document", docIDs).Delete(&model.RelationTuple{})
+	db.Where("subject_id IN ?", []string{managerID, memberID}).Delete(&model.RelationTuple{})
+	db.Where("namespace = ? AND object_id = ?", "department", "zsrc-team").Delete(&model.RelationTuple{})
+
+	createTestUser(db, managerID, "Source Manager", "zsrc-manager@test.com")
+	createTestUser(db, memberID, "Source Member", "zsrc-member@test.com")
+	customer := createTestCustomer(db, "zsrc-customer", "Source Customer")
+	createTestDocument(db, docIDs[0], "Owned", customer.ID, memberID)
+	createTestDocument(db, docIDs[1], "Customer", customer.ID, managerID)
+
+	_, err := repo.BulkInsertTuples(ctx, []model.RelationTuple{
+		{Namespace: "department", ObjectID: "zsrc-team", Relation: "manager", SubjectNamespace: "user", SubjectID: managerID},
+		{Namespace: "department", ObjectID: "zsrc-team", Relation: "member", SubjectNamespace: "user", SubjectID: memberID},
+		{Namespace: "document", ObjectID: docIDs[0], Relation: "owner", SubjectNamespace: "user", SubjectID: memberID},
+		{Namespace: "document", ObjectID: docIDs[0], Relation: "viewer", SubjectNamespace: "user", SubjectID: managerID},
+		{Namespace: "document", ObjectID: docIDs[1], Relation: "owner_customer", SubjectNamespace: "customer", SubjectID: customer.ID},
+		{Namespace: "customer", ObjectID: customer.ID, Relation: "follower", SubjectNamespace: "user", SubjectID: memberID},
+	}, 100)
+	require.NoError(t, err)
+
+	list := func(pageSize int) (*model.UserDocumentList, int64) {
+		countCtx, queries := metrics.WithQueryCounter(ctx)
+		result, err := repo.GetUserDocuments(countCtx, managerID, "viewer", 1, pageSize)
+		require.NoError(t, err)
+		return result, queries.Load()
+	}
+
+	// Step 1: Direct grant and manager chain both attributed, each with its subject
+	result, queriesFull := list(10)
+	require.Equal(t, int64(2), result.Total)
+
+	byID := make(map[string]model.DocumentListItem)
+	for _, doc := range result.Documents {
+		byID[doc.ID] = doc
+	}
+
+	owned := byID[docIDs[0]]
+	assert.Equal(t, model.SourceTypeDirect, owned.SourceType)
+	assert.True(t, owned.Sources.Contains(model.SourceTypeDirect, docIDs[0]))
+	assert.True(t, owned.Sources.Contains(model.SourceTypeManagerChain, memberID))
+
+	viaCustomer := byID[docIDs[1]]
+	assert.Equal(t, model.SourceTypeManagerChain, viaCustomer.SourceType)
+	assert.Equal(t, model.PermissionSourceList{{Type: model.SourceTypeManagerChain, SourceID: memberID}}, viaCustomer.Sources)
+
+	// Step 2: A smaller page issues the same number of queries
+	_, queriesSmall := list(1)
+	assert.Equal(t, queriesFull, queriesSmall)
+
+	t.Logf("✅ Test passed! %d queries per page", queriesFull)
+}
@@ -24,6 +24,7 @@ type BenchmarkSuite struct {
 	mysqlRepo         *repository.MySQLPermissionRepository
 	zanzibarRepo      *repository.ZanzibarPermissionRepository
 	results           []BenchmarkResult
+	bitmapIndex       *model.BitmapIndexStats // Set by category N for the summary report
 	mu                sync.Mutex
 	benchmarkID       int64
 }
@@ -169,6 +170,30 @@ func (b *BenchmarkSuite) RunAllBenchmarks(ctx context.Context, config BenchmarkC
 		return fmt.Errorf("category J failed: %w", err)
 	}
 
+	// Category K: Department Reparenting
+	fmt.Println("\n📊 Category K: Department Reparenting")
+	if err := b.runBenchmarkCategoryK(ctx, config); err != nil {
+		return fmt.Errorf("category K failed: %w", err)
+	}
+
+	// Category L: Department Merge and Split
+	fmt.Println("\n📊 Category L: Department Merge and Split")
+	if err := b.runBenchmarkCategoryL(ctx, config); err != nil {
+		return fmt.Errorf("category L failed: %w", err)
+	}
+
+	// Category M: Manager Chain Strategies
+	fmt.Println("\n📊 Category M: Manager Chain Strategies")
+	if err := b.runBenchmarkCategoryM(ctx, config); err != nil {
+		return fmt.Errorf("category M failed: %w", err)
+	}
+
+	// Category N: Bitmap Index
+	fmt.Println("\n📊 Category N: Bitmap Index")
+	if err := b.runBenchmarkCategoryN(ctx, config); err != nil {
+		return fmt.Errorf("category N failed: %w", err)
+	}
+
 	duration := time.Since(startTime)
 	fmt.Printf("\n✅ All benchmarks completed in %v\n", duration)
 
@@ -764,6 +789,285 @@ func (b *BenchmarkSuite) runBenchmarkCategoryJ(ctx context.Context, config Bench
 	return nil
 }
 
+// Category K: Department Reparenting
+func (b *BenchmarkSuite) runBenchmarkCategoryK(ctx context.Context, config BenchmarkConfig) error {
+	fmt.Println("   Testing: Move department subtree to a new parent")
+
+	// Pick a level-3 department and a different level-2 parent, so levels stay in range
+	var dept model.Department
+	if err := b.db.WithContext(ctx).Where("level = ? AND parent_id IS NOT NULL", 3).First(&dept).Error; err != nil {
+		fmt.Println("   ⚠️  No level-3 department found, skipping test")
+		return nil
+	}
+	oldParentID := *dept.ParentID
+
+	var newParent model.Department
+	if err := b.db.WithContext(ctx).Where("level = ? AND id <> ?", 2, oldParentID).First(&newParent).Error; err != nil {
+		fmt.Println("   ⚠️  No second level-2 department found, skipping test")
+		return nil
+	}
+
+	// Test MySQL: relations and manager_chain rows of the whole subtree are rebuilt
+	fmt.Println("   Testing MySQL: Move department...")
+	fmt.Println("   ⚠️  Warning: This rebuilds management relations and permissions of the subtree...")
+	mysqlTimes := make([]float64, 3) // Only 3 rounds for MySQL
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		err := b.mysqlRepo.MoveDepartment(ctx, dept.ID, newParent.ID)
+		duration := time.Since(start)
+		mysqlTimes[i] = float64(duration.Microseconds()) / 1000.0
+		b.recordResult("K", "move_department", "mysql", mysqlTimes[i], 0, err == nil, false)
+		fmt.Printf("   MySQL round %d completed in %v\n", i+1, duration)
+
+		// Move back for next round
+		_ = b.mysqlRepo.MoveDepartment(ctx, dept.ID, oldParentID)
+	}
+
+	// Test Zanzibar: a single department#parent tuple is replaced
+	fmt.Println("   Testing Zanzibar: Move department...")
+
+	zanzibarTimes := make([]float64, 10)
+	for i := 0; i < 10; i++ {
+		start := time.Now()
+		err := b.zanzibarRepo.MoveDepartment(ctx, dept.ID, newParent.ID)
+		duration := time.Since(start)
+		zanzibarTimes[i] = float64(duration.Microseconds()) / 1000.0
+		b.recordResult("K", "move_department", "zanzibar", zanzibarTimes[i], 2, err == nil, false)
+
+		// Move back
+		_ = b.zanzibarRepo.MoveDepartment(ctx, dept.ID, oldParentID)
+	}
+
+	b.printStats("MySQL: Move Department (3 rounds only)", mysqlTimes)
+	b.printStats("Zanzibar: Move Department", zanzibarTimes)
+
+	return nil
+}
+
+// Category L: Department Merge and Split
+func (b *BenchmarkSuite) runBenchmarkCategoryL(ctx context.Context, config BenchmarkConfig) error {
+	fmt.Println("   Testing: Split half of a department into a new one, then merge it back")
+
+	// Pick a level-3 department with enough members to split
+	var dept struct {
+		DepartmentID string
+		Members      int
+	}
+	b.db.WithContext(ctx).Raw(`
+		SELECT ud.department_id, COUNT(*) AS members
+		FROM user_departments ud
+		JOIN departments d ON d.id = ud.department_id
+		WHERE d.level = 3
+		GROUP BY ud.department_id
+		HAVING COUNT(*) >= 4
+		ORDER BY ud.department_id
+		LIMIT 1
+	`).Scan(&dept)
+	if dept.DepartmentID == "" {
+		fmt.Println("   ⚠️  No level-3 department with enough members found, skipping test")
+		return nil
+	}
+
+	var memberIDs []string
+	b.db.WithContext(ctx).Table("user_departments").
+		Where("department_id = ?", dept.DepartmentID).
+		Order("user_id").
+		Limit(dept.Members/2).
+		Pluck("user_id", &memberIDs)
+
+	type reorgRepo interface {
+		SplitDepartment(ctx context.Context, departmentID, newDepartmentID, newName, managerID string, memberIDs []string) (*model.ReorgResult, error)
+		MergeDepartments(ctx context.Context, sourceID, targetID string) (*model.ReorgResult, error)
+	}
+
+	run := func(engine string, repo reorgRepo, rounds int) ([]float64, []float64) {
+		splitTimes := make([]float64, 0, rounds)
+		mergeTimes := make([]float64, 0, rounds)
+		for i := 0; i < rounds; i++ {
+			newID := fmt.Sprintf("benchmark-split-%d-%d", time.Now().UnixNano(), i)
+
+			split, err := repo.SplitDepartment(ctx, dept.DepartmentID, newID, "Benchmark Split", memberIDs[0], memberIDs)
+			if err != nil {
+				fmt.Printf("   ⚠️  %s split failed: %v\n", engine, err)
+				b.recordResult("L", "split_department", engine, 0, 0, false, false)
+				return splitTimes, mergeTimes
+			}
+			splitTimes = append(splitTimes, split.DurationMs)
+			b.recordResult("L", "split_department", engine, split.DurationMs, int(split.Writes()), true, false)
+
+			// Merge back so every round starts from the same tree
+			merge, err := repo.MergeDepartments(ctx, newID, dept.DepartmentID)
+			if err != nil {
+				fmt.Printf("   ⚠️  %s merge failed: %v\n", engine, err)
+				b.recordResult("L", "merge_departments", engine, 0, 0, false, false)
+				return splitTimes, mergeTimes
+			}
+			mergeTimes = append(mergeTimes, merge.DurationMs)
+			b.recordResult("L", "merge_departments", engine, merge.DurationMs, int(merge.Writes()), true, false)
+
+			if i == 0 {
+				fmt.Printf("   %s write amplification: split %d writes, merge %d writes\n", engine, split.Writes(), merge.Writes())
+			}
+		}
+		return splitTimes, mergeTimes
+	}
+
+	// Test MySQL
+	fmt.Printf("   Testing MySQL: Split/merge %d of %d members...\n", len(memberIDs), dept.Members)
+	fmt.Println("   ⚠️  Warning: This rebuilds management relations and permissions of both departments...")
+	mysqlSplit, mysqlMerge := run("mysql", b.mysqlRepo, 3) // Only 3 rounds for MySQL
+
+	// Test Zanzibar
+	fmt.Println("   Testing Zanzibar: Split/merge...")
+	zanzibarSplit, zanzibarMerge := run("zanzibar", b.zanzibarRepo, 10)
+
+	b.printStats("MySQL: Split Department (3 rounds only)", mysqlSplit)
+	b.printStats("MySQL: Merge Departments (3 rounds only)", mysqlMerge)
+	b.printStats("Zanzibar: Split Department", zanzibarSplit)
+	b.printStats("Zanzibar: Merge Departments", zanzibarMerge)
+
+	return nil
+}
+
+// Category M: Manager Chain Strategies
+// Compares the level-by-level BFS with the single recursive CTE for managers at
+// different heights of the org chart: the higher the manager, the more subordinates
+// BFS has to ship back and forth.
+func (b *BenchmarkSuite) runBenchmarkCategoryM(ctx context.Context, config BenchmarkConfig) error {
+	fmt.Println("   Testing: Manager chain check with BFS vs recursive CTE")
+
+	var docs []model.Document
+	if err := b.db.WithContext(ctx).Limit(100).Find(&docs).Error; err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		fmt.Println("   ⚠️  No documents found, skipping test")
+		return nil
+	}
+
+	rounds := config.TestRounds / 10
+	if rounds < 10 {
+		rounds = 10
+	}
+
+	for level := 1; level <= 4; level++ {
+		var managerIDs []string
+		b.db.WithContext(ctx).Model(&model.Department{}).
+			Where("level = ? AND manager_id IS NOT NULL", level).
+			Order("id").
+			Limit(5).
+			Pluck("manager_id", &managerIDs)
+		if len(managerIDs) == 0 {
+			fmt.Printf("   ⚠️  No level-%d managers found, skipping level\n", level)
+			continue
+		}
+
+		operation := fmt.Sprintf("manager_chain_check_level_%d", level)
+		times := make(map[string][]float64, 2)
+		for _, strategy := range []string{repository.ManagerChainStrategyBFS, repository.ManagerChainStrategyCTE} {
+			strategyCtx := repository.WithManagerChainStrategy(ctx, strategy)
+			engine := "zanzibar_" + strategy
+			for i := 0; i < rounds; i++ {
+				managerID := managerIDs[i%len(managerIDs)]
+				doc := docs[i%len(docs)]
+
+				start := time.Now()
+				_, err := b.zanzibarRepo.CheckPermission(strategyCtx, managerID, doc.ID, "viewer")
+				duration := float64(time.Since(start).Microseconds()) / 1000.0
+				times[strategy] = append(times[strategy], duration)
+				b.recordResult("M", operation, engine, duration, 0, err == nil, false)
+			}
+		}
+
+		b.printStats(fmt.Sprintf("Zanzibar BFS: Level-%d Manager", level), times[repository.ManagerChainStrategyBFS])
+		b.printStats(fmt.Sprintf("Zanzibar CTE: Level-%d Manager", level), times[repository.ManagerChainStrategyCTE])
+	}
+
+	return nil
+}
+
+// Category N: Bitmap Index
+// Rebuilds an in-memory bitmap index of accessible documents, then compares batch
+// checks, document lists and counts served from it with the tuple expansion.
+func (b *BenchmarkSuite) runBenchmarkCategoryN(ctx context.Context, config BenchmarkConfig) error {
+	const indexedUsers = 1000
+
+	indexedRepo := repository.NewZanzibarPermissionRepository(b.db)
+	indexedRepo.UseBitmapIndex(repository.NewDocumentBitmapIndex(indexedUsers))
+
+	fmt.Printf("   Rebuilding bitmap index for up to %d users...\n", indexedUsers)
+	stats, err := indexedRepo.RebuildBitmapIndex(ctx, "viewer")
+	if err != nil {
+		return err
+	}
+	b.bitmapIndex = stats
+	b.recordResult("N", "rebuild_bitmap_index", "zanzibar_bitmap", stats.LastRebuildMs, stats.LastRebuildUsers, true, false)
+	fmt.Printf("   Rebuilt %d users in %.1f ms: %d documents, %.2f MB (bitmaps %.2f MB, dictionary %.2f MB)\n",
+		stats.LastRebuildUsers, stats.LastRebuildMs, stats.Documents,
+		float64(stats.MemoryBytes)/1024/1024, float64(stats.BitmapBytes)/1024/1024, float64(stats.DictionaryBytes)/1024/1024)
+
+	// Sample users inside the rebuilt set
+	var users []model.User
+	if err := b.db.WithContext(ctx).Order("id").Limit(10).Find(&users).Error; err != nil {
+		return err
+	}
+	var docs []model.Document
+	if err := b.db.WithContext(ctx).Limit(50).Find(&docs).Error; err != nil {
+		return err
+	}
+	if len(users) == 0 || len(docs) == 0 {
+		fmt.Println("   ⚠️  No users or documents found, skipping test")
+		return nil
+	}
+	docIDs := make([]string, len(docs))
+	for i, doc := range docs {
+		docIDs[i] = doc.ID
+	}
+
+	rounds := config.TestRounds / 10
+	if rounds < 10 {
+		rounds = 10
+	}
+
+	run := func(operation, engine string, fn func(userID string) error) []float64 {
+		times := make([]float64, rounds)
+		for i := 0; i < rounds; i++ {
+			start := time.Now()
+			err := fn(users[i%len(users)].ID)
+			times[i] = float64(time.Since(start).Microseconds()) / 1000.0
+			b.recordResult("N", operation, engine, times[i], 0, err == nil, engine == "zanzibar_bitmap")
+		}
+		return times
+	}
+
+	for _, engine := range []struct {
+		name string
+		repo *repository.ZanzibarPermissionRepository
+	}{{"zanzibar", b.zanzibarRepo}, {"zanzibar_bitmap", indexedRepo}} {
+		repo := engine.repo
+		fmt.Printf("   Testing %s...\n", engine.name)
+
+		batchTimes := run("batch_permission_check_50", engine.name, func(userID string) error {
+			_, err := repo.CheckPermissionsBatch(ctx, userID, docIDs, "viewer")
+			return err
+		})
+		listTimes := run("user_document_list", engine.name, func(userID string) error {
+			_, err := repo.GetUserDocuments(ctx, userID, "viewer", 1, 20)
+			return err
+		})
+		countTimes := run("user_document_count", engine.name, func(userID string) error {
+			_, err := repo.CountUserDocuments(ctx, userID, "viewer")
+			return err
+		})
+
+		b.printStats(engine.name+": Batch Check (50 docs)", batchTimes)
+		b.printStats(engine.name+": Document List", listTimes)
+		b.printStats(engine.name+": Document Count", countTimes)
+	}
+
+	return nil
+}
+
 // Helper functions
 
 func (b *BenchmarkSuite) recordResult(category, operation, engine string, durationMs float64, rowsAffected int, success, cacheHit bool) {
@@ -968,6 +1272,17 @@ func (b *BenchmarkSuite) generateSummaryReport(config BenchmarkConfig) error {
 		}
 	}
 
+	if b.bitmapIndex != nil {
+		file.WriteString("## Bitmap Index\n\n")
+		file.WriteString(fmt.Sprintf("- **Users**: %d\n", b.bitmapIndex.LastRebuildUsers))
+		file.WriteString(fmt.Sprintf("- **Documents**: %d\n", b.bitmapIndex.Documents))
+		file.WriteString(fmt.Sprintf("- **Rebuild Time**: %.3f ms\n", b.bitmapIndex.LastRebuildMs))
+		file.WriteString(fmt.Sprintf("- **Memory**: %.2f MB (bitmaps %.2f MB, dictionary %.2f MB)\n\n",
+			float64(b.bitmapIndex.MemoryBytes)/1024/1024,
+			float64(b.bitmapIndex.BitmapBytes)/1024/1024,
+			float64(b.bitmapIndex.DictionaryBytes)/1024/1024))
+	}
+
 	fmt.Printf("   📊 Summary Report: %s\n", filename)
 	return nil
 }
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/config"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
+)
+
+// cutoverBuckets is the resolution of the sticky percentage (0.01%)
+const cutoverBuckets = 10000
+
+// defaultRouteNamespace is the namespace of requests that do not carry one
+const defaultRouteNamespace = "document"
+
+// Reasons a request was routed to an engine, in precedence order
+const (
+	RouteReasonDisabled       = "disabled"
+	RouteReasonRolledBack     = "rolled_back"
+	RouteReasonDenyUser       = "deny_user"
+	RouteReasonAllowUser      = "allow_user"
+	RouteReasonDenyNamespace  = "deny_namespace"
+	RouteReasonAllowNamespace = "allow_namespace"
+	RouteReasonPercentage     = "percentage"
+)
+
+// CutoverRules decide which engine serves a request. Deny lists pin users or
+// namespaces to MySQL, allow lists pin them to Zanzibar, and everyone else is
+// routed to Zanzibar when their user ID hashes below ZanzibarPercent.
+type CutoverRules struct {
+	ZanzibarPercent float64  `json:"zanzibar_percent"`
+	AllowUsers      []string `json:"allow_users"`
+	DenyUsers       []string `json:"deny_users"`
+	AllowNamespaces []string `json:"allow_namespaces"`
+	DenyNamespaces  []string `json:"deny_namespaces"`
+}
+
+// CutoverRulesFromConfig converts the cutover config section into routing rules
+func CutoverRulesFromConfig(cfg config.CutoverConfig) CutoverRules {
+	return CutoverRules{
+		ZanzibarPercent: cfg.ZanzibarPercent,
+		AllowUsers:      cfg.AllowUsers,
+		DenyUsers:       cfg.DenyUsers,
+		AllowNamespaces: cfg.AllowNamespaces,
+		DenyNamespaces:  cfg.DenyNamespaces,
+	}
+}
+
+// Validate checks the percentage range
+func (r CutoverRules) Validate() error {
+	if r.ZanzibarPercent < 0 || r.ZanzibarPercent > 100 {
+		return fmt.Errorf("zanzibar_percent must be between 0 and 100, got %v", r.ZanzibarPercent)
+	}
+	return nil
+}
+
+// cutoverState is the immutable routing table swapped in on every change
+type cutoverState struct {
+	rules           CutoverRules
+	threshold       uint32
+	allowUsers      map[string]bool
+	denyUsers       map[string]bool
+	allowNamespaces map[string]bool
+	denyNamespaces  map[string]bool
+	rolledBack      bool
+	disabled        bool
+	updatedAt       time.Time
+}
+
+func newCutoverState(rules CutoverRules, rolledBack, disabled bool) *cutoverState {
+	return &cutoverState{
+		rules:           rules,
+		threshold:       uint32(rules.ZanzibarPercent * cutoverBuckets / 100),
+		allowUsers:      toSet(rules.AllowUsers),
+		denyUsers:       toSet(rules.DenyUsers),
+		allowNamespaces: toSet(rules.AllowNamespaces),
+		denyNamespaces:  toSet(rules.DenyNamespaces),
+		rolledBack:      rolledBack,
+		disabled:        disabled,
+		updatedAt:       time.Now(),
+	}
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// CutoverRouter sits in front of both repositories and picks the engine per
+// request. Routing is sticky: a user stays on the same engine while the
+// percentage only grows, so raising it moves users over without flapping.
+// Rules can be replaced at runtime and Rollback sends all traffic back to
+// MySQL instantly without losing the configured rules.
+type CutoverRouter struct {
+	mysqlRepo    *repository.MySQLPermissionRepository
+	zanzibarRepo *repository.ZanzibarPermissionRepository
+
+	state atomic.Pointer[cutoverState]
+	mu    sync.Mutex // Serializes rule changes
+
+	// Last cutover config section applied, so Reload can skip unchanged ones
+	configRules   CutoverRules
+	configEnabled bool
+
+	mysqlRequests    atomic.Int64
+	zanzibarRequests atomic.Int64
+	reasonMu         sync.Mutex
+	byReason         map[string]int64
+}
+
+// NewCutoverRouter creates a cutover router with the initial rules
+func NewCutoverRouter(
+	mysqlRepo *repository.MySQLPermissionRepository,
+	zanzibarRepo *repository.ZanzibarPermissionRepository,
+	rules CutoverRules,
+) (*CutoverRouter, error) {
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := &CutoverRouter{
+		mysqlRepo:     mysqlRepo,
+		zanzibarRepo:  zanzibarRepo,
+		configRules:   rules,
+		configEnabled: true,
+		byReason:      make(map[string]int64),
+	}
+	r.state.Store(newCutoverState(rules, false, false))
+	return r, nil
+}
+
+// Update replaces the routing rules. A rollback stays in effect until Resume,
+// so new rules can be staged while traffic is pinned to MySQL.
+func (r *CutoverRouter) Update(rules CutoverRules) error {
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.state.Load()
+	r.state.Store(newCutoverState(rules, previous.rolledBack, previous.disabled))
+
+	logger.Info("Cutover rules updated",
+		zap.Float64("previous_percent", previous.rules.ZanzibarPercent),
+		zap.Float64("zanzibar_percent", rules.ZanzibarPercent),
+		zap.Int("allow_users", len(rules.AllowUsers)),
+		zap.Int("deny_users", len(rules.DenyUsers)),
+		zap.Int("allow_namespaces", len(rules.AllowNamespaces)),
+		zap.Int("deny_namespaces", len(rules.DenyNamespaces)),
+	)
+	return nil
+}
+
+// Reload applies the cutover config section after the config file changed.
+// An unchanged section is ignored, so rules set at runtime through Update
+// survive edits to the rest of the file. Disabling cutover routes every
+// request to MySQL; the rollback flag is kept either way.
+func (r *CutoverRouter) Reload(cfg config.CutoverConfig) error {
+	rules := CutoverRulesFromConfig(cfg)
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cfg.Enabled == r.configEnabled && reflect.DeepEqual(rules, r.configRules) {
+		return nil
+	}
+	r.configRules, r.configEnabled = rules, cfg.Enabled
+
+	r.state.Store(newCutoverState(rules, r.state.Load().rolledBack, !cfg.Enabled))
+
+	logger.Info("Cutover config reloaded",
+		zap.Bool("enabled", cfg.Enabled),
+		zap.Float64("zanzibar_percent", rules.ZanzibarPercent),
+		zap.Int("allow_users", len(rules.AllowUsers)),
+		zap.Int("deny_users", len(rules.DenyUsers)),
+		zap.Int("allow_namespaces", len(rules.AllowNamespaces)),
+		zap.Int("deny_namespaces", len(rules.DenyNamespaces)),
+	)
+	return nil
+}
+
+// Rollback routes every request to MySQL until Resume is called
+func (r *CutoverRouter) Rollback() {
+	r.setRolledBack(true)
+	logger.Warn("Cutover rolled back, all traffic routed to MySQL")
+}
+
+// Resume re-applies the configured rules after a rollback
+func (r *CutoverRouter) Resume() {
+	r.setRolledBack(false)
+	logger.Info("Cutover resumed")
+}
+
+func (r *CutoverRouter) setRolledBack(rolledBack bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.state.Load()
+	r.state.Store(newCutoverState(s.rules, rolledBack, s.disabled))
+}
+
+// Route returns the engine that serves userID's request on namespace, and why
+func (r *CutoverRouter) Route(userID, namespace string) (engine, reason string) {
+	s := r.state.Load()
+
+	switch {
+	case s.disabled:
+		return model.EngineMySQL, RouteReasonDisabled
+	case s.rolledBack:
+		return model.EngineMySQL, RouteReasonRolledBack
+	case s.denyUsers[userID]:
+		return model.EngineMySQL, RouteReasonDenyUser
+	case s.allowUsers[userID]:
+		return model.EngineZanzibar, RouteReasonAllowUser
+	case s.denyNamespaces[namespace]:
+		return model.EngineMySQL, RouteReasonDenyNamespace
+	case s.allowNamespaces[namespace]:
+		return model.EngineZanzibar, RouteReasonAllowNamespace
+	case cutoverBucket(userID) < s.threshold:
+		return model.EngineZanzibar, RouteReasonPercentage
+	default:
+		return model.EngineMySQL, RouteReasonPercentage
+	}
+}
+
+// cutoverBucket hashes a user ID into [0, cutoverBuckets) with FNV-1a
+func cutoverBucket(userID string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	return h.Sum32() % cutoverBuckets
+}
+
+// pick routes a request and counts it towards the engine's traffic share
+func (r *CutoverRouter) pick(userID, namespace string) string {
+	engine, reason := r.Route(userID, namespace)
+
+	if engine == model.EngineZanzibar {
+		r.zanzibarRequests.Add(1)
+	} else {
+		r.mysqlRequests.Add(1)
+	}
+	metrics.EngineRequests.WithLabelValues("cutover", engine).Inc()
+
+	r.reasonMu.Lock()
+	r.byReason[engine+":"+reason]++
+	r.reasonMu.Unlock()
+
+	return engine
+}
+
+type routeNamespaceKey struct{}
+
+// WithRouteNamespace sets the namespace the cutover namespace rules see for
+// the request; requests without one are routed as the document namespace.
+func WithRouteNamespace(ctx context.Context, namespace string) context.Context {
+	if namespace == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, routeNamespaceKey{}, namespace)
+}
+
+func routeNamespace(ctx context.Context) string {
+	if namespace, ok := ctx.Value(routeNamespaceKey{}).(string); ok {
+		return namespace
+	}
+	return defaultRouteNamespace
+}
+
+// CheckPermission answers a document permission check from the routed engine
+func (r *CutoverRouter) CheckPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error) {
+	if r.pick(userID, routeNamespace(ctx)) == model.EngineZanzibar {
+		return r.zanzibarRepo.CheckPermission(ctx, userID, documentID, permissionType)
+	}
+	return r.mysqlRepo.CheckPermission(ctx, userID, documentID, permissionType)
+}
+
+// CheckPermissionsBatch checks many documents on the routed engine. Routing is
+// per user, so the whole batch is answered by one engine.
+func (r *CutoverRouter) CheckPermissionsBatch(ctx context.Context, userID string, documentIDs []string, permissionType string) (map[string]bool, error) {
+	if r.pick(userID, routeNamespace(ctx)) == model.EngineZanzibar {
+		return r.zanzibarRepo.CheckPermissionsBatch(ctx, userID, documentIDs, permissionType)
+	}
+	return r.mysqlRepo.CheckPermissionsBatch(ctx, userID, documentIDs, permissionType)
+}
+
+// LookupDocuments streams a user's documents from the routed engine
+func (r *CutoverRouter) LookupDocuments(ctx context.Context, userID, permissionType string, batchSize int, yield func(documentIDs []string) error) error {
+	if r.pick(userID, routeNamespace(ctx)) == model.EngineZanzibar {
+		return r.zanzibarRepo.LookupDocuments(ctx, userID, permissionType, batchSize, yield)
+	}
+	return r.mysqlRepo.LookupDocuments(ctx, userID, permissionType, batchSize, yield)
+}
+
+// GetUserDocuments lists a user's documents from the routed engine
+func (r *CutoverRouter) GetUserDocuments(ctx context.Context, userID, permissionType string, page, pageSize int) (*model.UserDocumentList, error) {
+	if r.pick(userID, routeNamespace(ctx)) == model.EngineZanzibar {
+		return r.zanzibarRepo.GetUserDocuments(ctx, userID, permissionType, page, pageSize)
+	}
+	return r.mysqlRepo.GetUserDocuments(ctx, userID, permissionType, page, pageSize)
+}
+
+// Stats returns the current rules and the per-engine traffic share since startup
+func (r *CutoverRouter) Stats() *model.CutoverStats {
+	s := r.state.Load()
+	mysqlRequests := r.mysqlRequests.Load()
+	zanzibarRequests := r.zanzibarRequests.Load()
+
+	stats := &model.CutoverStats{
+		Enabled:          !s.disabled,
+		ZanzibarPercent:  s.rules.ZanzibarPercent,
+		AllowUsers:       len(s.rules.AllowUsers),
+		DenyUsers:        len(s.rules.DenyUsers),
+		AllowNamespaces:  s.rules.AllowNamespaces,
+		DenyNamespaces:   s.rules.DenyNamespaces,
+		RolledBack:       s.rolledBack,
+		UpdatedAt:        s.updatedAt,
+		MySQLRequests:    mysqlRequests,
+		ZanzibarRequests: zanzibarRequests,
+		ByReason:         make(map[string]int64),
+	}
+	if total := mysqlRequests + zanzibarRequests; total > 0 {
+		stats.ZanzibarShare = float64(zanzibarRequests) * 100 / float64(total)
+	}
+
+	r.reasonMu.Lock()
+	for k, v := range r.byReason {
+		stats.ByReason[k] = v
+	}
+	r.reasonMu.Unlock()
+
+	return stats
+}
+
+// Rules returns the routing rules currently in effect
+func (r *CutoverRouter) Rules() CutoverRules {
+	return r.state.Load().rules
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/pkg/config"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+func newTestCutoverRouter(t *testing.T, rules CutoverRules) *CutoverRouter {
+	t.Helper()
+	require.NoError(t, logger.Init("test"))
+
+	r, err := NewCutoverRouter(nil, nil, rules)
+	require.NoError(t, err)
+	return r
+}
+
+// userInBucket returns a user ID whose bucket is below (or not below) threshold
+func userInBucket(t *testing.T, threshold uint32, below bool) string {
+	t.Helper()
+	for i := 0; i < 100000; i++ {
+		userID := fmt.Sprintf("user-%d", i)
+		if (cutoverBucket(userID) < threshold) == below {
+			return userID
+		}
+	}
+	t.Fatalf("no user found with bucket below=%v %d", below, threshold)
+	return ""
+}
+
+func TestCutoverRouterRoute(t *testing.T) {
+	// 50%: bucketed users are split by the 5000 threshold
+	inside := userInBucket(t, 5000, true)
+	outside := userInBucket(t, 5000, false)
+
+	rules := CutoverRules{
+		ZanzibarPercent: 50,
+		AllowUsers:      []string{"allowed", "both"},
+		DenyUsers:       []string{"denied", "both"},
+		AllowNamespaces: []string{"folder", "contested"},
+		DenyNamespaces:  []string{"customer", "contested"},
+	}
+
+	tests := []struct {
+		name       string
+		userID     string
+		namespace  string
+		wantEngine string
+		wantReason string
+	}{
+		{"deny user beats allow user", "both", "document", model.EngineMySQL, RouteReasonDenyUser},
+		{"deny user beats allow namespace", "denied", "folder", model.EngineMySQL, RouteReasonDenyUser},
+		{"allow user beats deny namespace", "allowed", "customer", model.EngineZanzibar, RouteReasonAllowUser},
+		{"deny namespace beats allow namespace", inside, "contested", model.EngineMySQL, RouteReasonDenyNamespace},
+		{"deny namespace beats percentage", inside, "customer", model.EngineMySQL, RouteReasonDenyNamespace},
+		{"allow namespace beats percentage", outside, "folder", model.EngineZanzibar, RouteReasonAllowNamespace},
+		{"bucket below percentage", inside, "document", model.EngineZanzibar, RouteReasonPercentage},
+		{"bucket above percentage", outside, "document", model.EngineMySQL, RouteReasonPercentage},
+	}
+
+	r := newTestCutoverRouter(t, rules)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, reason := r.Route(tt.userID, tt.namespace)
+			assert.Equal(t, tt.wantEngine, engine)
+			assert.Equal(t, tt.wantReason, reason)
+		})
+	}
+}
+
+func TestCutoverRouterPercentageIsSticky(t *testing.T) {
+	r := newTestCutoverRouter(t, CutoverRules{})
+
+	users := make([]string, 2000)
+	for i := range users {
+		users[i] = fmt.Sprintf("user-%d", i)
+	}
+
+	onZanzibar := map[string]bool{}
+	for _, percent := range []float64{0, 1, 10, 25, 50, 90, 100} {
+		require.NoError(t, r.Update(CutoverRules{ZanzibarPercent: percent}))
+
+		routed := 0
+		for _, userID := range users {
+			engine, _ := r.Route(userID, "document")
+			again, _ := r.Route(userID, "document")
+			require.Equal(t, engine, again, "user %s must be routed consistently", userID)
+
+			if engine == model.EngineZanzibar {
+				routed++
+				onZanzibar[userID] = true
+			} else {
+				require.False(t, onZanzibar[userID], "user %s moved back to MySQL at %v%%", userID, percent)
+			}
+		}
+
+		share := float64(routed) * 100 / float64(len(users))
+		assert.InDelta(t, percent, share, 5, "share of users on Zanzibar at %v%%", percent)
+	}
+}
+
+func TestCutoverRouterRollback(t *testing.T) {
+	r := newTestCutoverRouter(t, CutoverRules{ZanzibarPercent: 100, AllowUsers: []string{"allowed"}})
+
+	r.Rollback()
+	for _, userID := range []string{"allowed", "anyone"} {
+		engine, reason := r.Route(userID, "document")
+		assert.Equal(t, model.EngineMySQL, engine)
+		assert.Equal(t, RouteReasonRolledBack, reason)
+	}
+
+	// Rules staged during a rollback take effect on resume
+	require.NoError(t, r.Update(CutoverRules{ZanzibarPercent: 0, AllowUsers: []string{"staged"}}))
+	engine, reason := r.Route("staged", "document")
+	assert.Equal(t, model.EngineMySQL, engine)
+	assert.Equal(t, RouteReasonRolledBack, reason)
+	assert.True(t, r.Stats().RolledBack)
+
+	r.Resume()
+	engine, reason = r.Route("staged", "document")
+	assert.Equal(t, model.EngineZanzibar, engine)
+	assert.Equal(t, RouteReasonAllowUser, reason)
+	engine, _ = r.Route("allowed", "document")
+	assert.Equal(t, model.EngineMySQL, engine, "rules replaced by Update no longer apply")
+}
+
+func TestCutoverRouterUpdate(t *testing.T) {
+	r := newTestCutoverRouter(t, CutoverRules{ZanzibarPercent: 0})
+
+	engine, _ := r.Route("user-1", "document")
+	assert.Equal(t, model.EngineMySQL, engine)
+
+	require.NoError(t, r.Update(CutoverRules{ZanzibarPercent: 100}))
+	engine, reason := r.Route("user-1", "document")
+	assert.Equal(t, model.EngineZanzibar, engine)
+	assert.Equal(t, RouteReasonPercentage, reason)
+
+	err := r.Update(CutoverRules{ZanzibarPercent: 101})
+	assert.Error(t, err)
+	assert.Equal(t, 100.0, r.Rules().ZanzibarPercent, "invalid rules are not applied")
+}
+
+func TestCutoverRouterReload(t *testing.T) {
+	cfg := config.CutoverConfig{Enabled: true, ZanzibarPercent: 0, DenyUsers: []string{"denied"}}
+	r := newTestCutoverRouter(t, CutoverRulesFromConfig(cfg))
+
+	// Runtime rules and the rollback survive a reload of an unchanged section
+	require.NoError(t, r.Update(CutoverRules{ZanzibarPercent: 100}))
+	r.Rollback()
+	require.NoError(t, r.Reload(cfg))
+	assert.Equal(t, 100.0, r.Rules().ZanzibarPercent)
+	assert.True(t, r.Stats().RolledBack)
+
+	// A changed section replaces the rules but keeps the rollback
+	cfg.ZanzibarPercent = 30
+	require.NoError(t, r.Reload(cfg))
+	assert.Equal(t, 30.0, r.Rules().ZanzibarPercent)
+	assert.True(t, r.Stats().RolledBack)
+	r.Resume()
+
+	// Disabling routes everything to MySQL, even allow-listed users
+	cfg.Enabled = false
+	cfg.AllowUsers = []string{"allowed"}
+	require.NoError(t, r.Reload(cfg))
+	engine, reason := r.Route("allowed", "document")
+	assert.Equal(t, model.EngineMySQL, engine)
+	assert.Equal(t, RouteReasonDisabled, reason)
+	assert.False(t, r.Stats().Enabled)
+
+	cfg.Enabled = true
+	require.NoError(t, r.Reload(cfg))
+	engine, reason = r.Route("allowed", "document")
+	assert.Equal(t, model.EngineZanzibar, engine)
+	assert.Equal(t, RouteReasonAllowUser, reason)
+	assert.True(t, r.Stats().Enabled)
+
+	cfg.ZanzibarPercent = -1
+	assert.Error(t, r.Reload(cfg))
+}
+
+func TestRouteNamespace(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "document", routeNamespace(ctx))
+	assert.Equal(t, "document", routeNamespace(WithRouteNamespace(ctx, "")))
+	assert.Equal(t, "folder", routeNamespace(WithRouteNamespace(ctx, "folder")))
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/config"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+// ExpiredGrantSweeper physically removes time-bound grants after they ended. Both
+// engines already ignore them from the moment they expire; the sweep only reclaims
+// the rows and lets the expanded table catch up on expired department memberships.
+type ExpiredGrantSweeper struct {
+	mysqlRepo    *repository.MySQLPermissionRepository
+	zanzibarRepo *repository.ZanzibarPermissionRepository
+	interval     time.Duration
+	batchSize    int
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewExpiredGrantSweeper creates a sweeper deleting batchSize expired tuples at a time
+// (0 keeps the default of 1000), sweeping every interval once started
+func NewExpiredGrantSweeper(
+	mysqlRepo *repository.MySQLPermissionRepository,
+	zanzibarRepo *repository.ZanzibarPermissionRepository,
+	interval time.Duration,
+	batchSize int,
+) *ExpiredGrantSweeper {
+	return &ExpiredGrantSweeper{
+		mysqlRepo:    mysqlRepo,
+		zanzibarRepo: zanzibarRepo,
+		interval:     interval,
+		batchSize:    batchSize,
+	}
+}
+
+// ExpiredGrantSweeperFromConfig creates a sweeper from the grants config section
+func ExpiredGrantSweeperFromConfig(
+	cfg config.GrantsConfig,
+	mysqlRepo *repository.MySQLPermissionRepository,
+	zanzibarRepo *repository.ZanzibarPermissionRepository,
+) *ExpiredGrantSweeper {
+	return NewExpiredGrantSweeper(mysqlRepo, zanzibarRepo,
+		time.Duration(cfg.SweepInterval)*time.Minute,
+		cfg.SweepBatchSize,
+	)
+}
+
+// Start sweeps on every interval; it does nothing when the interval is not positive
+func (s *ExpiredGrantSweeper) Start() {
+	if s.interval <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	go s.run(ctx)
+
+	logger.Info("Expired grant sweeper started", zap.Duration("interval", s.interval))
+}
+
+// Stop stops sweeping and waits for a running sweep to finish
+func (s *ExpiredGrantSweeper) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+	logger.Info("Expired grant sweeper stopped")
+}
+
+func (s *ExpiredGrantSweeper) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		result, err := s.Sweep(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("Failed to sweep expired grants", zap.Error(err))
+			}
+			continue
+		}
+		if result.TuplesDeleted > 0 || result.PermissionsDeleted > 0 {
+			logger.Info("Swept expired grants",
+				zap.Int64("tuples_deleted", result.TuplesDeleted),
+				zap.Int64("permissions_deleted", result.PermissionsDeleted),
+			)
+		}
+	}
+}
+
+// Sweep deletes the expired tuples, which queues the rematerialization of the
+// documents they reached, and then the expired expanded rows
+func (s *ExpiredGrantSweeper) Sweep(ctx context.Context) (*model.SweepResult, error) {
+	startTime := time.Now()
+	result := &model.SweepResult{}
+
+	tuples, err := s.zanzibarRepo.DeleteExpiredTuples(ctx, s.batchSize)
+	if err != nil {
+		return nil, err
+	}
+	result.TuplesDeleted = tuples
+
+	rows, err := s.mysqlRepo.DeleteExpiredPermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result.PermissionsDeleted = rows
+
+	result.DurationMs = float64(time.Since(startTime).Milliseconds())
+	return result, nil
+}
@@ -0,0 +1,365 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/config"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+// ErrUnknownJobType is returned when enqueuing a job type without a registered handler
+var ErrUnknownJobType = errors.New("unknown job type")
+
+// progressFlushInterval throttles how often job progress is written to the database
+const progressFlushInterval = time.Second
+
+// JobHandler executes one job. Progress reported through the repository progress
+// hook in ctx is persisted on the job row, and so is a result set with setJobResult.
+type JobHandler func(ctx context.Context, payload json.RawMessage) error
+
+type jobResultKey struct{}
+
+// setJobResult stores v as the JSON result of the job running with ctx
+func setJobResult(ctx context.Context, v interface{}) error {
+	result, ok := ctx.Value(jobResultKey{}).(*string)
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode job result: %w", err)
+	}
+	*result = string(data)
+	return nil
+}
+
+// JobQueueOptions tunes the worker pool
+type JobQueueOptions struct {
+	Workers      int           // Concurrent workers (default 4)
+	PollInterval time.Duration // Sleep when the queue is empty (default 500ms)
+	MaxAttempts  int           // Attempts per job before it is failed (default 5)
+	LeaseTimeout time.Duration // Running jobs not renewed for this long are requeued (default 10m)
+	BaseBackoff  time.Duration // First retry delay, doubled per attempt (default 1s)
+	MaxBackoff   time.Duration // Upper bound of the retry delay (default 5m)
+}
+
+// JobQueueOptionsFromConfig converts the jobs config section into queue options
+func JobQueueOptionsFromConfig(cfg config.JobsConfig) JobQueueOptions {
+	return JobQueueOptions{
+		Workers:      cfg.Workers,
+		PollInterval: time.Duration(cfg.PollInterval) * time.Millisecond,
+		MaxAttempts:  cfg.MaxAttempts,
+		LeaseTimeout: time.Duration(cfg.LeaseTimeout) * time.Second,
+	}
+}
+
+func (o *JobQueueOptions) setDefaults() {
+	if o.Workers <= 0 {
+		o.Workers = 4
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = 500 * time.Millisecond
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	if o.LeaseTimeout <= 0 {
+		o.LeaseTimeout = 10 * time.Minute
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 5 * time.Minute
+	}
+}
+
+// PermissionJobQueue is a durable, database-backed queue that recomputes
+// MySQL expanded permissions in the background
+type PermissionJobQueue struct {
+	jobRepo  *repository.PermissionJobRepository
+	opts     JobQueueOptions
+	workerID string
+
+	mu       sync.RWMutex
+	handlers map[string]JobHandler
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPermissionJobQueue creates a new permission job queue
+func NewPermissionJobQueue(jobRepo *repository.PermissionJobRepository, opts JobQueueOptions) *PermissionJobQueue {
+	opts.setDefaults()
+
+	hostname, _ := os.Hostname()
+	return &PermissionJobQueue{
+		jobRepo:  jobRepo,
+		opts:     opts,
+		workerID: fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8]),
+		handlers: make(map[string]JobHandler),
+	}
+}
+
+// Register installs the handler for a job type
+func (q *PermissionJobQueue) Register(jobType string, handler JobHandler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = handler
+}
+
+func (q *PermissionJobQueue) handler(jobType string) (JobHandler, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	h, ok := q.handlers[jobType]
+	return h, ok
+}
+
+// Enqueue stores a job. Enqueuing the same key twice returns the existing job
+// (created is false), which makes retried API calls idempotent. An empty key
+// always creates a new job.
+func (q *PermissionJobQueue) Enqueue(ctx context.Context, jobType, key string, payload interface{}) (job *model.PermissionJob, created bool, err error) {
+	if _, ok := q.handler(jobType); !ok {
+		return nil, false, fmt.Errorf("%w: %s", ErrUnknownJobType, jobType)
+	}
+	if key == "" {
+		key = jobType + ":" + uuid.NewString()
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	return q.jobRepo.Enqueue(ctx, &model.PermissionJob{
+		JobKey:      key,
+		JobType:     jobType,
+		Payload:     string(data),
+		MaxAttempts: q.opts.MaxAttempts,
+	})
+}
+
+// Get returns a job for status polling
+func (q *PermissionJobQueue) Get(ctx context.Context, id int64) (*model.PermissionJob, error) {
+	return q.jobRepo.Get(ctx, id)
+}
+
+// Stats returns queue depth and the staleness window of the expanded table
+func (q *PermissionJobQueue) Stats(ctx context.Context) (*model.JobStats, error) {
+	return q.jobRepo.Stats(ctx)
+}
+
+// Start launches the worker pool and the stale lease reaper
+func (q *PermissionJobQueue) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+
+	for i := 0; i < q.opts.Workers; i++ {
+		q.wg.Add(1)
+		go q.worker(ctx)
+	}
+
+	q.wg.Add(1)
+	go q.reaper(ctx)
+
+	logger.Info("Permission job queue started",
+		zap.String("worker_id", q.workerID),
+		zap.Int("workers", q.opts.Workers),
+	)
+}
+
+// Stop signals the workers to exit and waits for running jobs to finish
+func (q *PermissionJobQueue) Stop() {
+	if q.cancel == nil {
+		return
+	}
+	q.cancel()
+	q.wg.Wait()
+	logger.Info("Permission job queue stopped")
+}
+
+func (q *PermissionJobQueue) worker(ctx context.Context) {
+	defer q.wg.Done()
+
+	for {
+		processed, err := q.RunOnce(ctx)
+		if err != nil {
+			logger.Error("Permission job worker error", zap.Error(err))
+		}
+		if processed && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(q.opts.PollInterval):
+		}
+	}
+}
+
+func (q *PermissionJobQueue) reaper(ctx context.Context) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.opts.LeaseTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := q.jobRepo.RecoverStale(ctx, time.Now().Add(-q.opts.LeaseTimeout))
+			if err != nil {
+				logger.Error("Failed to recover stale permission jobs", zap.Error(err))
+			} else if n > 0 {
+				logger.Warn("Recovered stale permission jobs", zap.Int64("count", n))
+			}
+		}
+	}
+}
+
+// RunOnce claims and executes a single job. It reports whether a job was processed.
+func (q *PermissionJobQueue) RunOnce(ctx context.Context) (bool, error) {
+	if ctx.Err() != nil {
+		return false, nil
+	}
+
+	job, err := q.jobRepo.Claim(ctx, q.workerID)
+	if err != nil || job == nil {
+		return false, err
+	}
+	lease := *job.LockedBy
+
+	// The job keeps running on shutdown; the lease is released once it finishes.
+	// It is cancelled only when the lease is lost to another worker.
+	var result string
+	runCtx, cancelRun := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRun()
+	stopHeartbeat := q.heartbeat(job.ID, lease, cancelRun)
+	runCtx = repository.WithProgress(runCtx, q.progressReporter(job.ID, lease))
+	runCtx = context.WithValue(runCtx, jobResultKey{}, &result)
+	start := time.Now()
+	runErr := q.execute(runCtx, job)
+	stopHeartbeat()
+
+	if runErr == nil {
+		logger.Info("Permission job succeeded",
+			zap.Int64("job_id", job.ID),
+			zap.String("job_type", job.JobType),
+			zap.Int("attempt", job.Attempts),
+			zap.Duration("duration", time.Since(start)),
+		)
+		var stored *string
+		if result != "" {
+			stored = &result
+		}
+		return true, q.jobRepo.Complete(context.WithoutCancel(ctx), job.ID, lease, stored)
+	}
+
+	var retryAt *time.Time
+	if job.Attempts < job.MaxAttempts && !errors.Is(runErr, ErrUnknownJobType) {
+		t := time.Now().Add(q.backoff(job.Attempts))
+		retryAt = &t
+	}
+
+	logger.Error("Permission job failed",
+		zap.Int64("job_id", job.ID),
+		zap.String("job_type", job.JobType),
+		zap.Int("attempt", job.Attempts),
+		zap.Bool("will_retry", retryAt != nil),
+		zap.Error(runErr),
+	)
+	return true, q.jobRepo.Fail(context.WithoutCancel(ctx), job.ID, lease, runErr.Error(), retryAt)
+}
+
+// execute runs the handler for job, converting panics into errors
+func (q *PermissionJobQueue) execute(ctx context.Context, job *model.PermissionJob) (err error) {
+	handler, ok := q.handler(job.JobType)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJobType, job.JobType)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return handler(ctx, json.RawMessage(job.Payload))
+}
+
+// backoff returns the retry delay after the given attempt (exponential, capped)
+func (q *PermissionJobQueue) backoff(attempt int) time.Duration {
+	d := q.opts.BaseBackoff
+	for i := 1; i < attempt && d < q.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > q.opts.MaxBackoff {
+		d = q.opts.MaxBackoff
+	}
+	return d
+}
+
+// heartbeat renews the lease of a running job every third of the lease timeout,
+// so long jobs are not requeued while they run. Losing the lease cancels the
+// job through cancelRun. The returned function stops the heartbeat.
+func (q *PermissionJobQueue) heartbeat(jobID int64, lease string, cancelRun context.CancelFunc) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(q.opts.LeaseTimeout / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := q.jobRepo.Renew(context.Background(), jobID, lease)
+				if errors.Is(err, repository.ErrJobLeaseLost) {
+					logger.Warn("Permission job lease lost, cancelling the job", zap.Int64("job_id", jobID))
+					cancelRun()
+					return
+				}
+				if err != nil {
+					logger.Warn("Failed to renew permission job lease", zap.Int64("job_id", jobID), zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// progressReporter persists progress updates, at most once per progressFlushInterval
+func (q *PermissionJobQueue) progressReporter(jobID int64, lease string) repository.ProgressFunc {
+	var last time.Time
+	return func(done, total int64, message string) {
+		if time.Since(last) < progressFlushInterval {
+			return
+		}
+		last = time.Now()
+
+		if err := q.jobRepo.UpdateProgress(context.Background(), jobID, lease, done, total, message); err != nil {
+			logger.Warn("Failed to update permission job progress", zap.Int64("job_id", jobID), zap.Error(err))
+		}
+	}
+}
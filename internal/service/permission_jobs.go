@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+// MySQL expanded-permission job types
+const (
+	JobUpdateDepartmentManager      = "update_department_manager"
+	JobRebuildDepartmentPermissions = "rebuild_department_permissions"
+	JobAddUserToDepartment          = "add_user_to_department"
+	JobRemoveUserFromDepartment     = "remove_user_from_department"
+	JobMoveDepartment               = "move_department"
+	JobMergeDepartments             = "merge_departments"
+	JobSplitDepartment              = "split_department"
+	JobReplaceCustomerFollower      = "replace_customer_follower"
+	JobRevokeSuperuser              = "revoke_superuser"
+	JobMaterializeTuples            = "materialize_tuples"
+	JobMaterializeAll               = "materialize_all"
+	JobPurgeSoftDeleted             = "purge_soft_deleted"
+	JobSweepExpiredGrants           = "sweep_expired_grants"
+)
+
+// UpdateDepartmentManagerPayload is the payload of JobUpdateDepartmentManager
+type UpdateDepartmentManagerPayload struct {
+	DepartmentID string `json:"department_id"`
+	ManagerID    string `json:"manager_id"`
+}
+
+// RebuildDepartmentPermissionsPayload is the payload of JobRebuildDepartmentPermissions
+type RebuildDepartmentPermissionsPayload struct {
+	DepartmentID string `json:"department_id"`
+}
+
+// AddUserToDepartmentPayload is the payload of JobAddUserToDepartment
+type AddUserToDepartmentPayload struct {
+	UserID       string `json:"user_id"`
+	DepartmentID string `json:"department_id"`
+	Role         string `json:"role"`
+	IsPrimary    bool   `json:"is_primary"`
+}
+
+// RemoveUserFromDepartmentPayload is the payload of JobRemoveUserFromDepartment
+type RemoveUserFromDepartmentPayload struct {
+	UserID       string `json:"user_id"`
+	DepartmentID string `json:"department_id"`
+}
+
+// MoveDepartmentPayload is the payload of JobMoveDepartment
+type MoveDepartmentPayload struct {
+	DepartmentID string `json:"department_id"`
+	NewParentID  string `json:"new_parent_id"`
+}
+
+// MergeDepartmentsPayload is the payload of JobMergeDepartments
+type MergeDepartmentsPayload struct {
+	SourceDepartmentID string `json:"source_department_id"`
+	TargetDepartmentID string `json:"target_department_id"`
+}
+
+// SplitDepartmentPayload is the payload of JobSplitDepartment
+type SplitDepartmentPayload struct {
+	DepartmentID      string   `json:"department_id"`
+	NewDepartmentID   string   `json:"new_department_id"`
+	NewDepartmentName string   `json:"new_department_name"`
+	ManagerID         string   `json:"manager_id"`
+	MemberIDs         []string `json:"member_ids"`
+}
+
+// ReplaceCustomerFollowerPayload is the payload of JobReplaceCustomerFollower
+type ReplaceCustomerFollowerPayload struct {
+	CustomerID    string `json:"customer_id"`
+	OldFollowerID string `json:"old_follower_id"`
+	NewFollowerID string `json:"new_follower_id"`
+}
+
+// RevokeSuperuserPayload is the payload of JobRevokeSuperuser
+type RevokeSuperuserPayload struct {
+	UserID string `json:"user_id"`
+}
+
+// MaterializeTuplesPayload is the payload of JobMaterializeTuples
+type MaterializeTuplesPayload struct {
+	Tuples []model.RelationTuple `json:"tuples"`
+}
+
+// PurgeSoftDeletedPayload is the payload of JobPurgeSoftDeleted
+type PurgeSoftDeletedPayload struct {
+	RetentionHours int `json:"retention_hours"` // 0 uses the configured retention
+}
+
+// RegisterMySQLPermissionJobs registers the handlers that maintain document_permissions_mysql
+func RegisterMySQLPermissionJobs(q *PermissionJobQueue, mysqlRepo *repository.MySQLPermissionRepository) {
+	q.Register(JobUpdateDepartmentManager, func(ctx context.Context, raw json.RawMessage) error {
+		var p UpdateDepartmentManagerPayload
+		if err := decodePayload(raw, &p); err != nil {
+			return err
+		}
+		return mysqlRepo.UpdateDepartmentManager(ctx, p.DepartmentID, p.ManagerID)
+	})
+
+	q.Register(JobRebuildDepartmentPermissions, func(ctx context.Context, raw json.RawMessage) error {
+		var p RebuildDepartmentPermissionsPayload
+		if err := decodePayload(raw, &p); err != nil {
+			return err
+		}
+		return mysqlRepo.RebuildDepartmentPermissions(ctx, p.DepartmentID)
+	})
+
+	q.Register(JobAddUserToDepartment, func(ctx context.Context, raw json.RawMessage) error {
+		var p AddUserToDepartmentPayload
+		if err := decodePayload(raw, &p); err != nil {
+			return err
+		}
+		return mysqlRepo.AddUserToDepartment(ctx, p.UserID, p.DepartmentID, p.Role, p.IsPrimary)
+	})
+
+	q.Register(JobRemoveUserFromDepartment, func(ctx context.Context, raw json.RawMessage) error {
+		var p RemoveUserFromDepartmentPayload
+		if err := decodePayload(raw, &p); err != nil {
+			return err
+		}
+		return mysqlRepo.RemoveUserFromDepartment(ctx, p.UserID, p.DepartmentID)
+	})
+
+	q.Register(JobMoveDepartment, func(ctx context.Context, raw json.RawMessage) error {
+		var p MoveDepartmentPayload
+		if err := decodePayload(raw, &p); err != nil {
+			return err
+		}
+		return mysqlRepo.MoveDepartment(ctx, p.DepartmentID, p.NewParentID)
+	})
+
+	q.Register(JobMergeDepartments, func(ctx context.Context, raw json.RawMessage) error {
+		var p MergeDepartmentsPayload
+		if err := decodePayload(raw, &p); err != nil {
+			return err
+		}
+		result, err := mysqlRepo.MergeDepartments(ctx, p.SourceDepartmentID, p.TargetDepartmentID)
+		if err != nil {
+			return err
+		}
+		return setJobResult(ctx, result)
+	})
+
+	q.Register(JobSplitDepartment, func(ctx context.Context, raw json.RawMessage) error {
+		var p SplitDepartmentPayload
+		if err := decodePayload(raw, &p); err != nil {
+			return err
+		}
+		result, err := mysqlRepo.SplitDepartment(ctx, p.DepartmentID, p.NewDepartmentID, p.NewDepartmentName, p.ManagerID, p.MemberIDs)
+		if err != nil {
+			return err
+		}
+		return setJobResult(ctx, result)
+	})
+
+	q.Register(JobReplaceCustomerFollower, func(ctx context.Context, raw json.RawMessage) error {
+		var p ReplaceCustomerFollowerPayload
+		if err := decodePayload(raw, &p); err != nil {
+			return err
+		}
+		return mysqlRepo.ReplaceCustomerFollowerComplete(ctx, p.CustomerID, p.OldFollowerID, p.NewFollowerID)
+	})
+
+	q.Register(JobRevokeSuperuser, func(ctx context.Context, raw json.RawMessage) error {
+		var p RevokeSuperuserPayload
+		if err := decodePayload(raw, &p); err != nil {
+			return err
+		}
+		return mysqlRepo.RevokeSuperuserPermissionsComplete(ctx, p.UserID)
+	})
+}
+
+// RegisterMaterializerJobs registers the handlers that derive document_permissions_mysql from relation_tuples
+func RegisterMaterializerJobs(q *PermissionJobQueue, materializer *repository.PermissionMaterializer) {
+	q.Register(JobMaterializeTuples, func(ctx context.Context, raw json.RawMessage) error {
+		var p MaterializeTuplesPayload
+		if err := decodePayload(raw, &p); err != nil {
+			return err
+		}
+		_, err := materializer.ApplyTupleChanges(ctx, p.Tuples)
+		return err
+	})
+
+	q.Register(JobMaterializeAll, func(ctx context.Context, _ json.RawMessage) error {
+		_, err := materializer.Rebuild(ctx)
+		return err
+	})
+}
+
+// RegisterSoftDeleteJobs registers the handler that purges tuples and expanded rows of soft-deleted entities
+func RegisterSoftDeleteJobs(q *PermissionJobQueue, purger *SoftDeletePurger) {
+	q.Register(JobPurgeSoftDeleted, func(ctx context.Context, raw json.RawMessage) error {
+		var p PurgeSoftDeletedPayload
+		if err := decodePayload(raw, &p); err != nil {
+			return err
+		}
+		_, err := purger.Purge(ctx, time.Duration(p.RetentionHours)*time.Hour)
+		return err
+	})
+}
+
+// RegisterExpiredGrantJobs registers the handler that deletes expired tuples and expanded rows
+func RegisterExpiredGrantJobs(q *PermissionJobQueue, sweeper *ExpiredGrantSweeper) {
+	q.Register(JobSweepExpiredGrants, func(ctx context.Context, _ json.RawMessage) error {
+		_, err := sweeper.Sweep(ctx)
+		return err
+	})
+}
+
+// MaterializeOnTupleChange queues an incremental materialization for every committed
+// tuple change made through zanzibarRepo
+func MaterializeOnTupleChange(q *PermissionJobQueue, zanzibarRepo *repository.ZanzibarPermissionRepository) {
+	zanzibarRepo.OnTupleChange(func(ctx context.Context, changed []model.RelationTuple) {
+		// Only the tuple keys are needed to find the affected documents
+		keys := make([]model.RelationTuple, len(changed))
+		for i, t := range changed {
+			keys[i] = model.RelationTuple{
+				Namespace:        t.Namespace,
+				ObjectID:         t.ObjectID,
+				Relation:         t.Relation,
+				SubjectNamespace: t.SubjectNamespace,
+				SubjectID:        t.SubjectID,
+			}
+		}
+
+		_, _, err := q.Enqueue(context.WithoutCancel(ctx), JobMaterializeTuples, "", MaterializeTuplesPayload{Tuples: keys})
+		if err != nil {
+			logger.Error("Failed to enqueue tuple materialization", zap.Int("tuples", len(keys)), zap.Error(err))
+		}
+	})
+}
+
+func decodePayload(raw json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid job payload: %w", err)
+	}
+	return nil
+}
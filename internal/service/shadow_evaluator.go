@@ -0,0 +1,406 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/config"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
+)
+
+// ErrUnknownEngine is returned when the configured primary engine is not mysql or zanzibar
+var ErrUnknownEngine = errors.New("unknown permission engine")
+
+// PermissionChecker answers a single document permission check (implemented by both engines)
+type PermissionChecker interface {
+	CheckPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error)
+}
+
+// PermissionEngine is the read API shared by both engines, and by the shadow
+// evaluator and cutover router that sit in front of them
+type PermissionEngine interface {
+	PermissionChecker
+	CheckPermissionsBatch(ctx context.Context, userID string, documentIDs []string, permissionType string) (map[string]bool, error)
+	LookupDocuments(ctx context.Context, userID, permissionType string, batchSize int, yield func(documentIDs []string) error) error
+}
+
+// mismatchRecorder stores shadow mismatches (implemented by ShadowMismatchRepository)
+type mismatchRecorder interface {
+	Record(ctx context.Context, mismatch *model.ShadowMismatch) error
+	List(ctx context.Context, userID, documentID string, limit int) ([]model.ShadowMismatch, error)
+}
+
+// shadowSampleBuckets is the resolution of the shadow sample (0.01%)
+const shadowSampleBuckets = 10000
+
+// ShadowOptions tunes shadow evaluation
+type ShadowOptions struct {
+	Primary   string        // Engine that answers the caller: mysql or zanzibar (default mysql)
+	QueueSize int           // Pending shadow checks; further checks are dropped (default 10000)
+	Workers   int           // Concurrent shadow workers (default 4)
+	Timeout   time.Duration // Timeout of one shadow check (default 2s)
+	Sample    float64       // Percentage of user/document pairs re-evaluated, 0-100 (default 100)
+}
+
+// ShadowOptionsFromConfig converts the shadow config section into evaluator options
+func ShadowOptionsFromConfig(cfg config.ShadowConfig) ShadowOptions {
+	return ShadowOptions{
+		Primary:   cfg.Primary,
+		QueueSize: cfg.QueueSize,
+		Workers:   cfg.Workers,
+		Timeout:   time.Duration(cfg.Timeout) * time.Millisecond,
+		Sample:    cfg.Sample,
+	}
+}
+
+func (o *ShadowOptions) setDefaults() {
+	if o.Primary == "" {
+		o.Primary = model.EngineMySQL
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = 10000
+	}
+	if o.Workers <= 0 {
+		o.Workers = 4
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 2 * time.Second
+	}
+	if o.Sample <= 0 || o.Sample > 100 {
+		o.Sample = 100
+	}
+}
+
+// shadowCheck is a primary answer waiting to be compared with the shadow engine
+type shadowCheck struct {
+	userID         string
+	documentID     string
+	permissionType string
+	caveatContext  map[string]interface{} // Request context of the primary check
+	primary        *model.PermissionCheckResult
+}
+
+// ShadowEvaluator answers permission checks from the primary engine and
+// re-evaluates them asynchronously on the shadow engine. Disagreements are
+// written to shadow_mismatches, so the shadow engine can be run against live
+// traffic without affecting latency or answers.
+type ShadowEvaluator struct {
+	primary      PermissionEngine
+	shadow       PermissionEngine
+	primaryName  string
+	shadowName   string
+	mismatchRepo mismatchRecorder
+	opts         ShadowOptions
+	threshold    uint32
+
+	mu      sync.RWMutex
+	stopped bool
+	queue   chan shadowCheck
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	enqueued     atomic.Int64
+	skipped      atomic.Int64
+	dropped      atomic.Int64
+	evaluated    atomic.Int64
+	matched      atomic.Int64
+	mismatched   atomic.Int64
+	shadowErrors atomic.Int64
+	recordErrors atomic.Int64
+}
+
+// NewShadowEvaluator creates a shadow evaluator; opts.Primary selects which engine answers
+func NewShadowEvaluator(
+	mysqlRepo *repository.MySQLPermissionRepository,
+	zanzibarRepo *repository.ZanzibarPermissionRepository,
+	mismatchRepo *repository.ShadowMismatchRepository,
+	opts ShadowOptions,
+) (*ShadowEvaluator, error) {
+	engines := map[string]PermissionEngine{
+		model.EngineMySQL:    mysqlRepo,
+		model.EngineZanzibar: zanzibarRepo,
+	}
+	return newShadowEvaluator(engines, mismatchRepo, opts)
+}
+
+// newShadowEvaluator wires the evaluator from the mysql and zanzibar entries of engines
+func newShadowEvaluator(engines map[string]PermissionEngine, mismatchRepo mismatchRecorder, opts ShadowOptions) (*ShadowEvaluator, error) {
+	opts.setDefaults()
+
+	e := &ShadowEvaluator{
+		mismatchRepo: mismatchRepo,
+		opts:         opts,
+		threshold:    uint32(opts.Sample * shadowSampleBuckets / 100),
+		queue:        make(chan shadowCheck, opts.QueueSize),
+	}
+
+	switch opts.Primary {
+	case model.EngineMySQL:
+		e.primaryName, e.shadowName = model.EngineMySQL, model.EngineZanzibar
+	case model.EngineZanzibar:
+		e.primaryName, e.shadowName = model.EngineZanzibar, model.EngineMySQL
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEngine, opts.Primary)
+	}
+	e.primary, e.shadow = engines[e.primaryName], engines[e.shadowName]
+
+	return e, nil
+}
+
+// Start launches the shadow worker pool
+func (e *ShadowEvaluator) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+
+	for i := 0; i < e.opts.Workers; i++ {
+		e.wg.Add(1)
+		go e.worker(ctx)
+	}
+
+	logger.Info("Shadow evaluation started",
+		zap.String("primary", e.primaryName),
+		zap.String("shadow", e.shadowName),
+		zap.Int("workers", e.opts.Workers),
+		zap.Int("queue_size", e.opts.QueueSize),
+		zap.Float64("sample", e.opts.Sample),
+	)
+}
+
+// Stop stops accepting shadow checks and waits for in-flight ones to finish.
+// Checks still queued are counted as dropped.
+func (e *ShadowEvaluator) Stop() {
+	e.mu.Lock()
+	if e.stopped || e.cancel == nil {
+		e.mu.Unlock()
+		return
+	}
+	e.stopped = true
+	e.mu.Unlock()
+
+	e.cancel()
+	e.wg.Wait()
+	e.drop(len(e.queue))
+	logger.Info("Shadow evaluation stopped")
+}
+
+// CheckPermission answers from the primary engine and queues the shadow check
+// when the user/document pair is sampled. The caller never waits for, or sees
+// the result of, the shadow engine.
+func (e *ShadowEvaluator) CheckPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error) {
+	metrics.EngineRequests.WithLabelValues("shadow", e.primaryName).Inc()
+
+	result, err := e.primary.CheckPermission(ctx, userID, documentID, permissionType)
+	if err != nil {
+		return nil, err
+	}
+
+	if !e.sampled(userID, documentID) {
+		e.skipped.Add(1)
+		e.countCheck("skipped")
+		return result, nil
+	}
+
+	e.enqueue(shadowCheck{
+		userID:         userID,
+		documentID:     documentID,
+		permissionType: permissionType,
+		caveatContext:  repository.CaveatContext(ctx),
+		primary:        result,
+	})
+	return result, nil
+}
+
+// CheckPermissionsBatch answers from the primary engine and queues a shadow
+// check for every sampled document of the batch
+func (e *ShadowEvaluator) CheckPermissionsBatch(ctx context.Context, userID string, documentIDs []string, permissionType string) (map[string]bool, error) {
+	metrics.EngineRequests.WithLabelValues("shadow", e.primaryName).Inc()
+
+	results, err := e.primary.CheckPermissionsBatch(ctx, userID, documentIDs, permissionType)
+	if err != nil {
+		return nil, err
+	}
+
+	caveatContext := repository.CaveatContext(ctx)
+	for _, documentID := range documentIDs {
+		if !e.sampled(userID, documentID) {
+			e.skipped.Add(1)
+			e.countCheck("skipped")
+			continue
+		}
+		e.enqueue(shadowCheck{
+			userID:         userID,
+			documentID:     documentID,
+			permissionType: permissionType,
+			caveatContext:  caveatContext,
+			primary:        &model.PermissionCheckResult{HasPermission: results[documentID], PermissionType: permissionType},
+		})
+	}
+	return results, nil
+}
+
+// LookupDocuments streams a user's documents from the primary engine. Document
+// lists are not shadowed; verify-consistency compares them offline.
+func (e *ShadowEvaluator) LookupDocuments(ctx context.Context, userID, permissionType string, batchSize int, yield func(documentIDs []string) error) error {
+	metrics.EngineRequests.WithLabelValues("shadow", e.primaryName).Inc()
+	return e.primary.LookupDocuments(ctx, userID, permissionType, batchSize, yield)
+}
+
+// sampled reports whether the pair is re-evaluated. The sample is a hash of
+// the pair, so a sampled pair is always compared and mismatches are reproducible.
+func (e *ShadowEvaluator) sampled(userID, documentID string) bool {
+	if e.threshold >= shadowSampleBuckets {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	h.Write([]byte{0})
+	h.Write([]byte(documentID))
+	return h.Sum32()%shadowSampleBuckets < e.threshold
+}
+
+// enqueue adds a shadow check without blocking; a full queue drops it
+func (e *ShadowEvaluator) enqueue(check shadowCheck) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.stopped {
+		e.drop(1)
+		return
+	}
+
+	select {
+	case e.queue <- check:
+		e.enqueued.Add(1)
+	default:
+		e.drop(1)
+	}
+}
+
+// drop counts shadow checks that were never evaluated
+func (e *ShadowEvaluator) drop(n int) {
+	e.dropped.Add(int64(n))
+	metrics.ShadowChecks.WithLabelValues(e.primaryName, e.shadowName, "dropped").Add(float64(n))
+}
+
+// countCheck counts a shadow check outcome in Prometheus
+func (e *ShadowEvaluator) countCheck(result string) {
+	metrics.ShadowChecks.WithLabelValues(e.primaryName, e.shadowName, result).Inc()
+}
+
+func (e *ShadowEvaluator) worker(ctx context.Context) {
+	defer e.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case check := <-e.queue:
+			e.evaluate(ctx, check)
+		}
+	}
+}
+
+// evaluate runs one shadow check and records a mismatch when the engines disagree
+func (e *ShadowEvaluator) evaluate(ctx context.Context, check shadowCheck) {
+	// Conditional tuples must see the same request context as the primary check
+	checkCtx := ctx
+	if check.caveatContext != nil {
+		checkCtx = repository.WithCaveatContext(ctx, check.caveatContext)
+	}
+	checkCtx, cancel := context.WithTimeout(checkCtx, e.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	shadowResult, err := e.shadow.CheckPermission(checkCtx, check.userID, check.documentID, check.permissionType)
+	shadowDurationMs := float64(time.Since(start).Microseconds()) / 1000
+
+	// Shutting down: the check was cut short, not answered differently
+	if ctx.Err() != nil {
+		e.drop(1)
+		return
+	}
+	e.evaluated.Add(1)
+
+	mismatch := &model.ShadowMismatch{
+		UserID:            check.userID,
+		DocumentID:        check.documentID,
+		PermissionType:    check.permissionType,
+		PrimaryEngine:     e.primaryName,
+		ShadowEngine:      e.shadowName,
+		PrimaryResult:     check.primary.HasPermission,
+		PrimarySources:    check.primary.Sources,
+		PrimaryDurationMs: check.primary.DurationMs,
+		ShadowDurationMs:  shadowDurationMs,
+	}
+
+	if err != nil {
+		e.shadowErrors.Add(1)
+		e.countCheck("error")
+		msg := err.Error()
+		mismatch.ShadowError = &msg
+		logger.Warn("Shadow permission check failed",
+			zap.String("engine", e.shadowName),
+			zap.String("user_id", check.userID),
+			zap.String("document_id", check.documentID),
+			zap.Error(err),
+		)
+	} else {
+		if shadowResult.HasPermission == check.primary.HasPermission {
+			e.matched.Add(1)
+			e.countCheck("match")
+			return
+		}
+		e.mismatched.Add(1)
+		e.countCheck("mismatch")
+		metrics.ShadowMismatches.WithLabelValues(e.primaryName, e.shadowName, check.permissionType).Inc()
+		mismatch.ShadowResult = shadowResult.HasPermission
+		mismatch.ShadowSources = shadowResult.Sources
+		logger.Warn("Shadow permission mismatch",
+			zap.String("user_id", check.userID),
+			zap.String("document_id", check.documentID),
+			zap.String("permission_type", check.permissionType),
+			zap.Bool(e.primaryName, check.primary.HasPermission),
+			zap.Bool(e.shadowName, shadowResult.HasPermission),
+		)
+	}
+
+	if err := e.mismatchRepo.Record(context.WithoutCancel(ctx), mismatch); err != nil {
+		e.recordErrors.Add(1)
+		logger.Error("Failed to record shadow mismatch", zap.Error(err))
+	}
+}
+
+// Stats returns the shadow counters since the evaluator was created
+func (e *ShadowEvaluator) Stats() *model.ShadowStats {
+	return &model.ShadowStats{
+		Enabled:       true,
+		PrimaryEngine: e.primaryName,
+		ShadowEngine:  e.shadowName,
+		QueueDepth:    len(e.queue),
+		QueueCapacity: cap(e.queue),
+		Sample:        e.opts.Sample,
+		Enqueued:      e.enqueued.Load(),
+		Skipped:       e.skipped.Load(),
+		Dropped:       e.dropped.Load(),
+		Evaluated:     e.evaluated.Load(),
+		Matched:       e.matched.Load(),
+		Mismatched:    e.mismatched.Load(),
+		Errors:        e.shadowErrors.Load(),
+		RecordErrors:  e.recordErrors.Load(),
+	}
+}
+
+// Mismatches returns the most recently recorded mismatches
+func (e *ShadowEvaluator) Mismatches(ctx context.Context, userID, documentID string, limit int) ([]model.ShadowMismatch, error) {
+	return e.mismatchRepo.List(ctx, userID, documentID, limit)
+}
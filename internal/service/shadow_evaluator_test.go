@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
+)
+
+// fakeEngine grants the permissions listed in allowed ("user|doc|relation"),
+// and the ones in conditional only when the request context has client_ip
+type fakeEngine struct {
+	mu          sync.Mutex
+	allowed     map[string]bool
+	conditional map[string]bool
+	err         error
+	calls       int
+}
+
+func (f *fakeEngine) CheckPermission(ctx context.Context, userID, documentID, permissionType string) (*model.PermissionCheckResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	key := userID + "|" + documentID + "|" + permissionType
+	_, hasIP := repository.CaveatContext(ctx)["client_ip"]
+	return &model.PermissionCheckResult{
+		HasPermission:  f.allowed[key] || (f.conditional[key] && hasIP),
+		PermissionType: permissionType,
+	}, nil
+}
+
+func (f *fakeEngine) CheckPermissionsBatch(ctx context.Context, userID string, documentIDs []string, permissionType string) (map[string]bool, error) {
+	results := make(map[string]bool, len(documentIDs))
+	for _, documentID := range documentIDs {
+		result, err := f.CheckPermission(ctx, userID, documentID, permissionType)
+		if err != nil {
+			return nil, err
+		}
+		results[documentID] = result.HasPermission
+	}
+	return results, nil
+}
+
+func (f *fakeEngine) LookupDocuments(_ context.Context, userID, permissionType string, _ int, yield func(documentIDs []string) error) error {
+	f.mu.Lock()
+	var documentIDs []string
+	for key := range f.allowed {
+		parts := strings.Split(key, "|")
+		if parts[0] == userID && parts[2] == permissionType {
+			documentIDs = append(documentIDs, parts[1])
+		}
+	}
+	f.mu.Unlock()
+	return yield(documentIDs)
+}
+
+func (f *fakeEngine) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// fakeRecorder keeps recorded mismatches in memory
+type fakeRecorder struct {
+	mu         sync.Mutex
+	mismatches []model.ShadowMismatch
+}
+
+func (f *fakeRecorder) Record(_ context.Context, mismatch *model.ShadowMismatch) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mismatches = append(f.mismatches, *mismatch)
+	return nil
+}
+
+func (f *fakeRecorder) List(_ context.Context, _, _ string, _ int) ([]model.ShadowMismatch, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]model.ShadowMismatch(nil), f.mismatches...), nil
+}
+
+func newTestShadowEvaluator(t *testing.T, mysql, zanzibar *fakeEngine, recorder *fakeRecorder, opts ShadowOptions) *ShadowEvaluator {
+	t.Helper()
+	require.NoError(t, logger.Init("test"))
+
+	e, err := newShadowEvaluator(map[string]PermissionEngine{
+		model.EngineMySQL:    mysql,
+		model.EngineZanzibar: zanzibar,
+	}, recorder, opts)
+	require.NoError(t, err)
+	return e
+}
+
+func TestShadowEvaluatorRecordsMismatches(t *testing.T) {
+	mysql := &fakeEngine{allowed: map[string]bool{
+		"alice|doc-1|viewer": true,
+		"alice|doc-2|viewer": true,
+	}}
+	zanzibar := &fakeEngine{allowed: map[string]bool{
+		"alice|doc-1|viewer": true,
+	}}
+	recorder := &fakeRecorder{}
+	e := newTestShadowEvaluator(t, mysql, zanzibar, recorder, ShadowOptions{Primary: model.EngineMySQL, Workers: 1})
+
+	mismatchCounter := metrics.ShadowMismatches.WithLabelValues(model.EngineMySQL, model.EngineZanzibar, "viewer")
+	before := testutil.ToFloat64(mismatchCounter)
+
+	e.Start()
+	defer e.Stop()
+
+	// doc-1 agrees, doc-2 is granted by MySQL only
+	for _, doc := range []string{"doc-1", "doc-2"} {
+		result, err := e.CheckPermission(context.Background(), "alice", doc, "viewer")
+		require.NoError(t, err)
+		assert.True(t, result.HasPermission, "the primary engine answers %s", doc)
+	}
+
+	require.Eventually(t, func() bool { return e.Stats().Evaluated == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	stats := e.Stats()
+	assert.Equal(t, int64(1), stats.Matched)
+	assert.Equal(t, int64(1), stats.Mismatched)
+	assert.Equal(t, 1.0, testutil.ToFloat64(mismatchCounter)-before)
+
+	recorded, err := e.Mismatches(context.Background(), "", "", 10)
+	require.NoError(t, err)
+	require.Len(t, recorded, 1)
+	assert.Equal(t, "doc-2", recorded[0].DocumentID)
+	assert.Equal(t, model.EngineMySQL, recorded[0].PrimaryEngine)
+	assert.Equal(t, model.EngineZanzibar, recorded[0].ShadowEngine)
+	assert.True(t, recorded[0].PrimaryResult)
+	assert.False(t, recorded[0].ShadowResult)
+	assert.Nil(t, recorded[0].ShadowError)
+}
+
+func TestShadowEvaluatorRecordsShadowErrors(t *testing.T) {
+	mysql := &fakeEngine{err: errors.New("connection refused")}
+	zanzibar := &fakeEngine{allowed: map[string]bool{"bob|doc-1|editor": true}}
+	recorder := &fakeRecorder{}
+	e := newTestShadowEvaluator(t, mysql, zanzibar, recorder, ShadowOptions{Primary: model.EngineZanzibar, Workers: 1})
+
+	e.Start()
+	defer e.Stop()
+
+	result, err := e.CheckPermission(context.Background(), "bob", "doc-1", "editor")
+	require.NoError(t, err, "a failing shadow engine must not fail the caller")
+	assert.True(t, result.HasPermission)
+
+	require.Eventually(t, func() bool { return e.Stats().Errors == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	recorded, err := e.Mismatches(context.Background(), "", "", 10)
+	require.NoError(t, err)
+	require.Len(t, recorded, 1)
+	assert.Equal(t, model.EngineZanzibar, recorded[0].PrimaryEngine)
+	require.NotNil(t, recorded[0].ShadowError)
+	assert.Contains(t, *recorded[0].ShadowError, "connection refused")
+}
+
+func TestShadowEvaluatorBatchAndLookup(t *testing.T) {
+	mysql := &fakeEngine{allowed: map[string]bool{
+		"dave|doc-1|viewer": true,
+		"dave|doc-2|viewer": true,
+	}}
+	zanzibar := &fakeEngine{allowed: map[string]bool{
+		"dave|doc-1|viewer": true,
+	}}
+	recorder := &fakeRecorder{}
+	e := newTestShadowEvaluator(t, mysql, zanzibar, recorder, ShadowOptions{Primary: model.EngineMySQL, Workers: 1})
+
+	e.Start()
+	defer e.Stop()
+
+	results, err := e.CheckPermissionsBatch(context.Background(), "dave", []string{"doc-1", "doc-2", "doc-3"}, "viewer")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"doc-1": true, "doc-2": true, "doc-3": false}, results)
+
+	// Every document of the batch is compared on its own
+	require.Eventually(t, func() bool { return e.Stats().Evaluated == 3 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(2), e.Stats().Matched)
+	assert.Equal(t, int64(1), e.Stats().Mismatched)
+	recorded, err := e.Mismatches(context.Background(), "", "", 10)
+	require.NoError(t, err)
+	require.Len(t, recorded, 1)
+	assert.Equal(t, "doc-2", recorded[0].DocumentID)
+
+	var listed []string
+	err = e.LookupDocuments(context.Background(), "dave", "viewer", 10, func(documentIDs []string) error {
+		listed = append(listed, documentIDs...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"doc-1", "doc-2"}, listed, "lookups are answered by the primary engine")
+}
+
+func TestShadowEvaluatorKeepsCaveatContext(t *testing.T) {
+	mysql := &fakeEngine{allowed: map[string]bool{"carol|doc-1|viewer": true}}
+	zanzibar := &fakeEngine{conditional: map[string]bool{"carol|doc-1|viewer": true}}
+	e := newTestShadowEvaluator(t, mysql, zanzibar, &fakeRecorder{}, ShadowOptions{Primary: model.EngineMySQL, Workers: 1})
+
+	e.Start()
+	defer e.Stop()
+
+	ctx := repository.WithCaveatContext(context.Background(), map[string]interface{}{"client_ip": "10.1.2.3"})
+	_, err := e.CheckPermission(ctx, "carol", "doc-1", "viewer")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return e.Stats().Evaluated == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), e.Stats().Matched, "the shadow check must see the request context of the primary check")
+	assert.Equal(t, int64(0), e.Stats().Mismatched)
+}
+
+func TestShadowEvaluatorSampling(t *testing.T) {
+	tests := []struct {
+		name     string
+		sample   float64
+		min, max int64 // Expected enqueued checks out of 1000 pairs
+	}{
+		{"default samples everything", 0, 1000, 1000},
+		{"full sample", 100, 1000, 1000},
+		{"quarter sample", 25, 200, 300},
+		{"tiny sample", 0.5, 0, 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mysql := &fakeEngine{}
+			zanzibar := &fakeEngine{}
+			// Workers are not started, so every sampled check stays queued
+			e := newTestShadowEvaluator(t, mysql, zanzibar, &fakeRecorder{}, ShadowOptions{Sample: tt.sample, QueueSize: 2000})
+
+			for i := 0; i < 1000; i++ {
+				_, err := e.CheckPermission(context.Background(), fmt.Sprintf("user-%d", i%37), fmt.Sprintf("doc-%d", i), "viewer")
+				require.NoError(t, err)
+			}
+
+			stats := e.Stats()
+			assert.Equal(t, 1000, mysql.callCount(), "the primary engine answers every check")
+			assert.Equal(t, int64(1000), stats.Enqueued+stats.Skipped)
+			assert.GreaterOrEqual(t, stats.Enqueued, tt.min)
+			assert.LessOrEqual(t, stats.Enqueued, tt.max)
+			assert.Equal(t, int64(0), stats.Dropped)
+		})
+	}
+}
+
+func TestShadowEvaluatorSamplingIsStable(t *testing.T) {
+	e := newTestShadowEvaluator(t, &fakeEngine{}, &fakeEngine{}, &fakeRecorder{}, ShadowOptions{Sample: 50})
+
+	for i := 0; i < 100; i++ {
+		doc := fmt.Sprintf("doc-%d", i)
+		first := e.sampled("alice", doc)
+		for j := 0; j < 3; j++ {
+			assert.Equal(t, first, e.sampled("alice", doc), "pair alice/%s must always get the same decision", doc)
+		}
+	}
+}
+
+func TestShadowEvaluatorDropsWhenQueueFull(t *testing.T) {
+	e := newTestShadowEvaluator(t, &fakeEngine{}, &fakeEngine{}, &fakeRecorder{}, ShadowOptions{QueueSize: 2})
+
+	dropped := metrics.ShadowChecks.WithLabelValues(model.EngineMySQL, model.EngineZanzibar, "dropped")
+	before := testutil.ToFloat64(dropped)
+
+	for i := 0; i < 5; i++ {
+		_, err := e.CheckPermission(context.Background(), "alice", fmt.Sprintf("doc-%d", i), "viewer")
+		require.NoError(t, err)
+	}
+
+	stats := e.Stats()
+	assert.Equal(t, int64(2), stats.Enqueued)
+	assert.Equal(t, int64(3), stats.Dropped)
+	assert.Equal(t, 3.0, testutil.ToFloat64(dropped)-before)
+}
+
+func TestNewShadowEvaluatorUnknownPrimary(t *testing.T) {
+	_, err := newShadowEvaluator(map[string]PermissionEngine{}, &fakeRecorder{}, ShadowOptions{Primary: "postgres"})
+	assert.ErrorIs(t, err, ErrUnknownEngine)
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/config"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+// defaultSoftDeleteRetention is how long soft-deleted entities keep their tuples and expanded rows
+const defaultSoftDeleteRetention = 30 * 24 * time.Hour
+
+// SoftDeletePurger hard-deletes the tuples and expanded rows of users, documents
+// and customers once they have been soft-deleted for longer than the retention
+// period. Until then a restore brings their access back unchanged. The entity
+// rows themselves are kept, so purging again is a cheap no-op.
+type SoftDeletePurger struct {
+	softDeletes  *repository.SoftDeleteRepository
+	mysqlRepo    *repository.MySQLPermissionRepository
+	zanzibarRepo *repository.ZanzibarPermissionRepository
+	retention    time.Duration
+	interval     time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSoftDeletePurger creates a purger with the given retention (default 30 days),
+// purging every interval once started
+func NewSoftDeletePurger(
+	softDeletes *repository.SoftDeleteRepository,
+	mysqlRepo *repository.MySQLPermissionRepository,
+	zanzibarRepo *repository.ZanzibarPermissionRepository,
+	retention, interval time.Duration,
+) *SoftDeletePurger {
+	if retention <= 0 {
+		retention = defaultSoftDeleteRetention
+	}
+	return &SoftDeletePurger{
+		softDeletes:  softDeletes,
+		mysqlRepo:    mysqlRepo,
+		zanzibarRepo: zanzibarRepo,
+		retention:    retention,
+		interval:     interval,
+	}
+}
+
+// SoftDeletePurgerFromConfig creates a purger from the soft_delete config section
+func SoftDeletePurgerFromConfig(
+	cfg config.SoftDeleteConfig,
+	softDeletes *repository.SoftDeleteRepository,
+	mysqlRepo *repository.MySQLPermissionRepository,
+	zanzibarRepo *repository.ZanzibarPermissionRepository,
+) *SoftDeletePurger {
+	return NewSoftDeletePurger(softDeletes, mysqlRepo, zanzibarRepo,
+		time.Duration(cfg.RetentionHours)*time.Hour,
+		time.Duration(cfg.PurgeInterval)*time.Minute,
+	)
+}
+
+// Start purges on every interval; it does nothing when the interval is not positive
+func (p *SoftDeletePurger) Start() {
+	if p.interval <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	p.wg.Add(1)
+	go p.run(ctx)
+
+	logger.Info("Soft delete purger started",
+		zap.Duration("interval", p.interval),
+		zap.Duration("retention", p.retention),
+	)
+}
+
+// Stop stops purging and waits for a running purge to finish
+func (p *SoftDeletePurger) Stop() {
+	if p.cancel == nil {
+		return
+	}
+	p.cancel()
+	p.wg.Wait()
+	logger.Info("Soft delete purger stopped")
+}
+
+func (p *SoftDeletePurger) run(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		result, err := p.Purge(ctx, 0)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("Failed to purge soft-deleted entities", zap.Error(err))
+			}
+			continue
+		}
+		logger.Info("Purged soft-deleted entities",
+			zap.Int("users", result.Users),
+			zap.Int("documents", result.Documents),
+			zap.Int("customers", result.Customers),
+			zap.Int64("tuples_deleted", result.TuplesDeleted),
+			zap.Int64("permissions_deleted", result.PermissionsDeleted),
+		)
+	}
+}
+
+// Purge hard-deletes the tuples and expanded rows of entities soft-deleted more
+// than retention ago (0 uses the configured retention)
+func (p *SoftDeletePurger) Purge(ctx context.Context, retention time.Duration) (*model.PurgeResult, error) {
+	startTime := time.Now()
+	if retention <= 0 {
+		retention = p.retention
+	}
+	result := &model.PurgeResult{Cutoff: startTime.Add(-retention)}
+
+	for _, entity := range []string{repository.EntityUser, repository.EntityDocument, repository.EntityCustomer} {
+		ids, err := p.softDeletes.DeletedBefore(ctx, entity, result.Cutoff)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		switch entity {
+		case repository.EntityUser:
+			result.Users = len(ids)
+		case repository.EntityDocument:
+			result.Documents = len(ids)
+		case repository.EntityCustomer:
+			result.Customers = len(ids)
+		}
+
+		tuples, err := p.zanzibarRepo.PurgeTuples(ctx, entity, ids)
+		if err != nil {
+			return nil, err
+		}
+		result.TuplesDeleted += tuples
+
+		rows, err := p.mysqlRepo.PurgePermissions(ctx, entity, ids)
+		if err != nil {
+			return nil, err
+		}
+		result.PermissionsDeleted += rows
+	}
+
+	result.DurationMs = float64(time.Since(startTime).Milliseconds())
+	return result, nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+	"github.com/d60-Lab/gin-template/pkg/metrics"
+)
+
+// StorageMetricsCollector periodically refreshes the storage gauges: tuple
+// counts per namespace/relation and expanded row counts per source type.
+// Both are GROUP BY scans, so they run on a timer instead of per scrape.
+type StorageMetricsCollector struct {
+	mysqlRepo    *repository.MySQLPermissionRepository
+	zanzibarRepo *repository.ZanzibarPermissionRepository
+	interval     time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewStorageMetricsCollector creates a collector refreshing every interval (default 60s)
+func NewStorageMetricsCollector(
+	mysqlRepo *repository.MySQLPermissionRepository,
+	zanzibarRepo *repository.ZanzibarPermissionRepository,
+	interval time.Duration,
+) *StorageMetricsCollector {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &StorageMetricsCollector{
+		mysqlRepo:    mysqlRepo,
+		zanzibarRepo: zanzibarRepo,
+		interval:     interval,
+	}
+}
+
+// Start refreshes the gauges once and then on every interval
+func (c *StorageMetricsCollector) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	c.wg.Add(1)
+	go c.run(ctx)
+
+	logger.Info("Storage metrics collector started", zap.Duration("interval", c.interval))
+}
+
+// Stop stops refreshing and waits for a running refresh to finish
+func (c *StorageMetricsCollector) Stop() {
+	if c.cancel == nil {
+		return
+	}
+	c.cancel()
+	c.wg.Wait()
+	logger.Info("Storage metrics collector stopped")
+}
+
+func (c *StorageMetricsCollector) run(ctx context.Context) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.Refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh recounts tuples and expanded rows. Gauges are reset first so
+// namespaces, relations or source types that disappeared drop to absent.
+func (c *StorageMetricsCollector) Refresh(ctx context.Context) {
+	tuples, err := c.zanzibarRepo.CountTuplesByRelation(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("Failed to refresh tuple metrics", zap.Error(err))
+		}
+	} else {
+		metrics.TupleCount.Reset()
+		for _, t := range tuples {
+			metrics.TupleCount.WithLabelValues(t.Namespace, t.Relation).Set(float64(t.Count))
+		}
+	}
+
+	rows, err := c.mysqlRepo.CountRowsBySourceType(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("Failed to refresh expanded permission metrics", zap.Error(err))
+		}
+	} else {
+		metrics.ExpandedRows.Reset()
+		for _, r := range rows {
+			metrics.ExpandedRows.WithLabelValues(r.SourceType).Set(float64(r.Count))
+		}
+	}
+}
@@ -345,7 +345,8 @@ func (g *TestDataGenerator) generateManagementRelations(ctx context.Context) err
 		managerID := managerUserDept.UserID
 		deptManagerUpdates[dept.ID] = managerID
 
-		// Create management relations for all non-manager users
+		// Create management relations for all users; the department's own manager
+		// is only managed through the parent departments (department#parent in Zanzibar)
 		for _, ud := range userDepts {
 			if ud.UserID != managerID {
 				// Direct manager relation (level 1)
@@ -353,28 +354,28 @@ func (g *TestDataGenerator) generateManagementRelations(ctx context.Context) err
 				if currentLevel, exists := relationsMap[key]; !exists || currentLevel > 1 {
 					relationsMap[key] = 1
 				}
+			}
 
-				// Build manager chain (levels 2-5) using deptMap
-				currentDept := &dept
-				currentLevel := 2
+			// Build manager chain (levels 2-5) using deptMap
+			currentDept := &dept
+			currentLevel := 2
 
-				for currentLevel <= 5 && currentDept.ParentID != nil {
-					parentDept, exists := deptMap[*currentDept.ParentID]
-					if !exists {
-						break
-					}
+			for currentLevel <= 5 && currentDept.ParentID != nil {
+				parentDept, exists := deptMap[*currentDept.ParentID]
+				if !exists {
+					break
+				}
 
-					// Get parent's manager if assigned
-					if parentManagerID, hasManager := deptManagerUpdates[parentDept.ID]; hasManager {
-						key := fmt.Sprintf("%s|%s|%s", parentManagerID, ud.UserID, dept.ID)
-						if existingLevel, exists := relationsMap[key]; !exists || existingLevel > currentLevel {
-							relationsMap[key] = currentLevel
-						}
+				// Get parent's manager if assigned
+				if parentManagerID, hasManager := deptManagerUpdates[parentDept.ID]; hasManager && parentManagerID != ud.UserID {
+					key := fmt.Sprintf("%s|%s|%s", parentManagerID, ud.UserID, dept.ID)
+					if existingLevel, exists := relationsMap[key]; !exists || existingLevel > currentLevel {
+						relationsMap[key] = currentLevel
 					}
-
-					currentDept = parentDept
-					currentLevel++
 				}
+
+				currentDept = parentDept
+				currentLevel++
 			}
 		}
 	}
@@ -813,6 +814,22 @@ func (g *TestDataGenerator) generateZanzibarTuples(ctx context.Context) error {
 		}
 	}
 
+	// 5. Department parent tuples (managers inherit authority over the subtree)
+	var childDepartments []model.Department
+	if err := g.db.WithContext(ctx).Where("parent_id IS NOT NULL").Find(&childDepartments).Error; err != nil {
+		return err
+	}
+
+	for _, dept := range childDepartments {
+		tuples = append(tuples, model.RelationTuple{
+			Namespace:        "department",
+			ObjectID:         dept.ID,
+			Relation:         "parent",
+			SubjectNamespace: "department",
+			SubjectID:        *dept.ParentID,
+		})
+	}
+
 	// Batch insert tuples
 	if err := g.db.WithContext(ctx).CreateInBatches(tuples, 1000).Error; err != nil {
 		return err
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+)
+
+// maxTupleLineBytes bounds the length of a single line in a tuple dump
+const maxTupleLineBytes = 1024 * 1024
+
+// maxImportErrors bounds how many line errors are kept in ImportStats
+const maxImportErrors = 100
+
+// ImportOptions controls a tuple import
+type ImportOptions struct {
+	BatchSize int                     // Tuples per INSERT batch (default 1000)
+	DryRun    bool                    // Parse, validate and dedupe only - nothing is written
+	Strict    bool                    // Abort on the first invalid or conflicting line instead of skipping it
+	Progress  func(stats ImportStats) // Called after every batch, may be nil
+}
+
+// ImportLineError describes a line that could not be imported
+type ImportLineError struct {
+	Line  int    `json:"line"`
+	Text  string `json:"text"`
+	Error string `json:"error"`
+}
+
+// ImportStats summarizes a tuple import
+type ImportStats struct {
+	Lines      int               `json:"lines"`
+	Parsed     int               `json:"parsed"`
+	Duplicates int               `json:"duplicates"`
+	Conflicts  int               `json:"conflicts"` // Same key as an earlier line, but a different tuple
+	Invalid    int               `json:"invalid"`
+	Inserted   int64             `json:"inserted"`
+	Existing   int64             `json:"existing"`
+	Errors     []ImportLineError `json:"errors,omitempty"`
+	Duration   time.Duration     `json:"duration"`
+}
+
+// TupleImporter streams tuples in the canonical text format into relation_tuples
+type TupleImporter struct {
+	zanzibarRepo *repository.ZanzibarPermissionRepository
+}
+
+// NewTupleImporter creates a new tuple importer
+func NewTupleImporter(zanzibarRepo *repository.ZanzibarPermissionRepository) *TupleImporter {
+	return &TupleImporter{
+		zanzibarRepo: zanzibarRepo,
+	}
+}
+
+// Import reads one tuple per line from r. Blank lines and lines starting with
+// "//" are ignored. Tuples repeated within the stream are inserted once, and
+// tuples already stored are counted as existing. A line with the key of an
+// earlier one (the uk_tuple columns) but a different text form is a conflict:
+// the earlier line wins and the conflict is reported as an error.
+func (i *TupleImporter) Import(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportStats, error) {
+	startTime := time.Now()
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+
+	stats := &ImportStats{}
+	seen := make(map[importKey]importedLine)
+	batch := make([]model.RelationTuple, 0, opts.BatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if !opts.DryRun {
+			inserted, err := i.zanzibarRepo.BulkInsertTuples(ctx, batch, opts.BatchSize)
+			if err != nil {
+				return err
+			}
+			stats.Inserted += inserted
+			stats.Existing += int64(len(batch)) - inserted
+		}
+		batch = batch[:0]
+		stats.Duration = time.Since(startTime)
+		if opts.Progress != nil {
+			opts.Progress(*stats)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxTupleLineBytes)
+
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		stats.Lines++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		tuple, err := model.ParseTuple(line)
+		if err != nil {
+			stats.Invalid++
+			if opts.Strict {
+				return stats, fmt.Errorf("line %d: %w", stats.Lines, err)
+			}
+			if len(stats.Errors) < maxImportErrors {
+				stats.Errors = append(stats.Errors, ImportLineError{Line: stats.Lines, Text: line, Error: err.Error()})
+			}
+			continue
+		}
+		stats.Parsed++
+
+		key := importKey{tuple.Namespace, tuple.ObjectID, tuple.Relation, tuple.SubjectNamespace, tuple.SubjectID}
+		text := tuple.Text()
+		if first, ok := seen[key]; ok {
+			if first.text == text {
+				stats.Duplicates++
+				continue
+			}
+			stats.Conflicts++
+			err := fmt.Errorf("conflicts with line %d: %s", first.line, first.text)
+			if opts.Strict {
+				return stats, fmt.Errorf("line %d: %w", stats.Lines, err)
+			}
+			if len(stats.Errors) < maxImportErrors {
+				stats.Errors = append(stats.Errors, ImportLineError{Line: stats.Lines, Text: line, Error: err.Error()})
+			}
+			continue
+		}
+		seen[key] = importedLine{line: stats.Lines, text: text}
+
+		batch = append(batch, *tuple)
+		if len(batch) >= opts.BatchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, fmt.Errorf("failed to read tuples: %w", err)
+	}
+
+	if err := flush(); err != nil {
+		return stats, err
+	}
+
+	stats.Duration = time.Since(startTime)
+	return stats, nil
+}
+
+// importKey holds the uk_tuple columns, which identify a stored tuple
+type importKey struct {
+	namespace, objectID, relation, subjectNamespace, subjectID string
+}
+
+// importedLine is the first line of the import that had a given key
+type importedLine struct {
+	line int
+	text string
+}
+
+// TupleExporter streams tuples from relation_tuples in the canonical text format
+type TupleExporter struct {
+	zanzibarRepo *repository.ZanzibarPermissionRepository
+}
+
+// NewTupleExporter creates a new tuple exporter
+func NewTupleExporter(zanzibarRepo *repository.ZanzibarPermissionRepository) *TupleExporter {
+	return &TupleExporter{
+		zanzibarRepo: zanzibarRepo,
+	}
+}
+
+// Export writes every tuple matching filter to w, one per line, ordered by id.
+// It returns the number of tuples written.
+func (e *TupleExporter) Export(ctx context.Context, w io.Writer, filter model.TupleFilter, pageSize int) (int64, error) {
+	bw := bufio.NewWriter(w)
+
+	var written int64
+	pageToken := ""
+	for {
+		page, err := e.zanzibarRepo.ReadTuples(ctx, filter, pageToken, pageSize)
+		if err != nil {
+			return written, err
+		}
+
+		for idx := range page.Tuples {
+			if _, err := bw.WriteString(page.Tuples[idx].Text() + "\n"); err != nil {
+				return written, fmt.Errorf("failed to write tuple: %w", err)
+			}
+			written++
+		}
+
+		if page.NextPageToken == "" {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+
+	if err := bw.Flush(); err != nil {
+		return written, fmt.Errorf("failed to flush tuples: %w", err)
+	}
+	return written, nil
+}
+
+// TupleDiff describes the difference between two tuple dumps
+type TupleDiff struct {
+	Added   []string `json:"added"`   // Present only in the second dump
+	Removed []string `json:"removed"` // Present only in the first dump
+}
+
+// DiffTupleDumps compares two tuple dumps and returns the sorted tuples that differ.
+// Tuples are compared in canonical form, so formatting differences are ignored.
+func DiffTupleDumps(before, after io.Reader) (*TupleDiff, error) {
+	beforeSet, err := readTupleSet(before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read first dump: %w", err)
+	}
+	afterSet, err := readTupleSet(after)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read second dump: %w", err)
+	}
+
+	diff := &TupleDiff{Added: []string{}, Removed: []string{}}
+	for key := range afterSet {
+		if _, ok := beforeSet[key]; !ok {
+			diff.Added = append(diff.Added, key)
+		}
+	}
+	for key := range beforeSet {
+		if _, ok := afterSet[key]; !ok {
+			diff.Removed = append(diff.Removed, key)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+
+	return diff, nil
+}
+
+// readTupleSet parses a tuple dump into a set of canonical tuple strings
+func readTupleSet(r io.Reader) (map[string]struct{}, error) {
+	set := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxTupleLineBytes)
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		tuple, err := model.ParseTuple(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		set[tuple.Text()] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const importDump = `// header comment
+document:doc-1#viewer@user:user-1
+document:doc-1#viewer@user:user-1
+document:doc-1#viewer@user:user-1#member
+document:doc-1#viewer@user:user-2
+not a tuple
+`
+
+func TestTupleImporterDedupesOnKey(t *testing.T) {
+	importer := NewTupleImporter(nil)
+
+	stats, err := importer.Import(context.Background(), strings.NewReader(importDump), ImportOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, 6, stats.Lines)
+	assert.Equal(t, 4, stats.Parsed)
+	assert.Equal(t, 1, stats.Duplicates)
+	assert.Equal(t, 1, stats.Conflicts)
+	assert.Equal(t, 1, stats.Invalid)
+
+	require.Len(t, stats.Errors, 2)
+	assert.Equal(t, 4, stats.Errors[0].Line)
+	assert.Contains(t, stats.Errors[0].Error, "conflicts with line 2")
+	assert.Equal(t, 6, stats.Errors[1].Line)
+
+	_, err = importer.Import(context.Background(), strings.NewReader(importDump), ImportOptions{DryRun: true, Strict: true})
+	assert.ErrorContains(t, err, "line 4: conflicts with line 2")
+}
@@ -0,0 +1,39 @@
+-- =====================================================
+-- Permission Recompute Job Queue (Outbox)
+-- =====================================================
+-- Durable queue for the expanded MySQL engine. Mutations
+-- enqueue a job and return immediately; a worker pool
+-- recomputes document_permissions_mysql in the background.
+-- created_at -> finished_at is the permission staleness window.
+-- =====================================================
+
+CREATE TABLE IF NOT EXISTS permission_jobs (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    job_key VARCHAR(191) NOT NULL,
+    job_type VARCHAR(50) NOT NULL,
+    payload JSON NOT NULL,
+    status ENUM('pending', 'running', 'succeeded', 'failed') NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    last_error TEXT NULL,
+
+    -- Progress reported by the running operation
+    progress_done BIGINT NOT NULL DEFAULT 0,
+    progress_total BIGINT NOT NULL DEFAULT 0,
+    progress_message VARCHAR(500) NULL,
+
+    -- Scheduling and leasing
+    run_after TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    locked_by VARCHAR(100) NULL,
+    locked_at TIMESTAMP(3) NULL,
+    started_at TIMESTAMP(3) NULL,
+    finished_at TIMESTAMP(3) NULL,
+
+    created_at TIMESTAMP(3) DEFAULT CURRENT_TIMESTAMP(3),
+    updated_at TIMESTAMP(3) DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+
+    UNIQUE KEY uk_job_key (job_key),
+    INDEX idx_claim (status, run_after, id),
+    INDEX idx_type_status (job_type, status),
+    INDEX idx_finished (finished_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
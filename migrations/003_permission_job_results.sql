@@ -0,0 +1,11 @@
+-- =====================================================
+-- Permission Job Results
+-- =====================================================
+-- Jobs whose operation returns a summary (department
+-- merges and splits report their write amplification)
+-- store it as JSON when they succeed. NULL for jobs
+-- without a result.
+-- =====================================================
+
+ALTER TABLE permission_jobs
+    ADD COLUMN result JSON NULL AFTER progress_message;
@@ -0,0 +1,28 @@
+-- =====================================================
+-- Shadow Evaluation Mismatches
+-- =====================================================
+-- Live permission checks are answered by the primary
+-- engine; the shadow engine is evaluated asynchronously
+-- and every disagreement (or shadow failure) is recorded
+-- here with both engines' sources.
+-- =====================================================
+
+CREATE TABLE IF NOT EXISTS shadow_mismatches (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    user_id VARCHAR(36) NOT NULL,
+    document_id VARCHAR(36) NOT NULL,
+    permission_type VARCHAR(20) NOT NULL,
+    primary_engine VARCHAR(20) NOT NULL,
+    shadow_engine VARCHAR(20) NOT NULL,
+    primary_result BOOLEAN NOT NULL,
+    shadow_result BOOLEAN NOT NULL,
+    primary_sources JSON NULL,
+    shadow_sources JSON NULL,
+    shadow_error TEXT NULL,
+    primary_duration_ms DOUBLE NOT NULL DEFAULT 0,
+    shadow_duration_ms DOUBLE NOT NULL DEFAULT 0,
+    created_at TIMESTAMP(3) DEFAULT CURRENT_TIMESTAMP(3),
+
+    INDEX idx_user_document (user_id, document_id),
+    INDEX idx_created (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,45 @@
+-- =====================================================
+-- Dictionary-Encoded Relation Tuples
+-- =====================================================
+-- Optional compact copy of relation_tuples: namespace and
+-- relation names become SMALLINT codes, object and subject
+-- IDs become BIGINT surrogates. Rows keep the id of the
+-- relation_tuples row, so keyset pagination is unchanged.
+-- =====================================================
+
+-- Namespace and relation names share one dictionary
+CREATE TABLE IF NOT EXISTS tuple_names (
+    id SMALLINT UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(50) NOT NULL,
+
+    UNIQUE KEY uk_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Object and subject IDs of every namespace share one dictionary
+CREATE TABLE IF NOT EXISTS tuple_object_ids (
+    id BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    external_id VARCHAR(36) NOT NULL,
+
+    UNIQUE KEY uk_external_id (external_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS relation_tuples_encoded (
+    id BIGINT PRIMARY KEY,
+
+    namespace_id SMALLINT UNSIGNED NOT NULL,
+    object_id BIGINT UNSIGNED NOT NULL,
+    relation_id SMALLINT UNSIGNED NOT NULL,
+
+    subject_namespace_id SMALLINT UNSIGNED NOT NULL,
+    subject_id BIGINT UNSIGNED NOT NULL,
+
+    userset_namespace_id SMALLINT UNSIGNED NULL,
+    userset_relation_id SMALLINT UNSIGNED NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    -- The two access paths of relation_tuples, without the overlapping prefixes
+    UNIQUE KEY uk_tuple (namespace_id, object_id, relation_id, subject_namespace_id, subject_id),
+    INDEX idx_subject (subject_namespace_id, subject_id, relation_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
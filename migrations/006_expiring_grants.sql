@@ -0,0 +1,19 @@
+-- =====================================================
+-- Expiring (Time-Bound) Grants
+-- =====================================================
+-- Tuples and expanded rows may carry an end time. Both
+-- engines ignore expired grants when resolving access;
+-- the sweeper deletes them afterwards. NULL never expires.
+-- =====================================================
+
+ALTER TABLE relation_tuples
+    ADD COLUMN expires_at TIMESTAMP NULL DEFAULT NULL AFTER userset_relation,
+    ADD INDEX idx_expires_at (expires_at);
+
+ALTER TABLE document_permissions_mysql
+    ADD COLUMN expires_at TIMESTAMP NULL DEFAULT NULL AFTER source_id,
+    ADD INDEX idx_expires_at (expires_at);
+
+-- The encoded copy keeps the end time so reads through it match relation_tuples
+ALTER TABLE relation_tuples_encoded
+    ADD COLUMN expires_at TIMESTAMP NULL DEFAULT NULL AFTER userset_relation_id;
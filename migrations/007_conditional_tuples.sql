@@ -0,0 +1,18 @@
+-- =====================================================
+-- Conditional Tuples (Caveats)
+-- =====================================================
+-- A tuple may name a caveat from zanzibar.caveats and
+-- bind some of its parameters as a JSON object. Checks
+-- evaluate the caveat against the request context;
+-- lists, expansion and the MySQL expanded table ignore
+-- conditional tuples. NULL caveat_name is unconditional.
+-- =====================================================
+
+ALTER TABLE relation_tuples
+    ADD COLUMN caveat_name VARCHAR(50) NULL DEFAULT NULL AFTER expires_at,
+    ADD COLUMN caveat_context JSON NULL AFTER caveat_name;
+
+-- The encoded copy keeps the caveat so reads through it match relation_tuples
+ALTER TABLE relation_tuples_encoded
+    ADD COLUMN caveat_name_id SMALLINT UNSIGNED NULL DEFAULT NULL AFTER expires_at,
+    ADD COLUMN caveat_context JSON NULL AFTER caveat_name_id;
@@ -0,0 +1,20 @@
+-- =====================================================
+-- Entity Attributes (Attribute-Based Rules)
+-- =====================================================
+-- Users, documents and customers carry a JSON object of
+-- attributes, e.g. {"clearance": 3} or {"region": "eu"}.
+-- attribute_rules reference them as user.*, document.*
+-- and customer.*; a permission is granted only when the
+-- relationships grant it and its rule holds. NULL means
+-- no attributes, which leaves rules on them undecided
+-- and therefore denying.
+-- =====================================================
+
+ALTER TABLE users
+    ADD COLUMN attributes JSON NULL AFTER is_superuser;
+
+ALTER TABLE documents
+    ADD COLUMN attributes JSON NULL AFTER creator_id;
+
+ALTER TABLE customers
+    ADD COLUMN attributes JSON NULL AFTER name;
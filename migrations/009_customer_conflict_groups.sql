@@ -0,0 +1,21 @@
+-- =====================================================
+-- Customer Conflict Groups (Ethical Walls)
+-- =====================================================
+-- Customers in one group compete with each other. Staff
+-- following one member may not see documents of the
+-- other members, neither directly nor through the
+-- subordinate the manager chain runs through; following
+-- every member of a group, which adding a follower only
+-- allows with an admin override, lifts the wall.
+-- A customer may belong to several groups.
+-- =====================================================
+
+CREATE TABLE IF NOT EXISTS customer_conflict_members (
+    group_id VARCHAR(64) NOT NULL,
+    customer_id VARCHAR(36) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (group_id, customer_id),
+    INDEX idx_customer (customer_id),
+    FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -1,18 +1,34 @@
 package config
 
 import (
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/d60-Lab/gin-template/pkg/logger"
 )
 
 // Config 配置结构
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Pprof    PprofConfig    `mapstructure:"pprof"`
-	Sentry   SentryConfig   `mapstructure:"sentry"`
-	Tracing  TracingConfig  `mapstructure:"tracing"`
+	Server     ServerConfig     `mapstructure:"server"`
+	Database   DatabaseConfig   `mapstructure:"database"`
+	Redis      RedisConfig      `mapstructure:"redis"`
+	JWT        JWTConfig        `mapstructure:"jwt"`
+	Pprof      PprofConfig      `mapstructure:"pprof"`
+	Sentry     SentryConfig     `mapstructure:"sentry"`
+	Tracing    TracingConfig    `mapstructure:"tracing"`
+	GRPC       GRPCConfig       `mapstructure:"grpc"`
+	ExtAuthz   ExtAuthzConfig   `mapstructure:"ext_authz"`
+	Jobs       JobsConfig       `mapstructure:"jobs"`
+	Shadow     ShadowConfig     `mapstructure:"shadow"`
+	Cutover    CutoverConfig    `mapstructure:"cutover"`
+	Metrics    MetricsConfig    `mapstructure:"metrics"`
+	Zanzibar   ZanzibarConfig   `mapstructure:"zanzibar"`
+	SoftDelete SoftDeleteConfig `mapstructure:"soft_delete"`
+	Grants     GrantsConfig     `mapstructure:"grants"`
+
+	AttributeRules []AttributeRuleConfig `mapstructure:"attribute_rules"` // 两个引擎共用的属性规则
+	EthicalWalls   EthicalWallsConfig    `mapstructure:"ethical_walls"`   // 竞争客户之间的道德墙
 }
 
 // ServerConfig 服务器配置
@@ -71,6 +87,117 @@ type TracingConfig struct {
 	JaegerEndpoint string `mapstructure:"jaeger_endpoint"`
 }
 
+// GRPCConfig gRPC 服务配置
+type GRPCConfig struct {
+	Enabled     bool `mapstructure:"enabled"`
+	Port        int  `mapstructure:"port"`
+	AuthEnabled bool `mapstructure:"auth_enabled"` // 是否要求 JWT 认证
+}
+
+// ExtAuthzConfig Envoy 外部授权服务配置
+type ExtAuthzConfig struct {
+	Enabled      bool           `mapstructure:"enabled"`
+	Port         int            `mapstructure:"port"`
+	DefaultAllow bool           `mapstructure:"default_allow"` // 没有规则匹配时是否放行
+	Rules        []ExtAuthzRule `mapstructure:"rules"`
+}
+
+// ExtAuthzRule 请求到权限检查的映射规则
+// Object / Subject 支持模板：{name} 取路径正则的命名分组，{header:x-name} 取请求头，{jwt} 取 JWT 中的用户 ID
+type ExtAuthzRule struct {
+	Name      string            `mapstructure:"name"`
+	Methods   []string          `mapstructure:"methods"` // 为空表示任意方法
+	Path      string            `mapstructure:"path"`    // 路径正则
+	Headers   map[string]string `mapstructure:"headers"` // 请求头正则，全部匹配才生效
+	Namespace string            `mapstructure:"namespace"`
+	Object    string            `mapstructure:"object"`
+	Relation  string            `mapstructure:"relation"`
+	Subject   string            `mapstructure:"subject"`
+}
+
+// JobsConfig 权限重算任务队列配置（MySQL 展开表的后台重算）
+type JobsConfig struct {
+	Enabled      bool `mapstructure:"enabled"`
+	Workers      int  `mapstructure:"workers"`       // worker 数量
+	PollInterval int  `mapstructure:"poll_interval"` // 空闲时轮询间隔（毫秒）
+	MaxAttempts  int  `mapstructure:"max_attempts"`  // 单个任务最大尝试次数
+	LeaseTimeout int  `mapstructure:"lease_timeout"` // 任务租约超时（秒），运行中的任务定期续约，超时未续约的任务会被重新入队
+	Materialize  bool `mapstructure:"materialize"`   // 元组变更后增量物化 document_permissions_mysql
+}
+
+// ShadowConfig 影子模式配置：由主引擎应答，另一引擎异步复核并记录不一致
+type ShadowConfig struct {
+	Enabled   bool    `mapstructure:"enabled"`
+	Primary   string  `mapstructure:"primary"`    // 应答调用方的引擎：mysql 或 zanzibar，另一个作为影子
+	QueueSize int     `mapstructure:"queue_size"` // 待复核队列容量，队列满时丢弃并计数
+	Workers   int     `mapstructure:"workers"`    // 影子复核 worker 数量
+	Timeout   int     `mapstructure:"timeout"`    // 单次影子检查超时（毫秒）
+	Sample    float64 `mapstructure:"sample"`     // 复核的检查比例（0-100，按用户+文档哈希抽样，默认 100）
+}
+
+// CutoverConfig 引擎切流配置：按用户 ID 粘性哈希把一定比例的请求路由到 Zanzibar 引擎
+// 优先级：deny_users > allow_users > deny_namespaces > allow_namespaces > zanzibar_percent
+type CutoverConfig struct {
+	Enabled         bool     `mapstructure:"enabled"`
+	ZanzibarPercent float64  `mapstructure:"zanzibar_percent"` // 0-100，路由到 Zanzibar 的用户比例
+	AllowUsers      []string `mapstructure:"allow_users"`      // 始终使用 Zanzibar 的用户
+	DenyUsers       []string `mapstructure:"deny_users"`       // 始终使用 MySQL 的用户
+	AllowNamespaces []string `mapstructure:"allow_namespaces"` // 始终使用 Zanzibar 的命名空间
+	DenyNamespaces  []string `mapstructure:"deny_namespaces"`  // 始终使用 MySQL 的命名空间
+}
+
+// MetricsConfig Prometheus 指标配置
+type MetricsConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	Path            string `mapstructure:"path"`             // 指标暴露路径，默认 /metrics
+	RefreshInterval int    `mapstructure:"refresh_interval"` // 元组数/展开行数等存储指标的刷新间隔（秒）
+}
+
+// ZanzibarConfig Zanzibar 引擎配置
+type ZanzibarConfig struct {
+	ManagerChainStrategy string         `mapstructure:"manager_chain_strategy"` // 上级链解析策略：auto、bfs 或 cte
+	CTEThreshold         int            `mapstructure:"cte_threshold"`          // auto 模式下下属数超过该值时改用递归 CTE
+	BitmapIndex          bool           `mapstructure:"bitmap_index"`           // 在内存中以压缩位图缓存每个用户可访问的文档集合
+	BitmapIndexMaxUsers  int            `mapstructure:"bitmap_index_max_users"` // 位图索引最多缓存的用户数
+	EncodedTuples        bool           `mapstructure:"encoded_tuples"`         // 同步维护字典编码（整数 ID）的元组表，元组读取走编码表
+	Caveats              []CaveatConfig `mapstructure:"caveats"`                // 条件元组可引用的条件（caveat）定义
+}
+
+// CaveatConfig 条件定义：带条件的元组只有在表达式为真时才授权
+// 表达式中的参数可以绑定在元组上，其余由检查请求的 context 提供；缺少参数时检查结果为 conditional
+type CaveatConfig struct {
+	Name       string `mapstructure:"name"`
+	Expression string `mapstructure:"expression"` // 例如 ip_in_cidr(client_ip, cidr) && purpose == "audit"
+}
+
+// SoftDeleteConfig 软删除配置：软删除的用户、文档、客户立即在两个引擎中失去访问，
+// 保留期内可恢复，过期后清理其元组和展开行
+type SoftDeleteConfig struct {
+	RetentionHours int `mapstructure:"retention_hours"` // 保留期（小时），默认 720（30 天）
+	PurgeInterval  int `mapstructure:"purge_interval"`  // 定时清理间隔（分钟），0 表示不定时清理
+}
+
+// GrantsConfig 限时授权配置：过期的元组和展开行在检查、列表和查找时立即失效，
+// 由清扫器定时物理删除
+type GrantsConfig struct {
+	SweepInterval  int `mapstructure:"sweep_interval"`   // 清扫间隔（分钟），0 表示不定时清扫
+	SweepBatchSize int `mapstructure:"sweep_batch_size"` // 每批删除的过期元组数，默认 1000
+}
+
+// AttributeRuleConfig 属性规则：关系授予权限后，还要求用户、文档及其客户的属性满足表达式
+// 表达式通过 user.*、document.*、customer.* 引用属性；同一权限的多条规则须同时满足，缺少属性时拒绝
+type AttributeRuleConfig struct {
+	Permission string `mapstructure:"permission"`
+	Expression string `mapstructure:"expression"` // 例如 user.clearance >= document.classification
+}
+
+// EthicalWallsConfig 道德墙配置：同一冲突组内的客户互为竞争对手，
+// 关注其中一个客户的员工（以及经由该员工的上级链）看不到其竞争对手的文档
+type EthicalWallsConfig struct {
+	Enabled          bool   `mapstructure:"enabled"`
+	FollowerConflict string `mapstructure:"follower_conflict"` // 新关注者已关注竞争客户时：refuse（拒绝，默认）或 warn（仅告警）；超级管理员可强制放行
+}
+
 // Load 加载配置
 func Load() (*Config, error) {
 	viper.SetConfigName("config")
@@ -113,3 +240,20 @@ func LoadWithFile(configFile string) (*Config, error) {
 
 	return &config, nil
 }
+
+// Watch 监听配置文件变更，变更后重新解析并回调（用于运行时调整切流比例等）
+// 解析失败时记录错误且不回调，继续使用之前的配置
+func Watch(onChange func(*Config)) {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		var config Config
+		if err := viper.Unmarshal(&config); err != nil {
+			logger.Error("Failed to parse changed config, keeping the previous one",
+				zap.String("file", e.Name),
+				zap.Error(err),
+			)
+			return
+		}
+		onChange(&config)
+	})
+	viper.WatchConfig()
+}
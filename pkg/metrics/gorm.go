@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"gorm.io/gorm"
+)
+
+// GormPlugin 统计 SQL 语句数、每次检查的查询数以及变更操作写入的行数
+type GormPlugin struct{}
+
+// Name 实现 gorm.Plugin
+func (GormPlugin) Name() string {
+	return "metrics"
+}
+
+// Initialize 实现 gorm.Plugin，在各类语句执行后注册回调
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:create").Register("metrics:after_create", after("create", true)); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:query").Register("metrics:after_query", after("query", false)); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("metrics:after_update", after("update", true)); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:delete").Register("metrics:after_delete", after("delete", true)); err != nil {
+		return err
+	}
+	if err := cb.Row().After("gorm:row").Register("metrics:after_row", after("row", false)); err != nil {
+		return err
+	}
+	return cb.Raw().After("gorm:raw").Register("metrics:after_raw", after("raw", true))
+}
+
+func after(operation string, write bool) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Statement == nil {
+			return
+		}
+		table := db.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+		DBQueries.WithLabelValues(operation, table).Inc()
+		countQuery(db.Statement.Context, db.RowsAffected, write)
+	}
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "zanzibar"
+
+var (
+	// CheckDuration 单次权限检查耗时，按引擎、命中路径和结果区分
+	CheckDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "permission_check_duration_seconds",
+		Help:      "Permission check latency by engine, resolution path and result.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"engine", "path", "result"})
+
+	// CheckQueries 单次权限检查执行的 SQL 数量
+	CheckQueries = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "permission_check_db_queries",
+		Help:      "Database queries issued by a single permission check.",
+		Buckets:   []float64{1, 2, 3, 5, 8, 13, 21, 34, 55, 89},
+	}, []string{"engine", "path"})
+
+	// CacheRequests 权限检查缓存命中/未命中次数（命中率 = hit / (hit + miss)）
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "permission_cache_requests_total",
+		Help:      "Permission checks answered from (hit) or without (miss) a cache.",
+	}, []string{"engine", "result"})
+
+	// BatchSize 批量操作的大小（批量检查、批量写元组、批量物化等）
+	BatchSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "batch_size",
+		Help:      "Number of items per batch operation.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 9), // 1 .. 65536
+	}, []string{"operation"})
+
+	// MutationRows 单次变更操作写入的行数
+	MutationRows = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mutation_rows_touched",
+		Help:      "Rows inserted, updated or deleted by one mutation, by engine and operation.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 12), // 1 .. ~4M
+	}, []string{"engine", "operation"})
+
+	// DBQueries 所有 SQL 语句数，按语句类型和表区分
+	DBQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_queries_total",
+		Help:      "Database statements executed, by statement type and table.",
+	}, []string{"operation", "table"})
+
+	// TupleCount relation_tuples 行数，按 namespace/relation 区分（定期刷新）
+	TupleCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "relation_tuples",
+		Help:      "Relation tuples by namespace and relation.",
+	}, []string{"namespace", "relation"})
+
+	// ExpandedRows document_permissions_mysql 行数，按 source_type 区分（定期刷新）
+	ExpandedRows = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "expanded_permission_rows",
+		Help:      "Expanded MySQL permission rows by source type.",
+	}, []string{"source_type"})
+
+	// EngineRequests 影子模式主引擎或切流路由实际应答的权限检查数（各引擎流量占比）
+	EngineRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "engine_requests_total",
+		Help:      "Permission checks answered per engine, by the component that picked it (shadow or cutover).",
+	}, []string{"router", "engine"})
+
+	// ShadowChecks 影子检查数，result 为 match/mismatch/error/dropped/skipped
+	ShadowChecks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shadow_checks_total",
+		Help:      "Shadow checks by primary engine, shadow engine and outcome.",
+	}, []string{"primary", "shadow", "result"})
+
+	// ShadowMismatches 主引擎与影子引擎结论不一致的次数，按引擎组合和权限类型区分
+	ShadowMismatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shadow_mismatches_total",
+		Help:      "Shadow checks whose answer differs from the primary engine, by engine pair and permission type.",
+	}, []string{"primary", "shadow", "permission"})
+
+	// HTTPRequests HTTP 请求数
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration HTTP 请求耗时
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// Handler 返回 /metrics 的 HTTP 处理器
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type queryCounterKey struct{}
+
+type mutationKey struct{}
+
+// mutation 一次变更操作累计写入的行数
+type mutation struct {
+	rows atomic.Int64
+}
+
+// WithQueryCounter 在 ctx 中挂载 SQL 计数器，GORM 插件会为 ctx 上执行的每条语句加一
+func WithQueryCounter(ctx context.Context) (context.Context, *atomic.Int64) {
+	counter := new(atomic.Int64)
+	return context.WithValue(ctx, queryCounterKey{}, counter), counter
+}
+
+// TrackMutation 统计 ctx 上一次变更操作写入的行数，调用返回的 done 时记录到 MutationRows。
+// 嵌套调用（变更操作内部再调用其他变更操作）只由最外层记录。
+func TrackMutation(ctx context.Context, engine, operation string) (context.Context, func()) {
+	if _, ok := ctx.Value(mutationKey{}).(*mutation); ok {
+		return ctx, func() {}
+	}
+
+	m := &mutation{}
+	return context.WithValue(ctx, mutationKey{}, m), func() {
+		MutationRows.WithLabelValues(engine, operation).Observe(float64(m.rows.Load()))
+	}
+}
+
+// countQuery 供 GORM 插件调用：累加 ctx 上的 SQL 计数和变更行数
+func countQuery(ctx context.Context, rowsAffected int64, write bool) {
+	if ctx == nil {
+		return
+	}
+	if counter, ok := ctx.Value(queryCounterKey{}).(*atomic.Int64); ok {
+		counter.Add(1)
+	}
+	if write && rowsAffected > 0 {
+		if m, ok := ctx.Value(mutationKey{}).(*mutation); ok {
+			m.rows.Add(rowsAffected)
+		}
+	}
+}